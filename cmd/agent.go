@@ -134,6 +134,11 @@ func buildAgentConfig() (agent.AgentConfig, error) {
 		logger.Debug("Substituted API URL from environment variable: %s = %s", envVar, modelConfig.APIURL)
 	}
 
+	// Replayed runs do not call the chat model API, so it needs no API key
+	if agentReplay != "" && modelConfig.APIKey == "" {
+		modelConfig.APIKey = "replay"
+	}
+
 	// Tools configuration is required
 	if len(toolsFiles) == 0 {
 		return agent.AgentConfig{}, fmt.Errorf("tools configuration file(s) are required (use --tools flag)")
@@ -163,21 +168,84 @@ func buildAgentConfig() (agent.AgentConfig, error) {
 		}
 	}
 
-	// Get the path to mcpshell binary - it must be available in PATH
-	mcpshellBinary := "mcpshell"
-
 	return agent.AgentConfig{
 		ToolsFile:      localConfigPath,
 		UserPrompt:     agentUserPrompt,
 		Once:           agentOnce,
 		Version:        version,
-		MCPShellBinary: mcpshellBinary,
+		MCPShellBinary: mcpshellBinary(config),
 		ModelConfig:    modelConfig,
 		RAGSources:     agentRAGSources,
 		RAGConfig:      ragConfig,
+		RAGWatch:       agentRAGWatch,
+		RAGDocs:        agentRAGDocs,
+		Record:         agentRecord,
+		Replay:         agentReplay,
+		RAGOptions: agent.RAGProcessOptions{
+			HTTP:    config.Agent.RAGHTTP,
+			Cache:   config.Agent.RAGCache,
+			Reindex: agentRAGReindex,
+		},
 	}, nil
 }
 
+// mcpshellBinary returns the mcpshell binary: the --mcpshell flag, the one of the
+// configuration file, or mcpshell in the PATH
+func mcpshellBinary(config *agent.Config) string {
+	if mcpshell != "" {
+		return mcpshell
+	}
+	if config.Agent.MCPShell != "" {
+		return config.Agent.MCPShell
+	}
+	return agent.DefaultMCPShellBinary
+}
+
+// preflightMCPShell checks mcpshell can serve the tools files before starting,
+// returning the resolved path of the binary
+func preflightMCPShell(ctx context.Context, agentConfig agent.AgentConfig, toolsFiles []string, logger *common.Logger) (string, error) {
+	binary := agentConfig.MCPShellBinary
+	for _, toolsFile := range toolsFiles {
+		info, err := agent.PreflightMCPShell(ctx, agentConfig.MCPShellBinary, toolsFile, logger)
+		if err != nil {
+			return "", err
+		}
+		binary = info.Binary
+	}
+	return binary, nil
+}
+
+// prepareAgent builds and checks the agent configuration from the flags, caching
+// it for running the agent
+func prepareAgent(cmd *cobra.Command) error {
+	// Initialize logger
+	logger, err := initLogger()
+	if err != nil {
+		return err
+	}
+
+	// Build agent configuration (this will be cached for RunE)
+	cachedAgentConfig, err = buildAgentConfig()
+	if err != nil {
+		return err
+	}
+
+	// Validate agent configuration
+	agentInstance := agent.New(cachedAgentConfig, logger)
+	if err := agentInstance.Validate(); err != nil {
+		return err
+	}
+
+	// Check mcpshell and the tools file now, as cagent failures are hard to understand
+	binary, err := preflightMCPShell(cmd.Context(), cachedAgentConfig, []string{cachedAgentConfig.ToolsFile}, logger)
+	if err != nil {
+		return err
+	}
+	cachedAgentConfig.MCPShellBinary = binary
+
+	return nil
+}
+
 // runAgent is the main agent execution logic
 var runAgent = &cobra.Command{
 	Use:   "don [flags] [prompt]",
@@ -191,9 +259,15 @@ Examples:
   don --tools=tools.yaml "Help me debug this issue"
   don -t tools --model gpt-4o "What's the disk usage?"
   don --tools=tools.yaml --once "Run the tests"
+  don -t tools --rag-docs app.log --rag-docs worker.log "Why did the job fail?"
 
 You can provide the initial prompt as positional arguments or use STDIN with '-':
   cat error.log | don --tools=tools.yaml "Analyze this error" -
+
+Record a run, and replay its LLM responses (e.g. in CI) to check the agent flow
+(tools and embedding models still run for real):
+  don -t tools.yaml --once --record run.jsonl "What's the disk usage?"
+  don -t tools.yaml --once --replay run.jsonl "What's the disk usage?"
 `,
 	Args: cobra.ArbitraryArgs,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -211,25 +285,7 @@ You can provide the initial prompt as positional arguments or use STDIN with '-'
 			}
 		}
 
-		// Initialize logger
-		logger, err := initLogger()
-		if err != nil {
-			return err
-		}
-
-		// Build agent configuration (this will be cached for RunE)
-		cachedAgentConfig, err = buildAgentConfig()
-		if err != nil {
-			return err
-		}
-
-		// Validate agent configuration
-		agentInstance := agent.New(cachedAgentConfig, logger)
-		if err := agentInstance.Validate(); err != nil {
-			return err
-		}
-
-		return nil
+		return prepareAgent(cmd)
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		logger, err := initLogger()
@@ -297,15 +353,18 @@ You can provide the initial prompt as positional arguments or use STDIN with '-'
 		}
 
 		// Start the agent
+		runErr := make(chan error, 1)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := agentInstance.Run(ctx, userInput, agentOutput); err != nil {
+			err := agentInstance.Run(ctx, userInput, agentOutput)
+			if err != nil {
 				if err != context.Canceled && err != context.DeadlineExceeded {
 					logger.Error(color.HiRedString("Agent encountered an error: %v", err))
 				}
 				cancel()
 			}
+			runErr <- err
 		}()
 
 		// Print agent output
@@ -327,6 +386,15 @@ You can provide the initial prompt as positional arguments or use STDIN with '-'
 			logger.Debug("Cleanup timeout reached, forcing shutdown")
 		}
 
+		// Failed runs exit with an error (e.g. in CI, replays and mock scripts not followed)
+		select {
+		case err := <-runErr:
+			if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
+				cmd.SilenceUsage = true
+				return err
+			}
+		default:
+		}
 		return nil
 	},
 }
@@ -344,4 +412,12 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&agentOpenAIApiURL, "api-url", "b", "", "Base URL for the API")
 	rootCmd.PersistentFlags().BoolVarP(&agentOnce, "once", "o", false, "Exit after receiving a final response (one-shot mode)")
 	rootCmd.PersistentFlags().StringSliceVar(&agentRAGSources, "rag", []string{}, "RAG source names to enable from config")
+	rootCmd.PersistentFlags().BoolVar(&agentRAGReindex, "reindex", false, "Rebuild the indexes of the RAG sources from scratch")
+	rootCmd.PersistentFlags().StringArrayVar(&agentRAGDocs, "rag-docs", []string{}, "Documents (paths or URLs) to search with an ad-hoc RAG source (repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&agentRAGWatch, "rag-watch", false, "Refresh RAG sources when their local documents change (interactive mode)")
+
+	// Recording flags only apply to the agent run, not to the subcommands
+	rootCmd.Flags().StringVar(&agentRecord, "record", "", "Record the LLM requests/responses and tool calls of the run in a JSONL file")
+	rootCmd.Flags().StringVar(&agentReplay, "replay", "", "Replay the chat LLM responses of a recording instead of calling the model APIs (tools and embedding models still run)")
+	rootCmd.MarkFlagsMutuallyExclusive("record", "replay")
 }
@@ -0,0 +1,158 @@
+package root
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/batch"
+	"github.com/inercia/don/pkg/common"
+)
+
+var (
+	batchOutput      string
+	batchParallel    int
+	batchRetryFailed bool
+)
+
+// batchCommand runs the prompts of a batch file
+var batchCommand = &cobra.Command{
+	Use:   "batch <prompts.jsonl>",
+	Short: "Run many prompts from a JSONL file",
+	Long: `
+Runs the prompts of a batch file, one JSON object per line, and writes their
+results to an output JSONL file. Each item runs once, with its own agent and
+runtime, and its tool calls are approved automatically.
+
+Items:
+  {"id": "prod", "prompt": "Check the pods of {{.ns}}", "variables": {"ns": "prod"}}
+  {"prompt": "...", "tools": "k8s.yaml", "model": "gpt-4o-mini", "rag": ["runbooks"]}
+
+Only the prompt is required. The tools file, model and RAG sources default to
+those given with the usual flags. Items without an id are identified by their
+line number.
+
+Each result has the final answer, the tool calls, the token usage, the duration
+and the error of the item. Items already in the output file are skipped, so an
+interrupted batch resumes where it stopped; failed items run again with
+--retry-failed. The command fails if any item run failed.
+
+Examples:
+  $ don batch prompts.jsonl --tools k8s.yaml
+  $ don batch prompts.jsonl -t k8s.yaml --parallel 8 --output results.jsonl
+  $ don batch prompts.jsonl -t k8s.yaml --retry-failed
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+		items, err := batch.LoadItems(args[0])
+		if err != nil {
+			return err
+		}
+		output := batchOutput
+		if output == "" {
+			output = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".results.jsonl"
+		}
+
+		runner, err := newBatchRunner(items, logger)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		summary, err := runner.Run(ctx, items, output)
+		cmd.SilenceUsage = true
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("batch interrupted after %d items: run it again to resume", summary.Succeeded+summary.Failed)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n%d items: %d succeeded, %d failed, %d already done (results in %s)\n",
+			summary.Total, summary.Succeeded, summary.Failed, summary.Skipped, output)
+		if summary.Failed > 0 {
+			return fmt.Errorf("%d of %d items failed", summary.Failed, summary.Total)
+		}
+		return nil
+	},
+}
+
+// newBatchRunner creates the runner of a batch, with the agent flags as the
+// defaults of the items, checking the configuration and the tools of all the
+// items before running any
+func newBatchRunner(items []batch.Item, logger *common.Logger) (*batch.Runner, error) {
+	agentConfig, err := buildAgentConfig()
+	if err != nil {
+		return nil, err
+	}
+	config, err := agent.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	batchConfig := batch.Config{
+		Agent:       agentConfig,
+		Models:      config.Agent.Models,
+		RAG:         config.Agent.RAG,
+		Parallel:    batchParallel,
+		RetryFailed: batchRetryFailed,
+		OnResult:    printBatchResult,
+	}
+	runner := batch.New(batchConfig, logger)
+
+	tools := []string{agentConfig.ToolsFile}
+	for _, item := range items {
+		itemConfig, err := runner.ItemConfig(item)
+		if err != nil {
+			return nil, fmt.Errorf("item '%s': %w", item.ID, err)
+		}
+		if err := agent.New(itemConfig, logger).Validate(); err != nil {
+			return nil, fmt.Errorf("item '%s': %w", item.ID, err)
+		}
+		if !slices.Contains(tools, itemConfig.ToolsFile) {
+			tools = append(tools, itemConfig.ToolsFile)
+		}
+	}
+
+	// The tools of all the items are checked once, so items do not fail one by one
+	batchConfig.Agent.MCPShellBinary, err = preflightMCPShell(context.Background(), agentConfig, tools, logger)
+	if err != nil {
+		return nil, err
+	}
+	return batch.New(batchConfig, logger), nil
+}
+
+// printBatchResult prints a line for the result of an item
+func printBatchResult(result batch.Result) {
+	duration := (time.Duration(result.DurationMS) * time.Millisecond).Round(100 * time.Millisecond)
+	if result.Failed() {
+		fmt.Printf("%s %s (%s): %s\n", color.HiRedString("✗"), result.ID, duration, result.Error)
+		return
+	}
+	fmt.Printf("%s %s (%s, %d tool calls, %d tokens)\n",
+		color.HiGreenString("✓"), result.ID, duration, len(result.ToolCalls), result.Usage.TotalTokens)
+}
+
+func init() {
+	rootCmd.AddCommand(batchCommand)
+
+	batchCommand.Flags().StringVar(&batchOutput, "output", "", "Output JSONL file (default: <prompts>.results.jsonl)")
+	batchCommand.Flags().IntVar(&batchParallel, "parallel", batch.DefaultParallel, "Number of items run at the same time")
+	batchCommand.Flags().BoolVar(&batchRetryFailed, "retry-failed", false, "Run again the items that failed in a previous run")
+}
@@ -81,6 +81,8 @@ type ConfigShowModelInfo struct {
 	Model         string   `json:"model"`
 	Class         string   `json:"class"`
 	Default       bool     `json:"default"`
+	Type          string   `json:"type,omitempty"`
+	Dimensions    int      `json:"dimensions,omitempty"`
 	APIKey        string   `json:"api_key_masked,omitempty"`
 	APIURL        string   `json:"api_url,omitempty"`
 	SystemPrompts []string `json:"system_prompts,omitempty"`
@@ -167,6 +169,12 @@ func printModelInfo(index int, model agent.ModelConfig) {
 	fmt.Printf("  Model: %s\n", model.Model)
 	fmt.Printf("  Class: %s\n", model.Class)
 	fmt.Printf("  Default: %t\n", model.Default)
+	if model.IsEmbedding() {
+		fmt.Printf("  Type: %s\n", model.Type)
+		if model.Dimensions > 0 {
+			fmt.Printf("  Dimensions: %d\n", model.Dimensions)
+		}
+	}
 
 	if model.APIKey != "" {
 		if model.APIKey == "${OPENAI_API_KEY}" {
@@ -196,11 +204,13 @@ func outputConfigShowJSON(configPath string, config *agent.Config) error {
 
 	for _, model := range config.Agent.Models {
 		modelInfo := ConfigShowModelInfo{
-			Name:    model.Name,
-			Model:   model.Model,
-			Class:   model.Class,
-			Default: model.Default,
-			APIURL:  model.APIURL,
+			Name:       model.Name,
+			Model:      model.Model,
+			Class:      model.Class,
+			Default:    model.Default,
+			Type:       model.Type,
+			Dimensions: model.Dimensions,
+			APIURL:     model.APIURL,
 		}
 
 		if model.APIKey != "" {
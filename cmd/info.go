@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -32,6 +33,8 @@ var infoCommand = &cobra.Command{
 Display information about the agent configuration including:
 - LLM model details
 - API configuration
+- MCP toolsets of the configuration file
+- mcpshell binary and the tools of the tools file (with --tools)
 - System prompts (with --include-prompts)
 - LLM connectivity status (with --check)
 
@@ -40,6 +43,7 @@ $ don info
 $ don info --json
 $ don info --include-prompts
 $ don info --check
+$ don info --tools=tools.yaml
 $ don info --model gpt-4o --json
 `,
 	Args: cobra.NoArgs,
@@ -57,23 +61,42 @@ $ don info --model gpt-4o --json
 		orchestratorConfig := agentConfig.ModelConfig
 		toolRunnerConfig := agentConfig.ModelConfig
 
+		config, err := agent.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		toolsets := config.Agent.Toolsets
+
+		// Discover the tools of the tools file, reporting why mcpshell cannot serve them
+		var mcpshellInfo *MCPShellInfo
+		if agentConfig.ToolsFile != "" {
+			mcpshellInfo = &MCPShellInfo{}
+			mcpshellInfo.MCPShellInfo, err = agent.PreflightMCPShell(cmd.Context(), agentConfig.MCPShellBinary, agentConfig.ToolsFile, logger)
+			if err != nil {
+				mcpshellInfo.Error = err.Error()
+			}
+		}
+
 		var checkResult *CheckResult
 		if infoCheck {
 			checkResult = checkLLMConnectivity(orchestratorConfig, logger)
 		}
 
 		if infoJSON {
-			err := outputInfoJSON(agentConfig, orchestratorConfig, toolRunnerConfig, checkResult)
+			err := outputInfoJSON(agentConfig, orchestratorConfig, toolRunnerConfig, toolsets, mcpshellInfo, checkResult)
 			if err != nil {
 				return err
 			}
+			if mcpshellInfo != nil && mcpshellInfo.Error != "" {
+				return fmt.Errorf("mcpshell check failed: %s", mcpshellInfo.Error)
+			}
 			if checkResult != nil && !checkResult.Success {
 				return fmt.Errorf("LLM connectivity check failed: %s", checkResult.Error)
 			}
 			return nil
 		}
 
-		return outputInfoHumanReadable(agentConfig, orchestratorConfig, toolRunnerConfig, checkResult)
+		return outputInfoHumanReadable(agentConfig, orchestratorConfig, toolRunnerConfig, toolsets, mcpshellInfo, checkResult)
 	},
 }
 
@@ -87,13 +110,15 @@ type CheckResult struct {
 
 // InfoOutput holds the complete info output structure for JSON
 type InfoOutput struct {
-	ConfigFile   string       `json:"config_file,omitempty"`
-	ToolsFile    string       `json:"tools_file,omitempty"`
-	Once         bool         `json:"once_mode"`
-	Orchestrator ModelInfo    `json:"orchestrator"`
-	ToolRunner   ModelInfo    `json:"tool_runner"`
-	Check        *CheckResult `json:"check,omitempty"`
-	Prompts      *PromptsInfo `json:"prompts,omitempty"`
+	ConfigFile   string        `json:"config_file,omitempty"`
+	ToolsFile    string        `json:"tools_file,omitempty"`
+	Once         bool          `json:"once_mode"`
+	Orchestrator ModelInfo     `json:"orchestrator"`
+	ToolRunner   ModelInfo     `json:"tool_runner"`
+	Toolsets     []ToolsetInfo `json:"toolsets,omitempty"`
+	MCPShell     *MCPShellInfo `json:"mcpshell,omitempty"`
+	Check        *CheckResult  `json:"check,omitempty"`
+	Prompts      *PromptsInfo  `json:"prompts,omitempty"`
 }
 
 // ModelInfo holds model configuration details for JSON output
@@ -105,6 +130,50 @@ type ModelInfo struct {
 	APIKey string `json:"api_key_masked,omitempty"`
 }
 
+// ToolsetInfo holds the details of an MCP toolset for JSON output
+// Only the names of the environment variables and headers are shown, as their values can be secrets
+type ToolsetInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Transport   string   `json:"transport"`
+	Location    string   `json:"location"`
+	Agent       string   `json:"agent"`
+	Tools       []string `json:"tools,omitempty"`
+	Env         []string `json:"env,omitempty"`
+	Headers     []string `json:"headers,omitempty"`
+}
+
+// newToolsetInfo returns the details of an MCP toolset
+func newToolsetInfo(t agent.ToolsetConfig) ToolsetInfo {
+	return ToolsetInfo{
+		Name:        t.Name,
+		Description: t.Description,
+		Transport:   t.TransportType(),
+		Location:    t.Location(),
+		Agent:       t.AgentRole(),
+		Tools:       t.Tools,
+		Env:         sortedKeys(t.Env),
+		Headers:     sortedKeys(t.Headers),
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MCPShellInfo holds the mcpshell binary and the tools of the tools file, or
+// why they could not be discovered
+type MCPShellInfo struct {
+	*agent.MCPShellInfo
+	Error string `json:"error,omitempty"`
+}
+
 // PromptsInfo holds prompt information for JSON output
 type PromptsInfo struct {
 	System []string `json:"system,omitempty"`
@@ -172,11 +241,12 @@ func buildAgentConfigForInfo() (agent.AgentConfig, error) {
 	}
 
 	return agent.AgentConfig{
-		ToolsFile:   toolsFile,
-		UserPrompt:  agentUserPrompt,
-		Once:        agentOnce,
-		Version:     version,
-		ModelConfig: modelConfig,
+		ToolsFile:      toolsFile,
+		UserPrompt:     agentUserPrompt,
+		Once:           agentOnce,
+		Version:        version,
+		MCPShellBinary: mcpshellBinary(config),
+		ModelConfig:    modelConfig,
 	}, nil
 }
 
@@ -227,7 +297,7 @@ func checkLLMConnectivity(modelConfig agent.ModelConfig, logger *common.Logger)
 	return result
 }
 
-func outputInfoJSON(agentConfig agent.AgentConfig, orchestrator, toolRunner agent.ModelConfig, check *CheckResult) error {
+func outputInfoJSON(agentConfig agent.AgentConfig, orchestrator, toolRunner agent.ModelConfig, toolsets []agent.ToolsetConfig, mcpshell *MCPShellInfo, check *CheckResult) error {
 	var configFile string
 	if donHome, err := utils.GetDonHome(); err == nil {
 		configFile = filepath.Join(donHome, "agent.yaml")
@@ -251,7 +321,11 @@ func outputInfoJSON(agentConfig agent.AgentConfig, orchestrator, toolRunner agen
 			APIURL: toolRunner.APIURL,
 			APIKey: maskAPIKey(toolRunner.APIKey),
 		},
-		Check: check,
+		MCPShell: mcpshell,
+		Check:    check,
+	}
+	for _, t := range toolsets {
+		output.Toolsets = append(output.Toolsets, newToolsetInfo(t))
 	}
 
 	if infoIncludePrompts {
@@ -266,7 +340,7 @@ func outputInfoJSON(agentConfig agent.AgentConfig, orchestrator, toolRunner agen
 	return encoder.Encode(output)
 }
 
-func outputInfoHumanReadable(agentConfig agent.AgentConfig, orchestrator, toolRunner agent.ModelConfig, check *CheckResult) error {
+func outputInfoHumanReadable(agentConfig agent.AgentConfig, orchestrator, toolRunner agent.ModelConfig, toolsets []agent.ToolsetConfig, mcpshell *MCPShellInfo, check *CheckResult) error {
 	fmt.Println(color.HiCyanString("Don Agent Configuration"))
 	fmt.Println(strings.Repeat("=", 50))
 	fmt.Println()
@@ -297,6 +371,41 @@ func outputInfoHumanReadable(agentConfig agent.AgentConfig, orchestrator, toolRu
 	}
 	fmt.Println()
 
+	if len(toolsets) > 0 {
+		fmt.Println(color.HiYellowString("Toolsets:"))
+		for _, t := range toolsets {
+			info := newToolsetInfo(t)
+			fmt.Printf("  %s\n", color.CyanString(info.Name))
+			if info.Description != "" {
+				fmt.Printf("    Description: %s\n", info.Description)
+			}
+			fmt.Printf("    Transport:   %s\n", info.Transport)
+			fmt.Printf("    Location:    %s\n", info.Location)
+			fmt.Printf("    Agent:       %s\n", info.Agent)
+			if len(info.Tools) > 0 {
+				fmt.Printf("    Tools:       %s\n", strings.Join(info.Tools, ", "))
+			}
+			if len(info.Env) > 0 {
+				fmt.Printf("    Env:         %s\n", strings.Join(info.Env, ", "))
+			}
+			if len(info.Headers) > 0 {
+				fmt.Printf("    Headers:     %s\n", strings.Join(info.Headers, ", "))
+			}
+		}
+		fmt.Println()
+	}
+
+	if mcpshell != nil {
+		fmt.Println(color.HiYellowString("MCPShell:"))
+		if mcpshell.Error != "" {
+			fmt.Printf("  Status:      %s\n", color.HiRedString("✗ Failed"))
+			fmt.Printf("  Error:       %s\n", mcpshell.Error)
+		} else {
+			printMCPShellTools(mcpshell.MCPShellInfo)
+		}
+		fmt.Println()
+	}
+
 	if infoIncludePrompts {
 		fmt.Println(color.HiYellowString("Prompts:"))
 		if orchestrator.Prompts.HasSystemPrompts() {
@@ -326,9 +435,40 @@ func outputInfoHumanReadable(agentConfig agent.AgentConfig, orchestrator, toolRu
 		fmt.Println()
 	}
 
+	if mcpshell != nil && mcpshell.Error != "" {
+		return fmt.Errorf("mcpshell check failed: %s", mcpshell.Error)
+	}
+
 	return nil
 }
 
+// printMCPShellTools prints the mcpshell binary and the tools it serves, with their parameters
+func printMCPShellTools(info *agent.MCPShellInfo) {
+	fmt.Printf("  Binary:      %s\n", info.Binary)
+	if info.Version != "" {
+		fmt.Printf("  Version:     %s\n", info.Version)
+	}
+	fmt.Printf("  Tools:       %d\n", len(info.Tools))
+	for _, tool := range info.Tools {
+		fmt.Printf("    %s", color.CyanString(tool.Name))
+		if tool.Description != "" {
+			fmt.Printf(": %s", truncateString(tool.Description, 100))
+		}
+		fmt.Println()
+		for _, param := range tool.Parameters {
+			required := ""
+			if param.Required {
+				required = ", required"
+			}
+			fmt.Printf("      - %s (%s%s)", param.Name, param.Type, required)
+			if param.Description != "" {
+				fmt.Printf(": %s", truncateString(param.Description, 80))
+			}
+			fmt.Println()
+		}
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(infoCommand)
 
@@ -0,0 +1,57 @@
+package root
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/spf13/cobra"
+)
+
+// mcpCommand runs Don as an MCP server over stdio
+var mcpCommand = &cobra.Command{
+	Use:   "mcp",
+	Short: "Run the agent as an MCP server (stdio)",
+	Long: `
+Runs Don as an MCP (Model Context Protocol) server over stdin/stdout, so
+editors, desktop assistants and other agents can delegate work to it.
+
+Tools:
+  ask                  Run the agent once with a prompt and return its final answer
+                       (tool calls are approved automatically). Optional arguments
+                       select the RAG sources and the tools file.
+  rag_search_<source>  Search a RAG source of the configuration file locally,
+                       without an LLM (one tool per source)
+
+The model, prompts and RAG sources given with the usual flags are the defaults
+of the ask tool. Logs are written to stderr (or --log-file).
+
+Examples:
+  $ don mcp --tools=tools.yaml
+  $ don mcp -t tools.yaml --rag docs --log-file /tmp/don-mcp.log
+
+Example MCP client configuration:
+  {"mcpServers": {"don": {"command": "don", "args": ["mcp", "--tools", "/path/to/tools.yaml"]}}}
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+		srv, err := newServer(logger)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return srv.ServeMCP(ctx, version, &mcp.StdioTransport{})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mcpCommand)
+}
@@ -0,0 +1,160 @@
+package root
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/inercia/don/pkg/agent"
+)
+
+// modelsCheckTimeout is the time allowed to each model probe
+const modelsCheckTimeout = 30 * time.Second
+
+var (
+	modelsCheckJSON bool
+)
+
+// modelsCommand is the parent command for model subcommands
+var modelsCommand = &cobra.Command{
+	Use:   "models",
+	Short: "Inspect the configured models",
+	Long: `
+The models command provides subcommands to inspect the models in the agent configuration.
+
+Available subcommands:
+- check: Probe the embedding models with a small embedding request
+`,
+}
+
+// ModelsCheckOutput holds the JSON output structure for models check
+type ModelsCheckOutput struct {
+	Models []ModelCheckResult `json:"models"`
+}
+
+// ModelCheckResult holds the result of probing a model
+type ModelCheckResult struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	Class      string `json:"class"`
+	Dimensions int    `json:"dimensions,omitempty"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+}
+
+// modelsCheckCommand probes the embedding models
+var modelsCheckCommand = &cobra.Command{
+	Use:   "check [name...]",
+	Short: "Check the embedding models",
+	Long: `
+Probes the embedding models of the configuration (agent.models entries with
+type: embedding) with a small embedding request, and reports the size of their
+vectors. A model with configured dimensions fails the check if the vectors
+returned have a different size.
+
+Models can be selected by name; all the embedding models are checked otherwise.
+The command fails if any model fails the check.
+
+Examples:
+$ don models check
+$ don models check embeddings
+$ don models check --json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+
+		config, err := agent.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		var models []agent.ModelConfig
+		if len(args) == 0 {
+			models = config.GetEmbeddingModels()
+			if len(models) == 0 {
+				return fmt.Errorf("no embedding models configured (add agent.models entries with type: %s)", agent.ModelTypeEmbedding)
+			}
+		} else {
+			for _, name := range args {
+				model := config.GetModelByName(name)
+				if model == nil {
+					return fmt.Errorf("model '%s' not found in configuration", name)
+				}
+				models = append(models, *model)
+			}
+		}
+
+		manager := agent.NewModelManager(logger)
+		output := ModelsCheckOutput{Models: make([]ModelCheckResult, 0, len(models))}
+		failed := 0
+		for _, model := range models {
+			result := ModelCheckResult{
+				Name:  model.Name,
+				Model: model.Model,
+				Class: model.Class,
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), modelsCheckTimeout)
+			result.Dimensions, err = manager.ProbeEmbeddingModel(ctx, model)
+			cancel()
+			if err != nil {
+				result.Error = err.Error()
+				failed++
+			} else {
+				result.OK = true
+			}
+			output.Models = append(output.Models, result)
+		}
+
+		if modelsCheckJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(output); err != nil {
+				return err
+			}
+		} else {
+			outputModelsCheckHumanReadable(output)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d models failed the check", failed, len(models))
+		}
+		return nil
+	},
+}
+
+func outputModelsCheckHumanReadable(output ModelsCheckOutput) {
+	fmt.Println(color.HiCyanString("Embedding Models"))
+	fmt.Println(strings.Repeat("=", 50))
+	fmt.Println()
+
+	for _, result := range output.Models {
+		name := result.Name
+		if name == "" {
+			name = result.Model
+		}
+		if result.OK {
+			fmt.Printf("%s %s (%s/%s): %d dimensions\n",
+				color.HiGreenString("✓"), name, result.Class, result.Model, result.Dimensions)
+		} else {
+			fmt.Printf("%s %s (%s/%s): %s\n",
+				color.HiRedString("✗"), name, result.Class, result.Model, result.Error)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(modelsCommand)
+	modelsCommand.AddCommand(modelsCheckCommand)
+
+	modelsCheckCommand.Flags().BoolVar(&modelsCheckJSON, "json", false, "Output in JSON format")
+}
@@ -0,0 +1,472 @@
+package root
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/rag"
+)
+
+var (
+	ragCacheStatsJSON bool
+	ragSearchLimit    int
+	ragSearchJSON     bool
+	ragSearchFilter   string
+	ragEvalQuestions  string
+	ragEvalK          int
+	ragEvalJSON       bool
+)
+
+// ragCommand is the parent command for RAG subcommands
+var ragCommand = &cobra.Command{
+	Use:   "rag",
+	Short: "Manage RAG document sources",
+	Long: `
+The rag command provides subcommands to inspect and manage RAG document sources.
+
+Available subcommands:
+- cache: Inspect the RAG document cache
+- search: Search a RAG source locally, without an LLM
+- eval: Measure the retrieval quality of a RAG source with a set of questions
+`,
+}
+
+// ragCacheCommand is the parent command for RAG cache subcommands
+var ragCacheCommand = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect the RAG document cache",
+	Long: `
+The cache command provides subcommands to inspect the RAG document cache.
+
+Available subcommands:
+- stats: Display cache size, hits, misses and bytes saved
+`,
+}
+
+// RAGCacheStatsOutput holds the JSON output structure for rag cache stats
+type RAGCacheStatsOutput struct {
+	CacheDir  string                      `json:"cache_dir"`
+	MaxSize   int64                       `json:"max_size,omitempty"`
+	TotalSize int64                       `json:"total_size"`
+	Entries   map[string]RAGCacheKindStat `json:"entries"`
+	Stats     *rag.CacheStats             `json:"stats"`
+	HitRate   float64                     `json:"hit_rate"`
+}
+
+// RAGCacheKindStat holds the number and size of the cache entries of a kind
+type RAGCacheKindStat struct {
+	Count int   `json:"count"`
+	Size  int64 `json:"size"`
+}
+
+// ragCacheStatsCommand displays cache usage statistics
+var ragCacheStatsCommand = &cobra.Command{
+	Use:   "stats",
+	Short: "Display RAG cache statistics",
+	Long: `
+Displays the size of the RAG document cache and its usage statistics:
+hits (documents served from the cache), misses (documents downloaded),
+bytes saved, deduplicated downloads and evictions.
+
+Statistics are shared by all processes using the same cache directory.
+
+Examples:
+$ don rag cache stats
+$ don rag cache stats --json
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+
+		cacheDir, err := rag.GetCacheDir()
+		if err != nil {
+			return fmt.Errorf("failed to get RAG cache directory: %w", err)
+		}
+
+		entries, err := rag.ScanCache(cacheDir)
+		if err != nil {
+			return fmt.Errorf("failed to scan RAG cache: %w", err)
+		}
+		stats, err := rag.LoadCacheStats(cacheDir)
+		if err != nil {
+			return err
+		}
+
+		output := RAGCacheStatsOutput{
+			CacheDir: cacheDir,
+			Entries:  make(map[string]RAGCacheKindStat),
+			Stats:    stats,
+			HitRate:  stats.HitRate(),
+		}
+		for _, entry := range entries {
+			kind := output.Entries[string(entry.Kind)]
+			kind.Count++
+			kind.Size += entry.Size
+			output.Entries[string(entry.Kind)] = kind
+			output.TotalSize += entry.Size
+		}
+
+		// The size limit is optional, so a missing config file is not an error
+		if config, err := agent.GetConfig(); err != nil {
+			logger.Debug("Failed to load agent config: %v", err)
+		} else if config.Agent.RAGCache != nil {
+			output.MaxSize = int64(config.Agent.RAGCache.MaxSize)
+		}
+
+		if ragCacheStatsJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(output)
+		}
+
+		outputRAGCacheStatsHumanReadable(output)
+		return nil
+	},
+}
+
+func outputRAGCacheStatsHumanReadable(output RAGCacheStatsOutput) {
+	fmt.Println(color.HiCyanString("RAG Cache"))
+	fmt.Println(strings.Repeat("=", 50))
+	fmt.Println()
+
+	fmt.Printf("Cache Dir:     %s\n", output.CacheDir)
+	if output.MaxSize > 0 {
+		fmt.Printf("Size:          %s of %s\n", formatBytes(output.TotalSize), formatBytes(output.MaxSize))
+	} else {
+		fmt.Printf("Size:          %s (no limit)\n", formatBytes(output.TotalSize))
+	}
+	fmt.Println()
+
+	fmt.Println(color.HiYellowString("Entries:"))
+	for _, kind := range []struct {
+		kind  rag.CacheEntryKind
+		label string
+	}{
+		{rag.CacheEntryDocument, "Documents:"},
+		{rag.CacheEntryGit, "Git repos:"},
+		{rag.CacheEntryArchive, "Archives:"},
+	} {
+		stat := output.Entries[string(kind.kind)]
+		fmt.Printf("  %-13s %6d  %s\n", kind.label, stat.Count, formatBytes(stat.Size))
+	}
+	fmt.Println()
+
+	stats := output.Stats
+	fmt.Println(color.HiYellowString("Usage:"))
+	if !stats.Since.IsZero() {
+		fmt.Printf("  Since:        %s\n", stats.Since.Local().Format(time.DateTime))
+	}
+	fmt.Printf("  Hits:         %d\n", stats.Hits)
+	fmt.Printf("  Misses:       %d\n", stats.Misses)
+	fmt.Printf("  Hit Rate:     %.1f%%\n", output.HitRate*100)
+	fmt.Printf("  Downloaded:   %s\n", formatBytes(stats.BytesDownloaded))
+	fmt.Printf("  Saved:        %s\n", formatBytes(stats.BytesSaved))
+	fmt.Printf("  Deduplicated: %d (%s)\n", stats.Deduplicated, formatBytes(stats.BytesDeduplicated))
+	fmt.Printf("  Evictions:    %d (%s)\n", stats.Evictions, formatBytes(stats.BytesEvicted))
+}
+
+// formatBytes formats a size in bytes with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// RAGSearchOutput holds the JSON output structure for rag search
+type RAGSearchOutput struct {
+	Source  string             `json:"source"`
+	Query   string             `json:"query"`
+	Filter  string             `json:"filter,omitempty"`
+	Results []rag.SearchResult `json:"results"`
+}
+
+// ragSearchCommand searches a RAG source with the local retrieval engine
+var ragSearchCommand = &cobra.Command{
+	Use:   "search <source> <query>",
+	Short: "Search a RAG source locally",
+	Long: `
+Searches a RAG source from the configuration file with the built-in retrieval
+engine and displays the ranked chunks with their scores. No LLM is involved,
+so this is useful for tuning chunking, BM25 parameters and fusion settings.
+
+Documents are fetched as for the agent (using the cache) and indexed in the
+cache directory; only documents changed since the last search are indexed
+again, unless --reindex is given.
+Only keyword (bm25) strategies run locally: other strategies are skipped, and
+a source without a bm25 strategy is searched with a default one.
+
+With --filter, only the documents whose docs entry has matching tags or
+properties are searched (e.g. "tag=prod" or "tag=prod,service=payments").
+
+Examples:
+$ don rag search docs "how to install"
+$ don rag search docs "authentication tokens" --limit 10
+$ don rag search runbooks "restart the service" --filter tag=prod
+$ don rag search docs "error codes" --json
+$ don rag search docs "error codes" --reindex
+`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+
+		sourceName := args[0]
+		query := strings.Join(args[1:], " ")
+
+		filter, err := rag.ParseMetadataFilter(ragSearchFilter)
+		if err != nil {
+			return err
+		}
+
+		config, err := agent.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		source, ok := config.Agent.RAG[sourceName]
+		if !ok {
+			return fmt.Errorf("RAG source '%s' not found in configuration", sourceName)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		processed, err := agent.ProcessRAGSources(ctx, map[string]agent.RAGSourceConfig{sourceName: source}, agent.RAGProcessOptions{
+			HTTP:    config.Agent.RAGHTTP,
+			Cache:   config.Agent.RAGCache,
+			Reindex: agentRAGReindex,
+		}, logger)
+		if err != nil {
+			return err
+		}
+
+		results, err := agent.SearchRAGSource(ctx, sourceName, processed[sourceName], query, agent.RAGSearchOptions{
+			Limit:   ragSearchLimit,
+			Reindex: agentRAGReindex,
+			Filter:  filter,
+		}, logger)
+		if err != nil {
+			return fmt.Errorf("search failed: %w", err)
+		}
+
+		if ragSearchJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(RAGSearchOutput{Source: sourceName, Query: query, Filter: filter.String(), Results: results})
+		}
+
+		outputRAGSearchHumanReadable(sourceName, query, filter, results)
+		return nil
+	},
+}
+
+func outputRAGSearchHumanReadable(sourceName, query string, filter rag.MetadataFilter, results []rag.SearchResult) {
+	fmt.Println(color.HiCyanString("RAG Search: %s", sourceName))
+	fmt.Println(strings.Repeat("=", 50))
+	fmt.Printf("Query: %s\n", query)
+	if len(filter) > 0 {
+		fmt.Printf("Filter: %s\n", filter)
+	}
+	fmt.Println()
+
+	if len(results) == 0 {
+		fmt.Println("No matching chunks found.")
+		return
+	}
+
+	for i, result := range results {
+		chunk := result.Chunk
+		fmt.Printf("%s %s %s\n",
+			color.HiYellowString("%d.", i+1),
+			color.HiGreenString("%.4f", result.Score),
+			chunk.Location())
+		if len(result.Scores) > 1 {
+			var scores []string
+			for name, score := range result.Scores {
+				scores = append(scores, fmt.Sprintf("%s=%.4f", name, score))
+			}
+			sort.Strings(scores)
+			fmt.Printf("   Scores: %s\n", strings.Join(scores, ", "))
+		}
+		if chunk.Metadata != nil {
+			fmt.Printf("   Metadata: %s\n", describeMetadata(chunk.Metadata))
+		}
+		fmt.Printf("   %s\n", snippet(chunk.Text, 200))
+		fmt.Println()
+	}
+}
+
+// ragEvalCommand evaluates the retrieval quality of a RAG source
+var ragEvalCommand = &cobra.Command{
+	Use:   "eval <source>",
+	Short: "Evaluate the retrieval quality of a RAG source",
+	Long: `
+Runs the retrieval of a RAG source (without an LLM) for a set of questions and
+reports recall@k and MRR (mean reciprocal rank) for each strategy and for the
+fused results, so changes to chunking, strategies and fusion can be compared.
+
+Questions are read from a YAML file, each with the documents (paths, path
+suffixes or URLs) or keywords its results should contain:
+
+  questions:
+    - question: "How do I install Don?"
+      sources: ["docs/install.md"]
+    - question: "Which environment variable overrides the cache directory?"
+      keywords: ["MCPSHELL_RAG_CACHE_DIR"]
+
+A result is relevant if it comes from an expected document or contains an
+expected keyword. Recall@k is the fraction of the expected documents and
+keywords found in the top k results, and MRR uses the rank of the first
+relevant result in the top k. As with 'don rag search', only keyword (bm25)
+strategies run locally.
+
+Examples:
+$ don rag eval docs --questions qa.yaml
+$ don rag eval docs --questions qa.yaml --k 10
+$ don rag eval docs --questions qa.yaml --json
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+
+		sourceName := args[0]
+		questions, err := agent.LoadRAGEvalQuestions(ragEvalQuestions)
+		if err != nil {
+			return err
+		}
+
+		config, err := agent.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		source, ok := config.Agent.RAG[sourceName]
+		if !ok {
+			return fmt.Errorf("RAG source '%s' not found in configuration", sourceName)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		processed, err := agent.ProcessRAGSources(ctx, map[string]agent.RAGSourceConfig{sourceName: source}, agent.RAGProcessOptions{
+			HTTP:    config.Agent.RAGHTTP,
+			Cache:   config.Agent.RAGCache,
+			Reindex: agentRAGReindex,
+		}, logger)
+		if err != nil {
+			return err
+		}
+
+		report, err := agent.EvaluateRAGSource(ctx, sourceName, processed[sourceName], questions, ragEvalK, agentRAGReindex, logger)
+		if err != nil {
+			return fmt.Errorf("evaluation failed: %w", err)
+		}
+
+		if ragEvalJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		}
+
+		outputRAGEvalHumanReadable(report)
+		return nil
+	},
+}
+
+func outputRAGEvalHumanReadable(report *agent.RAGEvalReport) {
+	fmt.Println(color.HiCyanString("RAG Evaluation: %s", report.Source))
+	fmt.Println(strings.Repeat("=", 50))
+	fmt.Printf("Questions: %d, k: %d\n", len(report.Questions), report.K)
+	fmt.Println()
+
+	fmt.Println(color.HiYellowString("%-16s %10s %8s %8s", "Strategy", fmt.Sprintf("Recall@%d", report.K), "MRR", "Hits"))
+	for _, name := range report.Strategies {
+		metrics := report.Metrics[name]
+		fmt.Printf("%-16s %10.3f %8.3f %8s\n", name, metrics.Recall, metrics.MRR,
+			fmt.Sprintf("%d/%d", metrics.Hits, len(report.Questions)))
+	}
+
+	var missed []string
+	for _, question := range report.Questions {
+		if question.Scores[agent.RAGEvalFused].Rank == 0 {
+			missed = append(missed, question.Question)
+		}
+	}
+	if len(missed) > 0 {
+		fmt.Println()
+		fmt.Println(color.HiYellowString("Questions without relevant results (%s):", agent.RAGEvalFused))
+		for _, question := range missed {
+			fmt.Printf("  - %s\n", question)
+		}
+	}
+}
+
+// snippet returns the text on a single line, truncated to at most n characters
+func snippet(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n]) + "..."
+	}
+	return text
+}
+
+// describeMetadata returns a one-line description of the tags and properties of a document
+func describeMetadata(m *rag.Metadata) string {
+	var parts []string
+	if len(m.Tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(m.Tags, ", "))
+	}
+	var properties []string
+	for key, value := range m.Properties {
+		properties = append(properties, key+"="+value)
+	}
+	sort.Strings(properties)
+	parts = append(parts, properties...)
+	if len(parts) == 0 {
+		return m.Description
+	}
+	return strings.Join(parts, "; ")
+}
+
+func init() {
+	rootCmd.AddCommand(ragCommand)
+	ragCommand.AddCommand(ragCacheCommand)
+	ragCacheCommand.AddCommand(ragCacheStatsCommand)
+	ragCommand.AddCommand(ragSearchCommand)
+	ragCommand.AddCommand(ragEvalCommand)
+
+	ragCacheStatsCommand.Flags().BoolVar(&ragCacheStatsJSON, "json", false, "Output in JSON format")
+
+	ragSearchCommand.Flags().IntVarP(&ragSearchLimit, "limit", "n", 0, "Maximum number of results (default: the source results limit)")
+	ragSearchCommand.Flags().BoolVar(&ragSearchJSON, "json", false, "Output in JSON format")
+	ragSearchCommand.Flags().StringVar(&ragSearchFilter, "filter", "", "Only search documents with matching metadata (e.g. tag=prod,service=payments)")
+
+	ragEvalCommand.Flags().StringVarP(&ragEvalQuestions, "questions", "q", "", "YAML file with the questions and their expected sources or keywords")
+	ragEvalCommand.Flags().IntVar(&ragEvalK, "k", agent.DefaultRAGEvalK, "Number of results considered per question")
+	ragEvalCommand.Flags().BoolVar(&ragEvalJSON, "json", false, "Output in JSON format")
+	_ = ragEvalCommand.MarkFlagRequired("questions")
+}
@@ -23,6 +23,7 @@ var (
 	logToFile  bool
 	toolsFiles []string
 	verbose    bool
+	mcpshell   string
 )
 
 // Agent command flags
@@ -34,6 +35,11 @@ var (
 	agentOpenAIApiURL string
 	agentOnce         bool
 	agentRAGSources   []string
+	agentRAGReindex   bool
+	agentRAGWatch     bool
+	agentRAGDocs      []string
+	agentRecord       string
+	agentReplay       string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -96,4 +102,5 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&logToFile, "log-to-file", false, "Write logs to file instead of stderr")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging (same as --log-level=debug)")
 	rootCmd.PersistentFlags().StringSliceVarP(&toolsFiles, "tools", "t", []string{}, "Tool configuration file(s) (MCPShell format)")
+	rootCmd.PersistentFlags().StringVar(&mcpshell, "mcpshell", "", "Path of the mcpshell binary (default: agent.mcpshell in the config file, or mcpshell in the PATH)")
 }
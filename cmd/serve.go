@@ -0,0 +1,130 @@
+package root
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/server"
+)
+
+// serveTokenEnv is the environment variable with the default bearer token of the API
+const serveTokenEnv = "DON_SERVE_TOKEN"
+
+var (
+	serveListen      string
+	serveRetention   time.Duration
+	serveIdleTimeout time.Duration
+	serveMaxRuns     int
+	serveToken       string
+	serveAutoApprove bool
+	serveAnnotate    bool
+)
+
+// serveCommand runs the HTTP API server
+var serveCommand = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the agent as an HTTP API server",
+	Long: `
+Serves the agent over an HTTP API, so other programs can run it. Each run has
+its own agent and runtime, and runs are isolated from each other.
+
+Endpoints:
+  POST   /v1/runs                 Start a run: {"prompt": "...", "tools": "...", "rag": [...]}
+  GET    /v1/runs/{id}            Describe a run
+  GET    /v1/runs/{id}/events     Stream the events of a run (Server-Sent Events)
+  POST   /v1/runs/{id}/messages   Continue the conversation: {"content": "..."}
+  POST   /v1/runs/{id}/approve    Answer a tool call confirmation: {"approval": "approve"}
+  DELETE /v1/runs/{id}            Stop and forget a run
+
+OpenAI-compatible endpoints, for using Don as a model from any OpenAI client:
+  GET    /v1/models               List the models (the tools files)
+  POST   /v1/chat/completions     Answer a conversation (streamed with "stream": true)
+
+The model, prompts and RAG sources given with the usual flags are the defaults
+of the runs. Runs can pick any of the tools files given with --tools, and any
+RAG source of the configuration file.
+
+Tool calls of the runs wait for an approval (see /approve) unless
+--auto-approve is given. When --token (or DON_SERVE_TOKEN) is set,
+all the requests need an "Authorization: Bearer <token>" header.
+
+Examples:
+  $ don serve --tools=tools.yaml
+  $ don serve -t tools.yaml -t k8s.yaml --listen 127.0.0.1:9000 --rag docs
+  $ DON_SERVE_TOKEN=secret don serve -t k8s.yaml --listen :8080 --auto-approve
+  $ don serve -t k8s.yaml --tool-annotations
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+		srv, err := newServer(logger)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return srv.ListenAndServe(ctx, serveListen)
+	},
+}
+
+// newServer creates the server running the agent for other programs, with the
+// agent flags as the defaults of the runs
+func newServer(logger *common.Logger) (*server.Server, error) {
+	agentConfig, err := buildAgentConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := agent.New(agentConfig, logger).Validate(); err != nil {
+		return nil, err
+	}
+	agentConfig.MCPShellBinary, err = preflightMCPShell(context.Background(), agentConfig, toolsFiles, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := agent.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	token := serveToken
+	if token == "" {
+		token = os.Getenv(serveTokenEnv)
+	}
+
+	return server.New(server.Config{
+		Agent:       agentConfig,
+		ToolsFiles:  toolsFiles,
+		RAG:         config.Agent.RAG,
+		Retention:   serveRetention,
+		IdleTimeout: serveIdleTimeout,
+		MaxRuns:     serveMaxRuns,
+		Token:       token,
+		AutoApprove: serveAutoApprove,
+		Annotations: serveAnnotate,
+	}, logger), nil
+}
+
+func init() {
+	rootCmd.AddCommand(serveCommand)
+
+	serveCommand.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8080", "Address to listen on")
+	serveCommand.Flags().DurationVar(&serveRetention, "retention", server.DefaultRetention, "How long finished runs are kept")
+	serveCommand.Flags().DurationVar(&serveIdleTimeout, "idle-timeout", server.DefaultIdleTimeout, "How long runs wait for a message or an approval before being stopped (0: forever)")
+	serveCommand.Flags().IntVar(&serveMaxRuns, "max-runs", server.DefaultMaxRuns, "Maximum number of runs and chat completions at the same time (0: no limit)")
+	serveCommand.Flags().StringVar(&serveToken, "token", "", "Bearer token required by the requests (default: $"+serveTokenEnv+")")
+	serveCommand.Flags().BoolVar(&serveAutoApprove, "auto-approve", false, "Approve the tool calls of all the runs and chat completions without asking")
+	serveCommand.Flags().BoolVar(&serveAnnotate, "tool-annotations", false, "Report the tool activity as annotations in chat completions")
+}
@@ -0,0 +1,183 @@
+package root
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/inercia/don/pkg/agent"
+)
+
+var runVars []string
+
+// runTemplateCommand runs the agent with a prompt template
+var runTemplateCommand = &cobra.Command{
+	Use:   "run <template> [prompt]",
+	Short: "Run the agent with a prompt template",
+	Long: `
+Renders a prompt template with the values of its variables, given with --var,
+and runs the agent with it. Templates are defined in agent.templates of the
+configuration file, or as files in ~/.don/templates/ (see 'don templates list').
+
+The tools file, model, RAG sources and system prompts of the template are used
+unless given with the usual flags. Extra arguments are appended to the prompt,
+with '-' replaced by STDIN as in the agent command.
+
+Examples:
+  $ don run pod-restarts --var namespace=api
+  $ don run pod-restarts --var namespace=api --var cluster=staging --once
+  $ cat error.log | don run analyze-log -
+`,
+	Args: cobra.MinimumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		config, err := agent.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		tmpl, err := config.GetTemplate(args[0])
+		if err != nil {
+			return err
+		}
+		prompt, err := tmpl.Render(runVars)
+		if err != nil {
+			return err
+		}
+
+		if len(args) > 1 {
+			extra, usedStdin, err := processArgsWithStdin(args[1:])
+			if err != nil {
+				return fmt.Errorf("failed to process arguments: %w", err)
+			}
+			prompt += "\n\n" + extra
+
+			// If STDIN was used, automatically enable --once mode
+			if usedStdin && !agentOnce {
+				agentOnce = true
+			}
+		}
+
+		applyTemplate(cmd, tmpl, prompt)
+		return prepareAgent(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAgent.RunE(cmd, args)
+	},
+}
+
+// applyTemplate sets the agent flags from a template and its rendered prompt.
+// Flags given in the command line take precedence.
+func applyTemplate(cmd *cobra.Command, tmpl *agent.TemplateConfig, prompt string) {
+	agentUserPrompt = prompt
+	if tmpl.Tools != "" && !cmd.Flags().Changed("tools") {
+		toolsFiles = []string{tmpl.Tools}
+	}
+	if tmpl.Model != "" && !cmd.Flags().Changed("model") {
+		agentModel = tmpl.Model
+	}
+	if tmpl.RAG != nil && !cmd.Flags().Changed("rag") {
+		agentRAGSources = tmpl.RAG
+	}
+
+	// The system prompts of the template come before the one of the flag
+	if tmpl.Prompts.HasSystemPrompts() {
+		systemPrompts := append([]string(nil), tmpl.Prompts.System...)
+		if agentSystemPrompt != "" {
+			systemPrompts = append(systemPrompts, agentSystemPrompt)
+		}
+		agentSystemPrompt = strings.Join(systemPrompts, "\n")
+	}
+}
+
+// templatesCommand is the parent command for template subcommands
+var templatesCommand = &cobra.Command{
+	Use:   "templates",
+	Short: "Manage prompt templates",
+	Long: `
+The templates command provides subcommands to manage the prompt templates run
+with 'don run'.
+
+Available subcommands:
+- list: List the templates with their variables
+`,
+}
+
+// templatesListCommand lists the prompt templates
+var templatesListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List the prompt templates",
+	Long: `
+Lists the prompt templates of the configuration file (agent.templates) and of
+~/.don/templates/, with their variables and what they run with. Invalid
+templates are listed with their error.
+
+Examples:
+$ don templates list
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := agent.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		templates, err := config.GetTemplates()
+		if err != nil {
+			return err
+		}
+		if len(templates) == 0 {
+			fmt.Println("No templates defined.")
+			fmt.Println("Add them in agent.templates of the configuration file, or as files in ~/.don/templates/.")
+			return nil
+		}
+
+		for i, tmpl := range templates {
+			if i > 0 {
+				fmt.Println()
+			}
+			if tmpl.Err != nil {
+				fmt.Printf("%s %s\n", color.HiYellowString(tmpl.Name), color.HiRedString("(invalid)"))
+				fmt.Printf("  %s\n", color.HiRedString(tmpl.Err.Error()))
+				continue
+			}
+			fmt.Println(color.HiYellowString(tmpl.Name))
+			if tmpl.Description != "" {
+				fmt.Printf("  %s\n", tmpl.Description)
+			}
+			for _, variable := range tmpl.Variables {
+				value := "required"
+				if !variable.Required() {
+					value = fmt.Sprintf("default: %q", *variable.Default)
+				}
+				fmt.Printf("  - %s (%s)", color.HiCyanString(variable.Name), value)
+				if variable.Description != "" {
+					fmt.Printf(": %s", variable.Description)
+				}
+				fmt.Println()
+			}
+			var uses []string
+			if tmpl.Tools != "" {
+				uses = append(uses, "tools: "+tmpl.Tools)
+			}
+			if tmpl.Model != "" {
+				uses = append(uses, "model: "+tmpl.Model)
+			}
+			if len(tmpl.RAG) > 0 {
+				uses = append(uses, "rag: "+strings.Join(tmpl.RAG, ", "))
+			}
+			if len(uses) > 0 {
+				fmt.Printf("  %s\n", strings.Join(uses, "; "))
+			}
+			fmt.Printf("  %s\n", color.HiBlackString(tmpl.Source))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runTemplateCommand)
+	rootCmd.AddCommand(templatesCommand)
+	templatesCommand.AddCommand(templatesListCommand)
+
+	runTemplateCommand.Flags().StringArrayVar(&runVars, "var", []string{}, "Value of a variable of the template, as name=value (repeatable)")
+}
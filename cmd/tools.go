@@ -0,0 +1,218 @@
+package root
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/spf13/cobra"
+
+	"github.com/inercia/don/pkg/agent"
+)
+
+var (
+	toolsJSON     bool
+	toolsCallArgs []string
+)
+
+// toolsCommand is the parent command for tool subcommands
+var toolsCommand = &cobra.Command{
+	Use:   "tools",
+	Short: "Inspect and run the tools of a tools file",
+	Long: `
+The tools command provides subcommands to inspect and run the tools of a tools
+file directly, without an LLM, through the same mcpshell MCP server the agent uses.
+
+Available subcommands:
+- list: List the tools with their descriptions and parameters
+- call: Run a tool once and print its response
+`,
+}
+
+// toolsListCommand lists the tools of a tools file
+var toolsListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List the tools of a tools file",
+	Long: `
+Starts mcpshell for the tools file, as the agent does, and lists the tools it
+serves with their descriptions and parameters. With --json, the JSON schemas of
+the parameters are included.
+
+Examples:
+$ don tools list --tools k8s.yaml
+$ don tools list -t k8s.yaml --json
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := initLogger()
+		if err != nil {
+			return err
+		}
+		toolsFile, binary, err := toolsCommandConfig()
+		if err != nil {
+			return err
+		}
+
+		info, err := agent.PreflightMCPShell(cmd.Context(), binary, toolsFile, logger)
+		if err != nil {
+			return err
+		}
+
+		if toolsJSON {
+			return printJSON(info)
+		}
+
+		fmt.Printf("%s (%s, mcpshell %s)\n\n", color.HiCyanString(toolsFile), info.Binary, info.Version)
+		for _, tool := range info.Tools {
+			fmt.Println(color.HiYellowString(tool.Name))
+			if tool.Description != "" {
+				fmt.Printf("  %s\n", tool.Description)
+			}
+			for _, param := range tool.Parameters {
+				required := ""
+				if param.Required {
+					required = ", required"
+				}
+				fmt.Printf("  - %s (%s%s)", param.Name, param.Type, required)
+				if param.Description != "" {
+					fmt.Printf(": %s", param.Description)
+				}
+				fmt.Println()
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+// toolsCallCommand runs a tool of a tools file
+var toolsCallCommand = &cobra.Command{
+	Use:   "call <name>",
+	Short: "Run a tool of a tools file",
+	Long: `
+Runs a tool once through mcpshell, as the agent would, and prints its raw
+response. Arguments are given as --arg name=value, and converted to the types
+of the parameters (arrays and objects are given as JSON). With --json, the MCP
+result of the call is printed.
+
+The command fails if the tool reports an error.
+
+Examples:
+$ don tools call --tools k8s.yaml get_pods --arg namespace=default
+$ don tools call -t disk.yaml disk_usage --arg path=/var --arg depth=2 --json
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := initLogger(); err != nil {
+			return err
+		}
+		toolsFile, binary, err := toolsCommandConfig()
+		if err != nil {
+			return err
+		}
+		path, err := agent.ResolveMCPShellBinary(binary)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		session, err := agent.ConnectMCPShell(ctx, path, toolsFile)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = session.Close() }()
+
+		tool, err := findTool(ctx, session, toolsFile, args[0])
+		if err != nil {
+			return err
+		}
+		arguments, err := tool.Arguments(toolsCallArgs)
+		if err != nil {
+			return err
+		}
+
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: tool.Name, Arguments: arguments})
+		if err != nil {
+			return fmt.Errorf("failed to call tool '%s': %w", tool.Name, err)
+		}
+
+		if toolsJSON {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		} else {
+			for _, content := range result.Content {
+				switch c := content.(type) {
+				case *mcp.TextContent:
+					fmt.Print(c.Text)
+					if !strings.HasSuffix(c.Text, "\n") {
+						fmt.Println()
+					}
+				default:
+					data, err := json.Marshal(content)
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(data))
+				}
+			}
+		}
+
+		if result.IsError {
+			return fmt.Errorf("tool '%s' failed", tool.Name)
+		}
+		return nil
+	},
+}
+
+// toolsCommandConfig returns the tools file and the mcpshell binary of the tools commands
+func toolsCommandConfig() (string, string, error) {
+	if len(toolsFiles) != 1 {
+		return "", "", fmt.Errorf("a tools file is required (use --tools flag once)")
+	}
+	config, err := agent.GetConfig()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load config: %w", err)
+	}
+	return toolsFiles[0], mcpshellBinary(config), nil
+}
+
+// findTool returns a tool served by mcpshell
+func findTool(ctx context.Context, session *mcp.ClientSession, toolsFile, name string) (agent.MCPShellTool, error) {
+	tools, err := agent.ListMCPShellTools(ctx, session)
+	if err != nil {
+		return agent.MCPShellTool{}, err
+	}
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Name == name {
+			return tool, nil
+		}
+		names = append(names, tool.Name)
+	}
+	return agent.MCPShellTool{}, fmt.Errorf("tool '%s' not found in %s (tools: %s)", name, toolsFile, strings.Join(names, ", "))
+}
+
+// printJSON prints a value as indented JSON
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func init() {
+	rootCmd.AddCommand(toolsCommand)
+	toolsCommand.AddCommand(toolsListCommand)
+	toolsCommand.AddCommand(toolsCallCommand)
+
+	toolsCommand.PersistentFlags().BoolVar(&toolsJSON, "json", false, "Output in JSON format")
+	toolsCallCommand.Flags().StringArrayVar(&toolsCallArgs, "arg", nil, "Argument of the tool, as name=value (repeatable)")
+}
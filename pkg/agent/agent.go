@@ -7,12 +7,14 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/docker/cagent/pkg/runtime"
 	"github.com/fatih/color"
 	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
 )
 
 // AgentConfig holds the configuration for the agent including tools file location,
@@ -28,12 +30,23 @@ type AgentConfig struct {
 	// RAG configuration
 	RAGSources []string                   // Names of RAG sources to use (from config file)
 	RAGConfig  map[string]RAGSourceConfig // RAG source definitions (from config file)
+	RAGOptions RAGProcessOptions          // HTTP and cache settings for RAG sources (from config file)
+	RAGWatch   bool                       // Refresh RAG sources when their local documents change (interactive mode)
+	RAGDocs    []string                   // Documents searched by an ad-hoc RAG source, for this run only
+
+	// Recording of the LLM exchanges and tool calls of the run (JSONL files)
+	Record string // Record the run in this file
+	Replay string // Serve the LLM responses from this recording, instead of the real APIs
+
+	// AutoApprove approves tool calls without asking (RunEvents only: Run always approves them)
+	AutoApprove bool
 }
 
 // Agent represents an MCP agent
 type Agent struct {
-	config AgentConfig
-	logger *common.Logger
+	config    AgentConfig
+	logger    *common.Logger
+	citations *ragCitations // Sources of the RAG answers (nil without RAG sources)
 }
 
 // New creates a new agent instance
@@ -61,17 +74,41 @@ func (a *Agent) Validate() error {
 	return nil
 }
 
-// Run executes the agent using cagent multi-agent framework
+// Run executes the agent using cagent multi-agent framework, writing its output
+// as text for a terminal. Tool calls are approved automatically.
 func (a *Agent) Run(ctx context.Context, userInput chan string, agentOutput chan string) error {
 	// Setup panic handler
 	defer common.RecoverPanic()
 	defer close(agentOutput) // Ensure agentOutput is closed when Run exits
 
+	return a.run(ctx, userInput, &textOutput{agent: a, out: agentOutput})
+}
+
+// RunEvents executes the agent like Run, sending its output as structured events.
+// Tool calls needing a confirmation wait for an answer in approvals, unless
+// AutoApprove is set, and are rejected when approvals is nil. The last event is always EventDone, and events is closed
+// when the run ends.
+func (a *Agent) RunEvents(ctx context.Context, userInput <-chan string, events chan<- Event, approvals <-chan ToolApproval) (err error) {
+	defer common.RecoverPanic()
+	defer close(events)
+	defer func() {
+		done := Event{Type: EventDone}
+		if err != nil {
+			done.Content = err.Error()
+		}
+		events <- done
+	}()
+
+	return a.run(ctx, userInput, &eventOutput{agent: a, events: events, approvals: approvals})
+}
+
+// run executes the agent, sending its output to out
+func (a *Agent) run(ctx context.Context, userInput <-chan string, out runOutput) (err error) {
 	// Load agent configuration to get orchestrator and tool-runner models
 	config, err := GetConfig()
 	if err != nil {
 		a.logger.Error("Failed to load agent config: %v", err)
-		agentOutput <- fmt.Sprintf("Error: Failed to load agent config: %v", err)
+		out.errorf("Failed to load agent config: %v", err)
 		return fmt.Errorf("failed to load agent config: %w", err)
 	}
 
@@ -91,18 +128,77 @@ func (a *Agent) Run(ctx context.Context, userInput chan string, agentOutput chan
 	a.logger.Info("Orchestrator model: %s (%s)", orchestratorConfig.Model, orchestratorConfig.Class)
 	a.logger.Info("Tool-runner model: %s (%s)", toolRunnerConfig.Model, toolRunnerConfig.Class)
 
+	// Add an ad-hoc RAG source for the documents given on the command line
+	if len(a.config.RAGDocs) > 0 {
+		if _, exists := a.config.RAGConfig[AdHocRAGSourceName]; exists {
+			err := fmt.Errorf("RAG source '%s' is reserved for --rag-docs", AdHocRAGSourceName)
+			out.errorf("%v", err)
+			return err
+		}
+		source, cleanup, err := NewAdHocRAGSource(a.config.RAGDocs, a.logger)
+		if err != nil {
+			out.errorf("%v", err)
+			return err
+		}
+		defer cleanup()
+
+		ragConfig := make(map[string]RAGSourceConfig, len(a.config.RAGConfig)+1)
+		for name, source := range a.config.RAGConfig {
+			ragConfig[name] = source
+		}
+		ragConfig[AdHocRAGSourceName] = source
+		a.config.RAGConfig = ragConfig
+		a.config.RAGSources = append(append([]string(nil), a.config.RAGSources...), AdHocRAGSourceName)
+		a.logger.Info("Enabled RAG source '%s' with %d documents", AdHocRAGSourceName, len(a.config.RAGDocs))
+	}
+
 	// Process RAG sources if configured
 	if len(a.config.RAGConfig) > 0 {
+		// Check the embedding models before downloading and indexing anything
+		resolvedRAGConfig, err := ResolveEmbeddingModels(config, a.config.RAGConfig, a.logger)
+		if err != nil {
+			a.logger.Error("Invalid RAG embedding model: %v", err)
+			out.errorf("%v", err)
+			return err
+		}
+		a.config.RAGConfig = resolvedRAGConfig
+
 		a.logger.Info("Processing RAG sources...")
-		processedRAGConfig, err := ProcessRAGSources(ctx, a.config.RAGConfig, a.logger)
+		processedRAGConfig, err := ProcessRAGSources(ctx, a.config.RAGConfig, a.config.RAGOptions, a.logger)
 		if err != nil {
 			a.logger.Error("Failed to process RAG sources: %v", err)
-			agentOutput <- fmt.Sprintf("Error: Failed to process RAG sources: %v", err)
+			out.errorf("Failed to process RAG sources: %v", err)
 			return fmt.Errorf("failed to process RAG sources: %w", err)
 		}
 		// Update config with processed RAG sources
 		config.Agent.RAG = processedRAGConfig
 		a.logger.Info("RAG sources processed successfully")
+
+		// Collect the documents returned by the RAG tools, for citing them
+		if cacheDir, err := rag.GetCacheDir(); err != nil {
+			a.logger.Warn("Failed to get RAG cache directory, sources will not be cited: %v", err)
+		} else {
+			names := make([]string, 0, len(processedRAGConfig))
+			for name := range processedRAGConfig {
+				names = append(names, name)
+			}
+			a.citations = newRAGCitations(names, rag.NewSourceResolver(cacheDir))
+		}
+	}
+
+	// Watch the local documents of the RAG sources in interactive sessions
+	var ragRefreshes <-chan *RAGRefresh
+	if a.config.RAGWatch && !a.config.Once && len(a.config.RAGConfig) > 0 {
+		watcher, err := NewRAGWatcher(a.config.RAGConfig, a.config.RAGOptions, a.logger)
+		if err != nil {
+			a.logger.Warn("Failed to watch RAG sources: %v", err)
+		} else if watcher == nil {
+			a.logger.Warn("RAG sources have no local documents to watch")
+		} else {
+			defer watcher.Close()
+			go watcher.Run(ctx)
+			ragRefreshes = watcher.Refreshes()
+		}
 	}
 
 	// Create a single-run context if in --once mode
@@ -118,11 +214,13 @@ func (a *Agent) Run(ctx context.Context, userInput chan string, agentOutput chan
 
 	// Build a complete config for cagent runtime
 	// This includes the file-based config merged with command-line overrides
+	// Models are copied, as they can be routed to local APIs (mock models, recordings)
 	runtimeConfig := &Config{
 		Agent: AgentConfigFile{
-			Models:       config.Agent.Models,
+			Models:       append([]ModelConfig(nil), config.Agent.Models...),
 			Orchestrator: &orchestratorConfig,
 			ToolRunner:   &toolRunnerConfig,
+			Toolsets:     config.Agent.Toolsets,
 			RAG:          config.Agent.RAG,
 		},
 	}
@@ -132,13 +230,41 @@ func (a *Agent) Run(ctx context.Context, userInput chan string, agentOutput chan
 	runtimeConfig.RAGSources = a.config.RAGSources
 	runtimeConfig.MCPShellBinary = a.config.MCPShellBinary
 
+	// Serve the mock models from their scripts
+	mocks, err := a.startMockModels(runtimeConfig)
+	if err != nil {
+		out.errorf("%v", err)
+		return err
+	}
+	if mocks != nil {
+		defer func() {
+			if closeErr := mocks.close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	// Record or replay the LLM exchanges and tool calls of the run
+	recording, err := a.startRecording(runtimeConfig)
+	if err != nil {
+		out.errorf("%v", err)
+		return err
+	}
+	if recording != nil {
+		defer func() {
+			if closeErr := recording.close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
 	// Create cagent runtime using teamloader
 	// Note: srv is still needed for the server lifecycle, but CreateCagentRuntime
 	// will start mcpshell as a subprocess for MCP tools
 	cagentRT, err := CreateCagentRuntime(ctx, runtimeConfig, a.config.UserPrompt, a.logger)
 	if err != nil {
 		a.logger.Error("Failed to create cagent runtime: %v", err)
-		agentOutput <- fmt.Sprintf("Error: Failed to create cagent runtime: %v", err)
+		out.errorf("Failed to create cagent runtime: %v", err)
 		return fmt.Errorf("failed to create cagent runtime: %w", err)
 	}
 
@@ -154,16 +280,16 @@ func (a *Agent) Run(ctx context.Context, userInput chan string, agentOutput chan
 			eventCount++
 			a.logger.Debug("Received event #%d: %T", eventCount, event)
 
-			// Handle tool call confirmations - auto-approve tools
-			if _, ok := event.(*runtime.ToolCallConfirmationEvent); ok {
-				a.logger.Debug("Auto-approving tool execution")
-				cagentRT.Runtime().Resume(ctx, "approve-session")
+			// Handle tool call confirmations
+			if confirmation, ok := event.(*runtime.ToolCallConfirmationEvent); ok {
+				approval := out.confirm(ctx, confirmation)
+				cagentRT.Runtime().Resume(ctx, runtime.ResumeType(approval))
 			}
 
-			if err := a.handleCagentEvent(event, agentOutput); err != nil {
-				a.logger.Error("Error handling event: %v", err)
-				// Continue processing other events
+			if recording != nil {
+				recording.handle(event)
 			}
+			out.handle(event)
 		}
 		a.logger.Debug("Event stream completed, processed %d events", eventCount)
 
@@ -175,38 +301,132 @@ func (a *Agent) Run(ctx context.Context, userInput chan string, agentOutput chan
 
 		// In interactive mode, wait for user input to continue
 		a.logger.Debug("Waiting for user input to continue conversation...")
-		promptColor := color.New(color.Bold, color.FgHiCyan)
-		agentOutput <- fmt.Sprintf("\n%s", promptColor.Sprint("💬 Enter your next question (or Ctrl+C to exit): "))
+		out.waitingInput()
 
+		if err := a.waitForInput(ctx, cagentRT, runtimeConfig, userInput, ragRefreshes, out); err != nil {
+			if errors.Is(err, errStopConversation) {
+				return nil
+			}
+			return err
+		}
+		// Loop will continue with the updated session
+	}
+}
+
+// errStopConversation is returned by waitForInput when the user ends the conversation
+var errStopConversation = errors.New("conversation ended")
+
+// waitForInput waits for the next user message and adds it to the session
+// RAG sources refreshed in the meantime are announced as they are re-indexed,
+// and the runtime is reloaded with them when the next message arrives, before
+// the conversation continues
+func (a *Agent) waitForInput(
+	ctx context.Context,
+	cagentRT *CagentRuntime,
+	runtimeConfig *Config,
+	userInput <-chan string,
+	ragRefreshes <-chan *RAGRefresh,
+	out runOutput,
+) error {
+	reloadRAG := false
+	for {
 		select {
 		case <-ctx.Done():
 			a.logger.Info("Context cancelled, exiting")
 			return ctx.Err()
+
+		case refresh := <-ragRefreshes:
+			for name, source := range refresh.Sources {
+				runtimeConfig.Agent.RAG[name] = source
+			}
+			reloadRAG = true
+			out.notice(refresh.String())
+
 		case nextInput, ok := <-userInput:
 			if !ok {
 				a.logger.Info("User input channel closed, exiting")
-				return nil
+				return errStopConversation
 			}
 			if nextInput == "" {
 				a.logger.Info("Empty input received, exiting")
-				return nil
+				return errStopConversation
+			}
+
+			if reloadRAG {
+				if err := cagentRT.Reload(ctx, runtimeConfig); err != nil {
+					a.logger.Error("Failed to reload runtime with refreshed RAG sources: %v", err)
+					out.errorf("%v\n", err)
+				}
 			}
 
 			// Add the new user message to the session to continue the conversation
 			a.logger.Debug("Received user input: %s", nextInput)
 			if err := cagentRT.ContinueConversation(nextInput); err != nil {
 				a.logger.Error("Failed to continue conversation: %v", err)
-				agentOutput <- fmt.Sprintf("Error: %v\n", err)
+				out.errorf("%v\n", err)
 				return fmt.Errorf("failed to continue conversation: %w", err)
 			}
-			// Loop will continue with the updated session
+			return nil
+		}
+	}
+}
+
+// textOutput writes the output of a run as colored text for a terminal
+type textOutput struct {
+	agent *Agent
+	out   chan string
+}
+
+func (o *textOutput) handle(event interface{}) {
+	if err := o.agent.handleCagentEvent(event, o.out); err != nil {
+		o.agent.logger.Error("Error handling event: %v", err)
+		// Continue processing other events
+	}
+}
+
+func (o *textOutput) errorf(format string, args ...interface{}) {
+	o.out <- "Error: " + fmt.Sprintf(format, args...)
+}
+
+func (o *textOutput) notice(message string) {
+	o.out <- fmt.Sprintf("\n%s\n", color.New(color.FgMagenta).Sprintf("🔄 %s", message))
+}
+
+func (o *textOutput) waitingInput() {
+	promptColor := color.New(color.Bold, color.FgHiCyan)
+	o.out <- fmt.Sprintf("\n%s", promptColor.Sprint("💬 Enter your next question (or Ctrl+C to exit): "))
+}
+
+func (o *textOutput) confirm(context.Context, *runtime.ToolCallConfirmationEvent) ToolApproval {
+	o.agent.logger.Debug("Auto-approving tool execution")
+	return ToolApproveSession
+}
+
+// citeSources records the answer and the results of the RAG tools found in an
+// event, and returns the sources of the answer when the root agent finishes
+func (a *Agent) citeSources(event interface{}) string {
+	if a.citations == nil {
+		return ""
+	}
+	switch e := event.(type) {
+	case *runtime.AgentChoiceEvent:
+		a.citations.addAnswer(e.Content)
+	case *runtime.ToolCallResponseEvent:
+		a.citations.add(e.ToolCall.Function.Name, e.Response)
+	case *runtime.StreamStoppedEvent:
+		if e.AgentName == "root" {
+			footer := a.citations.footer()
+			a.citations.reset()
+			return footer
 		}
 	}
+	return ""
 }
 
 // handleCagentEvent processes a single cagent event and sends appropriate output
 func (a *Agent) handleCagentEvent(event interface{}, agentOutput chan string) error {
 	a.logger.Debug("Handling event type: %T", event)
+	footer := a.citeSources(event)
 
 	// Define color schemes for different outputs
 	cyan := color.New(color.FgCyan)
@@ -265,6 +485,10 @@ func (a *Agent) handleCagentEvent(event interface{}, agentOutput chan string) er
 	case *runtime.StreamStoppedEvent:
 		// Agent finished processing - use magenta for agent status
 		// Add newlines before the completion message to ensure separation from streamed text
+		// The answer of the root agent is followed by the sources it used
+		if footer != "" {
+			agentOutput <- fmt.Sprintf("\n\n%s", cyan.Sprint(footer))
+		}
 		agentOutput <- fmt.Sprintf("\n\n%s\n\n", magenta.Sprintf("[%s completed]", e.AgentName))
 		a.logger.Debug("Agent %s stream stopped", e.AgentName)
 
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	cagentConfig "github.com/docker/cagent/pkg/config"
+	cagentPaths "github.com/docker/cagent/pkg/paths"
 	"github.com/docker/cagent/pkg/runtime"
 	"github.com/docker/cagent/pkg/session"
+	"github.com/docker/cagent/pkg/team"
 	"github.com/docker/cagent/pkg/teamloader"
 
 	"github.com/inercia/don/pkg/common"
@@ -23,6 +26,7 @@ var defaultOrchestratorPrompt string
 // CagentRuntime wraps the cagent runtime and session
 type CagentRuntime struct {
 	runtime runtime.Runtime
+	team    *team.Team
 	session *session.Session
 	logger  *common.Logger
 }
@@ -43,26 +47,71 @@ func CreateCagentRuntime(
 		return nil, fmt.Errorf("failed to setup environment: %w", err)
 	}
 
+	agentTeam, rt, err := loadCagentRuntime(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the session with the user prompt
+	// Enhance prompt to emphasize iterative workflow
+	enhancedPrompt := userPrompt + `
+
+Remember: This is a multi-step investigation. Keep calling tools iteratively until you have ALL the information needed to fully answer the question. Don't stop after just one tool call.`
+
+	// The session gets a title, as cagent would otherwise ask the model for one in
+	// the background: an LLM request Don never shows, and that makes runs non-deterministic
+	sess := session.New(session.WithUserMessage(enhancedPrompt), session.WithTitle(sessionTitle(userPrompt)))
+
+	logger.Debug("Cagent runtime created successfully")
+
+	return &CagentRuntime{
+		runtime: rt,
+		team:    agentTeam,
+		session: sess,
+		logger:  logger,
+	}, nil
+}
+
+// sessionTitle returns the title of a session: the first line of its prompt, shortened
+func sessionTitle(prompt string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	if runes := []rune(title); len(runes) > 50 {
+		title = string(runes[:50]) + "…"
+	}
+	return title
+}
+
+// loadCagentRuntime generates the cagent configuration, loads the team and creates its runtime
+func loadCagentRuntime(ctx context.Context, cfg *Config, logger *common.Logger) (*team.Team, runtime.Runtime, error) {
 	// Generate cagent-compatible YAML configuration
 	yamlBytes, err := GenerateCagentYAML(cfg, cfg.ToolsFile, cfg.RAGSources, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate cagent config: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate cagent config: %w", err)
 	}
 
-	logger.Debug("Generated cagent config YAML:\n%s", string(yamlBytes))
+	logger.Debug("Generated cagent config YAML:\n%s", redactCagentYAML(yamlBytes))
 
 	// Write config to a temporary file
 	// teamloader.Load requires a file path, not bytes
 	donHome, err := utils.GetDonHome()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get Don home: %w", err)
+		return nil, nil, fmt.Errorf("failed to get Don home: %w", err)
 	}
 
-	tempConfigPath := filepath.Join(donHome, ".cagent-runtime.yaml")
-	if err := os.WriteFile(tempConfigPath, yamlBytes, 0600); err != nil {
-		return nil, fmt.Errorf("failed to write temp config: %w", err)
+	// Each runtime gets its own file, as several runs can be loaded at the same time (don serve)
+	tempConfig, err := os.CreateTemp(donHome, ".cagent-runtime-*.yaml")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp config: %w", err)
 	}
+	tempConfigPath := tempConfig.Name()
 	defer os.Remove(tempConfigPath) // Clean up temp file
+	_, err = tempConfig.Write(yamlBytes)
+	if closeErr := tempConfig.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write temp config: %w", err)
+	}
 
 	logger.Debug("Wrote temp config to: %s", tempConfigPath)
 
@@ -74,11 +123,16 @@ func CreateCagentRuntime(
 	agentTeam, err := teamloader.Load(ctx, cagentConfig.NewFileSource(tempConfigPath), &runtimeConfig)
 	if err != nil {
 		logger.Error("Failed to load team: %v", err)
-		return nil, fmt.Errorf("failed to load team: %w", err)
+		return nil, nil, fmt.Errorf("failed to load team: %w", err)
 	}
 
 	logger.Debug("Team loaded successfully")
 
+	// Let the model filter the results of sources with document metadata
+	if err := addRAGFilters(ctx, agentTeam, cfg.Agent.RAG, logger); err != nil {
+		return nil, nil, fmt.Errorf("failed to add RAG filters: %w", err)
+	}
+
 	// Create the runtime with session compaction enabled
 	rt, err := runtime.New(
 		agentTeam,
@@ -86,24 +140,27 @@ func CreateCagentRuntime(
 	)
 	if err != nil {
 		logger.Error("Failed to create cagent runtime: %v", err)
-		return nil, fmt.Errorf("failed to create cagent runtime: %w", err)
+		return nil, nil, fmt.Errorf("failed to create cagent runtime: %w", err)
 	}
 
-	// Create the session with the user prompt
-	// Enhance prompt to emphasize iterative workflow
-	enhancedPrompt := userPrompt + `
-
-Remember: This is a multi-step investigation. Keep calling tools iteratively until you have ALL the information needed to fully answer the question. Don't stop after just one tool call.`
-
-	sess := session.New(session.WithUserMessage(enhancedPrompt))
+	return agentTeam, rt, nil
+}
 
-	logger.Debug("Cagent runtime created successfully")
+// Reload loads the team again from an updated configuration (e.g. after RAG sources
+// were refreshed), keeping the conversation. The previous team is stopped.
+func (cr *CagentRuntime) Reload(ctx context.Context, cfg *Config) error {
+	cr.logger.Debug("Reloading cagent runtime")
+	agentTeam, rt, err := loadCagentRuntime(ctx, cfg, cr.logger)
+	if err != nil {
+		return err
+	}
 
-	return &CagentRuntime{
-		runtime: rt,
-		session: sess,
-		logger:  logger,
-	}, nil
+	if err := cr.team.StopToolSets(ctx); err != nil {
+		cr.logger.Warn("Failed to stop previous team: %v", err)
+	}
+	cr.team = agentTeam
+	cr.runtime = rt
+	return nil
 }
 
 // RunStream starts the streaming runtime and returns the event channel
@@ -177,3 +234,47 @@ func getAPIKeyEnvVar(provider string) string {
 		return "OPENAI_API_KEY" // Default to OpenAI
 	}
 }
+
+// ragDatabasePath returns the path of the cagent database of a RAG strategy, resolved
+// as cagent does (relative paths are relative to the generated config in Don home)
+// Returns false for databases that are not local files (connection strings)
+func ragDatabasePath(sourceName string, strategy RAGStrategyConfig) (string, bool, error) {
+	if strategy.Database == "" {
+		name := fmt.Sprintf("rag_%s_%s.db", sourceName, strings.ReplaceAll(strategy.Type, "-", "_"))
+		return filepath.Join(cagentPaths.GetDataDir(), name), true, nil
+	}
+	if strings.Contains(strategy.Database, "://") {
+		return "", false, nil
+	}
+	if filepath.IsAbs(strategy.Database) {
+		return strategy.Database, true, nil
+	}
+	donHome, err := utils.GetDonHome()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get Don home: %w", err)
+	}
+	return filepath.Join(donHome, strategy.Database), true, nil
+}
+
+// removeRAGDatabases removes the cagent databases of the strategies of a RAG source,
+// so cagent indexes all its documents again
+func removeRAGDatabases(sourceName string, strategies []RAGStrategyConfig, logger *common.Logger) error {
+	for _, strategy := range strategies {
+		dbPath, ok, err := ragDatabasePath(sourceName, strategy)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			logger.Warn("Cannot reset database '%s' of RAG source '%s': not a local file", strategy.Database, sourceName)
+			continue
+		}
+		// SQLite keeps write-ahead log and shared memory files next to the database
+		for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove RAG database %s: %w", path, err)
+			}
+		}
+		logger.Debug("Removed RAG database %s", dbPath)
+	}
+	return nil
+}
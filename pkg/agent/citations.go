@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/inercia/don/pkg/rag"
+)
+
+// ragCitationInstruction asks the model to cite the documents returned by RAG tools
+const ragCitationInstruction = "When your answer uses information from the results of this tool, " +
+	"cite the documents it comes from by their source_path, in square brackets."
+
+// ragToolResult is a result of a cagent RAG tool, as returned to the model
+type ragToolResult struct {
+	SourcePath string `json:"source_path"`
+	Content    string `json:"content"`
+	ChunkIndex int    `json:"chunk_index"`
+}
+
+// ragCitation is a document chunk returned by a RAG tool during a turn
+type ragCitation struct {
+	Path  string // Path of the document, as seen by the model
+	Chunk rag.Chunk
+}
+
+// ragCitations collects the chunks returned by RAG tools during a turn, so the
+// answer can be followed by the list of its sources with their original locations
+type ragCitations struct {
+	tools     map[string]bool // Names of the RAG tools
+	resolver  *rag.SourceResolver
+	citations []ragCitation
+	seen      map[string]bool
+	documents map[string]string // Contents of the documents read to locate chunks
+	answer    strings.Builder   // Text of the answer, to find the cited documents
+}
+
+// newRAGCitations creates a collector for the results of the RAG tools of some sources
+func newRAGCitations(sourceNames []string, resolver *rag.SourceResolver) *ragCitations {
+	c := &ragCitations{
+		tools:    make(map[string]bool, len(sourceNames)),
+		resolver: resolver,
+	}
+	for _, name := range sourceNames {
+		c.tools[name] = true
+	}
+	c.reset()
+	return c
+}
+
+// reset forgets the chunks of the previous turn
+func (c *ragCitations) reset() {
+	c.citations = nil
+	c.seen = make(map[string]bool)
+	c.documents = make(map[string]string)
+	c.answer.Reset()
+}
+
+// addAnswer records a piece of the answer of the model
+func (c *ragCitations) addAnswer(text string) {
+	c.answer.WriteString(text)
+}
+
+// add records the chunks in the response of a tool, if it is a RAG tool
+func (c *ragCitations) add(toolName, response string) {
+	if !c.tools[toolName] {
+		return
+	}
+	var results []ragToolResult
+	if err := json.Unmarshal([]byte(response), &results); err != nil {
+		return
+	}
+	for _, result := range results {
+		id := fmt.Sprintf("%s#%d", result.SourcePath, result.ChunkIndex)
+		if result.SourcePath == "" || c.seen[id] {
+			continue
+		}
+		c.seen[id] = true
+
+		chunk := rag.Chunk{
+			Path:   result.SourcePath,
+			Source: c.resolver.Resolve(result.SourcePath),
+			Index:  result.ChunkIndex,
+			Text:   result.Content,
+		}
+		chunk.StartLine, chunk.EndLine, _ = rag.FindLines(c.document(result.SourcePath), result.Content)
+		c.citations = append(c.citations, ragCitation{Path: result.SourcePath, Chunk: chunk})
+	}
+}
+
+// document returns the contents of a document (empty if it cannot be read)
+func (c *ragCitations) document(path string) string {
+	text, ok := c.documents[path]
+	if !ok {
+		if data, err := os.ReadFile(path); err == nil {
+			text = string(data)
+		}
+		c.documents[path] = text
+	}
+	return text
+}
+
+// footer returns the list of the sources of the turn (empty if there are none)
+// Only the documents cited in the answer are listed, or all the documents
+// returned by RAG tools if the answer cites none of them. Cached documents are
+// listed with their original location and their cache path, which is the
+// source_path the model cites.
+func (c *ragCitations) footer() string {
+	answer := c.answer.String()
+	var cited []ragCitation
+	for _, citation := range c.citations {
+		if strings.Contains(answer, citation.Path) {
+			cited = append(cited, citation)
+		}
+	}
+	if len(cited) == 0 {
+		cited = c.citations
+	}
+	if len(cited) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Sources:\n")
+	for i, citation := range cited {
+		location := citation.Chunk.Source
+		if citation.Chunk.StartLine > 0 {
+			location = citation.Chunk.Location()
+		}
+		fmt.Fprintf(&b, "  [%d] %s", i+1, location)
+		if citation.Chunk.Source != citation.Path {
+			fmt.Fprintf(&b, " (%s)", citation.Path)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inercia/don/pkg/rag"
+)
+
+func TestRAGCitations(t *testing.T) {
+	cacheDir := t.TempDir()
+	content := "# Install\n\nRun the installer.\nThen restart.\n"
+	hash := rag.ComputeContentHash([]byte(content))
+	blobPath := rag.GetBlobPath(cacheDir, hash)
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		t.Fatalf("failed to create blobs directory: %v", err)
+	}
+	if err := os.WriteFile(blobPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write blob: %v", err)
+	}
+	url := "https://example.com/install.html"
+	if err := rag.SaveMetadata(rag.GetCachedMetadataPath(cacheDir, url), &rag.CacheMetadata{URL: url, ContentHash: hash}); err != nil {
+		t.Fatalf("SaveMetadata() error = %v", err)
+	}
+	localPath := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(localPath, []byte("notes"), 0644); err != nil {
+		t.Fatalf("failed to write document: %v", err)
+	}
+
+	response, err := json.Marshal([]ragToolResult{
+		{SourcePath: blobPath, Content: "Run the installer.\nThen restart.", ChunkIndex: 1},
+		{SourcePath: localPath, Content: "notes", ChunkIndex: 0},
+		{SourcePath: blobPath, Content: "Run the installer.\nThen restart.", ChunkIndex: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal results: %v", err)
+	}
+
+	citations := newRAGCitations([]string{"docs"}, rag.NewSourceResolver(cacheDir))
+	citations.add("shell_exec", string(response))
+	if footer := citations.footer(); footer != "" {
+		t.Errorf("footer() after a non-RAG tool = %q, want empty", footer)
+	}
+
+	// Without citations in the answer, all the returned documents are listed
+	citations.add("docs", string(response))
+	citations.add("docs", "not JSON")
+	want := "Sources:\n" +
+		"  [1] " + url + ":3-4 (" + blobPath + ")\n" +
+		"  [2] " + localPath + ":1-1\n"
+	if footer := citations.footer(); footer != want {
+		t.Errorf("footer() = %q, want %q", footer, want)
+	}
+
+	// Otherwise only the cited ones are
+	citations.addAnswer("Run the installer [" + blobPath + "].")
+	if footer := citations.footer(); strings.Contains(footer, localPath) || !strings.Contains(footer, url) {
+		t.Errorf("footer() = %q, want only %s", footer, url)
+	}
+
+	citations.reset()
+	if footer := citations.footer(); footer != "" {
+		t.Errorf("footer() after reset = %q, want empty", footer)
+	}
+}
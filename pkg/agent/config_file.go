@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
 	"github.com/inercia/don/pkg/utils"
 )
 
@@ -25,12 +29,19 @@ type ModelConfig struct {
 	APIKey  string               `yaml:"api-key,omitempty"` // API key, optional
 	APIURL  string               `yaml:"api-url,omitempty"` // API URL, optional
 	Prompts common.PromptsConfig `yaml:"prompts,omitempty"` // Prompts configuration, optional
+
+	// Embedding models
+	Type       string `yaml:"type,omitempty"`       // Type of the model: "chat" (default) or "embedding"
+	Dimensions int    `yaml:"dimensions,omitempty"` // Size of the vectors of an embedding model, optional
+
+	// Mock models
+	Script string `yaml:"script,omitempty"` // Script of the replies of a mock model (class: mock)
 }
 
 // RAGChunkingConfig holds chunking configuration for RAG strategies
 type RAGChunkingConfig struct {
 	Size                  int  `yaml:"size,omitempty"`
-	Overlap               int  `yaml:"overlap,omitempty"`
+	Overlap               *int `yaml:"overlap,omitempty"` // Unset takes the default, 0 for no overlap
 	RespectWordBoundaries bool `yaml:"respect_word_boundaries,omitempty"`
 }
 
@@ -50,29 +61,218 @@ type RAGResultsConfig struct {
 	ReturnFullContent bool             `yaml:"return_full_content,omitempty"` // Return full document content
 }
 
+// RAGCrawlConfig holds configuration for a bounded web crawl or sitemap expansion
+// It can be written as a plain URL or as a mapping with the crawl options
+type RAGCrawlConfig struct {
+	URL          string   `yaml:"url"`                     // Start URL (crawl) or sitemap.xml URL (sitemap)
+	MaxDepth     *int     `yaml:"max_depth,omitempty"`     // Maximum link depth followed, 0 for the start page only (crawl only, default: 2)
+	MaxPages     int      `yaml:"max_pages,omitempty"`     // Maximum number of pages downloaded (default: 50)
+	SameHost     *bool    `yaml:"same_host,omitempty"`     // Only follow URLs on the start host (default: true)
+	Include      []string `yaml:"include,omitempty"`       // Regexes a URL must match to be downloaded
+	Exclude      []string `yaml:"exclude,omitempty"`       // Regexes excluding URLs from being downloaded
+	IgnoreRobots bool     `yaml:"ignore_robots,omitempty"` // Do not respect robots.txt
+}
+
+// UnmarshalYAML allows a crawl configuration to be written as a plain URL
+func (c *RAGCrawlConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.URL = value.Value
+		return nil
+	}
+	type plain RAGCrawlConfig
+	return value.Decode((*plain)(c))
+}
+
+// RAGDocConfig holds a single entry of a RAG docs list
+// It can be written as a plain location (URL, git source, file or directory)
+// or as a mapping with a crawl or sitemap source, and metadata for its documents
+type RAGDocConfig struct {
+	Path    string          `yaml:"path,omitempty"`    // URL, git source, local file or directory
+	Crawl   *RAGCrawlConfig `yaml:"crawl,omitempty"`   // Bounded web crawl from a start URL
+	Sitemap *RAGCrawlConfig `yaml:"sitemap,omitempty"` // Pages listed in a sitemap.xml
+
+	// Metadata of the documents of the entry, used to filter search results
+	Description string            `yaml:"description,omitempty"` // Human-readable description
+	Tags        []string          `yaml:"tags,omitempty"`        // Tags (e.g. "prod"), filtered with "tag=<tag>"
+	Properties  map[string]string `yaml:"properties,omitempty"`  // Properties (e.g. service: payments), filtered with "<key>=<value>"
+}
+
+// UnmarshalYAML allows a docs entry to be written as a plain location
+func (d *RAGDocConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		d.Path = value.Value
+		return nil
+	}
+	type plain RAGDocConfig
+	if err := value.Decode((*plain)(d)); err != nil {
+		return err
+	}
+
+	sources := 0
+	for _, set := range []bool{d.Path != "", d.Crawl != nil, d.Sitemap != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("line %d: docs entry must have exactly one of path, crawl or sitemap", value.Line)
+	}
+	return nil
+}
+
+// MarshalYAML writes plain location entries back as strings
+func (d RAGDocConfig) MarshalYAML() (interface{}, error) {
+	if d.Crawl == nil && d.Sitemap == nil && d.metadata() == nil {
+		return d.Path, nil
+	}
+	type plain RAGDocConfig
+	return plain(d), nil
+}
+
+// metadata returns the metadata of the documents of the entry, or nil if it has none
+func (d RAGDocConfig) metadata() *rag.Metadata {
+	m := &rag.Metadata{Description: d.Description, Tags: d.Tags, Properties: d.Properties}
+	if m.IsEmpty() {
+		return nil
+	}
+	return m
+}
+
+// withMetadata returns a docs entry for a document with some metadata
+func withMetadata(path string, m *rag.Metadata) RAGDocConfig {
+	doc := RAGDocConfig{Path: path}
+	if m != nil {
+		doc.Description, doc.Tags, doc.Properties = m.Description, m.Tags, m.Properties
+	}
+	return doc
+}
+
+// String returns a human-readable description of the docs entry
+func (d RAGDocConfig) String() string {
+	switch {
+	case d.Crawl != nil:
+		return "crawl:" + d.Crawl.URL
+	case d.Sitemap != nil:
+		return "sitemap:" + d.Sitemap.URL
+	default:
+		return d.Path
+	}
+}
+
+// RAGDocPaths builds docs entries from plain locations
+func RAGDocPaths(paths ...string) []RAGDocConfig {
+	docs := make([]RAGDocConfig, len(paths))
+	for i, p := range paths {
+		docs[i] = RAGDocConfig{Path: p}
+	}
+	return docs
+}
+
+// RAGByteSize is a size in bytes that can be written as a number or with a unit ("512KB", "20MB")
+type RAGByteSize int64
+
+// UnmarshalYAML parses a byte size with an optional KB/MB/GB (or KiB/MiB/GiB) unit
+func (b *RAGByteSize) UnmarshalYAML(value *yaml.Node) error {
+	s := strings.ToUpper(strings.TrimSpace(value.Value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+		{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("line %d: invalid size %q", value.Line, value.Value)
+	}
+	*b = RAGByteSize(n * multiplier)
+	return nil
+}
+
+// RAGBasicAuthConfig holds basic auth credentials for fetching RAG documents
+type RAGBasicAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// RAGHTTPConfig holds HTTP settings for fetching RAG documents
+// String values can reference environment variables as ${VAR}
+type RAGHTTPConfig struct {
+	Match       string              `yaml:"match,omitempty"`        // Host, "*.domain", URL prefix or "*" (agent.rag_http only)
+	Headers     map[string]string   `yaml:"headers,omitempty"`      // Extra request headers
+	BearerToken string              `yaml:"bearer_token,omitempty"` // Bearer token for the Authorization header
+	BasicAuth   *RAGBasicAuthConfig `yaml:"basic_auth,omitempty"`   // Basic auth credentials
+	CAFile      string              `yaml:"ca_file,omitempty"`      // PEM bundle of additional trusted CAs
+	Proxy       string              `yaml:"proxy,omitempty"`        // Proxy URL (default: from the environment)
+	UserAgent   string              `yaml:"user_agent,omitempty"`   // User-Agent header
+	Timeout     time.Duration       `yaml:"timeout,omitempty"`      // Request timeout (e.g. "60s", default: 30s)
+	MaxSize     RAGByteSize         `yaml:"max_size,omitempty"`     // Maximum document size (e.g. "20MB", default: 10MB)
+}
+
+// RAGCacheConfig holds configuration for the RAG document cache
+type RAGCacheConfig struct {
+	MaxSize RAGByteSize `yaml:"max_size,omitempty"` // Maximum cache size (e.g. "2GB"), least recently used entries are evicted
+}
+
 // RAGStrategyConfig holds configuration for a single RAG retrieval strategy
 type RAGStrategyConfig struct {
 	Type     string            `yaml:"type"`               // Strategy type: "chunked-embeddings", "bm25"
-	Docs     []string          `yaml:"docs,omitempty"`     // Strategy-specific documents
+	Docs     []RAGDocConfig    `yaml:"docs,omitempty"`     // Strategy-specific documents
 	Database string            `yaml:"database,omitempty"` // Database path for this strategy
 	Chunking RAGChunkingConfig `yaml:"chunking,omitempty"` // Chunking configuration
 	Limit    int               `yaml:"limit,omitempty"`    // Max results from this strategy
 
 	// Strategy-specific parameters (e.g., model, threshold, vector_dimensions for chunked-embeddings)
-	Model            string  `yaml:"model,omitempty"`
-	Threshold        float64 `yaml:"threshold,omitempty"`
-	VectorDimensions int     `yaml:"vector_dimensions,omitempty"`
-	SimilarityMetric string  `yaml:"similarity_metric,omitempty"`
-	K1               float64 `yaml:"k1,omitempty"` // BM25 parameter
-	B                float64 `yaml:"b,omitempty"`  // BM25 parameter
+	Model            string   `yaml:"model,omitempty"`
+	Threshold        float64  `yaml:"threshold,omitempty"`
+	VectorDimensions int      `yaml:"vector_dimensions,omitempty"`
+	SimilarityMetric string   `yaml:"similarity_metric,omitempty"`
+	K1               float64  `yaml:"k1,omitempty"` // BM25 parameter
+	B                *float64 `yaml:"b,omitempty"`  // BM25 parameter, unset takes the default, 0 disables length normalization
 }
 
 // RAGSourceConfig holds configuration for a RAG knowledge source
 type RAGSourceConfig struct {
 	Description string              `yaml:"description"`
-	Docs        []string            `yaml:"docs,omitempty"`       // Shared documents across all strategies
+	Docs        []RAGDocConfig      `yaml:"docs,omitempty"`       // Shared documents across all strategies
 	Strategies  []RAGStrategyConfig `yaml:"strategies,omitempty"` // Array of strategy configurations
 	Results     *RAGResultsConfig   `yaml:"results,omitempty"`
+
+	// Extensions lists additional file extensions (e.g. ".j2", "tpl") treated as
+	// text when scanning directories, even if their content is not valid UTF-8
+	Extensions []string `yaml:"extensions,omitempty"`
+
+	// HTTP holds HTTP settings for the URLs of this source, taking
+	// precedence over the matching agent.rag_http entries
+	HTTP *RAGHTTPConfig `yaml:"http,omitempty"`
+
+	// ManifestPath is where the manifest of the source is kept, instead of the
+	// cache directory (e.g. for the sources of a single run)
+	ManifestPath string `yaml:"-"`
+}
+
+// ToolsetConfig holds an MCP server providing tools to the agents, either a
+// command (stdio) or a URL (streamable HTTP or SSE)
+// Env values, headers and URLs can reference environment variables as ${VAR}
+type ToolsetConfig struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	Command     string            `yaml:"command,omitempty"`   // Command running a stdio MCP server
+	Args        []string          `yaml:"args,omitempty"`      // Arguments of the command
+	Env         map[string]string `yaml:"env,omitempty"`       // Extra environment variables of the command
+	URL         string            `yaml:"url,omitempty"`       // URL of a remote MCP server
+	Transport   string            `yaml:"transport,omitempty"` // Transport of the URL: "streamable" (default) or "sse"
+	Headers     map[string]string `yaml:"headers,omitempty"`   // Extra request headers for the URL
+	Tools       []string          `yaml:"tools,omitempty"`     // Only expose these tools (default: all)
+	Agent       string            `yaml:"agent,omitempty"`     // Agent using the tools: "orchestrator" (default) or "tool-runner"
 }
 
 // AgentConfigFile holds the agent configuration from file
@@ -83,8 +283,19 @@ type AgentConfigFile struct {
 	Orchestrator *ModelConfig `yaml:"orchestrator,omitempty"` // Root agent that plans and orchestrates
 	ToolRunner   *ModelConfig `yaml:"tool-runner,omitempty"`  // Sub-agent that executes tools
 
+	// Path of the mcpshell binary (default: mcpshell in the PATH)
+	MCPShell string `yaml:"mcpshell,omitempty"`
+
+	// MCP servers providing tools in addition to mcpshell
+	Toolsets []ToolsetConfig `yaml:"toolsets,omitempty"`
+
 	// RAG configuration
-	RAG map[string]RAGSourceConfig `yaml:"rag,omitempty"` // Named RAG knowledge sources
+	RAG      map[string]RAGSourceConfig `yaml:"rag,omitempty"`       // Named RAG knowledge sources
+	RAGHTTP  []RAGHTTPConfig            `yaml:"rag_http,omitempty"`  // Per-host HTTP settings for RAG downloads
+	RAGCache *RAGCacheConfig            `yaml:"rag_cache,omitempty"` // RAG document cache settings
+
+	// Prompt templates, by name
+	Templates map[string]TemplateConfig `yaml:"templates,omitempty"`
 }
 
 // Config holds the complete agent configuration
@@ -95,6 +306,7 @@ type Config struct {
 	ToolsFile      string   // Path to tools configuration file
 	RAGSources     []string // Names of RAG sources to use
 	MCPShellBinary string   // Path to mcpshell binary (for spawning MCP server subprocess)
+	Path           string   // Path of the configuration file (empty if there is none)
 }
 
 // GetConfig returns the agent configuration from the config file
@@ -131,27 +343,43 @@ func GetConfig() (*Config, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file %s: %w", configPath, err)
 	}
+	config.Path = configPath
 
 	return &config, nil
 }
 
 // GetDefaultModel returns the model configuration that has default=true
 // If no default is found, returns the first model in the list
+// Embedding models are never the default
 // If no models are configured, returns nil
 func (c *Config) GetDefaultModel() *ModelConfig {
-	if len(c.Agent.Models) == 0 {
-		return nil
-	}
-
-	// Look for the default model
+	var first *ModelConfig
 	for i := range c.Agent.Models {
+		if c.Agent.Models[i].IsEmbedding() {
+			continue
+		}
+		// Look for the default model
 		if c.Agent.Models[i].Default {
 			return &c.Agent.Models[i]
 		}
+		if first == nil {
+			first = &c.Agent.Models[i]
+		}
 	}
 
 	// If no default found, return the first model
-	return &c.Agent.Models[0]
+	return first
+}
+
+// GetEmbeddingModels returns the embedding models (type: embedding)
+func (c *Config) GetEmbeddingModels() []ModelConfig {
+	var models []ModelConfig
+	for _, model := range c.Agent.Models {
+		if model.IsEmbedding() {
+			models = append(models, model)
+		}
+	}
+	return models
 }
 
 // GetModelByName returns the model configuration with the specified name
@@ -3,7 +3,10 @@ package agent
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/inercia/don/pkg/common"
 	"github.com/inercia/don/pkg/utils"
@@ -182,6 +185,36 @@ func TestPromptsConfig(t *testing.T) {
 	}
 }
 
+func TestPromptsConfigParsing(t *testing.T) {
+	tests := []struct {
+		name       string
+		yaml       string
+		wantSystem []string
+		wantUser   []string
+	}{
+		{name: "strings", yaml: "system: Be brief.\nuser: Check {{.cluster}}.\n", wantSystem: []string{"Be brief."}, wantUser: []string{"Check {{.cluster}}."}},
+		{name: "lists", yaml: "system:\n  - Be brief.\n  - Be precise.\n", wantSystem: []string{"Be brief.", "Be precise."}},
+		{name: "null", yaml: "system: ~\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prompts common.PromptsConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &prompts); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(prompts.System, tt.wantSystem) || !reflect.DeepEqual(prompts.User, tt.wantUser) {
+				t.Errorf("Unmarshal() = %+v, want system %v and user %v", prompts, tt.wantSystem, tt.wantUser)
+			}
+		})
+	}
+
+	var prompts common.PromptsConfig
+	if err := yaml.Unmarshal([]byte("system: {a: b}\n"), &prompts); err == nil {
+		t.Errorf("Unmarshal() of a mapping = %+v, want an error", prompts)
+	}
+}
+
 func TestGetOrchestratorAndToolRunnerModels(t *testing.T) {
 	// Test with role-based configuration
 	config := Config{
@@ -369,3 +402,185 @@ func TestGetConfigWithNonExistentEnvPath(t *testing.T) {
 		t.Errorf("Expected empty config, got %d models", len(config.Agent.Models))
 	}
 }
+
+func TestRAGCrawlConfigMaxDepth(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want int
+	}{
+		{name: "unset", yaml: "url: https://docs.example.com/\n", want: 2},
+		{name: "start page only", yaml: "url: https://docs.example.com/\nmax_depth: 0\n", want: 0},
+		{name: "set", yaml: "url: https://docs.example.com/\nmax_depth: 5\n", want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var crawl RAGCrawlConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &crawl); err != nil {
+				t.Fatalf("Failed to parse crawl config: %v", err)
+			}
+			if got := crawl.crawlConfig(2).MaxDepth; got != tt.want {
+				t.Errorf("crawlConfig().MaxDepth = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRAGDocsParsing(t *testing.T) {
+	configContent := `agent:
+  rag:
+    docs:
+      description: "Product docs"
+      docs:
+        - "./docs"
+        - "https://example.com/guide.md"
+        - crawl:
+            url: "https://docs.example.com/"
+            max_depth: 3
+            max_pages: 20
+            same_host: false
+            include: ["^https://docs\\.example\\.com/guide/"]
+            exclude: ["\\.pdf$"]
+        - sitemap: "https://docs.example.com/sitemap.xml"
+        - path: "./runbooks/prod"
+          tags: ["prod"]
+          properties:
+            service: payments
+`
+
+	var config Config
+	if err := yaml.Unmarshal([]byte(configContent), &config); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	docs := config.Agent.RAG["docs"].Docs
+	if len(docs) != 5 {
+		t.Fatalf("Expected 5 docs entries, got %d", len(docs))
+	}
+	if docs[0].Path != "./docs" || docs[1].Path != "https://example.com/guide.md" {
+		t.Errorf("Expected plain paths, got %q and %q", docs[0].Path, docs[1].Path)
+	}
+
+	crawl := docs[2].Crawl
+	if crawl == nil {
+		t.Fatal("Expected crawl entry, got nil")
+	}
+	if crawl.URL != "https://docs.example.com/" || crawl.MaxDepth == nil || *crawl.MaxDepth != 3 || crawl.MaxPages != 20 {
+		t.Errorf("Unexpected crawl config: %+v", crawl)
+	}
+	if crawl.SameHost == nil || *crawl.SameHost {
+		t.Error("Expected same_host to be false")
+	}
+	if len(crawl.Include) != 1 || len(crawl.Exclude) != 1 {
+		t.Errorf("Expected include and exclude patterns, got %v and %v", crawl.Include, crawl.Exclude)
+	}
+
+	if docs[3].Sitemap == nil || docs[3].Sitemap.URL != "https://docs.example.com/sitemap.xml" {
+		t.Errorf("Expected sitemap entry, got %+v", docs[3])
+	}
+
+	metadata := docs[4].metadata()
+	if metadata == nil || len(metadata.Tags) != 1 || metadata.Tags[0] != "prod" || metadata.Properties["service"] != "payments" {
+		t.Errorf("Expected tags and properties, got %+v", metadata)
+	}
+	if docs[0].metadata() != nil {
+		t.Errorf("Expected no metadata for a plain path, got %+v", docs[0].metadata())
+	}
+
+	// Plain paths are written back as strings for cagent
+	out, err := yaml.Marshal(RAGDocPaths("/tmp/a.txt"))
+	if err != nil {
+		t.Fatalf("Failed to marshal docs: %v", err)
+	}
+	if string(out) != "- /tmp/a.txt\n" {
+		t.Errorf("Expected docs to marshal as strings, got %q", string(out))
+	}
+
+	// An entry with several sources is rejected
+	invalid := `agent:
+  rag:
+    docs:
+      docs:
+        - path: "./docs"
+          sitemap: "https://docs.example.com/sitemap.xml"
+`
+	if err := yaml.Unmarshal([]byte(invalid), &config); err == nil {
+		t.Error("Expected error for docs entry with several sources")
+	}
+}
+
+func TestRAGHTTPParsing(t *testing.T) {
+	t.Setenv("TEST_WIKI_TOKEN", "s3cret")
+
+	configContent := `agent:
+  rag_http:
+    - match: "wiki.example.com"
+      bearer_token: "${TEST_WIKI_TOKEN}"
+      headers:
+        X-Team: "platform"
+      timeout: 90s
+      max_size: 20MB
+    - match: "*.example.com"
+      basic_auth:
+        username: "bot"
+        password: "pa$$word"
+      ca_file: "/etc/ssl/internal-ca.pem"
+      proxy: "http://proxy.example.com:3128"
+      user_agent: "don-docs"
+      max_size: 4096
+  rag:
+    wiki:
+      description: "Internal wiki"
+      docs:
+        - "https://wiki.example.com/page"
+      http:
+        headers:
+          Accept: "text/markdown"
+`
+
+	var config Config
+	if err := yaml.Unmarshal([]byte(configContent), &config); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	rules := config.Agent.RAGHTTP
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rag_http entries, got %d", len(rules))
+	}
+	if rules[0].Timeout != 90*time.Second || rules[0].MaxSize != 20*1024*1024 || rules[1].MaxSize != 4096 {
+		t.Errorf("Unexpected timeout/max_size: %v, %d, %d", rules[0].Timeout, rules[0].MaxSize, rules[1].MaxSize)
+	}
+
+	settings, err := rules[0].settings()
+	if err != nil {
+		t.Fatalf("settings() error = %v", err)
+	}
+	if settings.BearerToken != "s3cret" || settings.Headers["X-Team"] != "platform" {
+		t.Errorf("Expected interpolated token and headers, got %+v", settings)
+	}
+
+	// A plain "$" is not an environment variable reference
+	settings, err = rules[1].settings()
+	if err != nil {
+		t.Fatalf("settings() error = %v", err)
+	}
+	if settings.Username != "bot" || settings.Password != "pa$$word" || settings.UserAgent != "don-docs" {
+		t.Errorf("Unexpected basic auth settings: %+v", settings)
+	}
+
+	if http := config.Agent.RAG["wiki"].HTTP; http == nil || http.Headers["Accept"] != "text/markdown" {
+		t.Errorf("Expected per-source http settings, got %+v", http)
+	}
+
+	// Unset variables are reported instead of sending empty credentials
+	missing := RAGHTTPConfig{BearerToken: "${TEST_UNSET_TOKEN_VARIABLE}"}
+	if _, err := missing.settings(); err == nil || !strings.Contains(err.Error(), "TEST_UNSET_TOKEN_VARIABLE") {
+		t.Errorf("Expected error for unset variable, got %v", err)
+	}
+
+	var size RAGByteSize
+	if err := yaml.Unmarshal([]byte(`"10 potatoes"`), &size); err == nil {
+		t.Error("Expected error for invalid size")
+	}
+}
@@ -22,7 +22,8 @@ func GenerateCagentYAML(
 
 	// Build the config structure as a map for easy YAML generation
 	cagentCfg := make(map[string]interface{})
-	cagentCfg["version"] = "v2"
+	// Version of the cagent config schema generated, the latest one cagent loads
+	cagentCfg["version"] = "3"
 
 	// Convert models
 	models := make(map[string]interface{})
@@ -59,58 +60,56 @@ func GenerateCagentYAML(
 	return yamlBytes, nil
 }
 
-// addModels adds model configurations to the cagent config
-func addModels(cfg *Config, models map[string]interface{}, logger *common.Logger) error {
-	// Add all models from the flat list
-	for _, model := range cfg.Agent.Models {
+// cagentModel is a model of the cagent config, with its name
+type cagentModel struct {
+	name   string
+	config *ModelConfig
+}
+
+// cagentModels returns the models of the cagent config: the flat list of models,
+// and the orchestrator and tool-runner models if specified
+func cagentModels(cfg *Config) []cagentModel {
+	var models []cagentModel
+	for i := range cfg.Agent.Models {
+		model := &cfg.Agent.Models[i]
 		name := model.Name
 		if name == "" {
 			name = model.Model
 		}
-
-		models[name] = map[string]interface{}{
-			"provider":  model.Class,
-			"model":     model.Model,
-			"base_url":  model.APIURL,
-			"token_key": model.APIKey,
-		}
-
-		logger.Debug("Added model: %s (provider: %s, model: %s)",
-			name, model.Class, model.Model)
+		models = append(models, cagentModel{name: name, config: model})
 	}
 
-	// Add orchestrator if specified
 	if cfg.Agent.Orchestrator != nil {
 		name := "orchestrator"
 		if cfg.Agent.Orchestrator.Name != "" {
 			name = cfg.Agent.Orchestrator.Name
 		}
-
-		models[name] = map[string]interface{}{
-			"provider":  cfg.Agent.Orchestrator.Class,
-			"model":     cfg.Agent.Orchestrator.Model,
-			"base_url":  cfg.Agent.Orchestrator.APIURL,
-			"token_key": cfg.Agent.Orchestrator.APIKey,
-		}
-
-		logger.Debug("Added orchestrator model: %s", name)
+		models = append(models, cagentModel{name: name, config: cfg.Agent.Orchestrator})
 	}
 
-	// Add tool-runner if specified
 	if cfg.Agent.ToolRunner != nil {
 		name := "tool-runner"
 		if cfg.Agent.ToolRunner.Name != "" {
 			name = cfg.Agent.ToolRunner.Name
 		}
+		models = append(models, cagentModel{name: name, config: cfg.Agent.ToolRunner})
+	}
+
+	return models
+}
 
-		models[name] = map[string]interface{}{
-			"provider":  cfg.Agent.ToolRunner.Class,
-			"model":     cfg.Agent.ToolRunner.Model,
-			"base_url":  cfg.Agent.ToolRunner.APIURL,
-			"token_key": cfg.Agent.ToolRunner.APIKey,
+// addModels adds model configurations to the cagent config
+func addModels(cfg *Config, models map[string]interface{}, logger *common.Logger) error {
+	for _, model := range cagentModels(cfg) {
+		models[model.name] = map[string]interface{}{
+			"provider":  model.config.Class,
+			"model":     model.config.Model,
+			"base_url":  model.config.APIURL,
+			"token_key": model.config.APIKey,
 		}
 
-		logger.Debug("Added tool-runner model: %s", name)
+		logger.Debug("Added model: %s (provider: %s, model: %s)",
+			model.name, model.config.Class, model.config.Model)
 	}
 
 	if len(models) == 0 {
@@ -129,27 +128,48 @@ func addRAGSources(cfg *Config, rag map[string]interface{}, logger *common.Logge
 		tool := make(map[string]interface{})
 		tool["name"] = name
 		tool["description"] = ragSrc.Description
-		tool["instruction"] = fmt.Sprintf("Search %s for relevant information", ragSrc.Description)
+		tool["instruction"] = fmt.Sprintf("Search %s for relevant information. %s", ragSrc.Description, ragCitationInstruction)
 		ragCfg["tool"] = tool
 
 		// Add docs
 		if len(ragSrc.Docs) > 0 {
-			ragCfg["docs"] = ragSrc.Docs
+			ragCfg["docs"] = docPaths(ragSrc.Docs)
+		}
+
+		// Sources with document metadata are filtered after retrieval (see
+		// ragFilterToolSet), so they fetch more results than their limits
+		overFetch := 1
+		if len(ragSrc.docMetadata()) > 0 {
+			overFetch = ragFilterOverFetch
 		}
 
 		// Add strategies
 		if len(ragSrc.Strategies) > 0 {
 			strategies := make([]interface{}, len(ragSrc.Strategies))
 			for i, s := range ragSrc.Strategies {
+				if overFetch > 1 {
+					if s.Limit == 0 {
+						s.Limit = defaultRAGStrategyLimit
+					}
+					s.Limit *= overFetch
+				}
 				strategies[i] = convertStrategy(s)
 			}
 			ragCfg["strategies"] = strategies
 		}
 
-		// Add results configuration
-		if ragSrc.Results != nil {
-			results := convertResults(ragSrc.Results)
-			ragCfg["results"] = results
+		// Add results configuration. Sources with document metadata always set
+		// the limit, as the cagent default would barely over-fetch: without a
+		// results block, only the limit is set, keeping the other cagent defaults.
+		switch {
+		case ragSrc.Results != nil:
+			results := *ragSrc.Results
+			if overFetch > 1 {
+				results.Limit = max(results.Limit, ragToolMaxResults) * overFetch
+			}
+			ragCfg["results"] = convertResults(&results)
+		case overFetch > 1:
+			ragCfg["results"] = map[string]interface{}{"limit": ragToolMaxResults * overFetch}
 		}
 
 		rag[name] = ragCfg
@@ -167,7 +187,7 @@ func convertStrategy(s RAGStrategyConfig) map[string]interface{} {
 	strategy["type"] = s.Type
 
 	if len(s.Docs) > 0 {
-		strategy["docs"] = s.Docs
+		strategy["docs"] = docPaths(s.Docs)
 	}
 
 	if s.Limit > 0 {
@@ -175,13 +195,13 @@ func convertStrategy(s RAGStrategyConfig) map[string]interface{} {
 	}
 
 	// Add chunking configuration
-	if s.Chunking.Size > 0 || s.Chunking.Overlap > 0 {
+	if s.Chunking.Size > 0 || s.Chunking.Overlap != nil {
 		chunking := make(map[string]interface{})
 		if s.Chunking.Size > 0 {
 			chunking["size"] = s.Chunking.Size
 		}
-		if s.Chunking.Overlap > 0 {
-			chunking["overlap"] = s.Chunking.Overlap
+		if s.Chunking.Overlap != nil {
+			chunking["overlap"] = *s.Chunking.Overlap
 		}
 		chunking["respect_word_boundaries"] = s.Chunking.RespectWordBoundaries
 		strategy["chunking"] = chunking
@@ -194,7 +214,7 @@ func convertStrategy(s RAGStrategyConfig) map[string]interface{} {
 
 	// Add strategy-specific parameters (flattened into the strategy map)
 	if s.Model != "" {
-		strategy["model"] = s.Model
+		strategy["embedding_model"] = s.Model
 	}
 	if s.Threshold != 0 {
 		strategy["threshold"] = s.Threshold
@@ -208,8 +228,8 @@ func convertStrategy(s RAGStrategyConfig) map[string]interface{} {
 	if s.K1 != 0 {
 		strategy["k1"] = s.K1
 	}
-	if s.B != 0 {
-		strategy["b"] = s.B
+	if s.B != nil {
+		strategy["b"] = *s.B
 	}
 
 	return strategy
@@ -271,8 +291,13 @@ func addRootAgent(
 	rootAgent["model"] = modelName
 	rootAgent["instruction"] = systemPrompt
 
+	if err := ValidateToolsets(cfg.Agent.Toolsets); err != nil {
+		return err
+	}
+
 	// Add toolsets - MCP server as a toolset
 	// Use command to start mcpshell as an MCP server subprocess
+	var toolsets []interface{}
 	if toolsFile != "" {
 		// Use the configured binary path, or default to "mcpshell" if not set
 		mcpBinary := "mcpshell"
@@ -282,15 +307,34 @@ func addRootAgent(
 
 		// cagent expects separate command and args fields for MCP toolsets
 		// This matches the format used by mcp-go's NewStdioMCPClient
-		toolsets := []interface{}{
-			map[string]interface{}{
-				"type":    "mcp",
-				"command": mcpBinary,
-				"args":    []string{"mcp", "--tools", toolsFile},
-			},
+		toolsets = append(toolsets, map[string]interface{}{
+			"type":    "mcp",
+			"command": mcpBinary,
+			"args":    []string{"mcp", "--tools", toolsFile},
+		})
+		logger.Debug("Added MCP toolset with command: %s, args: [mcp --tools %s]", mcpBinary, toolsFile)
+	}
+
+	// Add the toolsets of the configuration, the tool-runner ones in a sub-agent
+	var toolRunnerToolsets []interface{}
+	for _, t := range cfg.Agent.Toolsets {
+		toolset, err := cagentToolset(t)
+		if err != nil {
+			return err
+		}
+		if t.AgentRole() == ToolsetAgentToolRunner {
+			toolRunnerToolsets = append(toolRunnerToolsets, toolset)
+		} else {
+			toolsets = append(toolsets, toolset)
 		}
+		logger.Debug("Added MCP toolset %s (%s: %s) to the %s", t.Name, t.TransportType(), t.Location(), t.AgentRole())
+	}
+	if len(toolsets) > 0 {
 		rootAgent["toolsets"] = toolsets
-		logger.Debug("Added MCP toolset with command: %s, args: [mcp --tools %s]", mcpBinary, toolsFile)
+	}
+	if len(toolRunnerToolsets) > 0 {
+		agents[toolRunnerAgentName] = toolRunnerAgent(cfg, modelName, toolRunnerToolsets)
+		rootAgent["sub_agents"] = []string{toolRunnerAgentName}
 	}
 
 	// Add RAG sources
@@ -307,6 +351,30 @@ func addRootAgent(
 	return nil
 }
 
+// toolRunnerAgent returns the sub-agent running the tool-runner toolsets, with the
+// tool-runner model when configured, or the model of the root agent otherwise
+func toolRunnerAgent(cfg *Config, rootModel string, toolsets []interface{}) map[string]interface{} {
+	model := rootModel
+	instruction := "You run tools on behalf of the orchestrator. Use the available tools to complete " +
+		"the task you are given, and report the results accurately and concisely."
+	if cfg.Agent.ToolRunner != nil {
+		model = "tool-runner"
+		if cfg.Agent.ToolRunner.Name != "" {
+			model = cfg.Agent.ToolRunner.Name
+		}
+		if len(cfg.Agent.ToolRunner.Prompts.System) > 0 {
+			instruction = cfg.Agent.ToolRunner.Prompts.System[0]
+		}
+	}
+
+	return map[string]interface{}{
+		"model":       model,
+		"description": "Runs the tools of the tool-runner toolsets",
+		"instruction": instruction,
+		"toolsets":    toolsets,
+	}
+}
+
 // getSystemPrompt returns the system prompt for the agent
 func getSystemPrompt(cfg *Config) string {
 	// Check if orchestrator has custom prompts
@@ -324,3 +392,46 @@ func getSystemPrompt(cfg *Config) string {
 	return "You are a helpful AI assistant with access to command-line tools via MCP (Model Context Protocol). " +
 		"Use the available tools to help users accomplish their tasks safely and effectively."
 }
+
+// redactedValue replaces the secrets of the generated configuration in the logs
+const redactedValue = "<redacted>"
+
+// redactCagentYAML returns a generated cagent configuration for the logs, with
+// the literal values of the model tokens and of the env and headers of the
+// toolsets redacted. References to environment variables (${VAR}) are kept.
+func redactCagentYAML(data []byte) string {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Sprintf("(invalid YAML: %v)", err)
+	}
+	redactNode(&doc, false)
+	redacted, err := yaml.Marshal(&doc)
+	if err != nil {
+		return fmt.Sprintf("(failed to encode YAML: %v)", err)
+	}
+	return string(redacted)
+}
+
+// redactNode redacts the secrets of a YAML node; secret tells whether the node
+// is a value holding secrets
+func redactNode(node *yaml.Node, secret bool) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if secret && !strings.Contains(node.Value, "${") {
+			node.Value = redactedValue
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			switch node.Content[i].Value {
+			case "token_key", "env", "headers":
+				redactNode(node.Content[i+1], true)
+			default:
+				redactNode(node.Content[i+1], secret)
+			}
+		}
+	default:
+		for _, child := range node.Content {
+			redactNode(child, secret)
+		}
+	}
+}
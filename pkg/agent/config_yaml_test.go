@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	cagentConfig "github.com/docker/cagent/pkg/config"
+	"github.com/docker/cagent/pkg/config/latest"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+func TestGenerateCagentYAMLLoads(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		agent      AgentConfigFile
+		ragSources []string
+		wantAgents []string // Agents besides root
+	}{
+		{
+			name:  "models",
+			agent: AgentConfigFile{Models: []ModelConfig{{Name: "gpt", Class: "openai", Model: "gpt-4o"}}},
+		},
+		{
+			name: "orchestrator and tool-runner",
+			agent: AgentConfigFile{
+				Models:       []ModelConfig{{Name: "gpt", Class: "openai", Model: "gpt-4o"}},
+				Orchestrator: &ModelConfig{Class: "openai", Model: "gpt-4o"},
+				ToolRunner:   &ModelConfig{Class: "openai", Model: "gpt-4o-mini"},
+			},
+		},
+		{
+			name: "rag",
+			agent: AgentConfigFile{
+				Models: []ModelConfig{{Name: "gpt", Class: "openai", Model: "gpt-4o"}},
+				RAG: map[string]RAGSourceConfig{
+					"docs": {
+						Description: "Documentation",
+						Docs:        []RAGDocConfig{{Path: "./docs"}},
+						Strategies: []RAGStrategyConfig{
+							{Type: "bm25", Database: "bm25.db", K1: 1.2, B: ptr(0.75), Limit: 10},
+							{Type: "chunked-embeddings", Database: "embeddings.db", VectorDimensions: 1536},
+						},
+						Results: &RAGResultsConfig{Limit: 5, Fusion: &RAGFusionConfig{Strategy: "rrf", K: 60}},
+					},
+				},
+			},
+			ragSources: []string{"docs"},
+		},
+		{
+			name: "rag with metadata, chunking and an embedding model",
+			agent: AgentConfigFile{
+				Models: []ModelConfig{{Name: "gpt", Class: "openai", Model: "gpt-4o"}},
+				RAG: map[string]RAGSourceConfig{
+					"runbooks": {
+						Description: "Runbooks",
+						Docs: []RAGDocConfig{
+							{Path: "./runbooks/prod", Tags: []string{"prod"}, Properties: map[string]string{"service": "payments"}},
+							{Path: "./runbooks/staging", Tags: []string{"staging"}},
+						},
+						Strategies: []RAGStrategyConfig{{
+							Type:             "chunked-embeddings",
+							Database:         "runbooks.db",
+							Model:            "openai/text-embedding-3-small",
+							VectorDimensions: 1536,
+							SimilarityMetric: "cosine_similarity",
+							Threshold:        0.5,
+							Chunking:         RAGChunkingConfig{Size: 500, Overlap: ptr(0), RespectWordBoundaries: true},
+						}},
+						Results: &RAGResultsConfig{Limit: 3, Deduplicate: true, IncludeScore: true},
+					},
+				},
+			},
+			ragSources: []string{"runbooks"},
+		},
+		{
+			name: "toolsets",
+			agent: AgentConfigFile{
+				Models: []ModelConfig{{Name: "gpt", Class: "openai", Model: "gpt-4o"}},
+				Toolsets: []ToolsetConfig{
+					{Name: "github", Command: "github-mcp", Args: []string{"stdio"}, Env: map[string]string{"TOKEN": "${DON_TEST_TOKEN}"}},
+					{Name: "docs", URL: "https://mcp.example.com/sse", Transport: "sse", Headers: map[string]string{"Authorization": "Bearer ${DON_TEST_TOKEN}"}, Tools: []string{"search"}},
+					{Name: "tickets", URL: "https://mcp.example.com/mcp", Agent: ToolsetAgentToolRunner},
+				},
+			},
+			wantAgents: []string{toolRunnerAgentName},
+		},
+	}
+	t.Setenv("DON_TEST_TOKEN", "secret")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := GenerateCagentYAML(&Config{Agent: tt.agent}, "tools.yaml", tt.ragSources, logger)
+			if err != nil {
+				t.Fatalf("GenerateCagentYAML() error = %v", err)
+			}
+			cfg, err := cagentConfig.Load(context.Background(), cagentConfig.NewBytesSource("agent.yaml", data))
+			if err != nil {
+				t.Fatalf("cagent config.Load() error = %v\n%s", err, data)
+			}
+			if cfg.Version != latest.Version {
+				t.Errorf("version = %q, want %q", cfg.Version, latest.Version)
+			}
+			for _, name := range append([]string{"root"}, tt.wantAgents...) {
+				if _, ok := cfg.Agents[name]; !ok {
+					t.Errorf("agents = %v, want a %s agent", cfg.Agents, name)
+				}
+			}
+			for _, name := range tt.ragSources {
+				if _, ok := cfg.RAG[name]; !ok {
+					t.Errorf("rag = %v, want %s", cfg.RAG, name)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy RAGStrategyConfig
+		want     map[string]interface{}
+	}{
+		{
+			name:     "unset parameters",
+			strategy: RAGStrategyConfig{Type: "bm25"},
+			want:     map[string]interface{}{"type": "bm25"},
+		},
+		{
+			name:     "zero parameters",
+			strategy: RAGStrategyConfig{Type: "bm25", B: ptr(0.0), Chunking: RAGChunkingConfig{Overlap: ptr(0)}},
+			want: map[string]interface{}{
+				"type":     "bm25",
+				"b":        0.0,
+				"chunking": map[string]interface{}{"overlap": 0, "respect_word_boundaries": false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := convertStrategy(tt.strategy); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddRAGSourcesOverFetch(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	strategies := []RAGStrategyConfig{{Type: "bm25"}, {Type: "bm25", Limit: 3}}
+	results := &RAGResultsConfig{Limit: 4}
+	cfg := &Config{Agent: AgentConfigFile{RAG: map[string]RAGSourceConfig{
+		"tagged":         {Docs: []RAGDocConfig{{Path: "/runbooks/prod.md", Tags: []string{"prod"}}}, Strategies: strategies, Results: results},
+		"plain":          {Docs: RAGDocPaths("/docs/guide.md"), Strategies: strategies, Results: results},
+		"tagged-default": {Docs: []RAGDocConfig{{Path: "/runbooks/prod.md", Tags: []string{"prod"}}}, Strategies: strategies},
+		"tagged-high":    {Docs: []RAGDocConfig{{Path: "/runbooks/prod.md", Tags: []string{"prod"}}}, Strategies: strategies, Results: &RAGResultsConfig{Limit: 20}},
+	}}}
+
+	rag := make(map[string]interface{})
+	if err := addRAGSources(cfg, rag, logger); err != nil {
+		t.Fatalf("addRAGSources() error = %v", err)
+	}
+	limits := func(name string) []interface{} {
+		source := rag[name].(map[string]interface{})
+		var got []interface{}
+		for _, s := range source["strategies"].([]interface{}) {
+			got = append(got, s.(map[string]interface{})["limit"])
+		}
+		return append(got, source["results"].(map[string]interface{})["limit"])
+	}
+
+	// Sources with metadata fetch more results, as the filter drops some of them
+	// and never fewer than the results of the RAG tool times the over-fetch
+	if got, want := limits("tagged"), []interface{}{5 * ragFilterOverFetch, 3 * ragFilterOverFetch, ragToolMaxResults * ragFilterOverFetch}; !reflect.DeepEqual(got, want) {
+		t.Errorf("limits of a source with metadata = %v, want %v", got, want)
+	}
+	if got, want := limits("tagged-default"), []interface{}{5 * ragFilterOverFetch, 3 * ragFilterOverFetch, ragToolMaxResults * ragFilterOverFetch}; !reflect.DeepEqual(got, want) {
+		t.Errorf("limits of a source with metadata and no results = %v, want %v", got, want)
+	}
+	if got, want := rag["tagged-default"].(map[string]interface{})["results"], map[string]interface{}{"limit": ragToolMaxResults * ragFilterOverFetch}; !reflect.DeepEqual(got, want) {
+		t.Errorf("results of a source with metadata and no results = %v, want only the limit", got)
+	}
+	if got, want := limits("tagged-high"), []interface{}{5 * ragFilterOverFetch, 3 * ragFilterOverFetch, 20 * ragFilterOverFetch}; !reflect.DeepEqual(got, want) {
+		t.Errorf("limits of a source with metadata and a high limit = %v, want %v", got, want)
+	}
+	if got, want := limits("plain"), []interface{}{nil, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("limits of a source without metadata = %v, want %v", got, want)
+	}
+	if results.Limit != 4 || strategies[0].Limit != 0 {
+		t.Error("addRAGSources() changed the configuration of the source")
+	}
+}
+
+// ptr returns a pointer to a value, for optional configuration fields
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRedactCagentYAML(t *testing.T) {
+	data := []byte(`models:
+  gpt-4o:
+    model: gpt-4o
+    token_key: sk-literal
+agents:
+  root:
+    model: gpt-4o
+    toolsets:
+      - type: mcp
+        command: github-mcp
+        env:
+          TOKEN: ghp_literal
+          HOST: ${GITHUB_HOST}
+      - type: mcp
+        remote:
+          url: https://mcp.example.com/mcp
+          headers:
+            Authorization: Bearer ${env.DOCS_TOKEN}
+            X-Api-Key: literal-key
+`)
+	redacted := redactCagentYAML(data)
+	for _, secret := range []string{"sk-literal", "ghp_literal", "literal-key"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("redacted YAML contains %q:\n%s", secret, redacted)
+		}
+	}
+	for _, kept := range []string{"${GITHUB_HOST}", "Bearer ${env.DOCS_TOKEN}", "https://mcp.example.com/mcp", "command: github-mcp"} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("redacted YAML does not contain %q:\n%s", kept, redacted)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+// embeddingsStrategy is the type of the RAG strategies using an embedding model
+const embeddingsStrategy = "chunked-embeddings"
+
+// defaultEmbeddingProvider is the provider of embedding models given by name only
+const defaultEmbeddingProvider = "openai"
+
+// defaultEmbeddingDimensions are the sizes of the vectors of well-known embedding
+// models, used when neither the strategy nor the model configuration sets them
+var defaultEmbeddingDimensions = map[string]int{
+	"openai/text-embedding-3-small": 1536,
+	"openai/text-embedding-3-large": 3072,
+	"openai/text-embedding-ada-002": 1536,
+}
+
+// ResolveEmbeddingModels checks the embedding models of the chunked-embeddings
+// strategies of some RAG sources, returning the sources with resolved strategies.
+// A strategy model is either the name of an agent.models entry with type: embedding,
+// whose dimensions are used as the strategy vector_dimensions when unset, or an
+// inline "provider/model" reference passed to cagent as is. Other names are taken
+// as OpenAI models, as in previous versions. vector_dimensions is only required
+// for models whose dimensions are not known.
+func ResolveEmbeddingModels(cfg *Config, sources map[string]RAGSourceConfig, logger *common.Logger) (map[string]RAGSourceConfig, error) {
+	manager := NewModelManager(logger)
+
+	resolved := make(map[string]RAGSourceConfig, len(sources))
+	for sourceName, source := range sources {
+		strategies := make([]RAGStrategyConfig, len(source.Strategies))
+		for i, strategy := range source.Strategies {
+			if strategy.Type == embeddingsStrategy {
+				if err := resolveEmbeddingModel(cfg, &strategy, manager, logger); err != nil {
+					return nil, fmt.Errorf("RAG source '%s': %w", sourceName, err)
+				}
+			}
+			strategies[i] = strategy
+		}
+		source.Strategies = strategies
+		resolved[sourceName] = source
+	}
+	return resolved, nil
+}
+
+// resolveEmbeddingModel checks the embedding model of a strategy, filling in
+// the model name (as known by cagent) and the vector dimensions
+func resolveEmbeddingModel(cfg *Config, strategy *RAGStrategyConfig, manager *ModelManager, logger *common.Logger) error {
+	if strategy.Model == "" {
+		return fmt.Errorf("%s strategy requires a model", embeddingsStrategy)
+	}
+
+	reference := strategy.Model
+	if model := cfg.GetModelByName(strategy.Model); model != nil {
+		if err := manager.ValidateEmbeddingConfig(*model); err != nil {
+			return err
+		}
+		if model.Dimensions > 0 {
+			switch {
+			case strategy.VectorDimensions == 0:
+				strategy.VectorDimensions = model.Dimensions
+			case strategy.VectorDimensions != model.Dimensions:
+				return fmt.Errorf("vector_dimensions %d does not match the %d dimensions of model '%s'",
+					strategy.VectorDimensions, model.Dimensions, strategy.Model)
+			}
+		}
+		reference = strings.ToLower(model.Class) + "/" + model.Model
+		// Models are known by cagent by their name
+		if model.Name != "" {
+			strategy.Model = model.Name
+		} else {
+			strategy.Model = model.Model
+		}
+		logger.Debug("Resolved embedding model '%s' (%s, %d dimensions)", strategy.Model, model.Model, strategy.VectorDimensions)
+	} else if strings.Contains(strategy.Model, "/") {
+		logger.Debug("Using inline embedding model '%s'", strategy.Model)
+	} else {
+		logger.Warn("Embedding model '%s' is not in agent.models, using %s/%s (add it to agent.models with type: %s, or use provider/model)",
+			strategy.Model, defaultEmbeddingProvider, strategy.Model, ModelTypeEmbedding)
+		strategy.Model = defaultEmbeddingProvider + "/" + strategy.Model
+		reference = strategy.Model
+	}
+
+	if strategy.VectorDimensions == 0 {
+		strategy.VectorDimensions = defaultEmbeddingDimensions[reference]
+	}
+	if strategy.VectorDimensions <= 0 {
+		return fmt.Errorf("%s strategy with model '%s' requires vector_dimensions (or dimensions in the model)",
+			embeddingsStrategy, strategy.Model)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/mock"
+)
+
+func TestResolveEmbeddingModels(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	cfg := &Config{Agent: AgentConfigFile{Models: []ModelConfig{
+		{Name: "chat", Model: "gpt-4o", Class: "openai", APIKey: "test-key"},
+		{Name: "embeddings", Model: "text-embedding-3-small", Class: "openai", APIKey: "test-key", Type: ModelTypeEmbedding, Dimensions: 1536},
+		{Model: "nomic-embed-text", Class: "ollama", Type: ModelTypeEmbedding},
+		{Name: "large", Model: "text-embedding-3-large", Class: "openai", APIKey: "test-key", Type: ModelTypeEmbedding},
+	}}}
+
+	tests := []struct {
+		name           string
+		strategy       RAGStrategyConfig
+		wantModel      string
+		wantDimensions int
+		wantErr        string
+	}{
+		{
+			name:           "named model",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "embeddings"},
+			wantModel:      "embeddings",
+			wantDimensions: 1536,
+		},
+		{
+			name:           "model by model name",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "text-embedding-3-small", VectorDimensions: 1536},
+			wantModel:      "embeddings",
+			wantDimensions: 1536,
+		},
+		{
+			name:           "model without dimensions",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "nomic-embed-text", VectorDimensions: 768},
+			wantModel:      "nomic-embed-text",
+			wantDimensions: 768,
+		},
+		{
+			name:           "model with known dimensions",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "large"},
+			wantModel:      "large",
+			wantDimensions: 3072,
+		},
+		{
+			name:           "inline model",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "openai/text-embedding-3-large", VectorDimensions: 3072},
+			wantModel:      "openai/text-embedding-3-large",
+			wantDimensions: 3072,
+		},
+		{
+			name:     "other strategies are not checked",
+			strategy: RAGStrategyConfig{Type: "bm25"},
+		},
+		{
+			name:     "missing model",
+			strategy: RAGStrategyConfig{Type: "chunked-embeddings"},
+			wantErr:  "requires a model",
+		},
+		{
+			name:           "inline model with known dimensions",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "openai/text-embedding-3-large"},
+			wantModel:      "openai/text-embedding-3-large",
+			wantDimensions: 3072,
+		},
+		{
+			name:           "bare model name",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "text-embedding-ada-002"},
+			wantModel:      "openai/text-embedding-ada-002",
+			wantDimensions: 1536,
+		},
+		{
+			name:           "bare model name with dimensions",
+			strategy:       RAGStrategyConfig{Type: "chunked-embeddings", Model: "custom-embed", VectorDimensions: 512},
+			wantModel:      "openai/custom-embed",
+			wantDimensions: 512,
+		},
+		{
+			name:     "bare model name without known dimensions",
+			strategy: RAGStrategyConfig{Type: "chunked-embeddings", Model: "custom-embed"},
+			wantErr:  "strategy with model 'openai/custom-embed' requires vector_dimensions",
+		},
+		{
+			name:     "chat model",
+			strategy: RAGStrategyConfig{Type: "chunked-embeddings", Model: "chat"},
+			wantErr:  "is not an embedding model",
+		},
+		{
+			name:     "dimensions mismatch",
+			strategy: RAGStrategyConfig{Type: "chunked-embeddings", Model: "embeddings", VectorDimensions: 768},
+			wantErr:  "vector_dimensions 768 does not match the 1536 dimensions",
+		},
+		{
+			name:     "missing dimensions",
+			strategy: RAGStrategyConfig{Type: "chunked-embeddings", Model: "nomic-embed-text"},
+			wantErr:  "requires vector_dimensions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := map[string]RAGSourceConfig{"docs": {Strategies: []RAGStrategyConfig{tt.strategy}}}
+			resolved, err := ResolveEmbeddingModels(cfg, sources, logger)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveEmbeddingModels() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveEmbeddingModels() error = %v", err)
+			}
+			strategy := resolved["docs"].Strategies[0]
+			if strategy.Model != tt.wantModel || strategy.VectorDimensions != tt.wantDimensions {
+				t.Errorf("strategy model = %s (%d dimensions), want %s (%d dimensions)",
+					strategy.Model, strategy.VectorDimensions, tt.wantModel, tt.wantDimensions)
+			}
+			if given := sources["docs"].Strategies[0]; given.Model != tt.strategy.Model || given.VectorDimensions != tt.strategy.VectorDimensions {
+				t.Errorf("ResolveEmbeddingModels() modified the given sources")
+			}
+		})
+	}
+}
+
+func TestProbeEmbeddingModel(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"object": "list",
+			"data":   []map[string]interface{}{{"object": "embedding", "index": 0, "embedding": []float32{0.1, 0.2, 0.3}}},
+		})
+	}))
+	defer server.Close()
+	t.Setenv("DON_TEST_EMBEDDING_KEY", "test-key")
+
+	tests := []struct {
+		name           string
+		config         ModelConfig
+		wantDimensions int
+		wantErr        string
+	}{
+		{
+			name:           "dimensions reported",
+			config:         ModelConfig{Model: "embed", Class: "openai", APIKey: "${DON_TEST_EMBEDDING_KEY}", APIURL: server.URL, Type: ModelTypeEmbedding},
+			wantDimensions: 3,
+		},
+		{
+			name:           "dimensions mismatch",
+			config:         ModelConfig{Model: "embed", Class: "openai", APIKey: "test-key", APIURL: server.URL, Type: ModelTypeEmbedding, Dimensions: 1536},
+			wantDimensions: 3,
+			wantErr:        "vectors of 3 dimensions, but 1536 are configured",
+		},
+		{
+			name:           "mock model",
+			config:         ModelConfig{Model: "words", Class: MockModelClass, Type: ModelTypeEmbedding},
+			wantDimensions: mock.DefaultDimensions,
+		},
+		{
+			name:    "chat model",
+			config:  ModelConfig{Model: "gpt-4o", Class: "openai", APIKey: "test-key", APIURL: server.URL},
+			wantErr: "is not an embedding model",
+		},
+		{
+			name:    "request failure",
+			config:  ModelConfig{Model: "embed", Class: "openai", APIKey: "wrong-key", APIURL: server.URL, Type: ModelTypeEmbedding},
+			wantErr: "embedding request failed",
+		},
+	}
+	manager := NewModelManager(logger)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dimensions, err := manager.ProbeEmbeddingModel(context.Background(), tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ProbeEmbeddingModel() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("ProbeEmbeddingModel() error = %v", err)
+			}
+			if dimensions != tt.wantDimensions {
+				t.Errorf("ProbeEmbeddingModel() = %d dimensions, want %d", dimensions, tt.wantDimensions)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/cagent/pkg/runtime"
+)
+
+// EventType is the type of an event of an agent run
+type EventType string
+
+const (
+	EventStreamStarted    EventType = "stream_started"    // An agent started processing
+	EventMessage          EventType = "message"           // A piece of the answer of an agent
+	EventToolCall         EventType = "tool_call"         // An agent calls a tool
+	EventToolConfirmation EventType = "tool_confirmation" // A tool call waits for an approval
+	EventToolResult       EventType = "tool_result"       // Result of a tool call
+	EventSources          EventType = "sources"           // Sources of the answer of the root agent
+	EventStreamStopped    EventType = "stream_stopped"    // An agent finished processing
+	EventTokenUsage       EventType = "token_usage"       // Tokens used so far
+	EventWaitingInput     EventType = "waiting_input"     // The conversation waits for the next user message
+	EventNotice           EventType = "notice"            // Information for the user (e.g. refreshed RAG sources)
+	EventError            EventType = "error"             // An error, the run may continue
+	EventDone             EventType = "done"              // The run ended (with an error in Content if it failed)
+)
+
+// Event is an event of an agent run, as sent by RunEvents
+type Event struct {
+	Type       EventType   `json:"type"`
+	Agent      string      `json:"agent,omitempty"`        // Agent producing the event
+	Content    string      `json:"content,omitempty"`      // Text of messages, tool results, sources, notices and errors
+	ToolCallID string      `json:"tool_call_id,omitempty"` // Tool call of tool events
+	Tool       string      `json:"tool,omitempty"`         // Tool name of tool events
+	Arguments  string      `json:"arguments,omitempty"`    // Arguments (JSON) of tool calls
+	Usage      *EventUsage `json:"usage,omitempty"`        // Token usage (token_usage events)
+}
+
+// EventUsage holds the tokens used by a run
+type EventUsage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// ToolApproval is the answer to a tool call confirmation
+type ToolApproval string
+
+const (
+	ToolApprove        ToolApproval = ToolApproval(runtime.ResumeTypeApprove)        // Run this tool call
+	ToolApproveSession ToolApproval = ToolApproval(runtime.ResumeTypeApproveSession) // Run this and all the following tool calls
+	ToolReject         ToolApproval = ToolApproval(runtime.ResumeTypeReject)         // Do not run this tool call
+)
+
+// ParseToolApproval validates a tool approval
+func ParseToolApproval(s string) (ToolApproval, error) {
+	switch approval := ToolApproval(s); approval {
+	case ToolApprove, ToolApproveSession, ToolReject:
+		return approval, nil
+	default:
+		return "", fmt.Errorf("invalid approval %q (expected %s, %s or %s)", s, ToolApprove, ToolApproveSession, ToolReject)
+	}
+}
+
+// runOutput receives what an agent run produces: text for a terminal (Run) or
+// structured events (RunEvents)
+type runOutput interface {
+	// handle processes an event of the cagent runtime
+	handle(event interface{})
+	// errorf reports an error to the user
+	errorf(format string, args ...interface{})
+	// notice reports information to the user
+	notice(message string)
+	// waitingInput tells the user the conversation waits for the next message
+	waitingInput()
+	// confirm returns the answer to a tool call confirmation
+	confirm(ctx context.Context, event *runtime.ToolCallConfirmationEvent) ToolApproval
+}
+
+// eventOutput sends the output of a run as structured events
+type eventOutput struct {
+	agent     *Agent
+	events    chan<- Event
+	approvals <-chan ToolApproval
+}
+
+func (o *eventOutput) handle(event interface{}) {
+	if footer := o.agent.citeSources(event); footer != "" {
+		o.events <- Event{Type: EventSources, Agent: "root", Content: footer}
+	}
+
+	switch e := event.(type) {
+	case *runtime.AgentChoiceEvent:
+		if e.Content != "" {
+			o.events <- Event{Type: EventMessage, Agent: e.AgentName, Content: e.Content}
+		}
+	case *runtime.ToolCallEvent:
+		o.events <- Event{
+			Type:       EventToolCall,
+			Agent:      e.AgentName,
+			ToolCallID: e.ToolCall.ID,
+			Tool:       e.ToolCall.Function.Name,
+			Arguments:  e.ToolCall.Function.Arguments,
+		}
+	case *runtime.ToolCallResponseEvent:
+		o.events <- Event{
+			Type:       EventToolResult,
+			Agent:      e.AgentName,
+			ToolCallID: e.ToolCall.ID,
+			Tool:       e.ToolCall.Function.Name,
+			Content:    e.Response,
+		}
+	case *runtime.StreamStartedEvent:
+		o.events <- Event{Type: EventStreamStarted, Agent: e.AgentName}
+	case *runtime.StreamStoppedEvent:
+		o.events <- Event{Type: EventStreamStopped, Agent: e.AgentName}
+	case *runtime.TokenUsageEvent:
+		if e.Usage != nil {
+			o.events <- Event{
+				Type:  EventTokenUsage,
+				Agent: e.AgentName,
+				Usage: &EventUsage{InputTokens: e.Usage.InputTokens, OutputTokens: e.Usage.OutputTokens},
+			}
+		}
+	default:
+		o.agent.logger.Debug("Unhandled event type: %T", event)
+	}
+}
+
+func (o *eventOutput) errorf(format string, args ...interface{}) {
+	o.events <- Event{Type: EventError, Content: fmt.Sprintf(format, args...)}
+}
+
+func (o *eventOutput) notice(message string) {
+	o.events <- Event{Type: EventNotice, Content: message}
+}
+
+func (o *eventOutput) waitingInput() {
+	o.events <- Event{Type: EventWaitingInput}
+}
+
+func (o *eventOutput) confirm(ctx context.Context, event *runtime.ToolCallConfirmationEvent) ToolApproval {
+	if o.agent.config.AutoApprove {
+		return ToolApproveSession
+	}
+	if o.approvals == nil {
+		// Nobody can answer the confirmation, so the tool call is rejected
+		o.notice(fmt.Sprintf("Tool call '%s' rejected: tool calls need an approval", event.ToolCall.Function.Name))
+		return ToolReject
+	}
+	o.events <- Event{
+		Type:       EventToolConfirmation,
+		Agent:      event.AgentName,
+		ToolCallID: event.ToolCall.ID,
+		Tool:       event.ToolCall.Function.Name,
+		Arguments:  event.ToolCall.Function.Arguments,
+	}
+	select {
+	case approval := <-o.approvals:
+		o.agent.logger.Debug("Tool call '%s': %s", event.ToolCall.Function.Name, approval)
+		return approval
+	case <-ctx.Done():
+		return ToolReject
+	}
+}
@@ -0,0 +1,319 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+const (
+	// DefaultMCPShellBinary is the mcpshell binary looked up in the PATH when none is configured
+	DefaultMCPShellBinary = "mcpshell"
+
+	// MinMCPShellVersion is the oldest mcpshell version Don works with
+	MinMCPShellVersion = "0.1.0"
+
+	// mcpshellInstallHint tells how to get a mcpshell binary
+	mcpshellInstallHint = "install it with 'go install github.com/inercia/MCPShell@latest', " +
+		"or set its path with --mcpshell or 'agent.mcpshell' in the configuration file"
+
+	// mcpshellPreflightTimeout bounds starting mcpshell and listing its tools
+	mcpshellPreflightTimeout = 30 * time.Second
+)
+
+// MCPShellInfo describes the mcpshell binary and the tools it serves for a tools file
+type MCPShellInfo struct {
+	Binary    string         `json:"binary"`            // Resolved path of the binary
+	Version   string         `json:"version,omitempty"` // Version reported by the MCP server
+	ToolsFile string         `json:"tools_file"`
+	Tools     []MCPShellTool `json:"tools"`
+}
+
+// MCPShellTool is a tool defined in a tools file
+type MCPShellTool struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	Parameters  []MCPShellToolParameter `json:"parameters,omitempty"`
+	InputSchema any                     `json:"input_schema,omitempty"` // JSON schema of the arguments
+}
+
+// MCPShellToolParameter is a parameter of a tool
+type MCPShellToolParameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// ResolveMCPShellBinary returns the path of the mcpshell binary, looking it up
+// in the PATH when it is not a path
+func ResolveMCPShellBinary(binary string) (string, error) {
+	if binary == "" {
+		binary = DefaultMCPShellBinary
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) && !strings.ContainsRune(binary, '/') {
+			return "", fmt.Errorf("mcpshell binary '%s' not found in PATH: %s", binary, mcpshellInstallHint)
+		}
+		return "", fmt.Errorf("mcpshell binary '%s' cannot be run (%v): %s", binary, err, mcpshellInstallHint)
+	}
+	return path, nil
+}
+
+// ConnectMCPShell starts mcpshell as an MCP server for a tools file, as the agent
+// does, and returns a client session with it. Closing the session stops mcpshell.
+func ConnectMCPShell(ctx context.Context, binary, toolsFile string) (*mcp.ClientSession, error) {
+	stderr := &lockedBuffer{}
+	cmd := exec.Command(binary, "mcp", "--tools", toolsFile)
+	cmd.Stderr = stderr
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "don"}, nil)
+	session, err := client.Connect(ctx, &mcp.CommandTransport{Command: cmd}, nil)
+	if err != nil {
+		message := fmt.Sprintf("failed to start '%s mcp --tools %s' (check the tools file with 'mcpshell validate --tools %s')",
+			binary, toolsFile, toolsFile)
+		return nil, mcpshellError(message, err, stderr)
+	}
+	return session, nil
+}
+
+// ListMCPShellTools lists the tools served by a mcpshell session, sorted by name
+func ListMCPShellTools(ctx context.Context, session *mcp.ClientSession) ([]MCPShellTool, error) {
+	var tools []MCPShellTool
+	for tool, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the tools: %w", err)
+		}
+		tools = append(tools, MCPShellTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  toolParameters(tool.InputSchema),
+			InputSchema: tool.InputSchema,
+		})
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools, nil
+}
+
+// PreflightMCPShell checks mcpshell can serve the tools of a tools file before
+// the agent starts: it resolves the binary, runs it once to list the tools, and
+// checks its version. The errors tell the user how to fix the problem.
+func PreflightMCPShell(ctx context.Context, binary, toolsFile string, logger *common.Logger) (*MCPShellInfo, error) {
+	path, err := ResolveMCPShellBinary(binary)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("Checking mcpshell %s with tools file %s", path, toolsFile)
+
+	ctx, cancel := context.WithTimeout(ctx, mcpshellPreflightTimeout)
+	defer cancel()
+
+	session, err := ConnectMCPShell(ctx, path, toolsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = session.Close() }()
+
+	info := &MCPShellInfo{Binary: path, ToolsFile: toolsFile}
+	if result := session.InitializeResult(); result != nil && result.ServerInfo != nil {
+		info.Version = result.ServerInfo.Version
+	}
+	if err := checkMCPShellVersion(info.Version); err != nil {
+		return nil, fmt.Errorf("mcpshell %s: %w", path, err)
+	}
+
+	info.Tools, err = ListMCPShellTools(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("mcpshell %s: %w", path, err)
+	}
+	if len(info.Tools) == 0 {
+		return nil, fmt.Errorf("tools file '%s' defines no tools (check it with 'mcpshell validate --tools %s')", toolsFile, toolsFile)
+	}
+
+	logger.Info("mcpshell %s (%s) serves %d tools from %s", path, info.Version, len(info.Tools), toolsFile)
+	return info, nil
+}
+
+// Arguments converts "name=value" arguments to the arguments of a tool call,
+// parsing the values with the types of the parameters
+func (t MCPShellTool) Arguments(args []string) (map[string]any, error) {
+	params := make(map[string]MCPShellToolParameter, len(t.Parameters))
+	names := make([]string, 0, len(t.Parameters))
+	for _, param := range t.Parameters {
+		params[param.Name] = param
+		names = append(names, param.Name)
+	}
+
+	arguments := make(map[string]any, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid argument '%s' (expected name=value)", arg)
+		}
+		param, ok := params[name]
+		if !ok {
+			return nil, fmt.Errorf("tool '%s' has no parameter '%s' (parameters: %s)", t.Name, name, strings.Join(names, ", "))
+		}
+		parsed, err := parseArgument(param.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter '%s' (%s): %w", name, param.Type, err)
+		}
+		arguments[name] = parsed
+	}
+
+	for _, param := range t.Parameters {
+		if _, ok := arguments[param.Name]; param.Required && !ok {
+			return nil, fmt.Errorf("missing required parameter '%s' of tool '%s'", param.Name, t.Name)
+		}
+	}
+	return arguments, nil
+}
+
+// parseArgument parses the value of an argument as the JSON type of its parameter
+// Strings, and parameters of other or several types, are kept as is
+func parseArgument(paramType, value string) (any, error) {
+	switch paramType {
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "array", "object":
+		var parsed any
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, fmt.Errorf("expected JSON: %w", err)
+		}
+		return parsed, nil
+	default:
+		return value, nil
+	}
+}
+
+// semver matches the major, minor and patch numbers of a version
+var semver = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)`)
+
+// checkMCPShellVersion checks a mcpshell version is not older than MinMCPShellVersion
+// Development builds, without a release version, are accepted
+func checkMCPShellVersion(version string) error {
+	current, ok := parseVersion(version)
+	if !ok {
+		return nil
+	}
+	minimum, _ := parseVersion(MinMCPShellVersion)
+	for i := range current {
+		if current[i] != minimum[i] {
+			if current[i] < minimum[i] {
+				return fmt.Errorf("version %s is not supported (%s or newer is required): %s",
+					version, MinMCPShellVersion, mcpshellInstallHint)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseVersion returns the major, minor and patch numbers of a version
+func parseVersion(version string) ([3]int, bool) {
+	var numbers [3]int
+	match := semver.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return numbers, false
+	}
+	for i := range numbers {
+		numbers[i], _ = strconv.Atoi(match[i+1])
+	}
+	return numbers, true
+}
+
+// toolParameters returns the parameters of a tool from its input JSON schema,
+// the required ones first
+func toolParameters(schema any) []MCPShellToolParameter {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+	var object struct {
+		Properties map[string]struct {
+			Type        any    `json:"type"`
+			Description string `json:"description"`
+		} `json:"properties"`
+		Required []string `json:"required"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil
+	}
+
+	required := make(map[string]bool, len(object.Required))
+	for _, name := range object.Required {
+		required[name] = true
+	}
+	params := make([]MCPShellToolParameter, 0, len(object.Properties))
+	for name, property := range object.Properties {
+		param := MCPShellToolParameter{Name: name, Description: property.Description, Required: required[name]}
+		switch t := property.Type.(type) {
+		case string:
+			param.Type = t
+		case []any:
+			types := make([]string, 0, len(t))
+			for _, v := range t {
+				types = append(types, fmt.Sprint(v))
+			}
+			param.Type = strings.Join(types, "|")
+		}
+		params = append(params, param)
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].Required != params[j].Required {
+			return params[i].Required
+		}
+		return params[i].Name < params[j].Name
+	})
+	return params
+}
+
+// mcpshellError adds the last lines mcpshell wrote to stderr to an error, as
+// they usually explain the problem (e.g. a malformed tools file)
+func mcpshellError(message string, err error, stderr *lockedBuffer) error {
+	output := strings.TrimSpace(stderr.String())
+	if output == "" {
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) > 10 {
+		lines = lines[len(lines)-10:]
+	}
+	return fmt.Errorf("%s: %w\nmcpshell output:\n  %s", message, err, strings.Join(lines, "\n  "))
+}
+
+// lockedBuffer is a buffer safe for the concurrent writes of a command and reads
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
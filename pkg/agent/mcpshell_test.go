@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+// fakeMCPShellEnv makes the test binary behave as mcpshell, with the version of its value
+const fakeMCPShellEnv = "DON_TEST_FAKE_MCPSHELL"
+
+func TestMain(m *testing.M) {
+	if version, ok := os.LookupEnv(fakeMCPShellEnv); ok {
+		os.Exit(fakeMCPShell(version, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeMCPShell serves the tools of a tools file as 'mcpshell mcp --tools <file>'
+// would: a "disk_usage" tool, no tools for an empty file, or an error for a
+// malformed file
+func fakeMCPShell(version string, args []string) int {
+	if len(args) != 3 || args[0] != "mcp" || args[1] != "--tools" {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", args)
+		return 2
+	}
+	content, err := os.ReadFile(args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load tools file: %v\n", err)
+		return 1
+	}
+	if strings.Contains(string(content), "malformed") {
+		fmt.Fprintln(os.Stderr, "Error: failed to parse tools file: yaml: line 3: mapping values are not allowed")
+		return 1
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "mcpshell", Version: version}, nil)
+	if strings.TrimSpace(string(content)) != "" {
+		type diskUsageArgs struct {
+			Path  string `json:"path" jsonschema:"Directory to check"`
+			Depth int    `json:"depth,omitempty" jsonschema:"Maximum depth"`
+		}
+		mcp.AddTool(server, &mcp.Tool{Name: "disk_usage", Description: "Check the disk usage of a directory"},
+			func(ctx context.Context, req *mcp.CallToolRequest, args diskUsageArgs) (*mcp.CallToolResult, any, error) {
+				return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "42K " + args.Path}}}, nil, nil
+			})
+	}
+	if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func TestPreflightMCPShell(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to get the test binary: %v", err)
+	}
+
+	dir := t.TempDir()
+	writeToolsFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write tools file: %v", err)
+		}
+		return path
+	}
+	toolsFile := writeToolsFile("tools.yaml", "mcp:\n  tools: []\n")
+
+	tests := []struct {
+		name      string
+		binary    string
+		version   string
+		toolsFile string
+		wantErr   string
+	}{
+		{name: "ok", binary: binary, version: "v0.3.1", toolsFile: toolsFile},
+		{name: "development build", binary: binary, version: "dev", toolsFile: toolsFile},
+		{name: "binary not in PATH", binary: "don-test-no-such-mcpshell", toolsFile: toolsFile, wantErr: "not found in PATH"},
+		{name: "binary not found", binary: filepath.Join(dir, "mcpshell"), toolsFile: toolsFile, wantErr: "cannot be run"},
+		{name: "old version", binary: binary, version: "0.0.9", toolsFile: toolsFile, wantErr: "version 0.0.9 is not supported"},
+		{name: "malformed tools file", binary: binary, version: "v0.3.1", toolsFile: writeToolsFile("bad.yaml", "malformed"), wantErr: "mapping values are not allowed"},
+		{name: "no tools", binary: binary, version: "v0.3.1", toolsFile: writeToolsFile("empty.yaml", ""), wantErr: "defines no tools"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(fakeMCPShellEnv, tt.version)
+			info, err := PreflightMCPShell(context.Background(), tt.binary, tt.toolsFile, logger)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("PreflightMCPShell() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PreflightMCPShell() error = %v", err)
+			}
+			if info.Binary != binary || info.Version != tt.version || len(info.Tools) != 1 {
+				t.Fatalf("PreflightMCPShell() = %+v, want the binary, its version and a tool", info)
+			}
+			want := []MCPShellToolParameter{
+				{Name: "path", Type: "string", Description: "Directory to check", Required: true},
+				{Name: "depth", Type: "integer", Description: "Maximum depth"},
+			}
+			if got := info.Tools[0].Parameters; fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("parameters = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestMCPShellToolArguments(t *testing.T) {
+	tool := MCPShellTool{
+		Name: "deploy",
+		Parameters: []MCPShellToolParameter{
+			{Name: "service", Type: "string", Required: true},
+			{Name: "replicas", Type: "integer"},
+			{Name: "ratio", Type: "number"},
+			{Name: "dry_run", Type: "boolean"},
+			{Name: "labels", Type: "object"},
+			{Name: "hosts", Type: "array"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "typed values",
+			args: []string{"service=api=v2", "replicas=3", "ratio=0.5", "dry_run=true", `labels={"env":"prod"}`, `hosts=["a","b"]`},
+			want: map[string]any{
+				"service": "api=v2", "replicas": int64(3), "ratio": 0.5, "dry_run": true,
+				"labels": map[string]any{"env": "prod"}, "hosts": []any{"a", "b"},
+			},
+		},
+		{name: "empty string", args: []string{"service="}, want: map[string]any{"service": ""}},
+		{name: "not name=value", args: []string{"service"}, wantErr: "expected name=value"},
+		{name: "unknown parameter", args: []string{"service=api", "zone=eu"}, wantErr: "has no parameter 'zone'"},
+		{name: "invalid integer", args: []string{"service=api", "replicas=many"}, wantErr: "parameter 'replicas' (integer)"},
+		{name: "invalid JSON", args: []string{"service=api", "hosts=a,b"}, wantErr: "expected JSON"},
+		{name: "missing required", args: []string{"replicas=1"}, wantErr: "missing required parameter 'service'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tool.Arguments(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Arguments() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Arguments() error = %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Arguments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/inercia/don/pkg/mock"
+)
+
+// MockModelClass is the class of the mock models, which answer with the replies
+// of a script from an in-process OpenAI-compatible server
+const MockModelClass = "mock"
+
+// mockModels are the servers of the mock models of a run, by script
+type mockModels struct {
+	servers map[string]*mock.Server
+}
+
+// startMockModels starts a server for each script of the mock models of a run
+// configuration, and routes the models to them. Models with the same script
+// share its turns. It returns nil when there are no mock models, or when the
+// run is replayed (the recording answers instead).
+func (a *Agent) startMockModels(cfg *Config) (*mockModels, error) {
+	if a.config.Replay != "" {
+		return nil, nil
+	}
+
+	var m *mockModels
+	for _, model := range cagentModels(cfg) {
+		if model.config.Class != MockModelClass {
+			continue
+		}
+		if m == nil {
+			m = &mockModels{servers: make(map[string]*mock.Server)}
+		}
+		server, err := m.server(model)
+		if err != nil {
+			_ = m.close()
+			return nil, err
+		}
+		if err := useLocalAPI(model, server.URL()); err != nil {
+			_ = m.close()
+			return nil, err
+		}
+		a.logger.Info("Mock model '%s' answers from %s", model.name, model.config.Script)
+	}
+	return m, nil
+}
+
+// server returns the server of the script of a mock model, starting it the first time
+func (m *mockModels) server(model cagentModel) (*mock.Server, error) {
+	path, err := expandEnv(model.config.Script)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script of mock model '%s': %w", model.name, err)
+	}
+	// Embedding models need no script, they share a server without turns
+	if path == "" && !model.config.IsEmbedding() {
+		return nil, fmt.Errorf("mock model '%s' has no script", model.name)
+	}
+	if server, ok := m.servers[path]; ok {
+		return server, nil
+	}
+
+	script := &mock.Script{}
+	if path != "" {
+		if script, err = mock.LoadScript(path); err != nil {
+			return nil, err
+		}
+	}
+	server := mock.NewServer(script)
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	m.servers[path] = server
+	return server, nil
+}
+
+// close stops the servers, returning the differences between the requests of
+// the run and the scripts
+func (m *mockModels) close() error {
+	var scriptErr error
+	for path, server := range m.servers {
+		_ = server.Close()
+		if err := server.Err(); err != nil && scriptErr == nil {
+			scriptErr = fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return scriptErr
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/utils"
+)
+
+func TestMockModel(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	dir := t.TempDir()
+	t.Setenv(utils.DonDirEnv, dir)
+	t.Setenv(fakeMCPShellEnv, "v0.3.1")
+	t.Setenv("OPENAI_API_KEY", "")
+
+	toolsFile := filepath.Join(dir, "tools.yaml")
+	if err := os.WriteFile(toolsFile, []byte("mcp:\n  tools: []\n"), 0644); err != nil {
+		t.Fatalf("failed to write tools file: %v", err)
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to get the test binary: %v", err)
+	}
+
+	const diskUsage = `
+turns:
+  - expect: disk does /var use
+    tool_calls:
+      - name: disk_usage
+        arguments: {path: /var}
+`
+	tests := []struct {
+		name           string
+		script         string
+		approval       ToolApproval
+		noApprovals    bool // Run without a channel of approvals
+		wantTranscript string
+		wantErr        string
+	}{
+		{
+			name:           "approved tool call",
+			script:         diskUsage + "  - expect: 42K /var\n    reply: /var uses 42K.\n",
+			approval:       ToolApprove,
+			wantTranscript: "confirm:disk_usage|tool:42K /var|/var uses 42K.",
+		},
+		{
+			name:           "rejected tool call",
+			script:         diskUsage + "  - expect: (?i)reject\n    reply: The disk usage was not checked.\n",
+			approval:       ToolReject,
+			wantTranscript: "confirm:disk_usage|The disk usage was not checked.",
+		},
+		{
+			name:           "tool call without approvals",
+			script:         diskUsage + "  - expect: (?i)reject\n    reply: The disk usage was not checked.\n",
+			approval:       ToolReject,
+			noApprovals:    true,
+			wantTranscript: "The disk usage was not checked.",
+		},
+		{
+			name:    "unexpected prompt",
+			script:  "turns:\n  - expect: memory\n    reply: Plenty.\n",
+			wantErr: `request 1 does not match the expected "memory"`,
+		},
+		{
+			name:           "turns not requested",
+			script:         "turns:\n  - reply: Plenty.\n  - reply: And more.\n",
+			wantTranscript: "Plenty.",
+			wantErr:        "1 scripted turns were not requested (next: turn 2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := filepath.Join(t.TempDir(), "mock.yaml")
+			if err := os.WriteFile(script, []byte(tt.script), 0644); err != nil {
+				t.Fatalf("failed to write script: %v", err)
+			}
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			config := fmt.Sprintf("agent:\n  models:\n    - model: scripted\n      class: mock\n      default: true\n      script: %q\n", script)
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+			t.Setenv(utils.DonConfigEnv, configPath)
+
+			modelConfig := ModelConfig{Model: "scripted", Class: MockModelClass, Script: script}
+			a := New(AgentConfig{
+				ToolsFile:      toolsFile,
+				UserPrompt:     "How much disk does /var use?",
+				Once:           true,
+				MCPShellBinary: binary,
+				ModelConfig:    modelConfig,
+			}, logger)
+			if err := a.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			events := make(chan Event, 100)
+			approvals := make(chan ToolApproval, 1)
+			if tt.noApprovals {
+				approvals = nil
+			}
+			errc := make(chan error, 1)
+			go func() { errc <- a.RunEvents(ctx, nil, events, approvals) }()
+
+			var parts []string
+			for event := range events {
+				switch event.Type {
+				case EventToolConfirmation:
+					parts = append(parts, "confirm:"+event.Tool)
+					approvals <- tt.approval
+				case EventToolResult:
+					if tt.approval != ToolReject {
+						parts = append(parts, "tool:"+event.Content)
+					}
+				case EventMessage:
+					parts = append(parts, event.Content)
+				}
+			}
+			err := <-errc
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RunEvents() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("RunEvents() error = %v", err)
+			}
+			if tt.wantTranscript != "" {
+				if got := strings.Join(parts, "|"); got != tt.wantTranscript {
+					t.Errorf("transcript = %q, want %q", got, tt.wantTranscript)
+				}
+			}
+		})
+	}
+}
+
+func TestMockModelRAG(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	dir := t.TempDir()
+	t.Setenv(utils.DonDirEnv, dir)
+	t.Setenv(fakeMCPShellEnv, "v0.3.1")
+	t.Setenv("OPENAI_API_KEY", "")
+
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	toolsFile := writeFile("tools.yaml", "mcp:\n  tools: []\n")
+	notes := writeFile("notes.md", "# Disks\n\nThe /var partition is cleaned every night by the logrotate job.\n")
+	script := writeFile("mock.yaml", `
+turns:
+  - tool_calls:
+      - name: notes
+        arguments: {query: cleaning of the /var partition}
+  - expect: logrotate
+    reply: The logrotate job cleans /var every night.
+`)
+	configPath := writeFile("agent.yaml", fmt.Sprintf(`
+agent:
+  models:
+    - model: scripted
+      class: mock
+      default: true
+      script: %q
+    - name: embedder
+      model: words
+      class: mock
+      type: embedding
+      dimensions: 64
+`, script))
+	t.Setenv(utils.DonConfigEnv, configPath)
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to get the test binary: %v", err)
+	}
+
+	a := New(AgentConfig{
+		ToolsFile:      toolsFile,
+		UserPrompt:     "How is /var cleaned?",
+		Once:           true,
+		MCPShellBinary: binary,
+		AutoApprove:    true,
+		ModelConfig:    ModelConfig{Model: "scripted", Class: MockModelClass, Script: script},
+		RAGConfig: map[string]RAGSourceConfig{
+			"notes": {
+				Description: "Operations notes",
+				Docs:        RAGDocPaths(notes),
+				Strategies: []RAGStrategyConfig{{
+					Type:     embeddingsStrategy,
+					Model:    "embedder",
+					Database: filepath.Join(dir, "notes.db"),
+				}},
+			},
+		},
+		RAGSources: []string{"notes"},
+	}, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	events := make(chan Event, 100)
+	errc := make(chan error, 1)
+	go func() { errc <- a.RunEvents(ctx, nil, events, nil) }()
+
+	var results, messages []string
+	for event := range events {
+		switch event.Type {
+		case EventToolResult:
+			results = append(results, event.Content)
+		case EventMessage:
+			messages = append(messages, event.Content)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("RunEvents() error = %v", err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0], "logrotate") {
+		t.Errorf("RAG results = %q, want the notes", results)
+	}
+	if got := strings.Join(messages, ""); got != "The logrotate job cleans /var every night." {
+		t.Errorf("answer = %q", got)
+	}
+}
@@ -2,12 +2,30 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/mock"
 	"github.com/sashabaranov/go-openai"
 )
 
+const (
+	// ModelTypeChat is the type of the models used by agents (the default)
+	ModelTypeChat = "chat"
+
+	// ModelTypeEmbedding is the type of the models used by RAG strategies to embed documents
+	ModelTypeEmbedding = "embedding"
+
+	// embeddingProbeText is the text embedded when probing an embedding model
+	embeddingProbeText = "Don embedding model check"
+)
+
+// IsEmbedding returns true for embedding models
+func (c ModelConfig) IsEmbedding() bool {
+	return c.Type == ModelTypeEmbedding
+}
+
 // ModelProvider defines the interface for different model providers
 type ModelProvider interface {
 	// InitializeClient creates and configures the client for this model provider
@@ -36,6 +54,7 @@ func NewModelManager(logger *common.Logger) *ModelManager {
 	// Register all supported providers
 	manager.RegisterProvider("openai", &OpenAIProvider{})
 	manager.RegisterProvider("ollama", &OllamaProvider{})
+	manager.RegisterProvider(MockModelClass, &MockProvider{})
 
 	return manager
 }
@@ -53,10 +72,69 @@ func (mm *ModelManager) InitializeClient(config ModelConfig) (*openai.Client, er
 
 // ValidateConfig validates the configuration for the given model class
 func (mm *ModelManager) ValidateConfig(config ModelConfig) error {
+	switch config.Type {
+	case "", ModelTypeChat:
+	case ModelTypeEmbedding:
+		return fmt.Errorf("model '%s' is an embedding model and cannot be used by agents", config.Model)
+	default:
+		return fmt.Errorf("unknown type '%s' for model '%s' (expected %s or %s)", config.Type, config.Model, ModelTypeChat, ModelTypeEmbedding)
+	}
 	provider := mm.getProvider(config.Class)
 	return provider.ValidateConfig(config, mm.logger)
 }
 
+// ValidateEmbeddingConfig validates the configuration of an embedding model
+func (mm *ModelManager) ValidateEmbeddingConfig(config ModelConfig) error {
+	if !config.IsEmbedding() {
+		return fmt.Errorf("model '%s' is not an embedding model (set type: %s)", config.Model, ModelTypeEmbedding)
+	}
+	if config.Dimensions < 0 {
+		return fmt.Errorf("invalid dimensions for model '%s': %d", config.Model, config.Dimensions)
+	}
+	provider := mm.getProvider(config.Class)
+	return provider.ValidateConfig(config, mm.logger)
+}
+
+// ProbeEmbeddingModel checks that an embedding model works by embedding a short text
+// Returns the size of the vectors of the model, which must match the configured
+// dimensions (if any)
+func (mm *ModelManager) ProbeEmbeddingModel(ctx context.Context, config ModelConfig) (int, error) {
+	if err := mm.ValidateEmbeddingConfig(config); err != nil {
+		return 0, err
+	}
+
+	// Credentials are usually references to environment variables, e.g. ${OPENAI_API_KEY}
+	var err error
+	if config.APIKey, err = expandEnv(config.APIKey); err != nil {
+		return 0, fmt.Errorf("invalid API key: %w", err)
+	}
+	if config.APIURL, err = expandEnv(config.APIURL); err != nil {
+		return 0, fmt.Errorf("invalid API URL: %w", err)
+	}
+
+	client, err := mm.InitializeClient(config)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: []string{embeddingProbeText},
+		Model: openai.EmbeddingModel(config.Model),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("embedding request failed: %w", err)
+	}
+	if len(resp.Data) == 0 || len(resp.Data[0].Embedding) == 0 {
+		return 0, fmt.Errorf("embedding request returned no vectors")
+	}
+
+	dimensions := len(resp.Data[0].Embedding)
+	if config.Dimensions > 0 && dimensions != config.Dimensions {
+		return dimensions, fmt.Errorf("model returned vectors of %d dimensions, but %d are configured", dimensions, config.Dimensions)
+	}
+	return dimensions, nil
+}
+
 // getProvider returns the appropriate provider for the given class
 func (mm *ModelManager) getProvider(class string) ModelProvider {
 	// Default to OpenAI if class is empty or not found
@@ -142,6 +220,60 @@ func (p *OllamaProvider) GetProviderName() string {
 	return "Ollama"
 }
 
+// MockProvider implements ModelProvider for mock models, which answer with the
+// replies of a script (see pkg/mock)
+type MockProvider struct{}
+
+func (p *MockProvider) InitializeClient(config ModelConfig, logger *common.Logger) (*openai.Client, error) {
+	// Embedding models answer without script
+	script := &mock.Script{}
+	if config.Script != "" || !config.IsEmbedding() {
+		if err := p.ValidateConfig(config, logger); err != nil {
+			return nil, err
+		}
+		path, err := expandEnv(config.Script)
+		if err != nil {
+			return nil, fmt.Errorf("invalid script: %w", err)
+		}
+		if script, err = mock.LoadScript(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The client is answered in-process, the URL is never reached
+	clientConfig := openai.DefaultConfig(localAPIKey)
+	clientConfig.BaseURL = "http://mock/v1"
+	clientConfig.HTTPClient = mock.NewServer(script).Client()
+
+	client := openai.NewClientWithConfig(clientConfig)
+	logger.Info("Initialized mock client with model: %s", config.Model)
+	return client, nil
+}
+
+func (p *MockProvider) ValidateConfig(config ModelConfig, logger *common.Logger) error {
+	if config.Script == "" {
+		// Embedding models answer without script
+		if config.IsEmbedding() {
+			return nil
+		}
+		return fmt.Errorf("script is required for mock models")
+	}
+	path, err := expandEnv(config.Script)
+	if err != nil {
+		return fmt.Errorf("invalid script: %w", err)
+	}
+	if _, err := mock.LoadScript(path); err != nil {
+		return err
+	}
+
+	logger.Debug("Mock model configuration validated: %s", config.Script)
+	return nil
+}
+
+func (p *MockProvider) GetProviderName() string {
+	return "Mock"
+}
+
 // GenericProvider implements ModelProvider for unknown/generic model types
 // This allows for extensibility with other OpenAI-compatible APIs
 type GenericProvider struct {
@@ -1,8 +1,14 @@
 package agent
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/sashabaranov/go-openai"
+
 	"github.com/inercia/don/pkg/common"
 )
 
@@ -27,7 +33,7 @@ func TestNewModelManager(t *testing.T) {
 	}
 
 	// Test that default providers are registered
-	expectedProviders := []string{"openai", "ollama"}
+	expectedProviders := []string{"openai", "ollama", MockModelClass}
 	for _, providerClass := range expectedProviders {
 		if _, exists := manager.providers[providerClass]; !exists {
 			t.Errorf("Expected provider '%s' to be registered", providerClass)
@@ -208,6 +214,28 @@ func TestModelManager_ValidateConfig(t *testing.T) {
 			expectErr: true,
 			errMsg:    "model name is required",
 		},
+		{
+			name: "embedding model",
+			config: ModelConfig{
+				Model:  "text-embedding-3-small",
+				Class:  "openai",
+				APIKey: "test-key",
+				Type:   ModelTypeEmbedding,
+			},
+			expectErr: true,
+			errMsg:    "model 'text-embedding-3-small' is an embedding model and cannot be used by agents",
+		},
+		{
+			name: "unknown type",
+			config: ModelConfig{
+				Model:  "gpt-4",
+				Class:  "openai",
+				APIKey: "test-key",
+				Type:   "vision",
+			},
+			expectErr: true,
+			errMsg:    "unknown type 'vision' for model 'gpt-4' (expected chat or embedding)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -447,6 +475,69 @@ func TestGenericProvider(t *testing.T) {
 	})
 }
 
+func TestMockProvider(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	script := filepath.Join(t.TempDir(), "mock.yaml")
+	if err := os.WriteFile(script, []byte("turns:\n  - reply: OK\n"), 0644); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	provider := &MockProvider{}
+
+	tests := []struct {
+		name    string
+		config  ModelConfig
+		wantErr string
+	}{
+		{name: "script", config: ModelConfig{Model: "scripted", Script: script}},
+		{name: "embedding without script", config: ModelConfig{Model: "words", Type: ModelTypeEmbedding}},
+		{name: "no script", config: ModelConfig{Model: "scripted"}, wantErr: "script is required"},
+		{name: "missing script", config: ModelConfig{Model: "scripted", Script: script + ".missing"}, wantErr: "failed to read mock script"},
+		{name: "unset variable", config: ModelConfig{Model: "scripted", Script: "${DON_TEST_UNSET_SCRIPT}"}, wantErr: "DON_TEST_UNSET_SCRIPT is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := provider.ValidateConfig(tt.config, logger)
+			_, clientErr := provider.InitializeClient(tt.config, logger)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ValidateConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				if clientErr == nil || !strings.Contains(clientErr.Error(), tt.wantErr) {
+					t.Errorf("InitializeClient() error = %v, want %q", clientErr, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ValidateConfig() error = %v", err)
+			}
+			if clientErr != nil {
+				t.Errorf("InitializeClient() error = %v", clientErr)
+			}
+		})
+	}
+
+	t.Run("InitializeClient answers from the script", func(t *testing.T) {
+		client, err := provider.InitializeClient(ModelConfig{Model: "scripted", Script: script}, logger)
+		if err != nil {
+			t.Fatalf("InitializeClient() error = %v", err)
+		}
+		resp, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+			Model:    "scripted",
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Respond with just the word 'OK'"}},
+		})
+		if err != nil {
+			t.Fatalf("CreateChatCompletion() error = %v", err)
+		}
+		if got := resp.Choices[0].Message.Content; got != "OK" {
+			t.Errorf("reply = %q, want %q", got, "OK")
+		}
+	})
+}
+
 func TestConvenienceFunctions(t *testing.T) {
 	logger, err := common.NewLogger("", "", common.LogLevelError, false)
 	if err != nil {
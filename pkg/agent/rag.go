@@ -6,44 +6,100 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/inercia/don/pkg/common"
 	"github.com/inercia/don/pkg/rag"
 )
 
+// RAGProcessOptions holds the settings used when processing RAG sources
+type RAGProcessOptions struct {
+	HTTP    []RAGHTTPConfig // Per-host HTTP settings for downloads (agent.rag_http)
+	Cache   *RAGCacheConfig // Cache settings (agent.rag_cache)
+	Reindex bool            // Rebuild the indexes of the sources from scratch
+
+	// OnChanges is called (if set) with the documents of each source added,
+	// changed or removed since the previous run
+	OnChanges func(sourceName string, changes rag.ManifestChanges)
+}
+
 // ProcessRAGSources processes RAG document sources (URLs, files, directories)
 // Downloads remote URLs to local cache and scans local files/directories
 // Returns a map of RAG source names to processed configurations with local paths
-func ProcessRAGSources(ctx context.Context, ragSources map[string]RAGSourceConfig, logger *common.Logger) (map[string]RAGSourceConfig, error) {
+func ProcessRAGSources(ctx context.Context, ragSources map[string]RAGSourceConfig, opts RAGProcessOptions, logger *common.Logger) (map[string]RAGSourceConfig, error) {
 	if len(ragSources) == 0 {
 		return ragSources, nil
 	}
 
 	logger.Info("Processing RAG document sources...")
+	startedAt := time.Now()
 
-	// Create downloader for remote URLs
-	downloaderConfig := rag.DownloaderConfig{
-		Timeout: 30,               // 30 seconds
-		MaxSize: 10 * 1024 * 1024, // 10MB
-		Logger:  logger,
+	// Downloader configuration shared by all sources
+	baseDownloaderConfig := rag.DefaultConfig(logger)
+	for i, httpConfig := range opts.HTTP {
+		settings, err := httpConfig.settings()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rag_http entry %d: %w", i+1, err)
+		}
+		if httpConfig.Match == "" {
+			return nil, fmt.Errorf("invalid rag_http entry %d: match is required", i+1)
+		}
+		baseDownloaderConfig.HTTPRules = append(baseDownloaderConfig.HTTPRules, rag.HTTPRule{
+			Match:    httpConfig.Match,
+			Settings: settings,
+		})
 	}
 
-	downloader, err := rag.NewDownloader(downloaderConfig)
+	cacheDir, err := rag.GetCacheDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create document downloader: %w", err)
+		return nil, fmt.Errorf("failed to get cache directory: %w", err)
 	}
+	baseDownloaderConfig.CacheDir = cacheDir
+
+	// Create git fetcher for git repository sources, sharing the downloader cache
+	gitFetcher := rag.NewGitFetcher(cacheDir, logger)
 
-	// Create file scanner for local files
-	scanner := rag.NewScanner(logger)
+	// Create archive extractor for zip/tar sources, sharing the downloader cache
+	archives, err := rag.NewArchiveExtractor(rag.DefaultArchiveConfig(cacheDir, logger))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive extractor: %w", err)
+	}
 
 	// Process each RAG source
 	processedSources := make(map[string]RAGSourceConfig)
 	for sourceName, sourceConfig := range ragSources {
 		logger.Debug("Processing RAG source: %s", sourceName)
 
+		// Create downloader for remote URLs, with the source HTTP settings (if any)
+		downloaderConfig := baseDownloaderConfig
+		if sourceConfig.HTTP != nil {
+			settings, err := sourceConfig.HTTP.settings()
+			if err != nil {
+				return nil, fmt.Errorf("invalid http settings for RAG source '%s': %w", sourceName, err)
+			}
+			downloaderConfig.HTTP = settings
+		}
+		downloader, err := rag.NewDownloader(downloaderConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create document downloader for RAG source '%s': %w", sourceName, err)
+		}
+
+		// Create file scanner for local files
+		scannerConfig := rag.DefaultScannerConfig(logger)
+		scannerConfig.ExtraExtensions = sourceConfig.Extensions
+		processor := &documentProcessor{
+			downloader: downloader,
+			scanner:    rag.NewScannerWithConfig(scannerConfig),
+			git:        gitFetcher,
+			crawler:    rag.NewCrawler(downloader, logger),
+			archives:   archives,
+			logger:     logger,
+		}
+
 		// Process shared documents
-		processedDocs, err := processDocuments(ctx, sourceConfig.Docs, downloader, scanner, logger)
+		processedDocs, err := processor.processEntries(ctx, sourceConfig.Docs)
 		if err != nil {
 			return nil, fmt.Errorf("failed to process documents for RAG source '%s': %w", sourceName, err)
 		}
@@ -52,7 +108,7 @@ func ProcessRAGSources(ctx context.Context, ragSources map[string]RAGSourceConfi
 		processedStrategies := make([]RAGStrategyConfig, len(sourceConfig.Strategies))
 		for i, strategy := range sourceConfig.Strategies {
 			if len(strategy.Docs) > 0 {
-				strategyDocs, err := processDocuments(ctx, strategy.Docs, downloader, scanner, logger)
+				strategyDocs, err := processor.processEntries(ctx, strategy.Docs)
 				if err != nil {
 					return nil, fmt.Errorf("failed to process documents for strategy '%s' in RAG source '%s': %w", strategy.Type, sourceName, err)
 				}
@@ -61,67 +117,382 @@ func ProcessRAGSources(ctx context.Context, ragSources map[string]RAGSourceConfi
 			processedStrategies[i] = strategy
 		}
 
+		// Report the documents changed since the last run
+		allDocs := docPaths(processedDocs)
+		for _, strategy := range processedStrategies {
+			allDocs = append(allDocs, docPaths(strategy.Docs)...)
+		}
+		manifestPath := sourceConfig.ManifestPath
+		if manifestPath == "" {
+			manifestPath = rag.GetManifestPath(cacheDir, sourceName)
+		}
+		changes, err := updateManifest(manifestPath, sourceName, uniquePaths(allDocs), opts.Reindex, logger)
+		if err != nil {
+			logger.Warn("Failed to update the manifest of RAG source '%s': %v", sourceName, err)
+		} else if opts.OnChanges != nil {
+			opts.OnChanges(sourceName, changes)
+		}
+		if opts.Reindex {
+			if err := removeRAGDatabases(sourceName, sourceConfig.Strategies, logger); err != nil {
+				return nil, fmt.Errorf("failed to reset indexes of RAG source '%s': %w", sourceName, err)
+			}
+		}
+
 		// Create processed source config
 		processedConfig := RAGSourceConfig{
 			Description: sourceConfig.Description,
 			Docs:        processedDocs,
 			Strategies:  processedStrategies,
 			Results:     sourceConfig.Results,
+			Extensions:  sourceConfig.Extensions,
+			HTTP:        sourceConfig.HTTP,
 		}
 
 		processedSources[sourceName] = processedConfig
 		logger.Info("Processed RAG source '%s': %d shared documents, %d strategies", sourceName, len(processedDocs), len(processedStrategies))
 	}
 
+	// Keep the cache within its size limit, never evicting what this run uses
+	if opts.Cache != nil && opts.Cache.MaxSize > 0 {
+		if _, err := rag.PruneCache(ctx, cacheDir, int64(opts.Cache.MaxSize), startedAt, logger); err != nil {
+			logger.Warn("Failed to prune RAG cache: %v", err)
+		}
+	}
+
 	return processedSources, nil
 }
 
-// processDocuments processes a list of document paths (URLs, files, directories)
-// Downloads remote URLs and scans local files/directories
+// updateManifest records the documents of a RAG source in its manifest and reports
+// the documents added, changed or removed since the previous run
+func updateManifest(manifestPath, sourceName string, paths []string, reindex bool, logger *common.Logger) (rag.ManifestChanges, error) {
+	previous, err := rag.LoadManifest(manifestPath)
+	if err != nil {
+		logger.Warn("Ignoring the manifest of RAG source '%s': %v", sourceName, err)
+		previous = nil
+	}
+
+	manifest, err := rag.BuildManifest(sourceName, paths, previous)
+	if err != nil {
+		return rag.ManifestChanges{}, err
+	}
+
+	changes := manifest.Diff(previous)
+	switch {
+	case reindex:
+		logger.Info("RAG source '%s': reindexing all %d documents", sourceName, len(manifest.Files))
+	case previous == nil:
+		logger.Info("RAG source '%s': indexing %d documents", sourceName, len(manifest.Files))
+	case changes.IsEmpty():
+		logger.Info("RAG source '%s': no changes since the last run", sourceName)
+	default:
+		logger.Info("RAG source '%s': %s since the last run", sourceName, changes)
+		for _, path := range changes.Added {
+			logger.Debug("  added: %s", path)
+		}
+		for _, path := range changes.Changed {
+			logger.Debug("  changed: %s", path)
+		}
+		for _, path := range changes.Removed {
+			logger.Debug("  removed: %s", path)
+		}
+	}
+
+	return changes, manifest.Save(manifestPath)
+}
+
+// documentProcessor resolves document locations of a RAG source to local file paths
+type documentProcessor struct {
+	downloader rag.Downloader
+	scanner    rag.Scanner
+	git        *rag.GitFetcher
+	crawler    *rag.Crawler
+	archives   *rag.ArchiveExtractor
+	logger     *common.Logger
+}
+
+// process processes a list of docs entries (URLs, crawls, sitemaps, git repositories, files, directories)
+// Downloads remote URLs, crawls sites, fetches git repositories and scans local files/directories
 // Returns a list of local file paths
-func processDocuments(ctx context.Context, docs []string, downloader rag.Downloader, scanner rag.Scanner, logger *common.Logger) ([]string, error) {
+func (p *documentProcessor) process(ctx context.Context, docs []RAGDocConfig) ([]string, error) {
 	var processedDocs []string
 
-	for _, doc := range docs {
-		// Check if it's a URL
-		if strings.HasPrefix(doc, "http://") || strings.HasPrefix(doc, "https://") {
+	for _, entry := range docs {
+		doc := entry.Path
+		switch {
+		case entry.Crawl != nil:
+			// Crawl a site from its start URL
+			p.logger.Debug("Crawling: %s", entry.Crawl.URL)
+			files, err := p.crawler.Crawl(ctx, entry.Crawl.crawlConfig(rag.DefaultCrawlMaxDepth))
+			if err != nil {
+				return nil, fmt.Errorf("failed to crawl '%s': %w", entry.Crawl.URL, err)
+			}
+			processedDocs = append(processedDocs, files...)
+
+		case entry.Sitemap != nil:
+			// Download the pages listed in a sitemap
+			p.logger.Debug("Expanding sitemap: %s", entry.Sitemap.URL)
+			files, err := p.crawler.Sitemap(ctx, entry.Sitemap.crawlConfig(0))
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand sitemap '%s': %w", entry.Sitemap.URL, err)
+			}
+			processedDocs = append(processedDocs, files...)
+
+		case rag.IsGitSource(doc):
+			// Fetch git repository and scan the checkout
+			files, err := p.processGitSource(ctx, doc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch git source '%s': %w", doc, err)
+			}
+			processedDocs = append(processedDocs, files...)
+
+		case rag.IsArchive(doc):
+			// Download (if remote) and unpack archive, then scan the extracted files
+			files, err := p.processArchive(ctx, doc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process archive '%s': %w", doc, err)
+			}
+			processedDocs = append(processedDocs, files...)
+
+		case isRemoteURL(doc):
 			// Download remote document
-			logger.Debug("Downloading remote document: %s", doc)
-			localPath, err := downloader.Download(ctx, doc)
+			p.logger.Debug("Downloading remote document: %s", doc)
+			localPath, err := p.downloader.Download(ctx, doc)
 			if err != nil {
 				return nil, fmt.Errorf("failed to download document '%s': %w", doc, err)
 			}
 			processedDocs = append(processedDocs, localPath)
-			logger.Debug("Downloaded to: %s", localPath)
-		} else {
+			p.logger.Debug("Downloaded to: %s", localPath)
+
+		default:
 			// Process local file or directory
-			absPath, err := filepath.Abs(doc)
+			files, err := p.processLocalPath(ctx, doc)
 			if err != nil {
-				return nil, fmt.Errorf("failed to resolve path '%s': %w", doc, err)
+				return nil, err
 			}
+			processedDocs = append(processedDocs, files...)
+		}
+	}
 
-			// Check if path exists
-			info, err := os.Stat(absPath)
-			if err != nil {
-				return nil, fmt.Errorf("failed to access path '%s': %w", absPath, err)
-			}
+	return uniquePaths(processedDocs), nil
+}
 
-			if info.IsDir() {
-				// Scan directory for text files
-				logger.Debug("Scanning directory: %s", absPath)
-				files, err := scanner.ScanDirectory(ctx, absPath, true) // recursive
-				if err != nil {
-					return nil, fmt.Errorf("failed to scan directory '%s': %w", absPath, err)
-				}
-				processedDocs = append(processedDocs, files...)
-				logger.Debug("Found %d files in directory", len(files))
-			} else {
-				// Single file
-				logger.Debug("Adding file: %s", absPath)
-				processedDocs = append(processedDocs, absPath)
+// processEntries processes a list of docs entries like process, keeping the
+// metadata of each entry on its documents. The metadata of a document listed by
+// several entries is merged.
+func (p *documentProcessor) processEntries(ctx context.Context, docs []RAGDocConfig) ([]RAGDocConfig, error) {
+	var processed []RAGDocConfig
+	positions := make(map[string]int)
+	for _, entry := range docs {
+		paths, err := p.process(ctx, []RAGDocConfig{entry})
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			if i, ok := positions[path]; ok {
+				processed[i] = withMetadata(path, processed[i].metadata().Merge(entry.metadata()))
+				continue
 			}
+			positions[path] = len(processed)
+			processed = append(processed, withMetadata(path, entry.metadata()))
 		}
 	}
+	return processed, nil
+}
 
-	return processedDocs, nil
+// docMetadata returns the metadata of the documents of a processed RAG source
+// (shared and strategy-specific), keyed by path
+func (s RAGSourceConfig) docMetadata() map[string]*rag.Metadata {
+	metadata := make(map[string]*rag.Metadata)
+	docs := append([]RAGDocConfig(nil), s.Docs...)
+	for _, strategy := range s.Strategies {
+		docs = append(docs, strategy.Docs...)
+	}
+	for _, doc := range docs {
+		if m := doc.metadata(); m != nil {
+			metadata[doc.Path] = m.Merge(metadata[doc.Path])
+		}
+	}
+	return metadata
+}
+
+// uniquePaths removes duplicated paths (e.g. URLs serving the same content), keeping the order
+func uniquePaths(paths []string) []string {
+	seen := make(map[string]bool, len(paths))
+	unique := paths[:0]
+	for _, p := range paths {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+// processGitSource fetches a git repository source and scans the checked out files
+func (p *documentProcessor) processGitSource(ctx context.Context, doc string) ([]string, error) {
+	src, err := rag.ParseGitSource(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Debug("Fetching git source: %s", src)
+	checkout, err := p.git.Fetch(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := p.scanner.ScanDirectory(ctx, checkout.Dir, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan checkout '%s': %w", checkout.Dir, err)
+	}
+	p.logger.Info("Git source %s at commit %s: %d files", src, checkout.Commit, len(files))
+	return files, nil
+}
+
+// processArchive downloads a remote archive (or resolves a local one), extracts it and scans its files
+func (p *documentProcessor) processArchive(ctx context.Context, doc string) ([]string, error) {
+	archivePath := doc
+	if isRemoteURL(doc) {
+		p.logger.Debug("Downloading archive: %s", doc)
+		localPath, err := p.downloader.DownloadArchive(ctx, doc)
+		if err != nil {
+			return nil, err
+		}
+		archivePath = localPath
+	} else {
+		absPath, err := filepath.Abs(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path '%s': %w", doc, err)
+		}
+		archivePath = absPath
+	}
+
+	dir, err := p.archives.Extract(ctx, archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := p.scanner.ScanDirectory(ctx, dir, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan extracted archive '%s': %w", dir, err)
+	}
+	p.logger.Info("Archive %s: %d files", doc, len(files))
+	return files, nil
+}
+
+// isRemoteURL checks if a document location is an http(s) URL
+func isRemoteURL(doc string) bool {
+	return strings.HasPrefix(doc, "http://") || strings.HasPrefix(doc, "https://")
+}
+
+// processLocalPath scans a local file or directory
+func (p *documentProcessor) processLocalPath(ctx context.Context, doc string) ([]string, error) {
+	absPath, err := filepath.Abs(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path '%s': %w", doc, err)
+	}
+
+	// Check if path exists
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access path '%s': %w", absPath, err)
+	}
+
+	if info.IsDir() {
+		// Scan directory for text files
+		p.logger.Debug("Scanning directory: %s", absPath)
+		files, err := p.scanner.ScanDirectory(ctx, absPath, true) // recursive
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan directory '%s': %w", absPath, err)
+		}
+		p.logger.Debug("Found %d files in directory", len(files))
+		return files, nil
+	}
+
+	// Single file
+	p.logger.Debug("Adding file: %s", absPath)
+	filePath, err := p.scanner.ScanFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add file '%s': %w", absPath, err)
+	}
+	return []string{filePath}, nil
+}
+
+// crawlConfig converts a crawl docs entry to a rag.CrawlConfig, applying defaults
+func (c *RAGCrawlConfig) crawlConfig(defaultMaxDepth int) rag.CrawlConfig {
+	maxDepth := defaultMaxDepth
+	if c.MaxDepth != nil {
+		maxDepth = *c.MaxDepth
+	}
+	sameHost := true
+	if c.SameHost != nil {
+		sameHost = *c.SameHost
+	}
+	return rag.CrawlConfig{
+		URL:          c.URL,
+		MaxDepth:     maxDepth,
+		MaxPages:     c.MaxPages,
+		SameHost:     sameHost,
+		Include:      c.Include,
+		Exclude:      c.Exclude,
+		IgnoreRobots: c.IgnoreRobots,
+	}
+}
+
+// envReference matches ${VAR} references in HTTP settings
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} references with the value of the environment variable
+// Unlike os.ExpandEnv, a plain "$" is kept as is and unset variables are an error
+func expandEnv(s string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// settings converts HTTP settings from the config file to rag.HTTPSettings,
+// expanding ${VAR} references
+func (c *RAGHTTPConfig) settings() (rag.HTTPSettings, error) {
+	var err error
+	expand := func(s string) string {
+		if err != nil {
+			return ""
+		}
+		var expanded string
+		expanded, err = expandEnv(s)
+		return expanded
+	}
+
+	settings := rag.HTTPSettings{
+		BearerToken: expand(c.BearerToken),
+		CAFile:      expand(c.CAFile),
+		Proxy:       expand(c.Proxy),
+		UserAgent:   expand(c.UserAgent),
+		Timeout:     c.Timeout,
+		MaxSize:     int64(c.MaxSize),
+	}
+	if len(c.Headers) > 0 {
+		settings.Headers = make(map[string]string, len(c.Headers))
+		for k, v := range c.Headers {
+			settings.Headers[k] = expand(v)
+		}
+	}
+	if c.BasicAuth != nil {
+		settings.Username = expand(c.BasicAuth.Username)
+		settings.Password = expand(c.BasicAuth.Password)
+	}
+	if err != nil {
+		return rag.HTTPSettings{}, err
+	}
+	return settings, nil
 }
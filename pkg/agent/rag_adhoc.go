@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+const (
+	// AdHocRAGSourceName is the name of the RAG source built from --rag-docs
+	AdHocRAGSourceName = "rag_docs"
+
+	// adHocEmbeddingModel is the embedding model of ad-hoc sources, used when an
+	// OpenAI API key is available
+	adHocEmbeddingModel = "openai/text-embedding-3-small"
+
+	// adHocEmbeddingDimensions is the size of the vectors of adHocEmbeddingModel
+	adHocEmbeddingDimensions = 1536
+
+	// adHocDescribedDocs is the number of documents named in the description of an ad-hoc source
+	adHocDescribedDocs = 3
+)
+
+// NewAdHocRAGSource builds a RAG source for a single run over some documents
+// (paths, URLs, git repositories or archives, as in the docs of a source)
+// It uses a bm25 strategy, plus a chunked-embeddings one if an OpenAI API key
+// is set, with their results fused. The strategy databases are created in a
+// temporary directory, with the manifest of the source, so concurrent runs do not
+// share them: the returned function removes them when the run is over.
+func NewAdHocRAGSource(docs []string, logger *common.Logger) (RAGSourceConfig, func(), error) {
+	dbDir, err := os.MkdirTemp("", "don-rag-docs-")
+	if err != nil {
+		return RAGSourceConfig{}, nil, fmt.Errorf("failed to create directory for RAG databases: %w", err)
+	}
+
+	strategies := []RAGStrategyConfig{{
+		Type:     "bm25",
+		Database: filepath.Join(dbDir, "bm25.db"),
+		Limit:    defaultRAGStrategyLimit,
+	}}
+	if os.Getenv("OPENAI_API_KEY") != "" {
+		strategies = append(strategies, RAGStrategyConfig{
+			Type:             embeddingsStrategy,
+			Model:            adHocEmbeddingModel,
+			VectorDimensions: adHocEmbeddingDimensions,
+			Database:         filepath.Join(dbDir, "embeddings.db"),
+			Limit:            defaultRAGStrategyLimit,
+		})
+	} else {
+		logger.Info("OPENAI_API_KEY is not set, searching the documents by keywords only")
+	}
+
+	source := RAGSourceConfig{
+		Description: describeAdHocDocs(docs),
+		Docs:        RAGDocPaths(docs...),
+		Strategies:  strategies,
+		Results: &RAGResultsConfig{
+			Limit:       2 * defaultRAGStrategyLimit,
+			Fusion:      &RAGFusionConfig{Strategy: rag.FusionRRF},
+			Deduplicate: true,
+		},
+		ManifestPath: filepath.Join(dbDir, "manifest.json"),
+	}
+
+	cleanup := func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			logger.Warn("Failed to remove RAG databases in %s: %v", dbDir, err)
+		}
+	}
+	return source, cleanup, nil
+}
+
+// describeAdHocDocs returns the description of an ad-hoc source, naming its first documents
+func describeAdHocDocs(docs []string) string {
+	names := make([]string, 0, adHocDescribedDocs)
+	for _, doc := range docs[:min(len(docs), adHocDescribedDocs)] {
+		names = append(names, filepath.Base(doc))
+	}
+	description := "the documents given by the user (" + strings.Join(names, ", ")
+	if len(docs) > adHocDescribedDocs {
+		description += fmt.Sprintf(" and %d more", len(docs)-adHocDescribedDocs)
+	}
+	return description + ")"
+}
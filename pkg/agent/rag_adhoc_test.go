@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+func TestNewAdHocRAGSource(t *testing.T) {
+	t.Setenv(rag.CacheDirEnv, t.TempDir())
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		apiKey         string
+		wantStrategies []string
+	}{
+		{"keywords only", "", []string{"bm25"}},
+		{"with embeddings", "sk-test", []string{"bm25", "chunked-embeddings"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPENAI_API_KEY", tt.apiKey)
+			source, cleanup, err := NewAdHocRAGSource([]string{"app.log", "https://example.com/guide.html"}, logger)
+			if err != nil {
+				t.Fatalf("NewAdHocRAGSource() error = %v", err)
+			}
+
+			if len(source.Docs) != 2 || source.Docs[0].Path != "app.log" {
+				t.Errorf("Docs = %v, want the given documents", source.Docs)
+			}
+			if len(source.Strategies) != len(tt.wantStrategies) {
+				t.Fatalf("Strategies = %v, want %v", source.Strategies, tt.wantStrategies)
+			}
+			dbDir := filepath.Dir(source.Strategies[0].Database)
+			for i, strategy := range source.Strategies {
+				if strategy.Type != tt.wantStrategies[i] {
+					t.Errorf("Strategies[%d].Type = %s, want %s", i, strategy.Type, tt.wantStrategies[i])
+				}
+				if filepath.Dir(strategy.Database) != dbDir {
+					t.Errorf("Strategies[%d].Database = %s, want a database in %s", i, strategy.Database, dbDir)
+				}
+			}
+
+			cleanup()
+			if _, err := os.Stat(dbDir); !os.IsNotExist(err) {
+				t.Errorf("database directory %s still exists after cleanup", dbDir)
+			}
+		})
+	}
+}
+
+func TestNewAdHocRAGSourceConcurrentRuns(t *testing.T) {
+	t.Setenv(rag.CacheDirEnv, t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	first, cleanupFirst, err := NewAdHocRAGSource([]string{"app.log"}, logger)
+	if err != nil {
+		t.Fatalf("NewAdHocRAGSource() error = %v", err)
+	}
+	second, cleanupSecond, err := NewAdHocRAGSource([]string{"worker.log"}, logger)
+	if err != nil {
+		t.Fatalf("NewAdHocRAGSource() error = %v", err)
+	}
+	defer cleanupSecond()
+
+	if first.ManifestPath == second.ManifestPath {
+		t.Fatalf("ManifestPath = %s for both runs, want one per run", first.ManifestPath)
+	}
+	for _, source := range []RAGSourceConfig{first, second} {
+		if err := os.WriteFile(source.ManifestPath, []byte("{}"), 0644); err != nil {
+			t.Fatalf("Failed to write manifest: %v", err)
+		}
+	}
+
+	// The end of a run keeps the manifest of the other one
+	cleanupFirst()
+	if _, err := os.Stat(first.ManifestPath); !os.IsNotExist(err) {
+		t.Errorf("manifest %s still exists after cleanup", first.ManifestPath)
+	}
+	if _, err := os.Stat(second.ManifestPath); err != nil {
+		t.Errorf("manifest of the other run was removed: %v", err)
+	}
+}
+
+func TestDescribeAdHocDocs(t *testing.T) {
+	tests := []struct {
+		docs []string
+		want string
+	}{
+		{[]string{"/var/log/app.log"}, "the documents given by the user (app.log)"},
+		{[]string{"a.log", "b.log", "c.log", "d.log", "e.log"}, "the documents given by the user (a.log, b.log, c.log and 2 more)"},
+	}
+	for _, tt := range tests {
+		if got := describeAdHocDocs(tt.docs); got != tt.want {
+			t.Errorf("describeAdHocDocs(%v) = %q, want %q", tt.docs, got, tt.want)
+		}
+	}
+}
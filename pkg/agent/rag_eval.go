@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+const (
+	// DefaultRAGEvalK is the default number of results considered per question
+	DefaultRAGEvalK = 5
+
+	// RAGEvalFused is the name of the fused results in an evaluation report
+	RAGEvalFused = "fused"
+)
+
+// RAGEvalQuestion is a question of an evaluation file, with the documents or
+// keywords expected in its results
+type RAGEvalQuestion struct {
+	Question string   `yaml:"question"`
+	Sources  []string `yaml:"sources,omitempty"`  // Expected documents: paths (or path suffixes) and URLs
+	Keywords []string `yaml:"keywords,omitempty"` // Expected keywords in the retrieved chunks
+}
+
+// RAGEvalFile holds the questions used to evaluate a RAG source
+type RAGEvalFile struct {
+	Questions []RAGEvalQuestion `yaml:"questions"`
+}
+
+// RAGEvalReport holds the retrieval metrics of a RAG source, for each strategy
+// and for the fused results
+type RAGEvalReport struct {
+	Source     string                     `json:"source"`
+	K          int                        `json:"k"`
+	Strategies []string                   `json:"strategies"` // Strategies in run order, followed by "fused"
+	Metrics    map[string]rag.EvalMetrics `json:"metrics"`
+	Questions  []RAGEvalQuestionResult    `json:"questions"`
+}
+
+// RAGEvalQuestionResult holds the scores of a question for each strategy and the fused results
+type RAGEvalQuestionResult struct {
+	Question string                   `json:"question"`
+	Scores   map[string]rag.EvalScore `json:"scores"`
+}
+
+// LoadRAGEvalQuestions loads the questions of an evaluation file
+func LoadRAGEvalQuestions(path string) ([]rag.EvalQuestion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read questions file: %w", err)
+	}
+	var file RAGEvalFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse questions file %s: %w", path, err)
+	}
+	if len(file.Questions) == 0 {
+		return nil, fmt.Errorf("no questions in %s", path)
+	}
+
+	questions := make([]rag.EvalQuestion, len(file.Questions))
+	for i, q := range file.Questions {
+		if q.Question == "" {
+			return nil, fmt.Errorf("question %d: question is required", i+1)
+		}
+		if len(q.Sources) == 0 && len(q.Keywords) == 0 {
+			return nil, fmt.Errorf("question %d: sources or keywords are required", i+1)
+		}
+		questions[i] = rag.EvalQuestion{Question: q.Question, Sources: q.Sources, Keywords: q.Keywords}
+	}
+	return questions, nil
+}
+
+// EvaluateRAGSource runs the retrieval of a processed RAG source for a set of
+// questions with the local engine (see RAGSearcher), and computes recall@k and
+// MRR for each strategy and for the fused results
+func EvaluateRAGSource(ctx context.Context, sourceName string, source RAGSourceConfig, questions []rag.EvalQuestion, k int, reindex bool, logger *common.Logger) (*RAGEvalReport, error) {
+	if k <= 0 {
+		k = DefaultRAGEvalK
+	}
+	searcher, err := NewRAGSearcher(ctx, sourceName, source, reindex, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RAGEvalReport{
+		Source:     sourceName,
+		K:          k,
+		Strategies: append(searcher.StrategyNames(), RAGEvalFused),
+		Metrics:    make(map[string]rag.EvalMetrics),
+	}
+	scores := make(map[string][]rag.EvalScore)
+	for _, question := range questions {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result := RAGEvalQuestionResult{Question: question.Question, Scores: make(map[string]rag.EvalScore)}
+
+		// Strategy results are scored before fusing them, as fusion can reuse them
+		strategyResults := searcher.SearchStrategies(question.Question)
+		for name, results := range strategyResults {
+			result.Scores[name] = rag.ScoreResults(question, results, k)
+		}
+		fused, err := searcher.Fuse(strategyResults, k)
+		if err != nil {
+			return nil, err
+		}
+		result.Scores[RAGEvalFused] = rag.ScoreResults(question, fused, k)
+
+		for name, score := range result.Scores {
+			scores[name] = append(scores[name], score)
+		}
+		report.Questions = append(report.Questions, result)
+	}
+
+	for name, nameScores := range scores {
+		report.Metrics[name] = rag.AggregateScores(nameScores)
+	}
+	return report, nil
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+func TestLoadRAGEvalQuestions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr string
+	}{
+		{
+			name: "valid",
+			content: `questions:
+  - question: "How do I install it?"
+    sources: ["docs/install.md"]
+  - question: "Where is the cache?"
+    keywords: ["cache"]
+`,
+			want: 2,
+		},
+		{name: "no questions", content: "questions: []\n", wantErr: "no questions"},
+		{name: "missing question", content: "questions:\n  - sources: [a.md]\n", wantErr: "question is required"},
+		{name: "missing expectations", content: "questions:\n  - question: why?\n", wantErr: "sources or keywords are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "qa.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write questions: %v", err)
+			}
+			questions, err := LoadRAGEvalQuestions(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadRAGEvalQuestions() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadRAGEvalQuestions() error = %v", err)
+			}
+			if len(questions) != tt.want {
+				t.Errorf("LoadRAGEvalQuestions() = %d questions, want %d", len(questions), tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateRAGSource(t *testing.T) {
+	t.Setenv(rag.CacheDirEnv, t.TempDir())
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	dir := t.TempDir()
+	docs := map[string]string{
+		"install.md": "Run go install to install the agent.",
+		"cache.md":   "The cache directory can be moved with an environment variable.",
+	}
+	var paths []string
+	for name, content := range docs {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write document: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	source := RAGSourceConfig{
+		Docs:       RAGDocPaths(paths...),
+		Strategies: []RAGStrategyConfig{{Type: "bm25"}, {Type: "bm25", Chunking: RAGChunkingConfig{Size: 20}}},
+	}
+	questions := []rag.EvalQuestion{
+		{Question: "install the agent", Sources: []string{"install.md"}},
+		{Question: "kubernetes operators", Sources: []string{"k8s.md"}},
+	}
+	report, err := EvaluateRAGSource(context.Background(), "docs", source, questions, 0, false, logger)
+	if err != nil {
+		t.Fatalf("EvaluateRAGSource() error = %v", err)
+	}
+
+	if report.K != DefaultRAGEvalK {
+		t.Errorf("K = %d, want %d", report.K, DefaultRAGEvalK)
+	}
+	if want := []string{"bm25", "bm25-2", RAGEvalFused}; strings.Join(report.Strategies, ",") != strings.Join(want, ",") {
+		t.Errorf("Strategies = %v, want %v", report.Strategies, want)
+	}
+	for _, name := range report.Strategies {
+		metrics := report.Metrics[name]
+		if metrics.Hits != 1 || metrics.Recall != 0.5 || metrics.MRR != 0.5 {
+			t.Errorf("Metrics[%s] = %+v, want 1 hit, recall 0.5 and MRR 0.5", name, metrics)
+		}
+	}
+	if len(report.Questions) != 2 || report.Questions[1].Scores[RAGEvalFused].Rank != 0 {
+		t.Errorf("Questions = %+v, want the second question without relevant results", report.Questions)
+	}
+}
@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	cagentAgent "github.com/docker/cagent/pkg/agent"
+	"github.com/docker/cagent/pkg/rag/database"
+	"github.com/docker/cagent/pkg/team"
+	"github.com/docker/cagent/pkg/tools"
+	"github.com/docker/cagent/pkg/tools/builtin"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+// ragFilterArgs are the arguments of a RAG tool with a metadata filter
+type ragFilterArgs struct {
+	Query  string `json:"query" jsonschema:"Search query"`
+	Filter string `json:"filter,omitempty" jsonschema:"Optional filter on the document metadata: comma-separated key=value conditions that must all hold, e.g. tag=prod or tag=prod,service=payments"`
+}
+
+const (
+	// ragFilterOverFetch multiplies the limits of the sources with document
+	// metadata, so enough results are left once the filter drops some of them
+	ragFilterOverFetch = 5
+
+	// ragToolMaxResults is the number of results of a RAG tool for a source
+	// without results.limit, as in the cagent RAG tool
+	ragToolMaxResults = 10
+)
+
+// ragQuerier runs the queries of a RAG source (a cagent RAG manager)
+type ragQuerier interface {
+	Query(ctx context.Context, query string) ([]database.SearchResult, error)
+}
+
+// ragFilterToolSet wraps the cagent RAG tool of a source whose documents have
+// metadata, adding a filter argument. The source is queried with its limits
+// raised by ragFilterOverFetch, and results are filtered before being cut to
+// the limit of the source, so the filter does not hide matching documents
+// ranked below it.
+type ragFilterToolSet struct {
+	tools.ToolSet
+	querier  ragQuerier
+	limit    int                      // Maximum number of results returned
+	metadata map[string]*rag.Metadata // Metadata of the documents, keyed by path
+	logger   *common.Logger
+}
+
+// Tools returns the tools of the wrapped RAG tool set, accepting a filter
+func (t *ragFilterToolSet) Tools(ctx context.Context) ([]tools.Tool, error) {
+	ragTools, err := t.ToolSet.Tools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ragTools {
+		tool := &ragTools[i]
+		tool.Parameters = tools.MustSchemaFor[ragFilterArgs]()
+		tool.Description = strings.TrimSpace(tool.Description + " " + t.describeMetadata())
+		tool.Handler = t.handler(tool.Name)
+	}
+	return ragTools, nil
+}
+
+// handler queries the source of a RAG tool, drops the results from documents
+// not matching the filter of the call, and returns the best ones
+func (t *ragFilterToolSet) handler(toolName string) tools.ToolHandler {
+	return func(ctx context.Context, toolCall tools.ToolCall) (*tools.ToolCallResult, error) {
+		var args ragFilterArgs
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+			return nil, err
+		}
+		if args.Query == "" {
+			return nil, fmt.Errorf("query cannot be empty")
+		}
+		filter, err := rag.ParseMetadataFilter(args.Filter)
+		if err != nil {
+			return tools.ResultError(err.Error()), nil
+		}
+
+		results, err := t.querier.Query(ctx, args.Query)
+		if err != nil {
+			return nil, fmt.Errorf("RAG query failed: %w", err)
+		}
+
+		filtered := make([]builtin.QueryResult, 0, len(results))
+		for _, result := range results {
+			if !filter.Matches(t.metadata[result.Document.SourcePath]) {
+				continue
+			}
+			filtered = append(filtered, builtin.QueryResult{
+				SourcePath: result.Document.SourcePath,
+				Content:    result.Document.Content,
+				Similarity: result.Similarity,
+				ChunkIndex: result.Document.ChunkIndex,
+			})
+		}
+		sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].Similarity > filtered[j].Similarity })
+		if len(filtered) > t.limit {
+			filtered = filtered[:t.limit]
+		}
+		if len(filter) > 0 {
+			t.logger.Debug("RAG tool '%s': %d of %d results match filter '%s'", toolName, len(filtered), len(results), filter)
+		}
+
+		output, err := json.Marshal(filtered)
+		if err != nil {
+			return nil, err
+		}
+		return tools.ResultSuccess(string(output)), nil
+	}
+}
+
+// describeMetadata tells the model the tags and properties it can filter on
+func (t *ragFilterToolSet) describeMetadata() string {
+	all := make([]*rag.Metadata, 0, len(t.metadata))
+	for _, m := range t.metadata {
+		all = append(all, m)
+	}
+	tags, properties := rag.MetadataKeys(all)
+
+	var available []string
+	if len(tags) > 0 {
+		available = append(available, "tags "+strings.Join(tags, ", "))
+	}
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		available = append(available, fmt.Sprintf("%s (%s)", key, strings.Join(properties[key], ", ")))
+	}
+	return fmt.Sprintf("Documents have metadata: %s. Use the filter argument (e.g. tag=<tag> or <property>=<value>) "+
+		"to only search the documents relevant to the question.", strings.Join(available, "; "))
+}
+
+// addRAGFilters replaces the RAG tools of the root agent of a team with tools
+// accepting a metadata filter, for the processed sources with document metadata
+func addRAGFilters(ctx context.Context, agentTeam *team.Team, sources map[string]RAGSourceConfig, logger *common.Logger) error {
+	filtered := make(map[string]RAGSourceConfig)
+	for name, source := range sources {
+		if len(source.docMetadata()) > 0 {
+			filtered[name] = source
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	managers := agentTeam.RAGManagers()
+
+	root, err := agentTeam.Agent("root")
+	if err != nil {
+		return err
+	}
+	toolSets := root.ToolSets()
+	for i, toolSet := range toolSets {
+		if startable, ok := toolSet.(*cagentAgent.StartableToolSet); ok {
+			toolSet = startable.ToolSet
+		}
+		toolSets[i] = toolSet
+
+		if _, ok := toolSet.(*builtin.RAGTool); !ok {
+			continue
+		}
+		ragTools, err := toolSet.Tools(ctx)
+		if err != nil || len(ragTools) == 0 {
+			continue
+		}
+		// RAG tools are named after their source (see addRAGSources)
+		name := ragTools[0].Name
+		source, ok := filtered[name]
+		manager, found := managers[name]
+		if !ok || !found {
+			continue
+		}
+		limit := ragToolMaxResults
+		if source.Results != nil && source.Results.Limit > 0 {
+			limit = source.Results.Limit
+		}
+		metadata := source.docMetadata()
+		toolSets[i] = &ragFilterToolSet{ToolSet: toolSet, querier: manager, limit: limit, metadata: metadata, logger: logger}
+		logger.Debug("Added metadata filter to RAG tool '%s' (%d documents with metadata)", name, len(metadata))
+	}
+	cagentAgent.WithToolSets(toolSets...)(root)
+	return nil
+}
@@ -0,0 +1,246 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cagentAgent "github.com/docker/cagent/pkg/agent"
+	cagentRAG "github.com/docker/cagent/pkg/rag"
+	"github.com/docker/cagent/pkg/rag/database"
+	"github.com/docker/cagent/pkg/rag/strategy"
+	"github.com/docker/cagent/pkg/team"
+	"github.com/docker/cagent/pkg/tools"
+	"github.com/docker/cagent/pkg/tools/builtin"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+func TestProcessRAGSourcesMetadata(t *testing.T) {
+	t.Setenv(rag.CacheDirEnv, t.TempDir())
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"prod/payments.md", "staging/payments.md", "common.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("restart the payments service"), 0644); err != nil {
+			t.Fatalf("failed to write document: %v", err)
+		}
+	}
+
+	sources := map[string]RAGSourceConfig{"runbooks": {
+		Docs: []RAGDocConfig{
+			{Path: filepath.Join(dir, "prod"), Tags: []string{"prod"}, Properties: map[string]string{"service": "payments"}},
+			{Path: filepath.Join(dir, "staging"), Tags: []string{"staging"}},
+			{Path: filepath.Join(dir, "common.md")},
+			{Path: filepath.Join(dir, "prod", "payments.md"), Tags: []string{"critical"}},
+		},
+		Strategies: []RAGStrategyConfig{{Type: "bm25"}},
+	}}
+	processed, err := ProcessRAGSources(context.Background(), sources, RAGProcessOptions{}, logger)
+	if err != nil {
+		t.Fatalf("ProcessRAGSources() error = %v", err)
+	}
+
+	source := processed["runbooks"]
+	if len(source.Docs) != 3 {
+		t.Fatalf("processed %d documents, want 3: %v", len(source.Docs), source.Docs)
+	}
+	metadata := source.docMetadata()
+	prod := metadata[filepath.Join(dir, "prod", "payments.md")]
+	if prod == nil || strings.Join(prod.Tags, ",") != "prod,critical" || prod.Properties["service"] != "payments" {
+		t.Errorf("metadata of the prod runbook = %+v, want merged tags and properties", prod)
+	}
+	if staging := metadata[filepath.Join(dir, "staging", "payments.md")]; staging == nil || strings.Join(staging.Tags, ",") != "staging" {
+		t.Errorf("metadata of the staging runbook = %+v, want the staging tag", staging)
+	}
+	if untagged := metadata[filepath.Join(dir, "common.md")]; untagged != nil {
+		t.Errorf("metadata of an untagged document = %+v, want none", untagged)
+	}
+
+	// Local searches can be filtered by metadata
+	results, err := SearchRAGSource(context.Background(), "runbooks", source, "restart payments", RAGSearchOptions{
+		Filter: rag.MetadataFilter{{Key: "tag", Value: "staging"}},
+	}, logger)
+	if err != nil {
+		t.Fatalf("SearchRAGSource() error = %v", err)
+	}
+	if len(results) != 1 || !strings.HasSuffix(results[0].Chunk.Path, filepath.Join("staging", "payments.md")) || results[0].Chunk.Metadata == nil {
+		t.Errorf("SearchRAGSource() with filter = %+v, want the staging runbook with its metadata", results)
+	}
+}
+
+// fakeRAGToolSet is a tool set with a single RAG tool, describing a source
+type fakeRAGToolSet struct {
+	tools.BaseToolSet
+}
+
+func (f *fakeRAGToolSet) Tools(context.Context) ([]tools.Tool, error) {
+	return []tools.Tool{{Name: "runbooks", Description: "Search the runbooks."}}, nil
+}
+
+// fakeRAGStrategy is a retrieval strategy returning documents in a fixed order
+type fakeRAGStrategy struct {
+	paths   []string // Documents, best first
+	queries []string
+}
+
+func (f *fakeRAGStrategy) Query(_ context.Context, query string, numResults int, _ float64) ([]database.SearchResult, error) {
+	f.queries = append(f.queries, query)
+	var results []database.SearchResult
+	for i, path := range f.paths {
+		if i == numResults {
+			break
+		}
+		results = append(results, database.SearchResult{
+			Document:   database.Document{SourcePath: path, Content: filepath.Base(path)},
+			Similarity: 1 / float64(i+1),
+		})
+	}
+	return results, nil
+}
+
+func (f *fakeRAGStrategy) Initialize(context.Context, []string, strategy.ChunkingConfig) error {
+	return nil
+}
+
+func (f *fakeRAGStrategy) CheckAndReindexChangedFiles(context.Context, []string, strategy.ChunkingConfig) error {
+	return nil
+}
+
+func (f *fakeRAGStrategy) StartFileWatcher(context.Context, []string, strategy.ChunkingConfig) error {
+	return nil
+}
+
+func (f *fakeRAGStrategy) Close() error {
+	return nil
+}
+
+// newFakeRAGManager creates a cagent RAG manager for a strategy, with a limit
+func newFakeRAGManager(t *testing.T, fake *fakeRAGStrategy, limit int) *cagentRAG.Manager {
+	t.Helper()
+	manager, err := cagentRAG.New(context.Background(), "runbooks", cagentRAG.Config{
+		StrategyConfigs: []strategy.Config{{Name: "bm25", Strategy: fake, Limit: limit}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create RAG manager: %v", err)
+	}
+	return manager
+}
+
+func TestRAGFilterToolSet(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	// The prod runbook ranks below the limit of the source
+	paths := []string{"/runbooks/common.md", "/runbooks/staging.md"}
+	for i := 0; i < 10; i++ {
+		paths = append(paths, fmt.Sprintf("/runbooks/other-%d.md", i))
+	}
+	paths = append(paths, "/runbooks/prod.md")
+	fake := &fakeRAGStrategy{paths: paths}
+	limit := 5
+
+	toolSet := &ragFilterToolSet{
+		ToolSet: &fakeRAGToolSet{},
+		querier: newFakeRAGManager(t, fake, limit*ragFilterOverFetch),
+		limit:   limit,
+		metadata: map[string]*rag.Metadata{
+			"/runbooks/prod.md":    {Tags: []string{"prod"}, Properties: map[string]string{"service": "payments"}},
+			"/runbooks/staging.md": {Tags: []string{"staging"}},
+		},
+		logger: logger,
+	}
+
+	ragTools, err := toolSet.Tools(context.Background())
+	if err != nil || len(ragTools) != 1 {
+		t.Fatalf("Tools() = %v, %v, want a single tool", ragTools, err)
+	}
+	tool := ragTools[0]
+	if !strings.Contains(tool.Description, "tags prod, staging") || !strings.Contains(tool.Description, "service (payments)") {
+		t.Errorf("Description = %q, want the available tags and properties", tool.Description)
+	}
+
+	call := func(arguments string) (*tools.ToolCallResult, []ragToolResult) {
+		t.Helper()
+		result, err := tool.Handler(context.Background(), tools.ToolCall{Function: tools.FunctionCall{Name: "runbooks", Arguments: arguments}})
+		if err != nil {
+			t.Fatalf("Handler() error = %v", err)
+		}
+		var results []ragToolResult
+		if !result.IsError {
+			if err := json.Unmarshal([]byte(result.Output), &results); err != nil {
+				t.Fatalf("failed to parse results: %v", err)
+			}
+		}
+		return result, results
+	}
+
+	if _, results := call(`{"query": "restart"}`); len(results) != limit || results[0].SourcePath != "/runbooks/common.md" {
+		t.Errorf("results without filter = %v, want the %d best ones", results, limit)
+	}
+	if _, results := call(`{"query": "restart", "filter": "tag=prod"}`); len(results) != 1 || results[0].SourcePath != "/runbooks/prod.md" {
+		t.Errorf("results with filter = %v, want the prod runbook", results)
+	}
+	if _, results := call(`{"query": "restart", "filter": "tag=prod,service=orders"}`); len(results) != 0 {
+		t.Errorf("results with a filter matching nothing = %v, want none", results)
+	}
+	if result, _ := call(`{"query": "restart", "filter": "prod"}`); !result.IsError {
+		t.Error("expected an error result for an invalid filter")
+	}
+	if last := fake.queries[len(fake.queries)-1]; last != "restart" {
+		t.Errorf("query sent to the RAG source = %s, want only the query", last)
+	}
+}
+
+func TestAddRAGFilters(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	root := cagentAgent.New("root", "", cagentAgent.WithToolSets(
+		builtin.NewRAGTool(nil, "runbooks"),
+		builtin.NewRAGTool(nil, "docs"),
+	))
+	agentTeam := team.New(team.WithAgents(root), team.WithRAGManagers(map[string]*cagentRAG.Manager{
+		"runbooks": newFakeRAGManager(t, &fakeRAGStrategy{}, 5),
+	}))
+
+	sources := map[string]RAGSourceConfig{
+		"runbooks": {Docs: []RAGDocConfig{{Path: "/runbooks/prod.md", Tags: []string{"prod"}}}},
+		"docs":     {Docs: RAGDocPaths("/docs/guide.md")},
+	}
+	if err := addRAGFilters(context.Background(), agentTeam, sources, logger); err != nil {
+		t.Fatalf("addRAGFilters() error = %v", err)
+	}
+
+	toolSets := root.ToolSets()
+	if len(toolSets) != 2 {
+		t.Fatalf("root agent has %d tool sets, want 2", len(toolSets))
+	}
+	unwrap := func(toolSet tools.ToolSet) tools.ToolSet {
+		if startable, ok := toolSet.(*cagentAgent.StartableToolSet); ok {
+			return startable.ToolSet
+		}
+		return toolSet
+	}
+	if _, ok := unwrap(toolSets[0]).(*ragFilterToolSet); !ok {
+		t.Errorf("tool set of a source with metadata is %T, want a filter", unwrap(toolSets[0]))
+	}
+	if _, ok := unwrap(toolSets[1]).(*builtin.RAGTool); !ok {
+		t.Errorf("tool set of a source without metadata is %T, want the RAG tool", unwrap(toolSets[1]))
+	}
+}
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+// defaultRAGStrategyLimit is the default number of results of a strategy, as in cagent
+const defaultRAGStrategyLimit = 5
+
+// RAGSearchOptions holds the settings of a local search of a RAG source
+type RAGSearchOptions struct {
+	Limit   int                // Maximum number of results (default: the source results limit)
+	Reindex bool               // Rebuild the indexes of the source from scratch
+	Filter  rag.MetadataFilter // Only search the documents with matching metadata
+}
+
+// RAGSearcher searches a processed RAG source (see ProcessRAGSources) with the
+// local retrieval engine, without an LLM. Only keyword strategies (bm25) can run
+// locally: other strategies are skipped, and a source without a bm25 strategy is
+// searched with a default one over its shared documents.
+type RAGSearcher struct {
+	strategies []ragSearchStrategy
+	fusion     rag.FusionConfig
+	results    *RAGResultsConfig
+	resolver   *rag.SourceResolver
+	metadata   map[string]*rag.Metadata // Metadata of the documents, keyed by path
+	filter     rag.MetadataFilter
+}
+
+// ragSearchStrategy is a strategy of a RAG source with its index
+type ragSearchStrategy struct {
+	name   string
+	index  *rag.Index
+	params rag.BM25Params
+	limit  int
+}
+
+// NewRAGSearcher opens (building or updating them as needed) the indexes of the
+// strategies of a processed RAG source
+func NewRAGSearcher(ctx context.Context, sourceName string, source RAGSourceConfig, reindex bool, logger *common.Logger) (*RAGSearcher, error) {
+	cacheDir, err := rag.GetCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache directory: %w", err)
+	}
+
+	var strategies []RAGStrategyConfig
+	for _, strategy := range source.Strategies {
+		if strategy.Type != "bm25" {
+			logger.Warn("Strategy '%s' is not supported by the local search, skipping it", strategy.Type)
+			continue
+		}
+		strategies = append(strategies, strategy)
+	}
+	if len(strategies) == 0 {
+		strategies = []RAGStrategyConfig{{Type: "bm25"}}
+	}
+
+	searcher := &RAGSearcher{
+		results:  source.Results,
+		resolver: rag.NewSourceResolver(cacheDir),
+		metadata: source.docMetadata(),
+	}
+	names := make(map[string]bool)
+	for i, strategy := range strategies {
+		name := strategy.Type
+		if names[name] {
+			name = fmt.Sprintf("%s-%d", strategy.Type, i+1)
+		}
+		names[name] = true
+
+		params := rag.BM25Params{
+			K1:        strategy.K1,
+			B:         strategy.B,
+			Threshold: strategy.Threshold,
+		}
+		if err := params.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid strategy '%s': %w", strategy.Type, err)
+		}
+
+		// Strategies use the shared documents and their own ones
+		paths := docPaths(source.Docs)
+		paths = append(paths, docPaths(strategy.Docs)...)
+
+		idx, err := rag.OpenIndex(ctx, cacheDir, sourceName+"/"+name, paths, strategy.chunkConfig(), reindex, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to index documents for strategy '%s': %w", strategy.Type, err)
+		}
+
+		limit := strategy.Limit
+		if limit == 0 {
+			limit = defaultRAGStrategyLimit
+		}
+		searcher.strategies = append(searcher.strategies, ragSearchStrategy{
+			name:   name,
+			index:  idx,
+			params: params,
+			limit:  limit,
+		})
+	}
+
+	if source.Results != nil && source.Results.Fusion != nil {
+		searcher.fusion = rag.FusionConfig{
+			Strategy: source.Results.Fusion.Strategy,
+			K:        source.Results.Fusion.K,
+			Weights:  source.Results.Fusion.Weights,
+		}
+	}
+	return searcher, nil
+}
+
+// StrategyNames returns the names of the strategies run by the searcher: their
+// type, with a suffix for repeated types (e.g. "bm25", "bm25-2")
+func (s *RAGSearcher) StrategyNames() []string {
+	names := make([]string, len(s.strategies))
+	for i, strategy := range s.strategies {
+		names[i] = strategy.name
+	}
+	return names
+}
+
+// SetFilter restricts the searches to the documents matching a metadata filter
+func (s *RAGSearcher) SetFilter(filter rag.MetadataFilter) {
+	s.filter = filter
+}
+
+// SearchStrategies returns the results of each strategy, keyed by strategy name
+func (s *RAGSearcher) SearchStrategies(query string) map[string][]rag.SearchResult {
+	strategyResults := make(map[string][]rag.SearchResult, len(s.strategies))
+	for _, strategy := range s.strategies {
+		if len(s.filter) == 0 {
+			results := strategy.index.SearchBM25(query, strategy.params, strategy.limit)
+			s.resolve(results)
+			strategyResults[strategy.name] = results
+			continue
+		}
+
+		// Filter all the matches, so the filter does not reduce the number of results
+		var results []rag.SearchResult
+		for _, result := range strategy.index.SearchBM25(query, strategy.params, 0) {
+			if s.filter.Matches(s.metadata[result.Chunk.Path]) {
+				results = append(results, result)
+			}
+		}
+		if len(results) > strategy.limit {
+			results = results[:strategy.limit]
+		}
+		s.resolve(results)
+		strategyResults[strategy.name] = results
+	}
+	return strategyResults
+}
+
+// Search returns the fused results of the strategies
+// A limit of 0 uses the source results limit
+func (s *RAGSearcher) Search(query string, limit int) ([]rag.SearchResult, error) {
+	return s.Fuse(s.SearchStrategies(query), limit)
+}
+
+// Fuse combines the results of the strategies as configured in the source
+// (fusion, deduplication and limit). A limit of 0 uses the source results limit.
+func (s *RAGSearcher) Fuse(strategyResults map[string][]rag.SearchResult, limit int) ([]rag.SearchResult, error) {
+	results, err := rag.Fuse(strategyResults, s.fusion)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.results != nil {
+		if limit == 0 {
+			limit = s.results.Limit
+		}
+		if s.results.Deduplicate {
+			results = rag.DeduplicateResults(results)
+		}
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// resolve points results at the original locations of cached documents, and
+// adds the metadata of their documents
+func (s *RAGSearcher) resolve(results []rag.SearchResult) {
+	for i := range results {
+		results[i].Chunk.Source = s.resolver.Resolve(results[i].Chunk.Path)
+		results[i].Chunk.Metadata = s.metadata[results[i].Chunk.Path]
+	}
+}
+
+// SearchRAGSource searches a processed RAG source with the local retrieval engine
+// (see RAGSearcher)
+func SearchRAGSource(ctx context.Context, sourceName string, source RAGSourceConfig, query string, opts RAGSearchOptions, logger *common.Logger) ([]rag.SearchResult, error) {
+	searcher, err := NewRAGSearcher(ctx, sourceName, source, opts.Reindex, logger)
+	if err != nil {
+		return nil, err
+	}
+	searcher.SetFilter(opts.Filter)
+	return searcher.Search(query, opts.Limit)
+}
+
+// docPaths returns the paths of processed docs entries
+func docPaths(docs []RAGDocConfig) []string {
+	paths := make([]string, len(docs))
+	for i, doc := range docs {
+		paths[i] = doc.Path
+	}
+	return paths
+}
+
+// chunkConfig converts the chunking configuration of a strategy to a rag.ChunkConfig
+func (s *RAGStrategyConfig) chunkConfig() rag.ChunkConfig {
+	return rag.ChunkConfig{
+		Size:                  s.Chunking.Size,
+		Overlap:               s.Chunking.Overlap,
+		RespectWordBoundaries: s.Chunking.RespectWordBoundaries,
+	}
+}
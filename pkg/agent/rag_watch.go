@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+// RAGRefresh holds RAG sources processed again after their local documents changed
+type RAGRefresh struct {
+	Sources map[string]RAGSourceConfig     // Processed configurations of the refreshed sources
+	Changes map[string]rag.ManifestChanges // Documents changed in each refreshed source
+}
+
+// String returns a short notice describing the refresh. The runtime is only
+// reloaded with the refreshed sources on the next user message, so the notice says so.
+func (r *RAGRefresh) String() string {
+	names := make([]string, 0, len(r.Changes))
+	for name := range r.Changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	notices := make([]string, len(names))
+	for i, name := range names {
+		notices[i] = fmt.Sprintf("RAG source '%s' re-indexed: %s (used from your next message)", name, r.Changes[name])
+	}
+	return strings.Join(notices, "\n")
+}
+
+// ragWatchRoot is a local docs entry of a RAG source
+type ragWatchRoot struct {
+	source string
+	path   string
+	isDir  bool
+}
+
+// RAGWatcher processes RAG sources again (scanning and indexing their documents)
+// when files change in their local docs entries
+type RAGWatcher struct {
+	sources   map[string]RAGSourceConfig
+	roots     []ragWatchRoot
+	opts      RAGProcessOptions
+	debounce  time.Duration
+	watcher   *rag.Watcher
+	refreshes chan *RAGRefresh
+	logger    *common.Logger
+}
+
+// NewRAGWatcher creates a watcher for the local files and directories of a set of
+// (unprocessed) RAG sources. Returns nil if the sources have no local documents.
+func NewRAGWatcher(sources map[string]RAGSourceConfig, opts RAGProcessOptions, logger *common.Logger) (*RAGWatcher, error) {
+	var roots []ragWatchRoot
+	var paths []string
+	for name, source := range sources {
+		docs := append([]RAGDocConfig(nil), source.Docs...)
+		for _, strategy := range source.Strategies {
+			docs = append(docs, strategy.Docs...)
+		}
+		for _, doc := range docs {
+			if doc.Path == "" || isRemoteURL(doc.Path) || rag.IsGitSource(doc.Path) || rag.IsArchive(doc.Path) {
+				continue
+			}
+			absPath, err := filepath.Abs(doc.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve path '%s': %w", doc.Path, err)
+			}
+			info, err := os.Stat(absPath)
+			if err != nil {
+				logger.Warn("Cannot watch '%s' of RAG source '%s': %v", doc.Path, name, err)
+				continue
+			}
+			roots = append(roots, ragWatchRoot{source: name, path: absPath, isDir: info.IsDir()})
+			paths = append(paths, absPath)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	watcher, err := rag.NewWatcher(paths, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &RAGWatcher{
+		sources:   sources,
+		roots:     roots,
+		opts:      opts,
+		debounce:  rag.DefaultWatchDebounce,
+		watcher:   watcher,
+		refreshes: make(chan *RAGRefresh, 1),
+		logger:    logger,
+	}, nil
+}
+
+// Refreshes returns the channel receiving the refreshed RAG sources
+func (w *RAGWatcher) Refreshes() <-chan *RAGRefresh {
+	return w.refreshes
+}
+
+// Run watches the documents until the context is cancelled, refreshing the
+// sources with changed documents in the background
+func (w *RAGWatcher) Run(ctx context.Context) {
+	w.logger.Info("Watching %d local RAG document paths for changes", len(w.roots))
+	w.watcher.Run(ctx, w.debounce, func(paths []string) {
+		refresh, err := w.refresh(ctx, w.affectedSources(paths))
+		if err != nil {
+			w.logger.Warn("Failed to refresh RAG sources: %v", err)
+			return
+		}
+		if refresh == nil {
+			return
+		}
+		select {
+		case w.refreshes <- refresh:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// Close stops watching
+func (w *RAGWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// affectedSources returns the names of the sources with docs entries containing any of the paths
+func (w *RAGWatcher) affectedSources(paths []string) []string {
+	affected := make(map[string]bool)
+	for _, path := range paths {
+		for _, root := range w.roots {
+			if path == root.path || (root.isDir && strings.HasPrefix(path, root.path+string(filepath.Separator))) {
+				affected[root.source] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(affected))
+	for name := range affected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// refresh processes some sources again
+// Returns nil if none of their documents actually changed
+func (w *RAGWatcher) refresh(ctx context.Context, names []string) (*RAGRefresh, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	w.logger.Debug("Refreshing RAG sources: %s", strings.Join(names, ", "))
+
+	sources := make(map[string]RAGSourceConfig, len(names))
+	for _, name := range names {
+		sources[name] = w.sources[name]
+	}
+
+	changes := make(map[string]rag.ManifestChanges)
+	opts := w.opts
+	opts.Reindex = false
+	opts.OnChanges = func(sourceName string, sourceChanges rag.ManifestChanges) {
+		if !sourceChanges.IsEmpty() {
+			changes[sourceName] = sourceChanges
+		}
+	}
+	processed, err := ProcessRAGSources(ctx, sources, opts, w.logger)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	refresh := &RAGRefresh{Sources: make(map[string]RAGSourceConfig), Changes: changes}
+	for name := range changes {
+		refresh.Sources[name] = processed[name]
+	}
+	return refresh, nil
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+func TestRAGWatcher(t *testing.T) {
+	t.Setenv(rag.CacheDirEnv, t.TempDir())
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	docsDir := t.TempDir()
+	otherDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(docsDir, "guide.md"), []byte("guide"), 0644); err != nil {
+		t.Fatalf("failed to write document: %v", err)
+	}
+	// Remote documents are not watched
+	remote := map[string]RAGSourceConfig{"remote": {Docs: RAGDocPaths("https://example.com/remote.md")}}
+	watcher, err := NewRAGWatcher(remote, RAGProcessOptions{}, logger)
+	if err != nil || watcher != nil {
+		t.Fatalf("NewRAGWatcher() for remote documents = %v, %v, want nil", watcher, err)
+	}
+
+	sources := map[string]RAGSourceConfig{
+		"docs":  {Docs: RAGDocPaths(docsDir)},
+		"other": {Docs: RAGDocPaths(otherDir)},
+	}
+	watcher, err = NewRAGWatcher(sources, RAGProcessOptions{}, logger)
+	if err != nil {
+		t.Fatalf("NewRAGWatcher() error = %v", err)
+	}
+	defer watcher.Close()
+	watcher.debounce = 100 * time.Millisecond
+
+	// First run, as done before starting the watcher
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := ProcessRAGSources(ctx, sources, RAGProcessOptions{}, logger); err != nil {
+		t.Fatalf("ProcessRAGSources() error = %v", err)
+	}
+	go watcher.Run(ctx)
+
+	added := filepath.Join(docsDir, "faq.md")
+	if err := os.WriteFile(added, []byte("faq"), 0644); err != nil {
+		t.Fatalf("failed to write document: %v", err)
+	}
+
+	select {
+	case refresh := <-watcher.Refreshes():
+		if _, ok := refresh.Sources["other"]; ok || len(refresh.Sources) != 1 {
+			t.Errorf("refreshed sources = %v, want only docs", refresh.Sources)
+		}
+		if docs := refresh.Sources["docs"].Docs; len(docs) != 2 {
+			t.Errorf("refreshed docs = %v, want 2 documents", docs)
+		}
+		changes := refresh.Changes["docs"]
+		if len(changes.Added) != 1 || changes.Added[0] != added {
+			t.Errorf("changes = %v, want %s added", changes, added)
+		}
+		if got, want := refresh.String(), "RAG source 'docs' re-indexed: 1 added, 0 changed, 0 removed (used from your next message)"; got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("RAGWatcher did not refresh the source")
+	}
+}
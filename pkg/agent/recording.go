@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/cagent/pkg/runtime"
+
+	"github.com/inercia/don/pkg/replay"
+)
+
+// localAPIKey is the API key given to the models using a local API (replayed
+// recordings, mock models), which needs none
+const localAPIKey = "local"
+
+// defaultAPIURLs are the base URLs of the APIs of the providers, for the models
+// recorded without an api-url
+var defaultAPIURLs = map[string]string{
+	"":          "https://api.openai.com/v1",
+	"openai":    "https://api.openai.com/v1",
+	"ollama":    "http://localhost:11434/v1",
+	"anthropic": "https://api.anthropic.com",
+}
+
+// runRecording records (--record) or replays (--replay) the LLM exchanges and
+// the tool calls of a run, with the models using a local endpoint as their API
+type runRecording struct {
+	endpoint *replay.Endpoint
+	recorder *replay.Recorder // Set when recording
+	player   *replay.Player   // Set when replaying
+}
+
+// startRecording routes the models of a run configuration through a recording
+// or replaying endpoint. It returns nil when the run is not recorded nor replayed.
+func (a *Agent) startRecording(cfg *Config) (*runRecording, error) {
+	switch {
+	case a.config.Record != "" && a.config.Replay != "":
+		return nil, fmt.Errorf("a run cannot be recorded and replayed at the same time")
+	case a.config.Record != "":
+		return startRecorder(a.config.Record, cfg)
+	case a.config.Replay != "":
+		return startPlayer(a.config.Replay, cfg)
+	default:
+		return nil, nil
+	}
+}
+
+// recordedModels returns the models whose requests are recorded and replayed
+// Embedding models keep using their APIs, as RAG indexing depends on the cache
+// and is not the same from run to run
+func recordedModels(cfg *Config) []cagentModel {
+	var models []cagentModel
+	for _, model := range cagentModels(cfg) {
+		if model.config.Type != ModelTypeEmbedding {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// startRecorder records the run in a file, forwarding the requests of the models to their APIs
+func startRecorder(path string, cfg *Config) (*runRecording, error) {
+	models := recordedModels(cfg)
+	upstreams := make(map[string]string, len(models))
+	for _, model := range models {
+		upstream, err := expandEnv(model.config.APIURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API URL of model '%s': %w", model.name, err)
+		}
+		if upstream == "" {
+			var ok bool
+			if upstream, ok = defaultAPIURLs[model.config.Class]; !ok {
+				return nil, fmt.Errorf("model '%s' (%s) needs an api-url to be recorded", model.name, model.config.Class)
+			}
+		}
+		upstreams[model.name] = upstream
+	}
+
+	recorder, err := replay.NewRecorder(path)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := recorder.Proxy(upstreams)
+	if err != nil {
+		_ = recorder.Close()
+		return nil, err
+	}
+	endpoint, err := replay.Serve(proxy)
+	if err != nil {
+		_ = recorder.Close()
+		return nil, err
+	}
+	for _, model := range models {
+		model.config.APIURL = endpoint.URL(model.name)
+	}
+	return &runRecording{endpoint: endpoint, recorder: recorder}, nil
+}
+
+// startPlayer serves the LLM responses of a recording to the models
+func startPlayer(path string, cfg *Config) (*runRecording, error) {
+	entries, err := replay.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	player := replay.NewPlayer(entries)
+	endpoint, err := replay.Serve(player)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, model := range recordedModels(cfg) {
+		if err := useLocalAPI(model, endpoint.URL(model.name)); err != nil {
+			_ = endpoint.Close()
+			return nil, err
+		}
+	}
+	return &runRecording{endpoint: endpoint, player: player}, nil
+}
+
+// useLocalAPI makes a model use a local OpenAI-compatible API (mock models
+// included), without API key
+func useLocalAPI(model cagentModel, url string) error {
+	model.config.APIURL = url
+	model.config.APIKey = ""
+	if model.config.Class == MockModelClass {
+		model.config.Class = "openai"
+	}
+	// The providers refuse to start without an API key, though no real API is used
+	if envVar := getAPIKeyEnvVar(model.config.Class); os.Getenv(envVar) == "" {
+		if err := os.Setenv(envVar, localAPIKey); err != nil {
+			return fmt.Errorf("failed to set %s: %w", envVar, err)
+		}
+	}
+	return nil
+}
+
+// handle records the tool calls and results of the run, or checks the tool
+// calls match the recording
+func (r *runRecording) handle(event interface{}) {
+	switch e := event.(type) {
+	case *runtime.ToolCallEvent:
+		if r.player != nil {
+			r.player.ToolCall(e.ToolCall.Function.Name, e.ToolCall.Function.Arguments)
+			return
+		}
+		r.recorder.Record(replay.Entry{
+			Type:       replay.EntryToolCall,
+			Agent:      e.AgentName,
+			ToolCallID: e.ToolCall.ID,
+			Tool:       e.ToolCall.Function.Name,
+			Arguments:  e.ToolCall.Function.Arguments,
+		})
+	case *runtime.ToolCallResponseEvent:
+		if r.recorder != nil {
+			r.recorder.Record(replay.Entry{
+				Type:       replay.EntryToolResult,
+				Agent:      e.AgentName,
+				ToolCallID: e.ToolCall.ID,
+				Tool:       e.ToolCall.Function.Name,
+				Content:    e.Response,
+			})
+		}
+	}
+}
+
+// close stops the endpoint, and returns the errors writing the recording, or
+// the differences between the run and the replayed recording
+func (r *runRecording) close() error {
+	err := r.endpoint.Close()
+	if r.recorder != nil {
+		if closeErr := r.recorder.Close(); closeErr != nil {
+			return closeErr
+		}
+	}
+	if r.player != nil {
+		if replayErr := r.player.Err(); replayErr != nil {
+			return replayErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/replay"
+	"github.com/inercia/don/pkg/utils"
+)
+
+// chatStream returns an OpenAI chat completion stream with a tool call, or with
+// an answer when tool is empty
+func chatStream(tool, arguments, answer string) string {
+	chunk := func(delta, finish string) string {
+		return fmt.Sprintf(`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o",`+
+			`"choices":[{"index":0,"delta":%s,"finish_reason":%s}]}`+"\n\n", delta, finish)
+	}
+	if tool != "" {
+		call := fmt.Sprintf(`{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function",`+
+			`"function":{"name":%q,"arguments":%q}}]}`, tool, arguments)
+		return chunk(call, "null") + chunk("{}", `"tool_calls"`) + "data: [DONE]\n\n"
+	}
+	// As OpenAI does with include_usage, the usage comes in a last chunk without choices
+	usage := `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[],` +
+		`"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}` + "\n\n"
+	return chunk(fmt.Sprintf(`{"role":"assistant","content":%q}`, answer), "null") + chunk("{}", `"stop"`) + usage + "data: [DONE]\n\n"
+}
+
+// fakeOpenAI serves chat completion streams in order
+func fakeOpenAI(t *testing.T, streams ...string) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasSuffix(r.URL.Path, "/chat/completions") || len(streams) == 0 {
+			http.Error(w, "unexpected request "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(streams[0]))
+		streams = streams[1:]
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	dir := t.TempDir()
+	t.Setenv(utils.DonDirEnv, dir)
+	t.Setenv(fakeMCPShellEnv, "v0.3.1")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+
+	configPath := filepath.Join(dir, "agent.yaml")
+	t.Setenv(utils.DonConfigEnv, configPath)
+
+	toolsFile := filepath.Join(dir, "tools.yaml")
+	if err := os.WriteFile(toolsFile, []byte("mcp:\n  tools: []\n"), 0644); err != nil {
+		t.Fatalf("failed to write tools file: %v", err)
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to get the test binary: %v", err)
+	}
+
+	// run runs the agent once, returning its events and error
+	run := func(t *testing.T, record, replay, apiURL string) ([]Event, error) {
+		t.Helper()
+		config := fmt.Sprintf("agent:\n  models:\n    - model: gpt-4o\n      class: openai\n      default: true\n      api-url: %q\n", apiURL)
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		a := New(AgentConfig{
+			ToolsFile:      toolsFile,
+			UserPrompt:     "How much disk does /var use?",
+			Once:           true,
+			MCPShellBinary: binary,
+			AutoApprove:    true,
+			Record:         record,
+			Replay:         replay,
+			ModelConfig:    ModelConfig{Model: "gpt-4o", Class: "openai", APIURL: apiURL},
+		}, logger)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		events := make(chan Event, 100)
+		errc := make(chan error, 1)
+		go func() { errc <- a.RunEvents(ctx, nil, events, nil) }()
+		var collected []Event
+		for event := range events {
+			collected = append(collected, event)
+		}
+		return collected, <-errc
+	}
+
+	// transcript returns the tool results and messages of the events
+	transcript := func(events []Event) string {
+		var parts []string
+		for _, event := range events {
+			switch event.Type {
+			case EventToolResult:
+				parts = append(parts, "tool:"+event.Content)
+			case EventMessage:
+				parts = append(parts, event.Content)
+			}
+		}
+		return strings.Join(parts, "|")
+	}
+	const want = "tool:42K /var|/var uses 42K."
+
+	recording := filepath.Join(dir, "run.jsonl")
+	upstream := fakeOpenAI(t,
+		chatStream("disk_usage", `{"path":"/var"}`, ""),
+		chatStream("", "", "/var uses 42K."),
+	)
+	events, err := run(t, recording, "", upstream.URL+"/v1")
+	if err != nil {
+		t.Fatalf("recorded run error = %v", err)
+	}
+	if got := transcript(events); got != want {
+		t.Fatalf("recorded run = %q, want %q", got, want)
+	}
+	upstream.Close()
+
+	entries, err := replay.Load(recording)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var types []string
+	for _, entry := range entries {
+		types = append(types, string(entry.Type))
+		if entry.Type == replay.EntryLLM && (entry.Path != "/chat/completions" || entry.Status != http.StatusOK || !strings.Contains(entry.Request, "/var")) {
+			t.Errorf("LLM entry = %+v, want the request and response of the chat completion", entry)
+		}
+	}
+	if got := strings.Join(types, ","); got != "llm,tool_call,tool_result,llm" {
+		t.Errorf("recording entries = %s, want the LLM exchanges and the tool call", got)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		events, err := run(t, "", recording, "")
+		if err != nil {
+			t.Fatalf("replayed run error = %v", err)
+		}
+		if got := transcript(events); got != want {
+			t.Errorf("replayed run = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("replay a different flow", func(t *testing.T) {
+		// The tool is called with other arguments, and the last answer is never requested
+		changed := filepath.Join(dir, "changed.jsonl")
+		recorder, err := replay.NewRecorder(changed)
+		if err != nil {
+			t.Fatalf("NewRecorder() error = %v", err)
+		}
+		first := entries[0]
+		first.Response = strings.Replace(first.Response, `\"path\":\"/var\"`, `\"path\":\"/tmp\"`, 1)
+		if first.Response == entries[0].Response {
+			t.Fatalf("failed to change the recorded tool call: %s", first.Response)
+		}
+		for _, entry := range []replay.Entry{first, entries[1], entries[2]} {
+			recorder.Record(entry)
+		}
+		if err := recorder.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		_, err = run(t, "", changed, "")
+		if err == nil || !strings.Contains(err.Error(), `does not match the recorded disk_usage({"path":"/var"})`) ||
+			!strings.Contains(err.Error(), "no recorded response left") {
+			t.Errorf("replayed run error = %v, want the differences with the recording", err)
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/utils"
+)
+
+// TemplatesDir is the directory of the template files, in the Don home
+const TemplatesDir = "templates"
+
+// TemplateConfig holds a prompt template: a user prompt written as a Go
+// template with declared variables, and optionally the tools file, RAG sources
+// and model it runs with
+type TemplateConfig struct {
+	Description string                   `yaml:"description,omitempty"`
+	Prompts     common.PromptsConfig     `yaml:"prompts"`             // User prompt (the template) and extra system prompts
+	Variables   []TemplateVariableConfig `yaml:"variables,omitempty"` // Variables of the user prompt
+	Tools       string                   `yaml:"tools,omitempty"`     // Tools file, as given with --tools
+	RAG         []string                 `yaml:"rag,omitempty"`       // RAG sources to enable
+	Model       string                   `yaml:"model,omitempty"`     // Model name, as given with --model
+
+	// Runtime fields (not from YAML)
+	Name   string `yaml:"-"` // Name of the template
+	Source string `yaml:"-"` // File defining the template
+	Err    error  `yaml:"-"` // Why the template is invalid (see GetTemplates)
+}
+
+// TemplateVariableConfig holds a variable of a prompt template. Variables
+// without a default value are required.
+type TemplateVariableConfig struct {
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description,omitempty"`
+	Default     *string `yaml:"default,omitempty"`
+}
+
+// Required returns whether the variable must be given
+func (v TemplateVariableConfig) Required() bool {
+	return v.Default == nil
+}
+
+// Validate checks the prompt and the variables of a template
+func (t TemplateConfig) Validate() error {
+	if !t.Prompts.HasUserPrompts() {
+		return fmt.Errorf("template '%s' has no user prompt (prompts.user)", t.Name)
+	}
+	if _, err := t.parse(); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(t.Variables))
+	for _, variable := range t.Variables {
+		if variable.Name == "" {
+			return fmt.Errorf("template '%s' has a variable without name", t.Name)
+		}
+		if seen[variable.Name] {
+			return fmt.Errorf("template '%s' declares the variable '%s' twice", t.Name, variable.Name)
+		}
+		seen[variable.Name] = true
+	}
+	return nil
+}
+
+// parse parses the user prompt of a template
+func (t TemplateConfig) parse() (*template.Template, error) {
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Prompts.GetUserPrompts())
+	if err != nil {
+		return nil, fmt.Errorf("invalid user prompt in template '%s': %w", t.Name, err)
+	}
+	return tmpl, nil
+}
+
+// Render returns the user prompt of a template with the values of its
+// variables, given as name=value. Variables not given take their default value.
+func (t TemplateConfig) Render(args []string) (string, error) {
+	names := make([]string, 0, len(t.Variables))
+	values := make(map[string]string, len(t.Variables))
+	declared := make(map[string]bool, len(t.Variables))
+	for _, variable := range t.Variables {
+		names = append(names, variable.Name)
+		declared[variable.Name] = true
+		if variable.Default != nil {
+			values[variable.Name] = *variable.Default
+		}
+	}
+
+	given := make(map[string]bool, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return "", fmt.Errorf("invalid variable '%s' (expected name=value)", arg)
+		}
+		if !declared[name] {
+			return "", fmt.Errorf("template '%s' has no variable '%s' (variables: %s)", t.Name, name, strings.Join(names, ", "))
+		}
+		values[name] = value
+		given[name] = true
+	}
+
+	var missing []string
+	for _, variable := range t.Variables {
+		if variable.Required() && !given[variable.Name] {
+			missing = append(missing, variable.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template '%s' requires the variables: %s (use --var name=value)", t.Name, strings.Join(missing, ", "))
+	}
+
+	tmpl, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+	var prompt bytes.Buffer
+	if err := tmpl.Execute(&prompt, values); err != nil {
+		return "", fmt.Errorf("failed to render template '%s': %w", t.Name, err)
+	}
+	return prompt.String(), nil
+}
+
+// GetTemplates returns the prompt templates, sorted by name: those of the
+// configuration file, and those of the files in the templates directory of the
+// Don home (one template per file, named after the file). Templates of the
+// configuration file take precedence. Invalid templates are returned too, with
+// the reason in their Err, so they do not hide the others.
+func (c *Config) GetTemplates() ([]TemplateConfig, error) {
+	templates, err := c.loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	for i := range templates {
+		templates[i].check()
+	}
+	return templates, nil
+}
+
+// GetTemplate returns a valid prompt template by name
+func (c *Config) GetTemplate(name string) (*TemplateConfig, error) {
+	templates, err := c.loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(templates))
+	for i := range templates {
+		if templates[i].Name == name {
+			tmpl := &templates[i]
+			if tmpl.check(); tmpl.Err != nil {
+				return nil, tmpl.Err
+			}
+			return tmpl, nil
+		}
+		names = append(names, templates[i].Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("template '%s' not found (no templates defined)", name)
+	}
+	return nil, fmt.Errorf("template '%s' not found (templates: %s)", name, strings.Join(names, ", "))
+}
+
+// check validates a template, setting its Err with the file defining it
+func (t *TemplateConfig) check() {
+	if t.Err != nil {
+		return
+	}
+	if err := t.Validate(); err != nil {
+		t.Err = fmt.Errorf("%s: %w", t.Source, err)
+	}
+}
+
+// loadTemplates reads the prompt templates, sorted by name and not validated.
+// Template files that cannot be read or parsed have their Err set.
+func (c *Config) loadTemplates() ([]TemplateConfig, error) {
+	templates := make(map[string]TemplateConfig)
+
+	donHome, err := utils.GetDonHome()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Don home directory: %w", err)
+	}
+	dir := filepath.Join(donHome, TemplatesDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		var tmpl TemplateConfig
+		if data, err := os.ReadFile(path); err != nil {
+			tmpl.Err = fmt.Errorf("failed to read template %s: %w", path, err)
+		} else if err := yaml.Unmarshal(data, &tmpl); err != nil {
+			tmpl = TemplateConfig{Err: fmt.Errorf("failed to parse template %s: %w", path, err)}
+		}
+		tmpl.Name = strings.TrimSuffix(entry.Name(), ext)
+		tmpl.Source = path
+		templates[tmpl.Name] = tmpl
+	}
+
+	for name, tmpl := range c.Agent.Templates {
+		tmpl.Name = name
+		tmpl.Source = c.Path
+		templates[name] = tmpl
+	}
+
+	result := make([]TemplateConfig, 0, len(templates))
+	for _, tmpl := range templates {
+		result = append(result, tmpl)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/inercia/don/pkg/utils"
+)
+
+func TestTemplateRender(t *testing.T) {
+	var tmpl TemplateConfig
+	if err := yaml.Unmarshal([]byte(`
+prompts:
+  user: Why are the pods of {{.namespace}} restarting in {{.cluster}}?
+variables:
+  - name: cluster
+    default: prod
+  - name: namespace
+    description: Namespace of the pods
+`), &tmpl); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	tmpl.Name = "restarts"
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{name: "default value", args: []string{"namespace=api"}, want: "Why are the pods of api restarting in prod?"},
+		{name: "all values", args: []string{"namespace=api", "cluster=staging=2"}, want: "Why are the pods of api restarting in staging=2?"},
+		{name: "empty value", args: []string{"namespace="}, want: "Why are the pods of  restarting in prod?"},
+		{name: "missing variable", wantErr: "template 'restarts' requires the variables: namespace"},
+		{name: "unknown variable", args: []string{"namespace=api", "zone=eu"}, wantErr: "template 'restarts' has no variable 'zone' (variables: cluster, namespace)"},
+		{name: "invalid variable", args: []string{"namespace"}, wantErr: "invalid variable 'namespace' (expected name=value)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tmpl.Render(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Render() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Render() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	undeclared := TemplateConfig{Name: "undeclared"}
+	undeclared.Prompts.User = []string{"Check {{.cluster}}"}
+	if _, err := undeclared.Render(nil); err == nil || !strings.Contains(err.Error(), "failed to render template 'undeclared'") {
+		t.Errorf("Render() of an undeclared variable error = %v, want a render error", err)
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "valid", yaml: "prompts:\n  user: Check {{.cluster}}\nvariables:\n  - name: cluster\n"},
+		{name: "no user prompt", yaml: "prompts:\n  system: Be brief.\n", wantErr: "has no user prompt"},
+		{name: "invalid prompt", yaml: "prompts:\n  user: Check {{.cluster\n", wantErr: "invalid user prompt"},
+		{name: "variable without name", yaml: "prompts:\n  user: Check\nvariables:\n  - default: prod\n", wantErr: "variable without name"},
+		{name: "duplicated variable", yaml: "prompts:\n  user: Check\nvariables:\n  - name: a\n  - name: a\n", wantErr: "declares the variable 'a' twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tmpl TemplateConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &tmpl); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			err := tmpl.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetTemplates(t *testing.T) {
+	donDir := t.TempDir()
+	t.Setenv(utils.DonDirEnv, donDir)
+	templatesDir := filepath.Join(donDir, TemplatesDir)
+	if err := os.MkdirAll(filepath.Join(templatesDir, "ignored.yaml"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"disk.yaml":    "description: Disk usage\nprompts:\n  user: What uses the disk of {{.host}}?\nvariables:\n  - name: host\ntools: disk.yaml\n",
+		"restarts.yml": "prompts:\n  user: Overridden by the configuration file\n",
+		"notes.txt":    "not a template",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(donDir, "agent.yaml")
+	if err := os.WriteFile(configPath, []byte(`agent:
+  templates:
+    restarts:
+      description: Pod restarts
+      prompts:
+        system: You are a Kubernetes expert.
+        user: Why are the pods of {{.namespace}} restarting?
+      variables:
+        - name: namespace
+          default: default
+      tools: k8s.yaml
+      rag: [runbooks]
+      model: gpt-4o
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(utils.DonConfigEnv, configPath)
+	config, err := GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+
+	templates, err := config.GetTemplates()
+	if err != nil {
+		t.Fatalf("GetTemplates() error = %v", err)
+	}
+	if len(templates) != 2 || templates[0].Name != "disk" || templates[1].Name != "restarts" {
+		t.Fatalf("GetTemplates() = %+v, want disk and restarts", templates)
+	}
+	if disk := templates[0]; disk.Source != filepath.Join(templatesDir, "disk.yaml") || disk.Tools != "disk.yaml" || !disk.Variables[0].Required() {
+		t.Errorf("disk template = %+v, want the template file", disk)
+	}
+	restarts, err := config.GetTemplate("restarts")
+	if err != nil {
+		t.Fatalf("GetTemplate() error = %v", err)
+	}
+	if restarts.Source != configPath || restarts.Model != "gpt-4o" || restarts.RAG[0] != "runbooks" ||
+		restarts.Prompts.GetSystemPrompts() != "You are a Kubernetes expert." {
+		t.Errorf("restarts template = %+v, want the template of the configuration file", restarts)
+	}
+
+	if _, err := config.GetTemplate("missing"); err == nil || !strings.Contains(err.Error(), "template 'missing' not found (templates: disk, restarts)") {
+		t.Errorf("GetTemplate() error = %v, want the available templates", err)
+	}
+
+	// Invalid templates do not hide the others
+	invalid := map[string]string{
+		"broken.yaml":   "prompts:\n  system: Be brief.\n",
+		"unparsed.yaml": "prompts: [\n",
+	}
+	for name, content := range invalid {
+		if err := os.WriteFile(filepath.Join(templatesDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	templates, err = config.GetTemplates()
+	if err != nil {
+		t.Fatalf("GetTemplates() with invalid templates error = %v", err)
+	}
+	wantErrs := map[string]string{
+		"broken":   "broken.yaml: template 'broken' has no user prompt",
+		"disk":     "",
+		"restarts": "",
+		"unparsed": "failed to parse template " + filepath.Join(templatesDir, "unparsed.yaml"),
+	}
+	if len(templates) != len(wantErrs) {
+		t.Fatalf("GetTemplates() = %+v, want %d templates", templates, len(wantErrs))
+	}
+	for _, tmpl := range templates {
+		wantErr, ok := wantErrs[tmpl.Name]
+		switch {
+		case !ok:
+			t.Errorf("unexpected template %s", tmpl.Name)
+		case wantErr == "" && tmpl.Err != nil:
+			t.Errorf("template %s error = %v", tmpl.Name, tmpl.Err)
+		case wantErr != "" && (tmpl.Err == nil || !strings.Contains(tmpl.Err.Error(), wantErr)):
+			t.Errorf("template %s error = %v, want %q", tmpl.Name, tmpl.Err, wantErr)
+		}
+	}
+	if _, err := config.GetTemplate("disk"); err != nil {
+		t.Errorf("GetTemplate() of a valid template among invalid ones error = %v", err)
+	}
+	if _, err := config.GetTemplate("broken"); err == nil || !strings.Contains(err.Error(), wantErrs["broken"]) {
+		t.Errorf("GetTemplate() of an invalid template error = %v, want %q", err, wantErrs["broken"])
+	}
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// ToolsetAgentOrchestrator runs the tools of a toolset in the root agent
+	ToolsetAgentOrchestrator = "orchestrator"
+	// ToolsetAgentToolRunner runs the tools of a toolset in the tool-runner sub-agent
+	ToolsetAgentToolRunner = "tool-runner"
+
+	// ToolsetTransportStreamable is the streamable HTTP transport of remote MCP servers
+	ToolsetTransportStreamable = "streamable"
+	// ToolsetTransportSSE is the SSE transport of remote MCP servers
+	ToolsetTransportSSE = "sse"
+	// ToolsetTransportStdio is the transport of MCP servers run as commands
+	ToolsetTransportStdio = "stdio"
+)
+
+// toolRunnerAgentName is the name of the sub-agent running the tool-runner toolsets
+const toolRunnerAgentName = "tool-runner"
+
+// Validate checks the toolset is complete and consistent
+func (t ToolsetConfig) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("toolset must have a name")
+	}
+	if (t.Command == "") == (t.URL == "") {
+		return fmt.Errorf("toolset '%s' must have exactly one of command or url", t.Name)
+	}
+	if t.Command != "" && (t.Transport != "" || len(t.Headers) > 0) {
+		return fmt.Errorf("toolset '%s': transport and headers can only be used with url", t.Name)
+	}
+	if t.URL != "" && (len(t.Args) > 0 || len(t.Env) > 0) {
+		return fmt.Errorf("toolset '%s': args and env can only be used with command", t.Name)
+	}
+	switch t.Transport {
+	case "", ToolsetTransportStreamable, ToolsetTransportSSE:
+	default:
+		return fmt.Errorf("toolset '%s': invalid transport '%s' (expected %s or %s)",
+			t.Name, t.Transport, ToolsetTransportStreamable, ToolsetTransportSSE)
+	}
+	switch t.Agent {
+	case "", ToolsetAgentOrchestrator, ToolsetAgentToolRunner:
+	default:
+		return fmt.Errorf("toolset '%s': invalid agent '%s' (expected %s or %s)",
+			t.Name, t.Agent, ToolsetAgentOrchestrator, ToolsetAgentToolRunner)
+	}
+	return nil
+}
+
+// AgentRole returns the agent using the tools of the toolset
+func (t ToolsetConfig) AgentRole() string {
+	if t.Agent == "" {
+		return ToolsetAgentOrchestrator
+	}
+	return t.Agent
+}
+
+// TransportType returns how the MCP server is reached: stdio, streamable or sse
+func (t ToolsetConfig) TransportType() string {
+	switch {
+	case t.Command != "":
+		return ToolsetTransportStdio
+	case t.Transport == "":
+		return ToolsetTransportStreamable
+	default:
+		return t.Transport
+	}
+}
+
+// Location returns the command line or the URL of the MCP server
+func (t ToolsetConfig) Location() string {
+	if t.Command != "" {
+		return strings.Join(append([]string{t.Command}, t.Args...), " ")
+	}
+	return t.URL
+}
+
+// ValidateToolsets checks the toolsets of a configuration, and that their names are unique
+func ValidateToolsets(toolsets []ToolsetConfig) error {
+	names := make(map[string]bool, len(toolsets))
+	for _, toolset := range toolsets {
+		if err := toolset.Validate(); err != nil {
+			return err
+		}
+		if names[toolset.Name] {
+			return fmt.Errorf("duplicate toolset '%s'", toolset.Name)
+		}
+		names[toolset.Name] = true
+	}
+	return nil
+}
+
+// cagentToolset converts a toolset to a cagent MCP toolset. The ${VAR}
+// references of its env values, headers and URL are expanded by cagent when it
+// starts the toolset, so they are only checked here: the values (usually
+// secrets) never end up in the generated configuration.
+func cagentToolset(t ToolsetConfig) (map[string]interface{}, error) {
+	toolset := map[string]interface{}{"type": "mcp"}
+	if len(t.Tools) > 0 {
+		toolset["tools"] = t.Tools
+	}
+
+	if t.Command != "" {
+		toolset["command"] = t.Command
+		if len(t.Args) > 0 {
+			toolset["args"] = t.Args
+		}
+		if len(t.Env) > 0 {
+			if err := checkEnvMap(t.Env); err != nil {
+				return nil, fmt.Errorf("toolset '%s': %w", t.Name, err)
+			}
+			toolset["env"] = t.Env
+		}
+		return toolset, nil
+	}
+
+	if err := checkEnv(t.URL); err != nil {
+		return nil, fmt.Errorf("toolset '%s': %w", t.Name, err)
+	}
+	remote := map[string]interface{}{
+		"url":            cagentTemplate(t.URL),
+		"transport_type": t.TransportType(),
+	}
+	if len(t.Headers) > 0 {
+		if err := checkEnvMap(t.Headers); err != nil {
+			return nil, fmt.Errorf("toolset '%s': %w", t.Name, err)
+		}
+		headers := make(map[string]string, len(t.Headers))
+		for key, value := range t.Headers {
+			headers[key] = cagentTemplate(value)
+		}
+		remote["headers"] = headers
+	}
+	toolset["remote"] = remote
+	return toolset, nil
+}
+
+// cagentTemplate converts the ${VAR} references of a remote toolset setting to
+// the ${env.VAR} of the JavaScript templates cagent expands them with
+func cagentTemplate(s string) string {
+	return envReference.ReplaceAllString(s, "$${env.$1}")
+}
+
+// checkEnv checks the environment variables of the ${VAR} references of a value are set
+func checkEnv(s string) error {
+	_, err := expandEnv(s)
+	return err
+}
+
+// checkEnvMap checks the environment variables referenced by the values of a map are set
+func checkEnvMap(m map[string]string) error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := checkEnv(m[key]); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
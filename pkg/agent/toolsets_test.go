@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/cagent/pkg/environment"
+	"github.com/docker/cagent/pkg/js"
+	"gopkg.in/yaml.v3"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+func TestValidateToolsets(t *testing.T) {
+	tests := []struct {
+		name     string
+		toolsets []ToolsetConfig
+		wantErr  string
+	}{
+		{
+			name: "valid",
+			toolsets: []ToolsetConfig{
+				{Name: "github", Command: "github-mcp", Args: []string{"stdio"}, Env: map[string]string{"TOKEN": "x"}},
+				{Name: "docs", URL: "https://mcp.example.com/sse", Transport: "sse", Agent: "tool-runner"},
+				{Name: "search", URL: "https://mcp.example.com/mcp", Headers: map[string]string{"X-Key": "k"}},
+			},
+		},
+		{name: "no name", toolsets: []ToolsetConfig{{Command: "x"}}, wantErr: "must have a name"},
+		{name: "no command nor url", toolsets: []ToolsetConfig{{Name: "a"}}, wantErr: "exactly one of command or url"},
+		{name: "command and url", toolsets: []ToolsetConfig{{Name: "a", Command: "x", URL: "http://x"}}, wantErr: "exactly one of command or url"},
+		{name: "headers with command", toolsets: []ToolsetConfig{{Name: "a", Command: "x", Headers: map[string]string{"A": "b"}}}, wantErr: "only be used with url"},
+		{name: "args with url", toolsets: []ToolsetConfig{{Name: "a", URL: "http://x", Args: []string{"a"}}}, wantErr: "only be used with command"},
+		{name: "invalid transport", toolsets: []ToolsetConfig{{Name: "a", URL: "http://x", Transport: "ws"}}, wantErr: "invalid transport 'ws'"},
+		{name: "invalid agent", toolsets: []ToolsetConfig{{Name: "a", Command: "x", Agent: "planner"}}, wantErr: "invalid agent 'planner'"},
+		{name: "duplicate", toolsets: []ToolsetConfig{{Name: "a", Command: "x"}, {Name: "a", URL: "http://x"}}, wantErr: "duplicate toolset 'a'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateToolsets(tt.toolsets)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateToolsets() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateToolsets() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateCagentYAMLToolsets(t *testing.T) {
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Setenv("DON_TEST_TOKEN", "secret")
+
+	newConfig := func(toolsets ...ToolsetConfig) *Config {
+		return &Config{Agent: AgentConfigFile{
+			Models:   []ModelConfig{{Model: "gpt-4o", Class: "openai", Default: true}},
+			Toolsets: toolsets,
+		}}
+	}
+	generate := func(t *testing.T, cfg *Config) map[string]interface{} {
+		t.Helper()
+		data, err := GenerateCagentYAML(cfg, "tools.yaml", nil, logger)
+		if err != nil {
+			t.Fatalf("GenerateCagentYAML() error = %v", err)
+		}
+		var generated map[string]interface{}
+		if err := yaml.Unmarshal(data, &generated); err != nil {
+			t.Fatalf("failed to parse the generated YAML: %v", err)
+		}
+		return generated["agents"].(map[string]interface{})
+	}
+
+	t.Run("orchestrator", func(t *testing.T) {
+		agents := generate(t, newConfig(
+			ToolsetConfig{Name: "github", Command: "github-mcp", Args: []string{"stdio"}, Env: map[string]string{"TOKEN": "${DON_TEST_TOKEN}"}},
+			ToolsetConfig{Name: "docs", URL: "https://mcp.example.com/sse", Transport: "sse", Headers: map[string]string{"Authorization": "Bearer ${DON_TEST_TOKEN}"}, Tools: []string{"search"}},
+		))
+		if _, ok := agents[toolRunnerAgentName]; ok {
+			t.Errorf("agents = %v, want no tool-runner without tool-runner toolsets", agents)
+		}
+		toolsets := agents["root"].(map[string]interface{})["toolsets"].([]interface{})
+		if len(toolsets) != 3 {
+			t.Fatalf("root toolsets = %v, want mcpshell and the two toolsets", toolsets)
+		}
+		github := toolsets[1].(map[string]interface{})
+		if github["command"] != "github-mcp" || github["env"].(map[string]interface{})["TOKEN"] != "${DON_TEST_TOKEN}" {
+			t.Errorf("stdio toolset = %v, want the command with the env references", github)
+		}
+		docs := toolsets[2].(map[string]interface{})
+		remote := docs["remote"].(map[string]interface{})
+		authorization := remote["headers"].(map[string]interface{})["Authorization"]
+		if remote["url"] != "https://mcp.example.com/sse" || remote["transport_type"] != "sse" || authorization != "Bearer ${env.DON_TEST_TOKEN}" {
+			t.Errorf("remote toolset = %v, want the URL, transport and headers with env references", docs)
+		}
+		// cagent expands the references when it starts the toolset
+		if got := js.NewJsExpander(environment.NewOsEnvProvider()).Expand(context.Background(), authorization.(string)); got != "Bearer secret" {
+			t.Errorf("expanded header = %q, want %q", got, "Bearer secret")
+		}
+		if tools := docs["tools"].([]interface{}); len(tools) != 1 || tools[0] != "search" {
+			t.Errorf("remote toolset tools = %v, want [search]", tools)
+		}
+	})
+
+	t.Run("tool-runner", func(t *testing.T) {
+		agents := generate(t, newConfig(ToolsetConfig{Name: "docs", URL: "https://mcp.example.com/mcp", Agent: "tool-runner"}))
+		root := agents["root"].(map[string]interface{})
+		if subAgents := root["sub_agents"].([]interface{}); len(subAgents) != 1 || subAgents[0] != toolRunnerAgentName {
+			t.Errorf("root sub_agents = %v, want the tool-runner", subAgents)
+		}
+		if toolsets := root["toolsets"].([]interface{}); len(toolsets) != 1 {
+			t.Errorf("root toolsets = %v, want only mcpshell", toolsets)
+		}
+		toolRunner := agents[toolRunnerAgentName].(map[string]interface{})
+		if toolRunner["model"] != "gpt-4o" {
+			t.Errorf("tool-runner model = %v, want the root model without a tool-runner model", toolRunner["model"])
+		}
+		remote := toolRunner["toolsets"].([]interface{})[0].(map[string]interface{})["remote"].(map[string]interface{})
+		if remote["transport_type"] != "streamable" {
+			t.Errorf("tool-runner toolset = %v, want a streamable remote", remote)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := GenerateCagentYAML(newConfig(ToolsetConfig{Name: "a"}), "tools.yaml", nil, logger); err == nil {
+			t.Error("GenerateCagentYAML() with an invalid toolset error = nil, want an error")
+		}
+		cfg := newConfig(ToolsetConfig{Name: "a", URL: "https://${DON_TEST_UNSET_HOST}/mcp"})
+		if _, err := GenerateCagentYAML(cfg, "tools.yaml", nil, logger); err == nil || !strings.Contains(err.Error(), "DON_TEST_UNSET_HOST") {
+			t.Errorf("GenerateCagentYAML() with an unset variable error = %v, want it", err)
+		}
+		cfg = newConfig(ToolsetConfig{Name: "a", Command: "a-mcp", Env: map[string]string{"TOKEN": "${DON_TEST_UNSET_TOKEN}"}})
+		if _, err := GenerateCagentYAML(cfg, "tools.yaml", nil, logger); err == nil || !strings.Contains(err.Error(), "TOKEN: environment variable DON_TEST_UNSET_TOKEN is not set") {
+			t.Errorf("GenerateCagentYAML() with an unset env variable error = %v, want it", err)
+		}
+	})
+}
+
+func TestToolsetsParsing(t *testing.T) {
+	content := `agent:
+  toolsets:
+    - name: github
+      command: github-mcp-server
+      args: [stdio]
+      env:
+        GITHUB_TOKEN: ${GITHUB_TOKEN}
+    - name: docs
+      url: https://mcp.example.com/sse
+      transport: sse
+      headers:
+        Authorization: Bearer ${DOCS_TOKEN}
+      agent: tool-runner
+`
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(content), &cfg); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	toolsets := cfg.Agent.Toolsets
+	if len(toolsets) != 2 {
+		t.Fatalf("toolsets = %v, want 2", toolsets)
+	}
+	if toolsets[0].TransportType() != "stdio" || toolsets[0].Location() != "github-mcp-server stdio" || toolsets[0].AgentRole() != "orchestrator" {
+		t.Errorf("toolset %s = %+v, want a stdio toolset of the orchestrator", toolsets[0].Name, toolsets[0])
+	}
+	if toolsets[1].TransportType() != "sse" || toolsets[1].Headers["Authorization"] != "Bearer ${DOCS_TOKEN}" || toolsets[1].AgentRole() != "tool-runner" {
+		t.Errorf("toolset %s = %+v, want an SSE toolset of the tool-runner", toolsets[1].Name, toolsets[1])
+	}
+	if err := ValidateToolsets(toolsets); err != nil {
+		t.Errorf("ValidateToolsets() error = %v", err)
+	}
+}
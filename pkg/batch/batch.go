@@ -0,0 +1,187 @@
+// Package batch runs many prompts with the agent, e.g. the same diagnostic
+// questions against several clusters. The items are read from a JSONL file,
+// run in parallel (each with its own agent and cagent runtime), and their
+// results appended to an output JSONL file, so an interrupted batch resumes
+// where it stopped.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Item is a prompt of a batch, a line of the batch file
+type Item struct {
+	ID        string            `json:"id,omitempty"`        // Identifier of the item in the results (default: its line number)
+	Prompt    string            `json:"prompt"`              // Prompt, a Go template using the variables
+	Tools     string            `json:"tools,omitempty"`     // Tools file (default: the one given with --tools)
+	Model     string            `json:"model,omitempty"`     // Model name, from the configuration file or as is
+	RAG       []string          `json:"rag,omitempty"`       // RAG sources to enable (default: those given with --rag)
+	Variables map[string]string `json:"variables,omitempty"` // Values of the variables of the prompt
+}
+
+// RenderPrompt returns the prompt of the item with its variables. Variables
+// used by the prompt but missing in the item are an error.
+func (i Item) RenderPrompt() (string, error) {
+	if !strings.Contains(i.Prompt, "{{") {
+		return i.Prompt, nil
+	}
+	tmpl, err := template.New(i.ID).Option("missingkey=error").Parse(i.Prompt)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	variables := i.Variables
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	var prompt bytes.Buffer
+	if err := tmpl.Execute(&prompt, variables); err != nil {
+		return "", fmt.Errorf("failed to render the prompt: %w", err)
+	}
+	return prompt.String(), nil
+}
+
+// ToolCall is a tool call made while answering an item
+type ToolCall struct {
+	Agent     string          `json:"agent,omitempty"`
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Result    string          `json:"result,omitempty"`
+}
+
+// Usage holds the tokens used by an item, by all the agents
+type Usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	TotalTokens  int64 `json:"total_tokens"`
+}
+
+// Result is the outcome of an item, a line of the output file
+type Result struct {
+	ID         string     `json:"id"`
+	Prompt     string     `json:"prompt"` // Prompt sent to the agent, with the variables
+	Answer     string     `json:"answer,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	Usage      Usage      `json:"usage"`
+	DurationMS int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"` // Error of a failed item
+}
+
+// Failed returns whether the item failed
+func (r Result) Failed() bool {
+	return r.Error != ""
+}
+
+// LoadItems reads the items of a batch file, one JSON object per line. Empty
+// lines are ignored.
+func LoadItems(path string) ([]Item, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch file: %w", err)
+	}
+	items, err := ParseItems(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return items, nil
+}
+
+// ParseItems parses the items of a batch, one JSON object per line. Items
+// without an ID are identified by their line number.
+func ParseItems(data []byte) ([]Item, error) {
+	var items []Item
+	ids := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var item Item
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&item); err != nil {
+			return nil, fmt.Errorf("line %d: invalid item: %w", line, err)
+		}
+		if strings.TrimSpace(item.Prompt) == "" {
+			return nil, fmt.Errorf("line %d: prompt is required", line)
+		}
+		if item.ID == "" {
+			item.ID = strconv.Itoa(line)
+		}
+		if previous, ok := ids[item.ID]; ok {
+			return nil, fmt.Errorf("line %d: item '%s' already defined at line %d", line, item.ID, previous)
+		}
+		ids[item.ID] = line
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items")
+	}
+	return items, nil
+}
+
+// LoadResults reads the results of an output file, by item. Items appearing
+// several times (e.g. failed items run again) keep their last result. A missing
+// file has no results.
+func LoadResults(path string) (map[string]Result, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]Result{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+
+	results := make(map[string]Result)
+	for n, line := range strings.Split(completeLines(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var result Result
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			return nil, fmt.Errorf("%s: line %d: invalid result: %w", path, n+1, err)
+		}
+		results[result.ID] = result
+	}
+	return results, nil
+}
+
+// completeLines returns the complete lines of an output file, without the last
+// line if a write was interrupted
+func completeLines(data []byte) string {
+	end := bytes.LastIndexByte(data, '\n')
+	return string(data[:end+1])
+}
+
+// openOutput opens an output file for appending results, dropping the last line
+// if a write was interrupted
+func openOutput(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = f.Truncate(int64(len(completeLines(data))))
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	return f, nil
+}
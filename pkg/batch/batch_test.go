@@ -0,0 +1,135 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string // IDs
+		wantErr string
+	}{
+		{
+			name: "ids and line numbers",
+			data: `{"id": "prod", "prompt": "check {{.cluster}}", "variables": {"cluster": "prod"}}
+
+{"prompt": "check staging", "tools": "k8s.yaml", "model": "gpt-4o", "rag": ["runbooks"]}
+`,
+			want: []string{"prod", "3"},
+		},
+		{name: "no items", data: "\n\n", wantErr: "no items"},
+		{name: "no prompt", data: `{"id": "a"}`, wantErr: "line 1: prompt is required"},
+		{name: "unknown field", data: `{"prompt": "p", "tool": "k8s"}`, wantErr: `line 1: invalid item: json: unknown field "tool"`},
+		{name: "invalid JSON", data: `{"prompt": `, wantErr: "line 1: invalid item"},
+		{
+			name:    "duplicated id",
+			data:    "{\"id\": \"a\", \"prompt\": \"p\"}\n{\"id\": \"a\", \"prompt\": \"q\"}\n",
+			wantErr: "line 2: item 'a' already defined at line 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := ParseItems([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseItems() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseItems() error = %v", err)
+			}
+			var ids []string
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ParseItems() IDs = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    Item
+		want    string
+		wantErr string
+	}{
+		{name: "plain prompt", item: Item{Prompt: "check the disk"}, want: "check the disk"},
+		{
+			name: "variables",
+			item: Item{Prompt: "check {{.cluster}} in {{.region}}", Variables: map[string]string{"cluster": "prod", "region": "eu"}},
+			want: "check prod in eu",
+		},
+		{name: "missing variable", item: Item{Prompt: "check {{.cluster}}"}, wantErr: "failed to render the prompt"},
+		{name: "invalid template", item: Item{Prompt: "check {{.cluster"}, wantErr: "invalid prompt template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.item.RenderPrompt()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RenderPrompt() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("RenderPrompt() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+
+	results, err := LoadResults(path)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("LoadResults() of a missing file = %v, %v, want no results", results, err)
+	}
+
+	// The last line was interrupted, and the failed item ran again
+	data := `{"id": "a", "error": "timeout"}
+{"id": "b", "answer": "ok"}
+{"id": "a", "answer": "fine"}
+{"id": "c", "ans`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	results, err = LoadResults(path)
+	if err != nil {
+		t.Fatalf("LoadResults() error = %v", err)
+	}
+	if len(results) != 2 || results["a"].Answer != "fine" || results["a"].Failed() || results["b"].Answer != "ok" {
+		t.Errorf("LoadResults() = %+v, want the last results of a and b", results)
+	}
+
+	f, err := openOutput(path)
+	if err != nil {
+		t.Fatalf("openOutput() error = %v", err)
+	}
+	if err := writeResult(f, Result{ID: "c"}); err != nil {
+		t.Fatalf("writeResult() error = %v", err)
+	}
+	_ = f.Close()
+	written, _ := os.ReadFile(path)
+	if !strings.Contains(string(written), "\"fine\"}\n{\"id\":\"c\",") || strings.Contains(string(written), `"id": "c"`) {
+		t.Errorf("output = %s, want the interrupted line replaced", written)
+	}
+
+	if err := os.WriteFile(path, []byte("not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadResults(path); err == nil || !strings.Contains(err.Error(), "line 1: invalid result") {
+		t.Errorf("LoadResults() error = %v, want an invalid result", err)
+	}
+}
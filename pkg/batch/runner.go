@@ -0,0 +1,303 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/common"
+)
+
+// DefaultParallel is the number of items run at the same time by default
+const DefaultParallel = 4
+
+// rootAgentName is the agent whose messages make the answer of an item
+const rootAgentName = "root"
+
+// Config holds the settings of a batch
+type Config struct {
+	Agent    agent.AgentConfig                // Base configuration of the items (model, tools, prompts, RAG options...)
+	Models   []agent.ModelConfig              // Models the items can use by name (from the configuration file)
+	RAG      map[string]agent.RAGSourceConfig // RAG sources the items can enable (from the configuration file)
+	Parallel int                              // Number of items run at the same time (default: DefaultParallel)
+
+	// RetryFailed runs again the items that failed in a previous run
+	RetryFailed bool
+
+	// OnResult is called with the result of each item, as it ends
+	OnResult func(Result)
+}
+
+// Summary counts the items of a batch run
+type Summary struct {
+	Total     int // Items in the batch
+	Skipped   int // Items with a result from a previous run
+	Succeeded int
+	Failed    int
+}
+
+// runAgentFunc runs an agent, sending its events (see agent.Agent.RunEvents)
+type runAgentFunc func(ctx context.Context, config agent.AgentConfig, events chan<- agent.Event) error
+
+// Runner runs the items of batches
+type Runner struct {
+	config   Config
+	logger   *common.Logger
+	runAgent runAgentFunc
+}
+
+// New creates a batch runner
+func New(config Config, logger *common.Logger) *Runner {
+	if config.Parallel <= 0 {
+		config.Parallel = DefaultParallel
+	}
+	return &Runner{
+		config: config,
+		logger: logger,
+		runAgent: func(ctx context.Context, config agent.AgentConfig, events chan<- agent.Event) error {
+			return agent.New(config, logger).RunEvents(ctx, nil, events, nil)
+		},
+	}
+}
+
+// ItemConfig builds the agent configuration of an item
+func (r *Runner) ItemConfig(item Item) (agent.AgentConfig, error) {
+	prompt, err := item.RenderPrompt()
+	if err != nil {
+		return agent.AgentConfig{}, err
+	}
+
+	config := r.config.Agent
+	config.UserPrompt = prompt
+	config.Once = true
+	config.AutoApprove = true
+
+	if item.Tools != "" {
+		config.ToolsFile = item.Tools
+	}
+
+	if item.Model != "" {
+		config.ModelConfig = r.model(item.Model)
+	}
+
+	if item.RAG != nil {
+		config.RAGSources = item.RAG
+		config.RAGConfig = make(map[string]agent.RAGSourceConfig, len(item.RAG))
+		for _, name := range item.RAG {
+			source, ok := r.config.RAG[name]
+			if !ok {
+				return agent.AgentConfig{}, fmt.Errorf("RAG source '%s' not found in agent config file", name)
+			}
+			config.RAGConfig[name] = source
+		}
+	}
+	return config, nil
+}
+
+// model returns the configuration of a model, from the configuration file or
+// the base one with that model name
+func (r *Runner) model(name string) agent.ModelConfig {
+	for _, model := range r.config.Models {
+		if model.Name == name || model.Model == name {
+			return model
+		}
+	}
+	model := r.config.Agent.ModelConfig
+	model.Model = name
+	return model
+}
+
+// Run runs the items without a result in the output file, appending their
+// results to it. All the items are checked before running any. Items
+// interrupted by the cancellation of the context have no result, so they run
+// again when the batch is resumed.
+func (r *Runner) Run(ctx context.Context, items []Item, output string) (Summary, error) {
+	summary := Summary{Total: len(items)}
+
+	previous, err := LoadResults(output)
+	if err != nil {
+		return summary, err
+	}
+
+	type job struct {
+		item   Item
+		config agent.AgentConfig
+	}
+	var jobs []job
+	for _, item := range items {
+		if result, ok := previous[item.ID]; ok && !(result.Failed() && r.config.RetryFailed) {
+			summary.Skipped++
+			continue
+		}
+		config, err := r.ItemConfig(item)
+		if err != nil {
+			return summary, fmt.Errorf("item '%s': %w", item.ID, err)
+		}
+		jobs = append(jobs, job{item: item, config: config})
+	}
+	if len(jobs) == 0 {
+		return summary, nil
+	}
+
+	f, err := openOutput(output)
+	if err != nil {
+		return summary, err
+	}
+	defer f.Close()
+
+	r.logger.Info("Running %d items of %d (%d already done), %d at a time", len(jobs), len(items), summary.Skipped, r.config.Parallel)
+
+	var (
+		mu       sync.Mutex
+		writeErr error
+		wg       sync.WaitGroup
+	)
+	queue := make(chan job)
+	for i := 0; i < r.config.Parallel && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				result := r.runItem(ctx, job.item.ID, job.config)
+				if ctx.Err() != nil {
+					r.logger.Info("Item '%s' interrupted", job.item.ID)
+					continue
+				}
+
+				mu.Lock()
+				if err := writeResult(f, result); err != nil && writeErr == nil {
+					writeErr = err
+				}
+				if result.Failed() {
+					summary.Failed++
+				} else {
+					summary.Succeeded++
+				}
+				if r.config.OnResult != nil {
+					r.config.OnResult(result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if writeErr != nil {
+		return summary, writeErr
+	}
+	return summary, ctx.Err()
+}
+
+// runItem runs the agent of an item, collecting its result from the events
+func (r *Runner) runItem(ctx context.Context, id string, config agent.AgentConfig) Result {
+	r.logger.Info("Item '%s' started (tools: %s, model: %s)", id, config.ToolsFile, config.ModelConfig.Model)
+	start := time.Now()
+
+	events := make(chan agent.Event)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- r.runAgent(ctx, config, events)
+	}()
+
+	result := collect(events)
+	result.ID = id
+	result.Prompt = config.UserPrompt
+	result.DurationMS = time.Since(start).Milliseconds()
+	if err := <-runErr; err != nil && result.Error == "" && !errors.Is(err, context.Canceled) {
+		result.Error = err.Error()
+	}
+
+	if result.Failed() {
+		r.logger.Warn("Item '%s' failed: %s", id, result.Error)
+	} else {
+		r.logger.Info("Item '%s' done in %s", id, time.Duration(result.DurationMS)*time.Millisecond)
+	}
+	return result
+}
+
+// collect builds the result of an item from the events of its run
+func collect(events <-chan agent.Event) Result {
+	var (
+		result Result
+		answer strings.Builder
+		calls  = make(map[string]int) // Tool calls by ID
+		usage  = make(map[string]agent.EventUsage)
+	)
+	for event := range events {
+		switch event.Type {
+		case agent.EventMessage:
+			if event.Agent == rootAgentName {
+				answer.WriteString(event.Content)
+			}
+		case agent.EventSources:
+			answer.WriteString("\n\n" + event.Content)
+		case agent.EventToolCall:
+			calls[event.ToolCallID] = len(result.ToolCalls)
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				Agent:     event.Agent,
+				Tool:      event.Tool,
+				Arguments: arguments(event.Arguments),
+			})
+		case agent.EventToolResult:
+			if i, ok := calls[event.ToolCallID]; ok {
+				result.ToolCalls[i].Result = event.Content
+			}
+		case agent.EventTokenUsage:
+			// Each agent reports the tokens used so far
+			if event.Usage != nil {
+				usage[event.Agent] = *event.Usage
+			}
+		case agent.EventDone:
+			result.Error = event.Content
+		}
+	}
+
+	result.Answer = answer.String()
+	for _, u := range usage {
+		result.Usage.InputTokens += u.InputTokens
+		result.Usage.OutputTokens += u.OutputTokens
+	}
+	result.Usage.TotalTokens = result.Usage.InputTokens + result.Usage.OutputTokens
+	return result
+}
+
+// arguments returns the arguments of a tool call as JSON, quoting them when
+// they are not valid JSON
+func arguments(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	quoted, _ := json.Marshal(s)
+	return quoted
+}
+
+// writeResult appends a result to the output file, as a line
+func writeResult(f *os.File, result Result) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode the result of item '%s': %w", result.ID, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write the result of item '%s': %w", result.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/common"
+)
+
+// fakeRun is an agent calling a tool and answering with the prompt, the tools
+// file and the model. Prompts with "fail" fail, and prompts with "hang" wait
+// until the run is canceled.
+func fakeRun(ctx context.Context, config agent.AgentConfig, events chan<- agent.Event) error {
+	defer close(events)
+	if strings.Contains(config.UserPrompt, "hang") {
+		<-ctx.Done()
+		events <- agent.Event{Type: agent.EventDone, Content: ctx.Err().Error()}
+		return ctx.Err()
+	}
+	events <- agent.Event{Type: agent.EventToolCall, Agent: "root", ToolCallID: "c1", Tool: "disk_usage", Arguments: `{"path":"/var"}`}
+	events <- agent.Event{Type: agent.EventToolResult, Agent: "root", ToolCallID: "c1", Tool: "disk_usage", Content: "42K /var"}
+	events <- agent.Event{Type: agent.EventMessage, Agent: "tool_runner", Content: "ignored"}
+	events <- agent.Event{Type: agent.EventMessage, Agent: "root", Content: config.UserPrompt}
+	events <- agent.Event{Type: agent.EventMessage, Agent: "root", Content: " with " + config.ToolsFile + " and " + config.ModelConfig.Model}
+	events <- agent.Event{Type: agent.EventTokenUsage, Agent: "root", Usage: &agent.EventUsage{InputTokens: 10, OutputTokens: 5}}
+	events <- agent.Event{Type: agent.EventTokenUsage, Agent: "root", Usage: &agent.EventUsage{InputTokens: 20, OutputTokens: 8}}
+	events <- agent.Event{Type: agent.EventTokenUsage, Agent: "tool_runner", Usage: &agent.EventUsage{InputTokens: 3, OutputTokens: 2}}
+	if strings.Contains(config.UserPrompt, "fail") {
+		events <- agent.Event{Type: agent.EventDone, Content: "model unavailable"}
+		return errors.New("model unavailable")
+	}
+	events <- agent.Event{Type: agent.EventDone}
+	return nil
+}
+
+// newTestRunner creates a runner using fakeRun, collecting the results
+func newTestRunner(t *testing.T, config Config) (*Runner, *[]Result) {
+	t.Helper()
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu      sync.Mutex
+		results []Result
+	)
+	config.Agent.ToolsFile = "tools.yaml"
+	config.Agent.ModelConfig = agent.ModelConfig{Model: "gpt-4o", Class: "openai"}
+	config.OnResult = func(result Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+	}
+	runner := New(config, logger)
+	runner.runAgent = fakeRun
+	return runner, &results
+}
+
+func TestItemConfig(t *testing.T) {
+	runner, _ := newTestRunner(t, Config{
+		Models: []agent.ModelConfig{{Name: "fast", Model: "gpt-4o-mini", Class: "openai"}},
+		RAG:    map[string]agent.RAGSourceConfig{"runbooks": {Description: "Runbooks"}},
+	})
+
+	config, err := runner.ItemConfig(Item{
+		ID:        "prod",
+		Prompt:    "check {{.cluster}}",
+		Tools:     "k8s.yaml",
+		Model:     "fast",
+		RAG:       []string{"runbooks"},
+		Variables: map[string]string{"cluster": "prod"},
+	})
+	if err != nil {
+		t.Fatalf("ItemConfig() error = %v", err)
+	}
+	if config.UserPrompt != "check prod" || config.ToolsFile != "k8s.yaml" || config.ModelConfig.Model != "gpt-4o-mini" ||
+		!config.Once || !config.AutoApprove || config.RAGConfig["runbooks"].Description != "Runbooks" {
+		t.Errorf("ItemConfig() = %+v, want the item settings", config)
+	}
+
+	config, err = runner.ItemConfig(Item{ID: "1", Prompt: "check", Model: "claude-sonnet-4-5"})
+	if err != nil || config.ToolsFile != "tools.yaml" || config.ModelConfig.Model != "claude-sonnet-4-5" || config.ModelConfig.Class != "openai" {
+		t.Errorf("ItemConfig() = %+v, %v, want the base settings with the model name", config, err)
+	}
+
+	if _, err := runner.ItemConfig(Item{ID: "1", Prompt: "check", RAG: []string{"missing"}}); err == nil ||
+		!strings.Contains(err.Error(), "RAG source 'missing' not found") {
+		t.Errorf("ItemConfig() error = %v, want a missing RAG source", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "results.jsonl")
+	items := []Item{
+		{ID: "prod", Prompt: "check {{.cluster}}", Variables: map[string]string{"cluster": "prod"}},
+		{ID: "staging", Prompt: "check staging", Tools: "k8s.yaml", Model: "gpt-4o-mini"},
+		{ID: "broken", Prompt: "fail on broken"},
+	}
+
+	runner, results := newTestRunner(t, Config{Parallel: 2})
+	summary, err := runner.Run(context.Background(), items, output)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if summary != (Summary{Total: 3, Succeeded: 2, Failed: 1}) {
+		t.Errorf("Run() = %+v, want 2 succeeded and 1 failed", summary)
+	}
+	if len(*results) != 3 {
+		t.Fatalf("OnResult called %d times, want 3", len(*results))
+	}
+
+	saved, err := LoadResults(output)
+	if err != nil {
+		t.Fatalf("LoadResults() error = %v", err)
+	}
+	prod := saved["prod"]
+	if prod.Prompt != "check prod" || prod.Answer != "check prod with tools.yaml and gpt-4o" || prod.Failed() {
+		t.Errorf("prod result = %+v, want the answer of the root agent", prod)
+	}
+	if len(prod.ToolCalls) != 1 || prod.ToolCalls[0].Tool != "disk_usage" || string(prod.ToolCalls[0].Arguments) != `{"path":"/var"}` ||
+		prod.ToolCalls[0].Result != "42K /var" {
+		t.Errorf("prod tool calls = %+v, want the disk_usage call", prod.ToolCalls)
+	}
+	if prod.Usage != (Usage{InputTokens: 23, OutputTokens: 10, TotalTokens: 33}) {
+		t.Errorf("prod usage = %+v, want the last usage of each agent", prod.Usage)
+	}
+	if got := saved["staging"].Answer; got != "check staging with k8s.yaml and gpt-4o-mini" {
+		t.Errorf("staging answer = %q, want the item tools and model", got)
+	}
+	if got := saved["broken"].Error; got != "model unavailable" {
+		t.Errorf("broken error = %q, want the error of the run", got)
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		runner, results := newTestRunner(t, Config{})
+		summary, err := runner.Run(context.Background(), append(items, Item{ID: "new", Prompt: "check new"}), output)
+		if err != nil || summary != (Summary{Total: 4, Skipped: 3, Succeeded: 1}) {
+			t.Errorf("Run() = %+v, %v, want only the new item run", summary, err)
+		}
+		if len(*results) != 1 || (*results)[0].ID != "new" {
+			t.Errorf("results = %+v, want the new item", *results)
+		}
+	})
+
+	t.Run("retry failed", func(t *testing.T) {
+		items := append([]Item(nil), items...)
+		items[2].Prompt = "check broken"
+		runner, _ := newTestRunner(t, Config{RetryFailed: true})
+		summary, err := runner.Run(context.Background(), items, output)
+		if err != nil || summary != (Summary{Total: 3, Skipped: 2, Succeeded: 1}) {
+			t.Errorf("Run() = %+v, %v, want the failed item run again", summary, err)
+		}
+		saved, _ := LoadResults(output)
+		if saved["broken"].Failed() {
+			t.Errorf("broken result = %+v, want the result of the retry", saved["broken"])
+		}
+	})
+
+	t.Run("invalid item", func(t *testing.T) {
+		runner, results := newTestRunner(t, Config{})
+		_, err := runner.Run(context.Background(), []Item{{ID: "a", Prompt: "check a"}, {ID: "b", Prompt: "check {{.cluster}}"}},
+			filepath.Join(t.TempDir(), "results.jsonl"))
+		if err == nil || !strings.Contains(err.Error(), "item 'b'") {
+			t.Errorf("Run() error = %v, want the invalid item", err)
+		}
+		if len(*results) != 0 {
+			t.Errorf("results = %+v, want no item run", *results)
+		}
+	})
+}
+
+func TestRunInterrupted(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "results.jsonl")
+	items := []Item{{ID: "quick", Prompt: "check quick"}, {ID: "slow", Prompt: "hang on slow"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runner, _ := newTestRunner(t, Config{Parallel: 2})
+	runner.config.OnResult = func(Result) { cancel() }
+	done := make(chan struct{})
+	var (
+		summary Summary
+		err     error
+	)
+	go func() {
+		defer close(done)
+		summary, err = runner.Run(ctx, items, output)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not stop when canceled")
+	}
+	if !errors.Is(err, context.Canceled) || summary.Succeeded != 1 {
+		t.Errorf("Run() = %+v, %v, want the quick item done and the run canceled", summary, err)
+	}
+
+	// The interrupted item runs again when resuming
+	saved, _ := LoadResults(output)
+	if _, ok := saved["slow"]; ok || len(saved) != 1 {
+		t.Errorf("results = %+v, want only the quick item", saved)
+	}
+	runner, results := newTestRunner(t, Config{})
+	items[1].Prompt = "check slow"
+	if summary, err := runner.Run(context.Background(), items, output); err != nil || summary.Skipped != 1 || summary.Succeeded != 1 {
+		t.Errorf("resumed Run() = %+v, %v, want the slow item run", summary, err)
+	}
+	if len(*results) != 1 || (*results)[0].ID != "slow" {
+		t.Errorf("results = %+v, want the slow item", *results)
+	}
+}
@@ -1,11 +1,49 @@
 package common
 
+import "gopkg.in/yaml.v3"
+
 // PromptsConfig holds prompt configuration with system and user prompts
 type PromptsConfig struct {
 	System []string `yaml:"system,omitempty"` // System prompts
 	User   []string `yaml:"user,omitempty"`   // User prompts
 }
 
+// UnmarshalYAML allows each kind of prompts to be written as a single string
+// or as a list of strings
+func (p *PromptsConfig) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		System yaml.Node `yaml:"system"`
+		User   yaml.Node `yaml:"user"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	var err error
+	if p.System, err = decodePrompts(&raw.System); err != nil {
+		return err
+	}
+	p.User, err = decodePrompts(&raw.User)
+	return err
+}
+
+// decodePrompts decodes a single prompt or a list of prompts
+func decodePrompts(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil, nil
+		}
+		return []string{node.Value}, nil
+	}
+	var prompts []string
+	if err := node.Decode(&prompts); err != nil {
+		return nil, err
+	}
+	return prompts, nil
+}
+
 // GetSystemPrompts returns all system prompts joined with newlines
 func (p PromptsConfig) GetSystemPrompts() string {
 	if len(p.System) == 0 {
@@ -0,0 +1,86 @@
+// Package mock provides a scripted, OpenAI-compatible LLM for tests: an
+// in-process HTTP server answering the requests of the models with the canned
+// replies and tool calls of a YAML script, and checking the requests are the
+// expected ones.
+package mock
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Script is the scripted conversation of a mock model: each chat completion
+// request is answered with the next turn
+//
+//	turns:
+//	  - expect: disk usage of /var
+//	    tool_calls:
+//	      - name: disk_usage
+//	        arguments: {path: /var}
+//	  - expect: "42K"
+//	    reply: /var uses 42K.
+type Script struct {
+	Turns []Turn `yaml:"turns"`
+}
+
+// Turn is a reply of the model, to a request whose last message matches Expect
+type Turn struct {
+	Expect    string     `yaml:"expect,omitempty"`     // Regular expression the last message of the request must match, optional
+	Reply     string     `yaml:"reply,omitempty"`      // Content of the reply
+	ToolCalls []ToolCall `yaml:"tool_calls,omitempty"` // Tools the model calls
+
+	expect *regexp.Regexp
+}
+
+// ToolCall is a tool call of a scripted turn
+type ToolCall struct {
+	Name      string         `yaml:"name"`
+	Arguments map[string]any `yaml:"arguments,omitempty"`
+}
+
+// LoadScript reads a script file
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock script: %w", err)
+	}
+	script, err := ParseScript(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock script %s: %w", path, err)
+	}
+	return script, nil
+}
+
+// ParseScript parses and validates a script
+func ParseScript(data []byte) (*Script, error) {
+	var script Script
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, err
+	}
+	if len(script.Turns) == 0 {
+		return nil, fmt.Errorf("no turns")
+	}
+
+	for i := range script.Turns {
+		turn := &script.Turns[i]
+		if turn.Reply == "" && len(turn.ToolCalls) == 0 {
+			return nil, fmt.Errorf("turn %d has no reply nor tool calls", i+1)
+		}
+		for _, call := range turn.ToolCalls {
+			if call.Name == "" {
+				return nil, fmt.Errorf("turn %d has a tool call without name", i+1)
+			}
+		}
+		if turn.Expect != "" {
+			expect, err := regexp.Compile(turn.Expect)
+			if err != nil {
+				return nil, fmt.Errorf("turn %d has an invalid expect: %w", i+1, err)
+			}
+			turn.expect = expect
+		}
+	}
+	return &script, nil
+}
@@ -0,0 +1,51 @@
+package mock
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    int
+		wantErr string
+	}{
+		{
+			name: "replies and tool calls",
+			script: `
+turns:
+  - expect: (?i)disk usage
+    tool_calls:
+      - name: disk_usage
+        arguments: {path: /var, depth: 2}
+  - reply: /var uses 42K.
+`,
+			want: 2,
+		},
+		{name: "no turns", script: "turns: []\n", wantErr: "no turns"},
+		{name: "empty turn", script: "turns:\n  - expect: disk\n", wantErr: "turn 1 has no reply nor tool calls"},
+		{name: "tool call without name", script: "turns:\n  - tool_calls:\n      - arguments: {path: /}\n", wantErr: "tool call without name"},
+		{name: "invalid expect", script: "turns:\n  - expect: \"(\"\n    reply: ok\n", wantErr: "turn 1 has an invalid expect"},
+		{name: "invalid YAML", script: "turns: {", wantErr: "yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := ParseScript([]byte(tt.script))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseScript() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseScript() error = %v", err)
+			}
+			if len(script.Turns) != tt.want {
+				t.Errorf("ParseScript() = %d turns, want %d", len(script.Turns), tt.want)
+			}
+		})
+	}
+}
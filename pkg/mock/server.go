@@ -0,0 +1,324 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// DefaultDimensions is the size of the embedding vectors, unless the requests
+// ask for other dimensions
+const DefaultDimensions = 64
+
+// Server answers chat completion requests with the turns of a script, and
+// embedding requests with vectors derived from the words of the texts
+type Server struct {
+	mu       sync.Mutex
+	script   *Script
+	next     int      // Next turn of the script
+	problems []string // Requests not matching the script
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewServer creates a server for a script. It can be used as an http.Handler,
+// or started on a local port with Start.
+func NewServer(script *Script) *Server {
+	return &Server{script: script}
+}
+
+// Start serves the script on a local port
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	s.listener = listener
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = s.server.Serve(listener) }()
+	return nil
+}
+
+// URL returns the base URL of the OpenAI-compatible API of a started server
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String() + "/v1"
+}
+
+// Client returns an HTTP client answered by the server in-process, without
+// starting it on a port
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		resp := rec.Result()
+		resp.Request = req
+		return resp, nil
+	})}
+}
+
+// roundTripper is an http.RoundTripper function
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Close stops a started server
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// Err returns the differences between the requests and the script: requests
+// that do not match their turn, and turns never requested
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	problems := append([]string(nil), s.problems...)
+	if left := len(s.script.Turns) - s.next; left > 0 {
+		problems = append(problems, fmt.Sprintf("%d scripted turns were not requested (next: turn %d)", left, s.next+1))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the requests do not match the mock script:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// ServeHTTP answers the requests of the OpenAI API used by the agents
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/chat/completions"):
+		s.chatCompletion(w, req)
+	case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/embeddings"):
+		s.embeddings(w, req)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("mock: %s %s is not supported", req.Method, req.URL.Path))
+	}
+}
+
+// chatRequest is the part of a chat completion request used by the server
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Stream        bool `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+// lastMessage returns the text of the last message of a request
+func (r *chatRequest) lastMessage() string {
+	if len(r.Messages) == 0 {
+		return ""
+	}
+	content := r.Messages[len(r.Messages)-1].Content
+
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+	// Content with several parts
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	_ = json.Unmarshal(content, &parts)
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// chatCompletion answers a chat completion request with the next turn of the script
+func (s *Server) chatCompletion(w http.ResponseWriter, req *http.Request) {
+	var request chatRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("mock: invalid request: %v", err))
+		return
+	}
+	message := request.lastMessage()
+
+	s.mu.Lock()
+	if s.next >= len(s.script.Turns) {
+		s.problemf("request %d has no scripted turn left (last message: %q)", s.next+1, message)
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "mock: no scripted turn left")
+		return
+	}
+	number, turn := s.next+1, s.script.Turns[s.next]
+	s.next++
+	if turn.expect != nil && !turn.expect.MatchString(message) {
+		s.problemf("request %d does not match the expected %q (last message: %q)", number, turn.Expect, message)
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("mock: request %d does not match the expected %q", number, turn.Expect))
+		return
+	}
+	s.mu.Unlock()
+
+	toolCalls := make([]map[string]any, 0, len(turn.ToolCalls))
+	for i, call := range turn.ToolCalls {
+		arguments, err := json.Marshal(call.Arguments)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("mock: invalid arguments of %s: %v", call.Name, err))
+			return
+		}
+		if call.Arguments == nil {
+			arguments = []byte("{}")
+		}
+		toolCalls = append(toolCalls, map[string]any{
+			"index":    i,
+			"id":       fmt.Sprintf("call_%d_%d", number, i+1),
+			"type":     "function",
+			"function": map[string]any{"name": call.Name, "arguments": string(arguments)},
+		})
+	}
+	finish := "stop"
+	if len(toolCalls) > 0 {
+		finish = "tool_calls"
+	}
+	message = turn.Reply
+	usage := map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	id := fmt.Sprintf("chatcmpl-mock-%d", number)
+
+	if !request.Stream {
+		reply := map[string]any{"role": "assistant", "content": message}
+		if len(toolCalls) > 0 {
+			reply["tool_calls"] = toolCalls
+		}
+		writeJSON(w, map[string]any{
+			"id": id, "object": "chat.completion", "created": time.Now().Unix(), "model": request.Model,
+			"choices": []any{map[string]any{"index": 0, "message": reply, "finish_reason": finish}},
+			"usage":   usage,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	chunk := func(choices []any, extra map[string]any) {
+		data := map[string]any{
+			"id": id, "object": "chat.completion.chunk", "created": time.Now().Unix(), "model": request.Model,
+			"choices": choices,
+		}
+		for key, value := range extra {
+			data[key] = value
+		}
+		encoded, _ := json.Marshal(data)
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", encoded)
+	}
+	delta := map[string]any{"role": "assistant"}
+	if message != "" {
+		delta["content"] = message
+	}
+	if len(toolCalls) > 0 {
+		delta["tool_calls"] = toolCalls
+	}
+	chunk([]any{map[string]any{"index": 0, "delta": delta, "finish_reason": nil}}, nil)
+	chunk([]any{map[string]any{"index": 0, "delta": map[string]any{}, "finish_reason": finish}}, nil)
+	if request.StreamOptions != nil && request.StreamOptions.IncludeUsage {
+		chunk([]any{}, map[string]any{"usage": usage})
+	}
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// embeddings answers an embedding request with a vector per input, derived
+// from its words: texts sharing words get close vectors
+func (s *Server) embeddings(w http.ResponseWriter, req *http.Request) {
+	var request struct {
+		Model      string          `json:"model"`
+		Input      json.RawMessage `json:"input"`
+		Dimensions int             `json:"dimensions"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("mock: invalid request: %v", err))
+		return
+	}
+	var inputs []string
+	if err := json.Unmarshal(request.Input, &inputs); err != nil {
+		var input string
+		if err := json.Unmarshal(request.Input, &input); err != nil {
+			writeError(w, http.StatusBadRequest, "mock: input must be a string or a list of strings")
+			return
+		}
+		inputs = []string{input}
+	}
+	dimensions := request.Dimensions
+	if dimensions <= 0 {
+		dimensions = DefaultDimensions
+	}
+
+	data := make([]any, 0, len(inputs))
+	for i, input := range inputs {
+		data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": Embed(input, dimensions)})
+	}
+	writeJSON(w, map[string]any{
+		"object": "list", "data": data, "model": request.Model,
+		"usage": map[string]any{"prompt_tokens": len(inputs), "total_tokens": len(inputs)},
+	})
+}
+
+// Embed returns the vector of a text: its words hashed into the dimensions,
+// normalized
+func Embed(text string, dimensions int) []float64 {
+	vector := make([]float64, dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(word))
+		vector[h.Sum32()%uint32(dimensions)]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm == 0 {
+		vector[0] = 1
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+// problemf records a request not matching the script (s.mu held)
+func (s *Server) problemf(format string, args ...interface{}) {
+	s.problems = append(s.problems, fmt.Sprintf(format, args...))
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as the OpenAI API does
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": "invalid_request_error"},
+	})
+}
@@ -0,0 +1,134 @@
+package mock
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerChatCompletion(t *testing.T) {
+	script, err := ParseScript([]byte(`
+turns:
+  - expect: disk usage of /var
+    tool_calls:
+      - name: disk_usage
+        arguments: {path: /var}
+  - expect: "42K"
+    reply: /var uses 42K.
+`))
+	if err != nil {
+		t.Fatalf("ParseScript() error = %v", err)
+	}
+
+	post := func(s *Server, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+	const (
+		first  = `{"model":"m","messages":[{"role":"user","content":"What is the disk usage of /var?"}]}`
+		second = `{"model":"m","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"tool","content":[{"type":"text","text":"42K /var"}]}]}`
+	)
+
+	t.Run("scripted flow", func(t *testing.T) {
+		s := NewServer(script)
+
+		rec := post(s, "/v1/chat/completions", first)
+		var completion struct {
+			Choices []struct {
+				Message struct {
+					ToolCalls []struct {
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &completion); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("first response = %d %s", rec.Code, rec.Body)
+		}
+		choice := completion.Choices[0]
+		if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 ||
+			choice.Message.ToolCalls[0].Function.Name != "disk_usage" || choice.Message.ToolCalls[0].Function.Arguments != `{"path":"/var"}` {
+			t.Errorf("first response = %s, want the disk_usage tool call", rec.Body)
+		}
+
+		rec = post(s, "/v1/chat/completions", second)
+		body := rec.Body.String()
+		if rec.Header().Get("Content-Type") != "text/event-stream" || !strings.Contains(body, `"content":"/var uses 42K."`) ||
+			!strings.Contains(body, `"finish_reason":"stop"`) || !strings.Contains(body, `"usage":`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+			t.Errorf("second response = %s, want a stream with the reply", body)
+		}
+
+		if err := s.Err(); err != nil {
+			t.Errorf("Err() = %v", err)
+		}
+	})
+
+	t.Run("other flow", func(t *testing.T) {
+		s := NewServer(script)
+		if rec := post(s, "/v1/chat/completions", second); rec.Code != http.StatusBadRequest {
+			t.Errorf("unexpected request = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+		post(s, "/v1/chat/completions", second)
+		if rec := post(s, "/v1/chat/completions", second); rec.Code != http.StatusBadRequest {
+			t.Errorf("request after the script = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+		err := s.Err()
+		for _, want := range []string{`request 1 does not match the expected "disk usage of /var"`, "request 3 has no scripted turn left"} {
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("Err() = %v, want %q", err, want)
+			}
+		}
+	})
+
+	t.Run("turns not requested", func(t *testing.T) {
+		s := NewServer(script)
+		post(s, "/v1/chat/completions", first)
+		if err := s.Err(); err == nil || !strings.Contains(err.Error(), "1 scripted turns were not requested (next: turn 2)") {
+			t.Errorf("Err() = %v, want the turns left", err)
+		}
+	})
+}
+
+func TestServerEmbeddings(t *testing.T) {
+	s := NewServer(&Script{})
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/embeddings",
+		strings.NewReader(`{"model":"e","input":["disk usage of /var","Usage of DISK: /var","network latency"]}`)))
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || len(response.Data) != 3 {
+		t.Fatalf("response = %d %s", rec.Code, rec.Body)
+	}
+	similarity := func(a, b []float64) float64 {
+		var dot float64
+		for i := range a {
+			dot += a[i] * b[i]
+		}
+		return dot
+	}
+	same, other := response.Data[0].Embedding, response.Data[1].Embedding
+	if len(same) != DefaultDimensions || math.Abs(similarity(same, other)-1) > 1e-9 {
+		t.Errorf("texts with the same words have different vectors")
+	}
+	if similarity(same, response.Data[2].Embedding) >= similarity(same, other) {
+		t.Errorf("texts with different words are as close as texts with the same words")
+	}
+
+	if got := Embed("", 8); len(got) != 8 || got[0] != 1 {
+		t.Errorf("Embed(\"\") = %v, want a unit vector", got)
+	}
+}
@@ -0,0 +1,354 @@
+package rag
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+const (
+	// DefaultArchiveMaxEntrySize is the default maximum size of a single extracted file
+	DefaultArchiveMaxEntrySize = 10 * 1024 * 1024 // 10MB
+
+	// DefaultArchiveMaxTotalSize is the default maximum total size of an extracted archive
+	DefaultArchiveMaxTotalSize = 100 * 1024 * 1024 // 100MB
+
+	// DefaultArchiveMaxEntries is the default maximum number of files extracted from an archive
+	DefaultArchiveMaxEntries = 10000
+)
+
+// archiveExtensions lists the file name suffixes recognized as archives
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// ArchiveConfig holds configuration for archive extraction
+type ArchiveConfig struct {
+	CacheDir     string         // Cache directory (archives are extracted under <CacheDir>/archives)
+	MaxEntrySize int64          // Maximum size of a single extracted file
+	MaxTotalSize int64          // Maximum total size of all extracted files
+	MaxEntries   int            // Maximum number of extracted files
+	Logger       *common.Logger // Logger instance
+}
+
+// DefaultArchiveConfig returns a default ArchiveConfig
+func DefaultArchiveConfig(cacheDir string, logger *common.Logger) ArchiveConfig {
+	return ArchiveConfig{
+		CacheDir:     cacheDir,
+		MaxEntrySize: DefaultArchiveMaxEntrySize,
+		MaxTotalSize: DefaultArchiveMaxTotalSize,
+		MaxEntries:   DefaultArchiveMaxEntries,
+		Logger:       logger,
+	}
+}
+
+// IsArchive checks if a document location (local path or URL) refers to a supported archive
+func IsArchive(location string) bool {
+	name := location
+	if u, err := url.Parse(location); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		name = u.Path
+	}
+	name = strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchiveExtractor unpacks archives into the RAG cache directory
+type ArchiveExtractor struct {
+	config ArchiveConfig
+	logger *common.Logger
+}
+
+// NewArchiveExtractor creates a new archive extractor
+func NewArchiveExtractor(config ArchiveConfig) (*ArchiveExtractor, error) {
+	if config.Logger == nil {
+		return nil, ErrInvalidConfig("logger is required")
+	}
+	if config.CacheDir == "" {
+		return nil, ErrInvalidConfig("cache directory is required")
+	}
+	if config.MaxEntrySize <= 0 || config.MaxTotalSize <= 0 || config.MaxEntries <= 0 {
+		return nil, ErrInvalidConfig("archive limits must be positive")
+	}
+	return &ArchiveExtractor{
+		config: config,
+		logger: config.Logger,
+	}, nil
+}
+
+// Extract unpacks an archive and returns the directory holding its contents.
+// Archives are extracted into a directory named after their content hash, so
+// unpacking is skipped when an archive with the same content was already extracted.
+func (e *ArchiveExtractor) Extract(ctx context.Context, archivePath string) (string, error) {
+	hash, err := hashFile(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash archive: %w", err)
+	}
+
+	archivesDir := filepath.Join(e.config.CacheDir, "archives")
+	destDir := filepath.Join(archivesDir, hash)
+	metaPath := filepath.Join(archivesDir, hash+metadataExt)
+
+	// Lock the extraction, so concurrent processes do not unpack the same archive at once
+	unlock, err := lockCacheEntry(ctx, destDir)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(metaPath); err == nil {
+		if info, err := os.Stat(destDir); err == nil && info.IsDir() {
+			e.logger.Debug("Archive %s unchanged (%s), reusing extracted files", archivePath, shortSHA(hash))
+			if _, err := touchMetadata(metaPath); err != nil {
+				e.logger.Debug("Failed to record access time for %s: %v", archivePath, err)
+			}
+			return destDir, nil
+		}
+	}
+
+	if err := os.MkdirAll(archivesDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archives directory: %w", err)
+	}
+
+	// Extract into a temporary directory and move it into place when complete,
+	// so a failed extraction never leaves a partial tree behind
+	tmpDir, err := os.MkdirTemp(archivesDir, hash+".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	total, err := e.extractTo(ctx, archivePath, tmpDir)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.RemoveAll(destDir); err != nil {
+		return "", fmt.Errorf("failed to remove stale extraction: %w", err)
+	}
+	if err := os.Rename(tmpDir, destDir); err != nil {
+		return "", fmt.Errorf("failed to move extracted archive into place: %w", err)
+	}
+
+	now := time.Now()
+	meta := &CacheMetadata{
+		URL:          archivePath,
+		DownloadedAt: now,
+		AccessedAt:   now,
+		ContentHash:  hash,
+		Size:         total,
+	}
+	if err := SaveMetadata(metaPath, meta); err != nil {
+		e.logger.Warn("Failed to save metadata for archive %s: %v", archivePath, err)
+	}
+
+	e.logger.Info("Extracted archive %s (%d bytes)", archivePath, total)
+	return destDir, nil
+}
+
+// extractTo detects the archive format and extracts it into destDir
+// Returns the total number of bytes extracted
+func (e *ArchiveExtractor) extractTo(ctx context.Context, archivePath, destDir string) (int64, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	// Detect the format from the magic bytes rather than the file name
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+
+	w := &archiveWriter{extractor: e, destDir: destDir}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")) || bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		info, err := f.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat archive: %w", err)
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return 0, fmt.Errorf("failed to read zip archive: %w", err)
+		}
+		err = w.extractZip(ctx, zr)
+		return w.total, err
+
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read gzip archive: %w", err)
+		}
+		defer gz.Close()
+		err = w.extractTar(ctx, tar.NewReader(gz))
+		return w.total, err
+
+	default:
+		err = w.extractTar(ctx, tar.NewReader(br))
+		return w.total, err
+	}
+}
+
+// archiveWriter writes archive entries below destDir, enforcing the extraction limits
+type archiveWriter struct {
+	extractor *ArchiveExtractor
+	destDir   string
+	total     int64
+	entries   int
+}
+
+// extractZip extracts all entries of a zip archive
+func (w *archiveWriter) extractZip(ctx context.Context, zr *zip.Reader) error {
+	for _, zf := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		mode := zf.Mode()
+		if mode.IsDir() {
+			if _, err := w.safePath(zf.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			w.extractor.logger.Debug("Skipping non-regular archive entry: %s", zf.Name)
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open archive entry %s: %w", zf.Name, err)
+		}
+		err = w.writeFile(zf.Name, int64(zf.UncompressedSize64), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTar extracts all entries of a tar archive
+func (w *archiveWriter) extractTar(ctx context.Context, tr *tar.Reader) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %w", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := w.safePath(hdr.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := w.writeFile(hdr.Name, hdr.Size, tr); err != nil {
+				return err
+			}
+		default:
+			// Symlinks, hard links and devices are never extracted
+			w.extractor.logger.Debug("Skipping non-regular archive entry: %s", hdr.Name)
+		}
+	}
+}
+
+// safePath validates an archive entry name and returns its destination path
+func (w *archiveWriter) safePath(name string) (string, error) {
+	if err := ValidatePath(name); err != nil {
+		return "", err
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(name, "/") {
+		return "", ErrPathTraversal(name)
+	}
+
+	dest := filepath.Join(w.destDir, clean)
+	if dest != w.destDir && !strings.HasPrefix(dest, w.destDir+string(filepath.Separator)) {
+		return "", ErrPathTraversal(name)
+	}
+	return dest, nil
+}
+
+// writeFile writes a regular file entry, enforcing per-entry and total size limits
+func (w *archiveWriter) writeFile(name string, declaredSize int64, r io.Reader) error {
+	cfg := w.extractor.config
+
+	dest, err := w.safePath(name)
+	if err != nil {
+		return err
+	}
+
+	w.entries++
+	if w.entries > cfg.MaxEntries {
+		return ErrInvalidPath(fmt.Sprintf("archive has more than %d files", cfg.MaxEntries))
+	}
+	if declaredSize > cfg.MaxEntrySize {
+		return ErrFileTooLarge{Size: declaredSize, MaxSize: cfg.MaxEntrySize}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer out.Close()
+
+	// Never trust the declared size: copy at most one byte past each limit
+	limit := cfg.MaxEntrySize
+	if remaining := cfg.MaxTotalSize - w.total; remaining < limit {
+		limit = remaining
+	}
+	n, err := io.Copy(out, io.LimitReader(r, limit+1))
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if n > cfg.MaxEntrySize {
+		return ErrFileTooLarge{Size: n, MaxSize: cfg.MaxEntrySize}
+	}
+	w.total += n
+	if w.total > cfg.MaxTotalSize {
+		return ErrFileTooLarge{Size: w.total, MaxSize: cfg.MaxTotalSize}
+	}
+	return nil
+}
+
+// hashFile computes the SHA256 hash of a file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,248 @@
+package rag
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type archiveEntry struct {
+	name    string
+	content string
+	link    bool
+}
+
+func buildZip(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(e.content)); err != nil {
+			t.Fatalf("failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.link {
+			hdr = &tar.Header{Name: e.name, Linkname: e.content, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if !e.link {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatalf("failed to write tar entry: %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestExtractor(t *testing.T) *ArchiveExtractor {
+	t.Helper()
+	config := DefaultArchiveConfig(t.TempDir(), testLogger)
+	config.MaxEntrySize = 64
+	config.MaxTotalSize = 100
+	extractor, err := NewArchiveExtractor(config)
+	if err != nil {
+		t.Fatalf("NewArchiveExtractor() error = %v", err)
+	}
+	return extractor
+}
+
+func TestIsArchive(t *testing.T) {
+	tests := []struct {
+		location string
+		want     bool
+	}{
+		{"docs.zip", true},
+		{"./vendor/docs.TAR.GZ", true},
+		{"/tmp/docs.tgz", true},
+		{"docs.tar", true},
+		{"https://example.com/releases/docs.tar.gz?token=abc", true},
+		{"https://example.com/docs.zip/index.html", false},
+		{"docs.gz", false},
+		{"README.md", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			if got := IsArchive(tt.location); got != tt.want {
+				t.Errorf("IsArchive(%q) = %v, want %v", tt.location, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveExtract(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "vendor-docs/README.md", content: "# Vendor docs\n"},
+		{name: "vendor-docs/guide/install.txt", content: "Run the installer\n"},
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+	}{
+		{name: "zip", file: "docs.zip", content: buildZip(t, entries)},
+		{name: "tar.gz", file: "docs.tar.gz", content: buildTarGz(t, entries)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(archivePath, tt.content, 0644); err != nil {
+				t.Fatalf("failed to write archive: %v", err)
+			}
+
+			extractor := newTestExtractor(t)
+			dir, err := extractor.Extract(context.Background(), archivePath)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			for _, e := range entries {
+				got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(e.name)))
+				if err != nil || string(got) != e.content {
+					t.Errorf("extracted %s = %q, %v, want %q", e.name, got, err, e.content)
+				}
+			}
+
+			// Extracting the same content again reuses the extracted tree
+			marker := filepath.Join(dir, "marker")
+			if err := os.WriteFile(marker, nil, 0644); err != nil {
+				t.Fatalf("failed to write marker: %v", err)
+			}
+			again, err := extractor.Extract(context.Background(), archivePath)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if again != dir {
+				t.Errorf("Extract() = %s, want %s", again, dir)
+			}
+			if _, err := os.Stat(marker); err != nil {
+				t.Error("Extract() unpacked an unchanged archive again")
+			}
+		})
+	}
+}
+
+func TestArchiveExtractRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		wantErr error
+	}{
+		{
+			name:    "path traversal",
+			entries: []archiveEntry{{name: "../../etc/evil.txt", content: "x"}},
+			wantErr: ErrPathTraversal(""),
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{{name: "/etc/evil.txt", content: "x"}},
+			wantErr: ErrPathTraversal(""),
+		},
+		{
+			name:    "entry too large",
+			entries: []archiveEntry{{name: "big.txt", content: strings.Repeat("x", 65)}},
+			wantErr: ErrFileTooLarge{},
+		},
+		{
+			name: "total too large",
+			entries: []archiveEntry{
+				{name: "a.txt", content: strings.Repeat("a", 60)},
+				{name: "b.txt", content: strings.Repeat("b", 60)},
+			},
+			wantErr: ErrFileTooLarge{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "docs.tar.gz")
+			if err := os.WriteFile(archivePath, buildTarGz(t, tt.entries), 0644); err != nil {
+				t.Fatalf("failed to write archive: %v", err)
+			}
+
+			extractor := newTestExtractor(t)
+			_, err := extractor.Extract(context.Background(), archivePath)
+			if err == nil {
+				t.Fatal("Extract() expected error")
+			}
+
+			switch tt.wantErr.(type) {
+			case ErrPathTraversal:
+				var target ErrPathTraversal
+				if !errors.As(err, &target) {
+					t.Errorf("Extract() error = %v, want ErrPathTraversal", err)
+				}
+			case ErrFileTooLarge:
+				var target ErrFileTooLarge
+				if !errors.As(err, &target) {
+					t.Errorf("Extract() error = %v, want ErrFileTooLarge", err)
+				}
+			}
+
+			// Nothing but the lock file is left behind after a failed extraction
+			var leftovers []string
+			entries, _ := filepath.Glob(filepath.Join(extractor.config.CacheDir, "archives", "*"))
+			for _, entry := range entries {
+				if !strings.HasSuffix(entry, lockExt) {
+					leftovers = append(leftovers, entry)
+				}
+			}
+			if len(leftovers) != 0 {
+				t.Errorf("Extract() left files behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestArchiveExtractSkipsSymlinks(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "docs.tar.gz")
+	content := buildTarGz(t, []archiveEntry{
+		{name: "docs/readme.txt", content: "hello\n"},
+		{name: "docs/passwd", content: "/etc/passwd", link: true},
+	})
+	if err := os.WriteFile(archivePath, content, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	dir, err := newTestExtractor(t).Extract(context.Background(), archivePath)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "docs", "passwd")); !os.IsNotExist(err) {
+		t.Errorf("Extract() created symlink entry: %v", err)
+	}
+}
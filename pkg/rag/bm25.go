@@ -0,0 +1,134 @@
+package rag
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultBM25K1 is the default term frequency saturation of BM25
+	DefaultBM25K1 = 1.5
+
+	// DefaultBM25B is the default document length normalization of BM25
+	DefaultBM25B = 0.75
+)
+
+// BM25Params holds the BM25 scoring parameters
+type BM25Params struct {
+	K1        float64  // Term frequency saturation (default: 1.5)
+	B         *float64 // Document length normalization, from 0 to 1 (default: 0.75)
+	Threshold float64  // Minimum score of a result
+}
+
+// Validate checks that the parameters are in range
+func (p BM25Params) Validate() error {
+	if p.K1 < 0 {
+		return ErrInvalidConfig("BM25 k1 must not be negative")
+	}
+	if p.B != nil && (*p.B < 0 || *p.B > 1) {
+		return ErrInvalidConfig("BM25 b must be between 0 and 1")
+	}
+	return nil
+}
+
+// withDefaults returns the parameters with unset values replaced by their defaults
+func (p BM25Params) withDefaults() BM25Params {
+	if p.K1 <= 0 {
+		p.K1 = DefaultBM25K1
+	}
+	if p.B == nil {
+		b := DefaultBM25B
+		p.B = &b
+	}
+	return p
+}
+
+// stopWords are frequent English words ignored when indexing and searching
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "in": true, "is": true,
+	"it": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "with": true,
+}
+
+// Tokenize splits text into lowercase terms, dropping punctuation and stop words
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := fields[:0]
+	for _, field := range fields {
+		if !stopWords[field] {
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+// SearchResult is a chunk matching a query
+type SearchResult struct {
+	Chunk  Chunk              `json:"chunk"`
+	Score  float64            `json:"score"`            // Relevance score (fused score for several strategies)
+	Scores map[string]float64 `json:"scores,omitempty"` // Score given by each strategy
+}
+
+// SearchBM25 ranks the chunks of the index against a query with BM25
+// Returns at most limit results (all matching chunks if limit is 0), best first
+func (idx *Index) SearchBM25(query string, params BM25Params, limit int) []SearchResult {
+	params = params.withDefaults()
+	if len(idx.Chunks) == 0 {
+		return nil
+	}
+	avgLength := float64(idx.TotalLength) / float64(len(idx.Chunks))
+	n := float64(len(idx.Chunks))
+
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.Postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, posting := range postings {
+			tf := float64(posting.Freq)
+			norm := 1 - *params.B + *params.B*float64(idx.Lengths[posting.Chunk])/avgLength
+			scores[posting.Chunk] += idf * tf * (params.K1 + 1) / (tf + params.K1*norm)
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for chunk, score := range scores {
+		if score < params.Threshold {
+			continue
+		}
+		results = append(results, SearchResult{Chunk: idx.Chunks[chunk], Score: score})
+	}
+	sortResults(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// sortResults sorts results best first, breaking ties by document and position
+func sortResults(results []SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Chunk.Path != b.Chunk.Path {
+			return a.Chunk.Path < b.Chunk.Path
+		}
+		return a.Chunk.Index < b.Chunk.Index
+	})
+}
@@ -2,6 +2,7 @@
 package rag
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -10,6 +11,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
 )
 
 const (
@@ -20,8 +24,13 @@ const (
 	cacheSubDir = "don/rag"
 
 	// Cache file extensions
+	blobsSubDir = "blobs"
 	metadataExt = ".meta.json"
 	documentExt = ".txt"
+	lockExt     = ".lock"
+
+	// lockRetryDelay is the interval between attempts to take a cache entry lock
+	lockRetryDelay = 50 * time.Millisecond
 )
 
 // GetCacheDir returns the platform-specific cache directory for RAG documents
@@ -76,10 +85,10 @@ func EnsureCacheDir(dir string) error {
 	return nil
 }
 
-// GetCachedDocumentPath generates the cache file path from a URL hash
-func GetCachedDocumentPath(cacheDir, url string) string {
-	hash := hashURL(url)
-	return filepath.Join(cacheDir, "documents", hash+documentExt)
+// GetBlobPath returns the path of the blob holding a document with the given content hash
+// Documents are stored by content, so URLs serving the same content share a blob
+func GetBlobPath(cacheDir, contentHash string) string {
+	return filepath.Join(cacheDir, blobsSubDir, contentHash+documentExt)
 }
 
 // GetCachedMetadataPath generates the metadata file path from a URL hash
@@ -122,13 +131,107 @@ func SaveMetadata(path string, meta *CacheMetadata) error {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := writeFileAtomic(path, data, 0644); err != nil {
 		return fmt.Errorf("failed to write metadata file: %w", err)
 	}
 
 	return nil
 }
 
+// writeFileAtomic writes data to a temporary file in the same directory and renames
+// it into place, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// storeBlob writes content to its blob, unless a valid blob with the same content exists
+// Returns the blob path and whether the content was already cached
+func storeBlob(ctx context.Context, cacheDir, contentHash string, content []byte) (string, bool, error) {
+	blobPath := GetBlobPath(cacheDir, contentHash)
+
+	unlock, err := lockCacheEntry(ctx, strings.TrimSuffix(blobPath, documentExt))
+	if err != nil {
+		return "", false, err
+	}
+	defer unlock()
+
+	if verifyBlob(cacheDir, contentHash) == nil {
+		return blobPath, true, nil
+	}
+	if err := writeFileAtomic(blobPath, content, 0644); err != nil {
+		return "", false, err
+	}
+	return blobPath, false, nil
+}
+
+// verifyBlob checks that a blob exists and its content matches its hash
+func verifyBlob(cacheDir, contentHash string) error {
+	if contentHash == "" {
+		return ErrCacheError{Operation: "verify", Reason: "metadata has no content hash"}
+	}
+	content, err := os.ReadFile(GetBlobPath(cacheDir, contentHash))
+	if err != nil {
+		return ErrCacheError{Operation: "verify", Reason: err.Error()}
+	}
+	if hash := ComputeContentHash(content); hash != contentHash {
+		return ErrCacheError{Operation: "verify", Reason: fmt.Sprintf("content hash %s does not match metadata %s", shortSHA(hash), shortSHA(contentHash))}
+	}
+	return nil
+}
+
+// touchMetadata records the current time as the last access time of a cache entry
+func touchMetadata(metaPath string) (*CacheMetadata, error) {
+	meta, err := LoadMetadata(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	meta.AccessedAt = time.Now()
+	if err := SaveMetadata(metaPath, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// lockCacheEntry takes an exclusive lock on a cache entry, shared by all processes
+// using the same cache directory. The lock is held on <entryPath>.lock until the
+// returned function is called, or the process exits.
+func lockCacheEntry(ctx context.Context, entryPath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return nil, ErrCacheError{Operation: "lock", Reason: err.Error()}
+	}
+
+	lock := flock.New(entryPath + lockExt)
+	locked, err := lock.TryLockContext(ctx, lockRetryDelay)
+	if err != nil {
+		return nil, ErrCacheError{Operation: "lock", Reason: err.Error()}
+	}
+	if !locked {
+		return nil, ErrCacheError{Operation: "lock", Reason: "lock not acquired"}
+	}
+	return func() { _ = lock.Unlock() }, nil
+}
+
 // ValidatePath checks if a path is safe (no path traversal)
 func ValidatePath(path string) error {
 	// Check for path traversal attempts before cleaning
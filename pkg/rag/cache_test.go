@@ -1,6 +1,8 @@
 package rag
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -149,6 +151,52 @@ func TestSaveAndLoadMetadata(t *testing.T) {
 	}
 }
 
+func TestWriteFileAtomic(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "doc.txt")
+
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writeFileAtomic() error = %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != content {
+			t.Errorf("ReadFile() = %q, %v, want %q", got, err, content)
+		}
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 1 {
+		t.Errorf("expected only doc.txt, found %d entries", len(entries))
+	}
+}
+
+func TestLockCacheEntry(t *testing.T) {
+	entry := filepath.Join(t.TempDir(), "documents", "abc")
+
+	unlock, err := lockCacheEntry(context.Background(), entry)
+	if err != nil {
+		t.Fatalf("lockCacheEntry() error = %v", err)
+	}
+
+	// A second lock on the same entry waits until the first one is released
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = lockCacheEntry(ctx, entry)
+	var cacheErr ErrCacheError
+	if !errors.As(err, &cacheErr) {
+		t.Fatalf("lockCacheEntry() error = %v, want lock timeout", err)
+	}
+
+	unlock()
+	unlock, err = lockCacheEntry(context.Background(), entry)
+	if err != nil {
+		t.Fatalf("lockCacheEntry() after unlock error = %v", err)
+	}
+	unlock()
+}
+
 func TestValidatePath(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,138 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultChunkSize is the default chunk size in characters (as used by cagent for text)
+	DefaultChunkSize = 1500
+
+	// DefaultChunkOverlap is the default number of characters shared by consecutive chunks
+	DefaultChunkOverlap = 75
+)
+
+// ChunkConfig holds the configuration for splitting documents into chunks
+type ChunkConfig struct {
+	Size                  int  `json:"size"`                    // Chunk size in characters (default: 1500)
+	Overlap               *int `json:"overlap"`                 // Characters shared by consecutive chunks (default: 75)
+	RespectWordBoundaries bool `json:"respect_word_boundaries"` // Avoid splitting words between chunks
+}
+
+// Validate checks that the configuration is in range
+func (c ChunkConfig) Validate() error {
+	if c.Size < 0 {
+		return ErrInvalidConfig("chunk size must not be negative")
+	}
+	if c.Overlap != nil && *c.Overlap < 0 {
+		return ErrInvalidConfig("chunk overlap must not be negative")
+	}
+	return nil
+}
+
+// withDefaults returns the configuration with unset values replaced by their defaults
+func (c ChunkConfig) withDefaults() ChunkConfig {
+	if c.Size <= 0 {
+		c.Size = DefaultChunkSize
+	}
+	overlap := DefaultChunkOverlap
+	if c.Overlap != nil {
+		overlap = *c.Overlap
+	}
+	if overlap >= c.Size {
+		overlap = c.Size / 2
+	}
+	c.Overlap = &overlap
+	return c
+}
+
+// sameAs checks whether two configurations split documents the same way
+func (c ChunkConfig) sameAs(other ChunkConfig) bool {
+	c, other = c.withDefaults(), other.withDefaults()
+	return c.Size == other.Size && *c.Overlap == *other.Overlap && c.RespectWordBoundaries == other.RespectWordBoundaries
+}
+
+// Chunk is a piece of a document
+type Chunk struct {
+	Path      string `json:"path"`             // Document the chunk comes from
+	Source    string `json:"source,omitempty"` // Original location of the document (URL or path), when known
+	Index     int    `json:"index"`            // Position of the chunk in the document
+	StartLine int    `json:"start_line"`       // First line of the chunk (1-based)
+	EndLine   int    `json:"end_line"`         // Last line of the chunk (1-based)
+	Text      string `json:"text"`             // Chunk content
+
+	Metadata *Metadata `json:"metadata,omitempty"` // Metadata of the document, when known
+}
+
+// Location returns the original location of the chunk, with its line range
+func (c Chunk) Location() string {
+	source := c.Source
+	if source == "" {
+		source = c.Path
+	}
+	return fmt.Sprintf("%s:%d-%d", source, c.StartLine, c.EndLine)
+}
+
+// ChunkText splits a document into overlapping chunks of config.Size characters
+func ChunkText(path, text string, config ChunkConfig) []Chunk {
+	config = config.withDefaults()
+	runes := []rune(text)
+	total := len(runes)
+
+	var chunks []Chunk
+	line := 1 // line of runes[start]
+	lineAt := 0
+	start := 0
+	for start < total {
+		end := min(start+config.Size, total)
+
+		// Do not cut the last word of a chunk, unless it is the whole chunk
+		if config.RespectWordBoundaries && end < total && !unicode.IsSpace(runes[end]) {
+			if boundary := lastSpace(runes[start:end]); boundary > 0 {
+				end = start + boundary
+			}
+		}
+
+		for ; lineAt < start; lineAt++ {
+			if runes[lineAt] == '\n' {
+				line++
+			}
+		}
+		content := string(runes[start:end])
+		if trimmed := strings.TrimSpace(content); trimmed != "" {
+			startLine := line + strings.Count(content[:len(content)-len(strings.TrimLeftFunc(content, unicode.IsSpace))], "\n")
+			chunks = append(chunks, Chunk{
+				Path:      path,
+				Index:     len(chunks),
+				StartLine: startLine,
+				EndLine:   startLine + strings.Count(trimmed, "\n"),
+				Text:      trimmed,
+			})
+		}
+		if end >= total {
+			break
+		}
+
+		// Always make progress, even with a large overlap
+		next := max(end-*config.Overlap, start+1)
+		if config.RespectWordBoundaries {
+			for next > start+1 && !unicode.IsSpace(runes[next-1]) {
+				next--
+			}
+		}
+		start = next
+	}
+	return chunks
+}
+
+// lastSpace returns the position of the last whitespace in runes, or -1
+func lastSpace(runes []rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			return i
+		}
+	}
+	return -1
+}
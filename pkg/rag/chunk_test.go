@@ -0,0 +1,112 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		config ChunkConfig
+		want   []string
+	}{
+		{
+			name:   "empty",
+			text:   "",
+			config: ChunkConfig{Size: 10},
+		},
+		{
+			name:   "single chunk",
+			text:   "hello world",
+			config: ChunkConfig{Size: 100},
+			want:   []string{"hello world"},
+		},
+		{
+			name:   "overlap",
+			text:   "abcdefghij",
+			config: ChunkConfig{Size: 4, Overlap: ptr(1)},
+			want:   []string{"abcd", "defg", "ghij"},
+		},
+		{
+			name:   "word boundaries",
+			text:   "alpha beta gamma delta",
+			config: ChunkConfig{Size: 12, Overlap: ptr(1), RespectWordBoundaries: true},
+			want:   []string{"alpha beta", "beta gamma", "gamma delta"},
+		},
+		{
+			name:   "no overlap",
+			text:   "abcdefgh",
+			config: ChunkConfig{Size: 4, Overlap: ptr(0)},
+			want:   []string{"abcd", "efgh"},
+		},
+		{
+			name:   "overlap larger than size",
+			text:   "abcdef",
+			config: ChunkConfig{Size: 4, Overlap: ptr(10)},
+			want:   []string{"abcd", "cdef"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := ChunkText("doc.txt", tt.text, tt.config)
+			var got []string
+			for i, chunk := range chunks {
+				got = append(got, chunk.Text)
+				if chunk.Index != i || chunk.Path != "doc.txt" {
+					t.Errorf("chunk %d = {Path: %s, Index: %d}", i, chunk.Path, chunk.Index)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("ChunkText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ChunkConfig
+		wantErr bool
+	}{
+		{name: "unset", config: ChunkConfig{}},
+		{name: "no overlap", config: ChunkConfig{Overlap: ptr(0)}},
+		{name: "negative size", config: ChunkConfig{Size: -1}, wantErr: true},
+		{name: "negative overlap", config: ChunkConfig{Overlap: ptr(-1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChunkTextLines(t *testing.T) {
+	text := "line one\nline two\n\nline four\nline five\n"
+	chunks := ChunkText("doc.txt", text, ChunkConfig{Size: 20, Overlap: ptr(1), RespectWordBoundaries: true})
+	if len(chunks) < 2 {
+		t.Fatalf("ChunkText() returned %d chunks, want at least 2", len(chunks))
+	}
+
+	lines := strings.Split(text, "\n")
+	for _, chunk := range chunks {
+		first := strings.Split(chunk.Text, "\n")[0]
+		if !strings.Contains(lines[chunk.StartLine-1], first) {
+			t.Errorf("chunk %q starts at line %d (%q)", chunk.Text, chunk.StartLine, lines[chunk.StartLine-1])
+		}
+		if want := chunk.StartLine + strings.Count(chunk.Text, "\n"); chunk.EndLine != want {
+			t.Errorf("chunk %q ends at line %d, want %d", chunk.Text, chunk.EndLine, want)
+		}
+	}
+}
+
+// ptr returns a pointer to a value, for optional configuration fields
+func ptr[T any](v T) *T {
+	return &v
+}
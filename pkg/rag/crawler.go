@@ -0,0 +1,436 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/temoto/robotstxt"
+	"golang.org/x/net/html"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+const (
+	// CrawlerUserAgent is the user agent matched against robots.txt rules
+	CrawlerUserAgent = "don"
+
+	// DefaultCrawlMaxDepth is the default maximum link depth followed from the start URL
+	DefaultCrawlMaxDepth = 2
+
+	// DefaultCrawlMaxPages is the default maximum number of pages downloaded per crawl
+	DefaultCrawlMaxPages = 50
+
+	// maxSitemapIndexDepth bounds how many nested sitemap indexes are followed
+	maxSitemapIndexDepth = 3
+)
+
+// CrawlConfig holds configuration for a bounded web crawl or sitemap expansion
+type CrawlConfig struct {
+	URL          string   // Start URL (crawl) or sitemap URL (sitemap)
+	MaxDepth     int      // Maximum link depth followed from the start URL (crawl only)
+	MaxPages     int      // Maximum number of pages downloaded
+	SameHost     bool     // Only follow URLs on the same host as URL
+	Include      []string // Regexes a URL must match to be downloaded (any of them)
+	Exclude      []string // Regexes excluding a URL from being downloaded
+	IgnoreRobots bool     // Do not check robots.txt before downloading
+}
+
+// Crawler expands crawl and sitemap sources into downloaded documents
+type Crawler struct {
+	downloader *DocumentDownloader
+	logger     *common.Logger
+}
+
+// NewCrawler creates a new crawler that downloads pages through downloader
+func NewCrawler(downloader *DocumentDownloader, logger *common.Logger) *Crawler {
+	return &Crawler{
+		downloader: downloader,
+		logger:     logger,
+	}
+}
+
+// crawlState holds the filters and bookkeeping of a single crawl
+type crawlState struct {
+	config  CrawlConfig
+	start   *url.URL
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	robots  map[string]*robotstxt.RobotsData
+	seen    map[string]bool
+	files   []string
+}
+
+// Crawl downloads the start URL and follows links breadth-first within the
+// configured depth, page and URL filter limits.
+// Returns the local paths of the downloaded pages.
+func (c *Crawler) Crawl(ctx context.Context, config CrawlConfig) ([]string, error) {
+	state, err := c.newState(config)
+	if err != nil {
+		return nil, err
+	}
+
+	type queued struct {
+		url   string
+		depth int
+	}
+	queue := []queued{{url: state.start.String(), depth: 0}}
+	state.seen[state.start.String()] = true
+
+	for len(queue) > 0 && len(state.files) < state.config.MaxPages {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		item := queue[0]
+		queue = queue[1:]
+
+		if !c.allowed(ctx, state, item.url) {
+			continue
+		}
+
+		localPath, err := c.downloader.Download(ctx, item.url)
+		if err != nil {
+			if item.depth == 0 {
+				return nil, fmt.Errorf("failed to download start URL: %w", err)
+			}
+			c.logger.Warn("Skipping %s: %v", item.url, err)
+			continue
+		}
+		state.files = append(state.files, localPath)
+
+		if item.depth >= state.config.MaxDepth {
+			continue
+		}
+
+		links, err := c.pageLinks(item.url, localPath)
+		if err != nil {
+			c.logger.Warn("Failed to extract links from %s: %v", item.url, err)
+			continue
+		}
+		for _, link := range links {
+			if !state.seen[link] {
+				state.seen[link] = true
+				queue = append(queue, queued{url: link, depth: item.depth + 1})
+			}
+		}
+	}
+
+	c.logger.Info("Crawled %s: downloaded %d pages", config.URL, len(state.files))
+	return state.files, nil
+}
+
+// Sitemap downloads the pages listed in a sitemap.xml (following sitemap indexes)
+// within the configured page and URL filter limits.
+// Returns the local paths of the downloaded pages.
+func (c *Crawler) Sitemap(ctx context.Context, config CrawlConfig) ([]string, error) {
+	state, err := c.newState(config)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := c.sitemapURLs(ctx, state.start.String(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, page := range pages {
+		if len(state.files) >= state.config.MaxPages {
+			break
+		}
+		if state.seen[page] || !c.allowed(ctx, state, page) {
+			continue
+		}
+		state.seen[page] = true
+
+		localPath, err := c.downloader.Download(ctx, page)
+		if err != nil {
+			c.logger.Warn("Skipping %s: %v", page, err)
+			continue
+		}
+		state.files = append(state.files, localPath)
+	}
+
+	c.logger.Info("Expanded sitemap %s: downloaded %d of %d pages", config.URL, len(state.files), len(pages))
+	return state.files, nil
+}
+
+// newState validates a crawl configuration and prepares its filters
+func (c *Crawler) newState(config CrawlConfig) (*crawlState, error) {
+	if err := c.downloader.validateURL(config.URL); err != nil {
+		return nil, err
+	}
+	start, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, ErrInvalidURL(fmt.Sprintf("failed to parse: %v", err))
+	}
+	start.Fragment = ""
+
+	if config.MaxDepth < 0 {
+		return nil, ErrInvalidConfig("crawl max depth must not be negative")
+	}
+	if config.MaxPages <= 0 {
+		config.MaxPages = DefaultCrawlMaxPages
+	}
+
+	state := &crawlState{
+		config: config,
+		start:  start,
+		robots: make(map[string]*robotstxt.RobotsData),
+		seen:   make(map[string]bool),
+	}
+	if state.include, err = compilePatterns(config.Include); err != nil {
+		return nil, err
+	}
+	if state.exclude, err = compilePatterns(config.Exclude); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// allowed checks the host restriction, URL filters and robots.txt for a URL
+func (c *Crawler) allowed(ctx context.Context, state *crawlState, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	if state.config.SameHost && !strings.EqualFold(u.Host, state.start.Host) {
+		c.logger.Debug("Skipping %s: different host", rawURL)
+		return false
+	}
+
+	// The start URL is always allowed by the include filters
+	if rawURL != state.start.String() && len(state.include) > 0 && !matchesAny(state.include, rawURL) {
+		c.logger.Debug("Skipping %s: not matched by include patterns", rawURL)
+		return false
+	}
+	if matchesAny(state.exclude, rawURL) {
+		c.logger.Debug("Skipping %s: matched by exclude patterns", rawURL)
+		return false
+	}
+
+	if !state.config.IgnoreRobots && !c.robotsAllowed(ctx, state, u) {
+		c.logger.Debug("Skipping %s: disallowed by robots.txt", rawURL)
+		return false
+	}
+
+	return true
+}
+
+// robotsAllowed checks robots.txt for a URL, fetching it once per host
+func (c *Crawler) robotsAllowed(ctx context.Context, state *crawlState, u *url.URL) bool {
+	origin := u.Scheme + "://" + u.Host
+	robots, ok := state.robots[origin]
+	if !ok {
+		robots = c.fetchRobots(ctx, origin)
+		state.robots[origin] = robots
+	}
+	if robots == nil {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return robots.TestAgent(path, CrawlerUserAgent)
+}
+
+// fetchRobots downloads and parses robots.txt for an origin
+// Returns nil (allow everything) when robots.txt cannot be fetched
+func (c *Crawler) fetchRobots(ctx context.Context, origin string) *robotstxt.RobotsData {
+	req, client, _, err := c.downloader.newRequest(ctx, "GET", origin+"/robots.txt")
+	if err != nil {
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		c.logger.Debug("Failed to fetch robots.txt for %s: %v", origin, err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	robots, err := robotstxt.FromResponse(resp)
+	if err != nil {
+		c.logger.Debug("Failed to parse robots.txt for %s: %v", origin, err)
+		return nil
+	}
+	return robots
+}
+
+// pageLinks extracts absolute http(s) links from a downloaded HTML page
+func (c *Crawler) pageLinks(pageURL, localPath string) ([]string, error) {
+	meta, err := LoadMetadata(GetCachedMetadataPath(c.downloader.GetCacheDir(), pageURL))
+	if err == nil && !isHTMLContentType(meta.ContentType) {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached page: %w", err)
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	return extractLinks(base, content), nil
+}
+
+// extractLinks returns the absolute http(s) targets of <a href> elements,
+// honoring a <base href> element and dropping fragments
+func extractLinks(base *url.URL, content []byte) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			return links
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		name, hasAttr := tokenizer.TagName()
+		tag := string(name)
+		if (tag != "a" && tag != "base") || !hasAttr {
+			continue
+		}
+
+		for {
+			key, val, more := tokenizer.TagAttr()
+			if string(key) == "href" {
+				ref, err := url.Parse(strings.TrimSpace(string(val)))
+				if err == nil {
+					target := base.ResolveReference(ref)
+					if tag == "base" {
+						base = target
+					} else if target.Scheme == "http" || target.Scheme == "https" {
+						target.Fragment = ""
+						if link := target.String(); !seen[link] {
+							seen[link] = true
+							links = append(links, link)
+						}
+					}
+				}
+			}
+			if !more {
+				break
+			}
+		}
+	}
+}
+
+// sitemapDocument covers both <urlset> and <sitemapindex> sitemap documents
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// sitemapLoc is a <url> or <sitemap> entry in a sitemap document
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapURLs fetches a sitemap and returns the page URLs it lists,
+// recursively expanding sitemap indexes
+func (c *Crawler) sitemapURLs(ctx context.Context, sitemapURL string, depth int) ([]string, error) {
+	if depth > maxSitemapIndexDepth {
+		c.logger.Warn("Ignoring sitemap %s: too many nested sitemap indexes", sitemapURL)
+		return nil, nil
+	}
+
+	req, client, settings, err := c.downloader.newRequest(ctx, "GET", sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, ErrDownloadFailed{URL: sitemapURL, Reason: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrDownloadFailed{URL: sitemapURL, Reason: fmt.Sprintf("HTTP %d", resp.StatusCode)}
+	}
+
+	maxSize := settings.MaxSize
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sitemap: %w", err)
+	}
+	if int64(len(body)) > maxSize {
+		return nil, ErrFileTooLarge{Size: int64(len(body)), MaxSize: maxSize}
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	var pages []string
+	for _, u := range doc.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			pages = append(pages, loc)
+		}
+	}
+	for _, s := range doc.Sitemaps {
+		loc := strings.TrimSpace(s.Loc)
+		if loc == "" {
+			continue
+		}
+		nested, err := c.sitemapURLs(ctx, loc, depth+1)
+		if err != nil {
+			c.logger.Warn("Skipping nested sitemap %s: %v", loc, err)
+			continue
+		}
+		pages = append(pages, nested...)
+	}
+
+	return pages, nil
+}
+
+// compilePatterns compiles a list of URL filter regexes
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, ErrInvalidConfig(fmt.Sprintf("invalid URL pattern '%s': %v", p, err))
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matchesAny checks if a string matches any of the regexes
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTMLContentType checks if a content type is HTML
+func isHTMLContentType(contentType string) bool {
+	contentType = strings.TrimSpace(strings.ToLower(strings.Split(contentType, ";")[0]))
+	return contentType == "text/html" || contentType == "application/xhtml+xml"
+}
@@ -0,0 +1,212 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestSite starts a small website with a robots.txt and a sitemap
+func newTestSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	page := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, body)
+		}
+	}
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+	})
+	mux.HandleFunc("/docs/", page(`<html><body>
+		<a href="guide.html">Guide</a>
+		<a href="/docs/api.html#auth">API</a>
+		<a href="/private/secret.html">Secret</a>
+		<a href="/docs/changelog.pdf">Changelog</a>
+		<a href="https://other.example.com/">Elsewhere</a>
+		<a href="mailto:docs@example.com">Mail</a>
+	</body></html>`))
+	mux.HandleFunc("/docs/changelog.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		fmt.Fprint(w, "%PDF-1.4")
+	})
+	mux.HandleFunc("/docs/guide.html", page(`<a href="deep/one.html">Deeper</a>`))
+	mux.HandleFunc("/docs/api.html", page(`<p>API reference</p>`))
+	mux.HandleFunc("/docs/deep/one.html", page(`<a href="two.html">Deepest</a>`))
+	mux.HandleFunc("/docs/deep/two.html", page(`<p>Too deep</p>`))
+	mux.HandleFunc("/private/secret.html", page(`<p>Secret</p>`))
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>http://%s/sitemap-docs.xml</loc></sitemap>
+</sitemapindex>`, r.Host)
+	})
+	mux.HandleFunc("/sitemap-docs.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://%[1]s/docs/guide.html</loc></url>
+  <url><loc>http://%[1]s/docs/api.html</loc></url>
+  <url><loc>http://%[1]s/private/secret.html</loc></url>
+</urlset>`, r.Host)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestCrawler(t *testing.T) *Crawler {
+	t.Helper()
+	config := DefaultConfig(testLogger)
+	config.CacheDir = t.TempDir()
+	downloader, err := NewDownloader(config)
+	if err != nil {
+		t.Fatalf("NewDownloader() error = %v", err)
+	}
+	return NewCrawler(downloader, testLogger)
+}
+
+// downloadedURLs maps downloaded cache files back to their URL paths
+func downloadedURLs(t *testing.T, cacheDir string, files []string) []string {
+	t.Helper()
+	entries, err := ScanCache(cacheDir)
+	if err != nil {
+		t.Fatalf("ScanCache() error = %v", err)
+	}
+	var paths []string
+	for _, f := range files {
+		for _, entry := range entries {
+			if entry.Path != f {
+				continue
+			}
+			for _, rawURL := range entry.URLs {
+				u, _ := url.Parse(rawURL)
+				paths = append(paths, u.Path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestCrawlerCrawl(t *testing.T) {
+	server := newTestSite(t)
+
+	tests := []struct {
+		name   string
+		config CrawlConfig
+		want   []string
+	}{
+		{
+			name:   "depth limited",
+			config: CrawlConfig{MaxDepth: 1, SameHost: true},
+			want:   []string{"/docs/", "/docs/api.html", "/docs/guide.html"},
+		},
+		{
+			name:   "deeper crawl",
+			config: CrawlConfig{MaxDepth: 2, SameHost: true},
+			want:   []string{"/docs/", "/docs/api.html", "/docs/deep/one.html", "/docs/guide.html"},
+		},
+		{
+			name:   "page limited",
+			config: CrawlConfig{MaxDepth: 2, MaxPages: 2, SameHost: true},
+			want:   []string{"/docs/", "/docs/guide.html"},
+		},
+		{
+			name:   "exclude pattern",
+			config: CrawlConfig{MaxDepth: 2, SameHost: true, Exclude: []string{`/api\.html$`, `/deep/`}},
+			want:   []string{"/docs/", "/docs/guide.html"},
+		},
+		{
+			name:   "include pattern",
+			config: CrawlConfig{MaxDepth: 2, SameHost: true, Include: []string{`/api\.html$`}},
+			want:   []string{"/docs/", "/docs/api.html"},
+		},
+		{
+			name:   "robots ignored",
+			config: CrawlConfig{MaxDepth: 1, SameHost: true, IgnoreRobots: true, Exclude: []string{`/docs/.+`}},
+			want:   []string{"/docs/", "/private/secret.html"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.URL = server.URL + "/docs/"
+			crawler := newTestCrawler(t)
+			files, err := crawler.Crawl(context.Background(), tt.config)
+			if err != nil {
+				t.Fatalf("Crawl() error = %v", err)
+			}
+			got := downloadedURLs(t, crawler.downloader.GetCacheDir(), files)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Crawl() downloaded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawlerCrawlErrors(t *testing.T) {
+	server := newTestSite(t)
+	crawler := newTestCrawler(t)
+
+	if _, err := crawler.Crawl(context.Background(), CrawlConfig{URL: server.URL + "/missing", MaxDepth: 1}); err == nil {
+		t.Error("Crawl() expected error for missing start page")
+	}
+	if _, err := crawler.Crawl(context.Background(), CrawlConfig{URL: server.URL + "/docs/", Include: []string{"("}}); err == nil {
+		t.Error("Crawl() expected error for invalid include pattern")
+	}
+	if _, err := crawler.Crawl(context.Background(), CrawlConfig{URL: "ftp://example.com/"}); err == nil {
+		t.Error("Crawl() expected error for unsupported scheme")
+	}
+}
+
+func TestCrawlerSitemap(t *testing.T) {
+	server := newTestSite(t)
+
+	crawler := newTestCrawler(t)
+	files, err := crawler.Sitemap(context.Background(), CrawlConfig{
+		URL:      server.URL + "/sitemap.xml",
+		SameHost: true,
+	})
+	if err != nil {
+		t.Fatalf("Sitemap() error = %v", err)
+	}
+
+	got := downloadedURLs(t, crawler.downloader.GetCacheDir(), files)
+	want := []string{"/docs/api.html", "/docs/guide.html"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Sitemap() downloaded %v, want %v", got, want)
+	}
+
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("expected cached page at %s: %v", f, err)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/index.html")
+	content := []byte(`<html><head><base href="/v2/"></head><body>
+		<a href="intro.html#top">Intro</a>
+		<a href="intro.html">Intro again</a>
+		<a href="https://example.com/abs">Absolute</a>
+		<a href="javascript:void(0)">JS</a>
+		<a name="anchor">No href</a>
+	</body></html>`)
+
+	got := extractLinks(base, content)
+	want := []string{"https://example.com/v2/intro.html", "https://example.com/abs"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("extractLinks() = %v, want %v", got, want)
+	}
+}
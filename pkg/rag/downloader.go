@@ -3,12 +3,12 @@ package rag
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -17,10 +17,10 @@ import (
 
 // DocumentDownloader implements the Downloader interface
 type DocumentDownloader struct {
-	config     DownloaderConfig
-	cacheDir   string
-	logger     *common.Logger
-	httpClient *http.Client
+	config   DownloaderConfig
+	cacheDir string
+	logger   *common.Logger
+	clients  *httpClients
 }
 
 // NewDownloader creates a new document downloader
@@ -45,19 +45,28 @@ func NewDownloader(config DownloaderConfig) (*DocumentDownloader, error) {
 		return nil, fmt.Errorf("failed to ensure cache directory: %w", err)
 	}
 
-	// Create HTTP client with timeout
-	httpClient := &http.Client{
-		Timeout: config.Timeout,
+	d := &DocumentDownloader{
+		config:   config,
+		cacheDir: cacheDir,
+		logger:   config.Logger,
+		clients:  &httpClients{},
+	}
+
+	// Create the HTTP clients up front, so a bad CA bundle or proxy is
+	// reported now rather than on the first download
+	if _, err := d.clients.get(config.HTTP.withDefaults(HTTPSettings{Timeout: config.Timeout})); err != nil {
+		return nil, fmt.Errorf("invalid HTTP settings: %w", err)
+	}
+	for _, rule := range config.HTTPRules {
+		settings := config.HTTP.withDefaults(rule.Settings).withDefaults(HTTPSettings{Timeout: config.Timeout})
+		if _, err := d.clients.get(settings); err != nil {
+			return nil, fmt.Errorf("invalid HTTP settings for '%s': %w", rule.Match, err)
+		}
 	}
 
 	config.Logger.Debug("Initialized RAG downloader with cache directory: %s", cacheDir)
 
-	return &DocumentDownloader{
-		config:     config,
-		cacheDir:   cacheDir,
-		logger:     config.Logger,
-		httpClient: httpClient,
-	}, nil
+	return d, nil
 }
 
 // GetCacheDir returns the cache directory being used
@@ -67,11 +76,32 @@ func (d *DocumentDownloader) GetCacheDir() string {
 
 // Download downloads a document from a URL and returns the local file path
 func (d *DocumentDownloader) Download(ctx context.Context, urlStr string) (string, error) {
+	return d.download(ctx, urlStr, true)
+}
+
+// DownloadArchive downloads an archive from a URL and returns the local file path
+// Unlike Download, the content is not required to be text
+func (d *DocumentDownloader) DownloadArchive(ctx context.Context, urlStr string) (string, error) {
+	return d.download(ctx, urlStr, false)
+}
+
+// download downloads a URL into the cache, reusing a fresh cached copy when possible
+func (d *DocumentDownloader) download(ctx context.Context, urlStr string, requireText bool) (string, error) {
 	// Validate URL
 	if err := d.validateURL(urlStr); err != nil {
 		return "", fmt.Errorf("invalid URL: %w", err)
 	}
 
+	metaPath := GetCachedMetadataPath(d.cacheDir, urlStr)
+
+	// Lock the cache entry, so concurrent processes do not download the
+	// same document at once or read it while it is being replaced
+	unlock, err := lockCacheEntry(ctx, strings.TrimSuffix(metaPath, metadataExt))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
 	// Check if we have a valid cached version
 	cachedPath, exists, err := d.GetCachedPath(urlStr)
 	if err != nil {
@@ -79,59 +109,80 @@ func (d *DocumentDownloader) Download(ctx context.Context, urlStr string) (strin
 	}
 
 	if exists && !d.config.ForceRefresh {
-		// Validate cache freshness
-		valid, err := d.ValidateCache(urlStr)
-		if err != nil {
+		if err := d.verifyCachedDocument(urlStr); err != nil {
+			// Corrupt or incomplete entry (e.g. a crash between writes): download it again
+			d.logger.Warn("Discarding cached document for %s: %v", urlStr, err)
+		} else if valid, err := d.ValidateCache(urlStr); err != nil {
+			// Validate cache freshness
 			d.logger.Warn("Failed to validate cache for %s: %v", urlStr, err)
 		} else if valid {
 			d.logger.Debug("Using cached document for %s", urlStr)
+			size := d.touch(metaPath)
+			d.recordStats(ctx, func(stats *CacheStats) {
+				stats.Hits++
+				stats.BytesSaved += size
+			})
 			return cachedPath, nil
 		}
 	}
 
 	// Download the document
 	d.logger.Info("Downloading document from %s", urlStr)
-	content, meta, err := d.downloadWithValidation(ctx, urlStr)
+	content, meta, err := d.downloadWithValidation(ctx, urlStr, requireText)
 	if err != nil {
 		return "", fmt.Errorf("download failed: %w", err)
 	}
 
-	// Save to cache
-	docPath := GetCachedDocumentPath(d.cacheDir, urlStr)
-	metaPath := GetCachedMetadataPath(d.cacheDir, urlStr)
-
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(docPath), 0755); err != nil {
-		return "", fmt.Errorf("failed to create cache directory: %w", err)
-	}
-
-	// Write document content
-	if err := os.WriteFile(docPath, content, 0644); err != nil {
+	// Store the content by its hash, so mirrors of the same document share a blob
+	blobPath, deduplicated, err := storeBlob(ctx, d.cacheDir, meta.ContentHash, content)
+	if err != nil {
 		return "", fmt.Errorf("failed to write document to cache: %w", err)
 	}
 
-	// Write metadata
+	// Write metadata once the content is in place. An interrupted write leaves
+	// a blob without metadata, which is detected on the next read
 	if err := SaveMetadata(metaPath, meta); err != nil {
 		d.logger.Warn("Failed to save metadata for %s: %v", urlStr, err)
 	}
 
-	d.logger.Info("Downloaded and cached document from %s (%d bytes)", urlStr, len(content))
-	return docPath, nil
+	d.recordStats(ctx, func(stats *CacheStats) {
+		stats.Misses++
+		stats.BytesDownloaded += meta.Size
+		if deduplicated {
+			stats.Deduplicated++
+			stats.BytesDeduplicated += meta.Size
+		}
+	})
+
+	if deduplicated {
+		d.logger.Info("Downloaded document from %s (%d bytes), same content already cached", urlStr, len(content))
+	} else {
+		d.logger.Info("Downloaded and cached document from %s (%d bytes)", urlStr, len(content))
+	}
+	return blobPath, nil
 }
 
 // GetCachedPath returns the cached file path for a URL if it exists
 func (d *DocumentDownloader) GetCachedPath(urlStr string) (string, bool, error) {
-	docPath := GetCachedDocumentPath(d.cacheDir, urlStr)
+	meta, err := LoadMetadata(GetCachedMetadataPath(d.cacheDir, urlStr))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	blobPath := GetBlobPath(d.cacheDir, meta.ContentHash)
 
 	// Check if file exists
-	if _, err := os.Stat(docPath); err != nil {
+	if _, err := os.Stat(blobPath); err != nil {
 		if os.IsNotExist(err) {
 			return "", false, nil
 		}
 		return "", false, fmt.Errorf("failed to stat cached file: %w", err)
 	}
 
-	return docPath, true, nil
+	return blobPath, true, nil
 }
 
 // ValidateCache checks if a cached document is still fresh
@@ -154,6 +205,33 @@ func (d *DocumentDownloader) ValidateCache(urlStr string) (bool, error) {
 	return d.checkCacheFreshness(urlStr, meta)
 }
 
+// verifyCachedDocument checks that the blob of a cached document matches the content hash in its metadata
+func (d *DocumentDownloader) verifyCachedDocument(urlStr string) error {
+	meta, err := LoadMetadata(GetCachedMetadataPath(d.cacheDir, urlStr))
+	if err != nil {
+		return ErrCacheError{Operation: "verify", Reason: err.Error()}
+	}
+	return verifyBlob(d.cacheDir, meta.ContentHash)
+}
+
+// touch records the access time of a cached document, used for LRU eviction
+// Returns the size of the document
+func (d *DocumentDownloader) touch(metaPath string) int64 {
+	meta, err := touchMetadata(metaPath)
+	if err != nil {
+		d.logger.Debug("Failed to record access time in %s: %v", metaPath, err)
+		return 0
+	}
+	return meta.Size
+}
+
+// recordStats updates the cache statistics, logging (but ignoring) failures
+func (d *DocumentDownloader) recordStats(ctx context.Context, update func(stats *CacheStats)) {
+	if err := UpdateCacheStats(ctx, d.cacheDir, update); err != nil {
+		d.logger.Debug("Failed to update cache statistics: %v", err)
+	}
+}
+
 // validateURL validates that a URL is safe to download from
 func (d *DocumentDownloader) validateURL(urlStr string) error {
 	parsedURL, err := url.Parse(urlStr)
@@ -175,13 +253,13 @@ func (d *DocumentDownloader) validateURL(urlStr string) error {
 }
 
 // downloadWithValidation downloads content from a URL with validation
-func (d *DocumentDownloader) downloadWithValidation(ctx context.Context, urlStr string) ([]byte, *CacheMetadata, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+func (d *DocumentDownloader) downloadWithValidation(ctx context.Context, urlStr string, requireText bool) ([]byte, *CacheMetadata, error) {
+	req, client, settings, err := d.newRequest(ctx, "GET", urlStr)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, err
 	}
 
-	resp, err := d.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, nil, ErrDownloadFailed{URL: urlStr, Reason: err.Error()}
 	}
@@ -197,37 +275,39 @@ func (d *DocumentDownloader) downloadWithValidation(ctx context.Context, urlStr
 
 	// Check content type
 	contentType := resp.Header.Get("Content-Type")
-	if !isTextContentType(contentType) {
+	if requireText && !isTextContentType(contentType) {
 		return nil, nil, ErrNotTextFile(fmt.Sprintf("content type: %s", contentType))
 	}
 
 	// Check content length
-	if resp.ContentLength > d.config.MaxSize {
+	if resp.ContentLength > settings.MaxSize {
 		return nil, nil, ErrFileTooLarge{
 			Size:    resp.ContentLength,
-			MaxSize: d.config.MaxSize,
+			MaxSize: settings.MaxSize,
 		}
 	}
 
 	// Read content with size limit
-	limitedReader := io.LimitReader(resp.Body, d.config.MaxSize+1)
+	limitedReader := io.LimitReader(resp.Body, settings.MaxSize+1)
 	content, err := io.ReadAll(limitedReader)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	// Check if we exceeded the size limit
-	if int64(len(content)) > d.config.MaxSize {
+	if int64(len(content)) > settings.MaxSize {
 		return nil, nil, ErrFileTooLarge{
 			Size:    int64(len(content)),
-			MaxSize: d.config.MaxSize,
+			MaxSize: settings.MaxSize,
 		}
 	}
 
 	// Create metadata
+	now := time.Now()
 	meta := &CacheMetadata{
 		URL:          urlStr,
-		DownloadedAt: time.Now(),
+		DownloadedAt: now,
+		AccessedAt:   now,
 		ContentHash:  ComputeContentHash(content),
 		ETag:         resp.Header.Get("ETag"),
 		LastModified: resp.Header.Get("Last-Modified"),
@@ -240,7 +320,7 @@ func (d *DocumentDownloader) downloadWithValidation(ctx context.Context, urlStr
 
 // checkCacheFreshness makes a HEAD request to check if cached content is still fresh
 func (d *DocumentDownloader) checkCacheFreshness(urlStr string, meta *CacheMetadata) (bool, error) {
-	req, err := http.NewRequest("HEAD", urlStr, nil)
+	req, client, _, err := d.newRequest(context.Background(), "HEAD", urlStr)
 	if err != nil {
 		return false, fmt.Errorf("failed to create HEAD request: %w", err)
 	}
@@ -253,7 +333,7 @@ func (d *DocumentDownloader) checkCacheFreshness(urlStr string, meta *CacheMetad
 		req.Header.Set("If-Modified-Since", meta.LastModified)
 	}
 
-	resp, err := d.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		// If HEAD request fails, assume cache is valid
 		d.logger.Debug("HEAD request failed for %s, assuming cache is valid: %v", urlStr, err)
@@ -0,0 +1,161 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloaderRefetchesCorruptCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "original content")
+	}))
+	defer server.Close()
+
+	config := DefaultConfig(testLogger)
+	config.CacheDir = t.TempDir()
+	d, err := NewDownloader(config)
+	if err != nil {
+		t.Fatalf("NewDownloader() error = %v", err)
+	}
+
+	docURL := server.URL + "/doc.txt"
+	tests := []struct {
+		name    string
+		corrupt func(blobPath, metaPath string)
+		want    int32 // total requests after downloading
+	}{
+		{name: "first download", corrupt: func(string, string) {}, want: 1},
+		{name: "valid cache", corrupt: func(string, string) {}, want: 1},
+		{name: "modified document", corrupt: func(blobPath, _ string) {
+			_ = os.WriteFile(blobPath, []byte("tampered"), 0644)
+		}, want: 2},
+		{name: "missing metadata", corrupt: func(_, metaPath string) {
+			_ = os.Remove(metaPath)
+		}, want: 3},
+		{name: "unreadable metadata", corrupt: func(_, metaPath string) {
+			_ = os.WriteFile(metaPath, []byte("{"), 0644)
+		}, want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobPath, _, _ := d.GetCachedPath(docURL)
+			tt.corrupt(blobPath, GetCachedMetadataPath(d.GetCacheDir(), docURL))
+
+			path, err := d.Download(context.Background(), docURL)
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if content, _ := os.ReadFile(path); string(content) != "original content" {
+				t.Errorf("cached content = %q", content)
+			}
+			if got := requests.Load(); got != tt.want {
+				t.Errorf("requests = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloaderConcurrentDownloads(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "shared document")
+	}))
+	defer server.Close()
+
+	// Several downloaders (as in several processes) share one cache directory
+	cacheDir := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config := DefaultConfig(testLogger)
+			config.CacheDir = cacheDir
+			d, err := NewDownloader(config)
+			if err != nil {
+				errs <- err
+				return
+			}
+			path, err := d.Download(context.Background(), server.URL+"/shared.txt")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if content, err := os.ReadFile(path); err != nil || string(content) != "shared document" {
+				errs <- fmt.Errorf("cached content = %q, %v", content, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want a single download", got)
+	}
+}
+
+func TestDownloaderDeduplicatesContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "same content on every mirror")
+	}))
+	defer server.Close()
+
+	config := DefaultConfig(testLogger)
+	config.CacheDir = t.TempDir()
+	d, err := NewDownloader(config)
+	if err != nil {
+		t.Fatalf("NewDownloader() error = %v", err)
+	}
+
+	first, err := d.Download(context.Background(), server.URL+"/mirror1/doc.txt")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	second, err := d.Download(context.Background(), server.URL+"/mirror2/doc.txt")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if first != second {
+		t.Errorf("Download() stored mirrors in %s and %s, want a shared blob", first, second)
+	}
+	if _, err := d.Download(context.Background(), server.URL+"/mirror1/doc.txt"); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+
+	stats, err := LoadCacheStats(config.CacheDir)
+	if err != nil {
+		t.Fatalf("LoadCacheStats() error = %v", err)
+	}
+	size := int64(len("same content on every mirror"))
+	if stats.Misses != 2 || stats.Hits != 1 || stats.Deduplicated != 1 {
+		t.Errorf("stats = %+v, want 2 misses, 1 hit, 1 deduplicated", stats)
+	}
+	if stats.BytesSaved != size || stats.BytesDeduplicated != size || stats.BytesDownloaded != 2*size {
+		t.Errorf("stats bytes = %+v", stats)
+	}
+
+	entries, err := ScanCache(config.CacheDir)
+	if err != nil {
+		t.Fatalf("ScanCache() error = %v", err)
+	}
+	if len(entries) != 1 || len(entries[0].URLs) != 2 || entries[0].Size != size {
+		t.Errorf("ScanCache() = %+v, want one blob for both URLs", entries)
+	}
+}
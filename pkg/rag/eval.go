@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// EvalQuestion is a question with the documents or keywords its results should contain
+type EvalQuestion struct {
+	Question string   `json:"question"`
+	Sources  []string `json:"sources,omitempty"`  // Expected documents: paths (or path suffixes) and URLs
+	Keywords []string `json:"keywords,omitempty"` // Expected keywords in the chunk contents (case-insensitive)
+}
+
+// EvalScore holds the retrieval metrics of a question
+type EvalScore struct {
+	Recall float64 `json:"recall"` // Fraction of the expected sources and keywords found in the top k results
+	Rank   int     `json:"rank"`   // Rank of the first relevant result in the top k (0 if none)
+}
+
+// EvalMetrics holds the retrieval metrics of a set of questions
+type EvalMetrics struct {
+	Recall float64 `json:"recall_at_k"` // Mean recall@k
+	MRR    float64 `json:"mrr"`         // Mean reciprocal rank of the first relevant result (within the top k)
+	Hits   int     `json:"hits"`        // Questions with a relevant result in the top k
+}
+
+// ScoreResults computes the metrics of the top k results of a question
+// A result is relevant if it comes from an expected source or contains an expected keyword.
+func ScoreResults(question EvalQuestion, results []SearchResult, k int) EvalScore {
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+
+	var score EvalScore
+	found := make(map[int]bool)
+	expected := len(question.Sources) + len(question.Keywords)
+	for rank, result := range results {
+		relevant := false
+		for i, source := range question.Sources {
+			if matchesSource(result.Chunk, source) {
+				found[i] = true
+				relevant = true
+			}
+		}
+		text := strings.ToLower(result.Chunk.Text)
+		for i, keyword := range question.Keywords {
+			if strings.Contains(text, strings.ToLower(keyword)) {
+				found[len(question.Sources)+i] = true
+				relevant = true
+			}
+		}
+		if relevant && score.Rank == 0 {
+			score.Rank = rank + 1
+		}
+	}
+	if expected > 0 {
+		score.Recall = float64(len(found)) / float64(expected)
+	}
+	return score
+}
+
+// AggregateScores computes the metrics of a set of questions
+func AggregateScores(scores []EvalScore) EvalMetrics {
+	var metrics EvalMetrics
+	if len(scores) == 0 {
+		return metrics
+	}
+	for _, score := range scores {
+		metrics.Recall += score.Recall
+		if score.Rank > 0 {
+			metrics.MRR += 1 / float64(score.Rank)
+			metrics.Hits++
+		}
+	}
+	metrics.Recall /= float64(len(scores))
+	metrics.MRR /= float64(len(scores))
+	return metrics
+}
+
+// matchesSource checks whether a chunk comes from an expected source: its path or
+// original location is the source, or ends with it (e.g. "docs/install.md")
+func matchesSource(chunk Chunk, source string) bool {
+	source = filepath.ToSlash(strings.TrimPrefix(source, "./"))
+	for _, location := range []string{chunk.Path, chunk.Source} {
+		location = filepath.ToSlash(location)
+		if location != "" && (location == source || strings.HasSuffix(location, "/"+source)) {
+			return true
+		}
+	}
+	return false
+}
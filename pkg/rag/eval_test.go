@@ -0,0 +1,50 @@
+package rag
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreResults(t *testing.T) {
+	results := []SearchResult{
+		{Chunk: Chunk{Path: "/repo/docs/intro.md", Text: "Welcome to the project"}},
+		{Chunk: Chunk{Path: "/cache/blobs/abc.txt", Source: "https://example.com/install.html", Text: "Run the installer"}},
+		{Chunk: Chunk{Path: "/repo/docs/install.md", Text: "Use GO INSTALL to build it"}},
+	}
+
+	tests := []struct {
+		name     string
+		question EvalQuestion
+		k        int
+		want     EvalScore
+	}{
+		{"path suffix", EvalQuestion{Sources: []string{"docs/install.md"}}, 3, EvalScore{Recall: 1, Rank: 3}},
+		{"relative path", EvalQuestion{Sources: []string{"./docs/intro.md"}}, 3, EvalScore{Recall: 1, Rank: 1}},
+		{"URL", EvalQuestion{Sources: []string{"https://example.com/install.html"}}, 3, EvalScore{Recall: 1, Rank: 2}},
+		{"keyword", EvalQuestion{Keywords: []string{"go install"}}, 3, EvalScore{Recall: 1, Rank: 3}},
+		{"partial recall", EvalQuestion{Sources: []string{"docs/install.md", "docs/missing.md"}}, 3, EvalScore{Recall: 0.5, Rank: 3}},
+		{"beyond k", EvalQuestion{Sources: []string{"docs/install.md"}}, 2, EvalScore{Recall: 0, Rank: 0}},
+		{"partial file name", EvalQuestion{Sources: []string{"stall.md"}}, 3, EvalScore{Recall: 0, Rank: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScoreResults(tt.question, results, tt.k); got != tt.want {
+				t.Errorf("ScoreResults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateScores(t *testing.T) {
+	metrics := AggregateScores([]EvalScore{
+		{Recall: 1, Rank: 1},
+		{Recall: 0.5, Rank: 4},
+		{Recall: 0, Rank: 0},
+	})
+	if math.Abs(metrics.Recall-0.5) > 1e-9 || math.Abs(metrics.MRR-1.25/3) > 1e-9 || metrics.Hits != 2 {
+		t.Errorf("AggregateScores() = %+v, want recall 0.5, MRR 0.4167 and 2 hits", metrics)
+	}
+	if metrics := AggregateScores(nil); metrics != (EvalMetrics{}) {
+		t.Errorf("AggregateScores(nil) = %+v, want zero metrics", metrics)
+	}
+}
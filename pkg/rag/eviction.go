@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+// PruneResult holds the outcome of a cache pruning
+type PruneResult struct {
+	Evicted      []*CacheEntry // Entries removed from the cache
+	BytesEvicted int64         // Bytes removed from the cache
+	TotalSize    int64         // Cache size after pruning
+}
+
+// PruneCache evicts the least recently used entries of a cache directory until its
+// size is at most maxSize bytes. Entries used at or after keepSince (e.g. by the
+// current run) are never evicted, so the cache can stay above maxSize.
+func PruneCache(ctx context.Context, cacheDir string, maxSize int64, keepSince time.Time, logger *common.Logger) (*PruneResult, error) {
+	entries, err := ScanCache(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cache: %w", err)
+	}
+
+	result := &PruneResult{}
+	for _, entry := range entries {
+		result.TotalSize += entry.Size
+	}
+
+	// Entries are sorted least recently used first
+	for _, entry := range entries {
+		if result.TotalSize <= maxSize {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if !entry.AccessedAt.Before(keepSince) {
+			logger.Warn("RAG cache size %d bytes exceeds the limit of %d bytes, but the remaining entries are in use", result.TotalSize, maxSize)
+			break
+		}
+
+		if err := evictEntry(ctx, entry); err != nil {
+			logger.Warn("Failed to evict %s from the RAG cache: %v", entry.Path, err)
+			continue
+		}
+		logger.Debug("Evicted %s %s (%d bytes) from the RAG cache", entry.Kind, entry.Path, entry.Size)
+		result.Evicted = append(result.Evicted, entry)
+		result.BytesEvicted += entry.Size
+		result.TotalSize -= entry.Size
+	}
+
+	if len(result.Evicted) > 0 {
+		logger.Info("Evicted %d entries (%d bytes) from the RAG cache", len(result.Evicted), result.BytesEvicted)
+		if err := UpdateCacheStats(ctx, cacheDir, func(stats *CacheStats) {
+			stats.Evictions += int64(len(result.Evicted))
+			stats.BytesEvicted += result.BytesEvicted
+		}); err != nil {
+			logger.Debug("Failed to update cache statistics: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// evictEntry removes a cache entry and the metadata referencing it
+// Metadata goes first: a URL left without its blob is simply downloaded again
+func evictEntry(ctx context.Context, entry *CacheEntry) error {
+	// Lock the URL entries before the blob, in the same order as downloads
+	if entry.Kind == CacheEntryDocument {
+		for _, metaPath := range entry.metaPaths {
+			unlock, err := lockCacheEntry(ctx, strings.TrimSuffix(metaPath, metadataExt))
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+	}
+	unlock, err := lockCacheEntry(ctx, entry.lockPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, metaPath := range entry.metaPaths {
+		if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.RemoveAll(entry.Path)
+}
@@ -0,0 +1,98 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addCachedDocument adds a document to the cache, as if downloaded from url at accessedAt
+func addCachedDocument(t *testing.T, cacheDir, url, content string, accessedAt time.Time) string {
+	t.Helper()
+	hash := ComputeContentHash([]byte(content))
+	blobPath, _, err := storeBlob(context.Background(), cacheDir, hash, []byte(content))
+	if err != nil {
+		t.Fatalf("storeBlob() error = %v", err)
+	}
+	meta := &CacheMetadata{
+		URL:          url,
+		DownloadedAt: accessedAt,
+		AccessedAt:   accessedAt,
+		ContentHash:  hash,
+		Size:         int64(len(content)),
+	}
+	if err := SaveMetadata(GetCachedMetadataPath(cacheDir, url), meta); err != nil {
+		t.Fatalf("SaveMetadata() error = %v", err)
+	}
+	return blobPath
+}
+
+func TestPruneCache(t *testing.T) {
+	now := time.Now()
+	kb := strings.Repeat("x", 1023)
+
+	tests := []struct {
+		name        string
+		maxSize     int64
+		keepSince   time.Time
+		wantEvicted []string
+	}{
+		{name: "under limit", maxSize: 10 * 1024, keepSince: now, wantEvicted: nil},
+		{name: "evicts until under limit", maxSize: 2 * 1024, keepSince: now, wantEvicted: []string{"old"}},
+		{name: "evicts least recently used", maxSize: 1024, keepSince: now, wantEvicted: []string{"old", "archive"}},
+		{name: "keeps entries in use", maxSize: 0, keepSince: now.Add(-90 * time.Minute), wantEvicted: []string{"old", "archive"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			paths := map[string]string{
+				"old":    addCachedDocument(t, cacheDir, "https://example.com/old", "a"+kb, now.Add(-3*time.Hour)),
+				"recent": addCachedDocument(t, cacheDir, "https://example.com/recent", "b"+kb, now.Add(-time.Hour)),
+				"mirror": addCachedDocument(t, cacheDir, "https://mirror.example.com/recent", "b"+kb, now.Add(-4*time.Hour)),
+			}
+
+			// An extracted archive, used between the two documents
+			archiveDir := filepath.Join(cacheDir, "archives", "abc")
+			writeFile(t, filepath.Join(archiveDir, "doc.md"), "c"+kb)
+			if err := SaveMetadata(archiveDir+metadataExt, &CacheMetadata{URL: "docs.zip", AccessedAt: now.Add(-2 * time.Hour)}); err != nil {
+				t.Fatalf("SaveMetadata() error = %v", err)
+			}
+			paths["archive"] = archiveDir
+
+			result, err := PruneCache(context.Background(), cacheDir, tt.maxSize, tt.keepSince, testLogger)
+			if err != nil {
+				t.Fatalf("PruneCache() error = %v", err)
+			}
+
+			var evicted []string
+			for _, entry := range result.Evicted {
+				for name, path := range paths {
+					if entry.Path == path && name != "mirror" {
+						evicted = append(evicted, name)
+					}
+				}
+			}
+			if strings.Join(evicted, ",") != strings.Join(tt.wantEvicted, ",") {
+				t.Errorf("PruneCache() evicted %v, want %v", evicted, tt.wantEvicted)
+			}
+
+			for _, name := range tt.wantEvicted {
+				if _, err := os.Stat(paths[name]); !os.IsNotExist(err) {
+					t.Errorf("%s still in cache after eviction", name)
+				}
+			}
+
+			// The mirror shares the recent document's blob, so it was kept alive by it
+			if _, err := os.Stat(paths["recent"]); err != nil {
+				t.Errorf("recently used document evicted: %v", err)
+			}
+			if _, err := LoadMetadata(GetCachedMetadataPath(cacheDir, "https://mirror.example.com/recent")); err != nil {
+				t.Errorf("mirror metadata removed with a blob still in use: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	// FusionRRF ranks results by reciprocal rank fusion
+	FusionRRF = "rrf"
+	// FusionWeighted ranks results by the weighted sum of their strategy scores
+	FusionWeighted = "weighted"
+	// FusionMax ranks results by their best strategy score
+	FusionMax = "max"
+
+	// DefaultRRFK is the default RRF smoothing parameter
+	DefaultRRFK = 60
+)
+
+// FusionConfig holds the configuration for combining the results of several strategies
+type FusionConfig struct {
+	Strategy string             // Fusion strategy: "rrf" (default), "weighted" or "max"
+	K        int                // RRF smoothing parameter (default: 60)
+	Weights  map[string]float64 // Strategy weights for weighted fusion
+}
+
+// Fuse combines the results of several strategies, keyed by strategy name, into a
+// single ranking. Results of a single strategy are returned as they are.
+// Results are the same passage when they have the same document and text, as
+// strategies may chunk documents differently and so number their chunks differently.
+func Fuse(strategyResults map[string][]SearchResult, config FusionConfig) ([]SearchResult, error) {
+	if len(strategyResults) == 1 {
+		for _, results := range strategyResults {
+			return results, nil
+		}
+	}
+
+	var score func(name string, rank int, result SearchResult) float64
+	combine := func(fused, score float64) float64 { return fused + score }
+	switch config.Strategy {
+	case "", FusionRRF:
+		k := config.K
+		if k <= 0 {
+			k = DefaultRRFK
+		}
+		score = func(_ string, rank int, _ SearchResult) float64 { return 1 / float64(k+rank+1) }
+	case FusionWeighted:
+		for name := range strategyResults {
+			if _, ok := config.Weights[name]; !ok {
+				return nil, fmt.Errorf("missing weight for strategy: %s", name)
+			}
+		}
+		score = func(name string, _ int, result SearchResult) float64 { return result.Score * config.Weights[name] }
+	case FusionMax:
+		score = func(_ string, _ int, result SearchResult) float64 { return result.Score }
+		combine = func(fused, score float64) float64 { return max(fused, score) }
+	default:
+		return nil, fmt.Errorf("unknown fusion strategy: %s", config.Strategy)
+	}
+
+	fused := make(map[string]*SearchResult)
+	for name, results := range strategyResults {
+		for rank, result := range results {
+			id := fmt.Sprintf("%s#%x", result.Chunk.Path, sha256.Sum256([]byte(result.Chunk.Text)))
+			doc, ok := fused[id]
+			if !ok {
+				doc = &SearchResult{Chunk: result.Chunk, Scores: make(map[string]float64)}
+				fused[id] = doc
+			}
+			doc.Score = combine(doc.Score, score(name, rank, result))
+			doc.Scores[name] = result.Score
+		}
+	}
+
+	results := make([]SearchResult, 0, len(fused))
+	for _, doc := range fused {
+		results = append(results, *doc)
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// DeduplicateResults removes results with the same content as a better ranked one
+func DeduplicateResults(results []SearchResult) []SearchResult {
+	seen := make(map[string]bool, len(results))
+	unique := results[:0]
+	for _, result := range results {
+		if !seen[result.Chunk.Text] {
+			seen[result.Chunk.Text] = true
+			unique = append(unique, result)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,90 @@
+package rag
+
+import (
+	"testing"
+)
+
+func result(path string, score float64) SearchResult {
+	return SearchResult{Chunk: Chunk{Path: path, Text: path}, Score: score}
+}
+
+func TestFuse(t *testing.T) {
+	strategyResults := map[string][]SearchResult{
+		"bm25":  {result("a", 9), result("b", 5), result("c", 1)},
+		"bm25b": {result("c", 8), result("b", 7)},
+	}
+
+	tests := []struct {
+		name    string
+		config  FusionConfig
+		want    []string
+		wantErr bool
+	}{
+		{name: "rrf", config: FusionConfig{}, want: []string{"c", "b", "a"}},
+		{name: "weighted", config: FusionConfig{Strategy: FusionWeighted, Weights: map[string]float64{"bm25": 1, "bm25b": 0.1}}, want: []string{"a", "b", "c"}},
+		{name: "max", config: FusionConfig{Strategy: FusionMax}, want: []string{"a", "c", "b"}},
+		{name: "missing weight", config: FusionConfig{Strategy: FusionWeighted, Weights: map[string]float64{"bm25": 1}}, wantErr: true},
+		{name: "unknown strategy", config: FusionConfig{Strategy: "median"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Fuse(strategyResults, tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fuse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("Fuse() returned %d results, want %d", len(results), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if results[i].Chunk.Path != want {
+					t.Errorf("Fuse()[%d] = %s, want %s", i, results[i].Chunk.Path, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFuseSingleStrategy(t *testing.T) {
+	results := []SearchResult{result("a", 2), result("b", 1)}
+	fused, err := Fuse(map[string][]SearchResult{"bm25": results}, FusionConfig{Strategy: FusionWeighted})
+	if err != nil {
+		t.Fatalf("Fuse() error = %v", err)
+	}
+	if len(fused) != 2 || fused[0].Score != 2 {
+		t.Errorf("Fuse() = %v, want the strategy results unchanged", fused)
+	}
+}
+
+func TestFuseDifferentChunking(t *testing.T) {
+	// Both strategies index doc.md, one in small chunks and the other in large ones
+	small := []SearchResult{
+		{Chunk: Chunk{Path: "doc.md", Index: 0, StartLine: 1, EndLine: 2, Text: "install"}, Score: 3},
+		{Chunk: Chunk{Path: "doc.md", Index: 1, StartLine: 3, EndLine: 4, Text: "configure"}, Score: 2},
+	}
+	large := []SearchResult{
+		{Chunk: Chunk{Path: "doc.md", Index: 0, StartLine: 1, EndLine: 4, Text: "install\nconfigure"}, Score: 5},
+		{Chunk: Chunk{Path: "doc.md", Index: 1, StartLine: 5, EndLine: 8, Text: "upgrade"}, Score: 1},
+	}
+
+	results, err := Fuse(map[string][]SearchResult{"small": small, "large": large}, FusionConfig{})
+	if err != nil {
+		t.Fatalf("Fuse() error = %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Fuse() returned %d results, want the 4 distinct passages: %v", len(results), results)
+	}
+	for _, result := range results {
+		if len(result.Scores) != 1 {
+			t.Errorf("Fuse() merged %q with a passage of another strategy: %v", result.Chunk.Text, result.Scores)
+		}
+	}
+}
+
+func TestDeduplicateResults(t *testing.T) {
+	results := []SearchResult{result("a", 3), {Chunk: Chunk{Path: "mirror", Text: "a"}, Score: 2}, result("b", 1)}
+	got := DeduplicateResults(results)
+	if len(got) != 2 || got[0].Chunk.Path != "a" || got[1].Chunk.Path != "b" {
+		t.Errorf("DeduplicateResults() = %v", got)
+	}
+}
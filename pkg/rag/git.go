@@ -0,0 +1,322 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+const (
+	// gitSourcePrefix is the prefix identifying git repository document sources
+	gitSourcePrefix = "git+"
+
+	// gitDefaultRef is the ref fetched when none is specified
+	gitDefaultRef = "HEAD"
+)
+
+// GitSource describes a git repository document source such as
+// git+https://host/org/repo.git//docs?ref=main or git+file:///path/repo
+type GitSource struct {
+	RepoURL string // Repository URL passed to git (without the git+ prefix)
+	SubDir  string // Optional subdirectory inside the repository
+	Ref     string // Branch, tag or commit to fetch
+}
+
+// GitCheckout is the result of fetching a git source
+type GitCheckout struct {
+	Dir    string // Local directory with the requested subdirectory of the checkout
+	Commit string // Commit SHA of the checkout
+}
+
+// IsGitSource checks if a document location refers to a git repository
+func IsGitSource(location string) bool {
+	return strings.HasPrefix(location, gitSourcePrefix)
+}
+
+// ParseGitSource parses a git document location
+func ParseGitSource(location string) (*GitSource, error) {
+	if !IsGitSource(location) {
+		return nil, ErrInvalidURL(fmt.Sprintf("not a git source: %s", location))
+	}
+
+	parsedURL, err := url.Parse(strings.TrimPrefix(location, gitSourcePrefix))
+	if err != nil {
+		return nil, ErrInvalidURL(fmt.Sprintf("failed to parse: %v", err))
+	}
+
+	switch parsedURL.Scheme {
+	case "http", "https", "ssh", "file":
+	default:
+		return nil, ErrInvalidURL(fmt.Sprintf("unsupported git scheme: %s", parsedURL.Scheme))
+	}
+
+	if parsedURL.Scheme != "file" && parsedURL.Host == "" {
+		return nil, ErrInvalidURL("missing host")
+	}
+
+	src := &GitSource{
+		Ref: parsedURL.Query().Get("ref"),
+	}
+	if src.Ref == "" {
+		src.Ref = gitDefaultRef
+	}
+	if err := validateGitRef(src.Ref); err != nil {
+		return nil, err
+	}
+
+	// A "//" in the path separates the repository from the subdirectory
+	repoPath := parsedURL.Path
+	if i := strings.Index(repoPath, "//"); i >= 0 {
+		src.SubDir = strings.Trim(repoPath[i+2:], "/")
+		repoPath = repoPath[:i]
+	}
+	if repoPath == "" {
+		return nil, ErrInvalidURL("missing repository path")
+	}
+	if src.SubDir != "" {
+		if err := ValidatePath(src.SubDir); err != nil {
+			return nil, err
+		}
+	}
+
+	repoURL := *parsedURL
+	repoURL.Path = repoPath
+	repoURL.RawPath = ""
+	repoURL.RawQuery = ""
+	repoURL.Fragment = ""
+	src.RepoURL = repoURL.String()
+
+	return src, nil
+}
+
+// validateGitRef checks that a ref is a commit SHA or a valid ref name, as in
+// "git check-ref-format --allow-onelevel", so it cannot be taken by git as an
+// option (e.g. --upload-pack=<command>)
+func validateGitRef(ref string) error {
+	invalid := func(reason string) error {
+		return ErrInvalidURL(fmt.Sprintf("invalid git ref %q: %s", ref, reason))
+	}
+	if strings.HasPrefix(ref, "-") {
+		return invalid("starts with '-'")
+	}
+	if isHexSHA(ref) {
+		return nil
+	}
+
+	switch {
+	case ref == "@":
+		return invalid("is '@'")
+	case strings.HasPrefix(ref, "/") || strings.HasSuffix(ref, "/"):
+		return invalid("starts or ends with '/'")
+	case strings.HasSuffix(ref, "."):
+		return invalid("ends with '.'")
+	case strings.Contains(ref, ".."), strings.Contains(ref, "//"), strings.Contains(ref, "@{"):
+		return invalid("contains '..', '//' or '@{'")
+	}
+	for _, r := range ref {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return invalid(fmt.Sprintf("contains %q", r))
+		}
+	}
+	for _, component := range strings.Split(ref, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return invalid("has a component starting with '.' or ending with '.lock'")
+		}
+	}
+	return nil
+}
+
+// isHexSHA checks whether a ref is a full SHA-1 or SHA-256 commit SHA.
+// Abbreviated SHAs are not accepted, as servers refuse to shallow-fetch them.
+func isHexSHA(ref string) bool {
+	if len(ref) != 40 && len(ref) != 64 {
+		return false
+	}
+	for _, r := range ref {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the canonical location of the git source, without the
+// credentials of the repository URL, so it can be logged and stored
+func (g *GitSource) String() string {
+	s := gitSourcePrefix + redactRepoURL(g.RepoURL)
+	if g.SubDir != "" {
+		s += "//" + g.SubDir
+	}
+	if g.Ref != gitDefaultRef {
+		s += "?ref=" + g.Ref
+	}
+	return s
+}
+
+// redactRepoURL removes the credentials from a repository URL: the password,
+// and the user name except for ssh, where it is an account (e.g. git) rather than a token
+func redactRepoURL(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.User == nil {
+		return repoURL
+	}
+	if u.Scheme == "ssh" {
+		u.User = url.User(u.User.Username())
+	} else {
+		u.User = nil
+	}
+	return u.String()
+}
+
+// GitFetcher fetches git repositories into the RAG cache directory
+type GitFetcher struct {
+	cacheDir string
+	gitPath  string
+	logger   *common.Logger
+}
+
+// NewGitFetcher creates a new git fetcher that stores checkouts under cacheDir
+func NewGitFetcher(cacheDir string, logger *common.Logger) *GitFetcher {
+	return &GitFetcher{
+		cacheDir: cacheDir,
+		gitPath:  "git",
+		logger:   logger,
+	}
+}
+
+// Fetch shallow-fetches the requested ref of a git source and checks it out in the cache.
+// When the ref has not moved since the last fetch, the existing checkout is reused.
+// When fetching fails but a previous checkout exists, the previous checkout is used.
+func (f *GitFetcher) Fetch(ctx context.Context, src *GitSource) (*GitCheckout, error) {
+	key := hashURL(src.RepoURL + "#" + src.Ref)
+	repoDir := filepath.Join(f.cacheDir, "git", key)
+	metaPath := filepath.Join(f.cacheDir, "git", key+metadataExt)
+
+	// Lock the checkout, so concurrent processes do not run git in it at once
+	unlock, err := lockCacheEntry(ctx, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	prev, _ := LoadMetadata(metaPath)
+
+	commit, err := f.fetch(ctx, repoDir, src)
+	if err != nil {
+		if prev != nil && prev.Commit != "" {
+			f.logger.Warn("Failed to fetch %s, using cached commit %s: %v", src, shortSHA(prev.Commit), err)
+			return f.checkout(repoDir, src, prev.Commit)
+		}
+		return nil, ErrDownloadFailed{URL: src.String(), Reason: err.Error()}
+	}
+
+	head, _ := f.git(ctx, repoDir, "rev-parse", "--verify", "--quiet", "HEAD")
+	if prev != nil && prev.Commit == commit && head == commit {
+		f.logger.Debug("Git source %s unchanged at %s", src, shortSHA(commit))
+		if _, err := touchMetadata(metaPath); err != nil {
+			f.logger.Debug("Failed to record access time for %s: %v", src, err)
+		}
+		return f.checkout(repoDir, src, commit)
+	}
+
+	if _, err := f.git(ctx, repoDir, "checkout", "--force", "--detach", commit); err != nil {
+		return nil, fmt.Errorf("failed to check out %s: %w", shortSHA(commit), err)
+	}
+	if _, err := f.git(ctx, repoDir, "clean", "-ffdx"); err != nil {
+		return nil, fmt.Errorf("failed to clean checkout: %w", err)
+	}
+
+	now := time.Now()
+	meta := &CacheMetadata{
+		URL:          src.String(),
+		DownloadedAt: now,
+		AccessedAt:   now,
+		Commit:       commit,
+		Ref:          src.Ref,
+	}
+	if err := SaveMetadata(metaPath, meta); err != nil {
+		f.logger.Warn("Failed to save metadata for %s: %v", src, err)
+	}
+
+	if prev != nil && prev.Commit != "" {
+		f.logger.Info("Git source %s moved from %s to %s", src, shortSHA(prev.Commit), shortSHA(commit))
+	} else {
+		f.logger.Info("Fetched git source %s at %s", src, shortSHA(commit))
+	}
+
+	return f.checkout(repoDir, src, commit)
+}
+
+// fetch initializes the local repository if needed, fetches the ref and returns its commit SHA
+func (f *GitFetcher) fetch(ctx context.Context, repoDir string, src *GitSource) (string, error) {
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(repoDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create repository directory: %w", err)
+		}
+		if _, err := f.git(ctx, repoDir, "init", "--quiet"); err != nil {
+			return "", err
+		}
+	}
+
+	// Arguments after --end-of-options are never taken as options, whatever they start with
+	if _, err := f.git(ctx, repoDir, "fetch", "--quiet", "--depth", "1", "--end-of-options", src.RepoURL, src.Ref); err != nil {
+		return "", err
+	}
+
+	commit, err := f.git(ctx, repoDir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// checkout returns the checkout for a fetched commit, verifying the subdirectory exists
+func (f *GitFetcher) checkout(repoDir string, src *GitSource, commit string) (*GitCheckout, error) {
+	dir := filepath.Join(repoDir, filepath.FromSlash(src.SubDir))
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, ErrInvalidPath(fmt.Sprintf("%s not found in %s at %s", src.SubDir, redactRepoURL(src.RepoURL), shortSHA(commit)))
+	}
+	if !info.IsDir() {
+		return nil, ErrInvalidPath(fmt.Sprintf("%s is not a directory in %s", src.SubDir, redactRepoURL(src.RepoURL)))
+	}
+	return &GitCheckout{Dir: dir, Commit: commit}, nil
+}
+
+// git runs a git command in a directory and returns its trimmed output
+func (f *GitFetcher) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, f.gitPath, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Keep the credentials of repository URLs out of the logs
+	logArgs := make([]string, len(args))
+	for i, arg := range args {
+		logArgs[i] = redactRepoURL(arg)
+	}
+	f.logger.Debug("Running git %s in %s", strings.Join(logArgs, " "), dir)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// shortSHA abbreviates a commit SHA for log messages
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,297 @@
+package rag
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRedirects is the maximum number of redirects followed for a single request
+const maxRedirects = 10
+
+// HTTPSettings holds the HTTP options used when fetching documents
+// Zero values mean "not set" and fall back to less specific settings
+type HTTPSettings struct {
+	Headers     map[string]string // Extra request headers
+	BearerToken string            // Bearer token sent in the Authorization header
+	Username    string            // Basic auth username
+	Password    string            // Basic auth password
+	CAFile      string            // PEM bundle of additional trusted CA certificates
+	Proxy       string            // Proxy URL (default: from the environment)
+	UserAgent   string            // User-Agent header
+	Timeout     time.Duration     // Request timeout
+	MaxSize     int64             // Maximum document size in bytes
+}
+
+// withDefaults returns a copy of s where unset fields are taken from defaults
+func (s HTTPSettings) withDefaults(defaults HTTPSettings) HTTPSettings {
+	merged := s
+	if len(defaults.Headers) > 0 {
+		merged.Headers = make(map[string]string, len(s.Headers)+len(defaults.Headers))
+		for k, v := range defaults.Headers {
+			merged.Headers[http.CanonicalHeaderKey(k)] = v
+		}
+		for k, v := range s.Headers {
+			merged.Headers[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	// Credentials are only taken as a whole, never mixed between levels
+	if merged.BearerToken == "" && merged.Username == "" {
+		merged.BearerToken = defaults.BearerToken
+		merged.Username = defaults.Username
+		merged.Password = defaults.Password
+	}
+	if merged.CAFile == "" {
+		merged.CAFile = defaults.CAFile
+	}
+	if merged.Proxy == "" {
+		merged.Proxy = defaults.Proxy
+	}
+	if merged.UserAgent == "" {
+		merged.UserAgent = defaults.UserAgent
+	}
+	if merged.Timeout == 0 {
+		merged.Timeout = defaults.Timeout
+	}
+	if merged.MaxSize == 0 {
+		merged.MaxSize = defaults.MaxSize
+	}
+	return merged
+}
+
+// apply sets the configured headers and credentials on a request
+func (s HTTPSettings) apply(req *http.Request) {
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+	switch {
+	case s.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+s.BearerToken)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+}
+
+// HTTPRule holds HTTP settings applied to the URLs matched by Match
+type HTTPRule struct {
+	// Match selects the URLs the rule applies to. It can be a host name
+	// ("docs.example.com"), a wildcard for subdomains ("*.example.com"),
+	// a URL prefix ("https://raw.githubusercontent.com/org/") or "*" for all URLs
+	Match    string
+	Settings HTTPSettings
+}
+
+// Matches checks if the rule applies to a URL
+func (r HTTPRule) Matches(u *url.URL) bool {
+	match := strings.TrimSpace(r.Match)
+	host := strings.ToLower(u.Hostname())
+
+	if strings.Contains(match, "://") {
+		return matchesURLPrefix(match, u)
+	}
+
+	match = strings.ToLower(match)
+	switch {
+	case match == "*":
+		return true
+	case strings.HasPrefix(match, "*."):
+		return strings.HasSuffix(host, match[1:])
+	default:
+		return host == match || strings.ToLower(u.Host) == match
+	}
+}
+
+// matchesURLPrefix checks if a URL starts with a URL prefix. Schemes and hosts
+// must be equal (ignoring case), and paths match only at a "/" boundary, so
+// "https://host/wiki" matches "https://host/wiki/page" but not "https://host/wikievil"
+func matchesURLPrefix(prefix string, u *url.URL) bool {
+	p, err := url.Parse(prefix)
+	if err != nil || p.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(p.Scheme, u.Scheme) || !strings.EqualFold(p.Host, u.Host) {
+		return false
+	}
+
+	prefixPath, path := p.EscapedPath(), u.EscapedPath()
+	if prefixPath == "" || prefixPath == "/" {
+		return true
+	}
+	if !strings.HasPrefix(path, prefixPath) {
+		return false
+	}
+	return len(path) == len(prefixPath) || strings.HasSuffix(prefixPath, "/") || path[len(prefixPath)] == '/'
+}
+
+// validate checks that a rule can be used
+func (r HTTPRule) validate() error {
+	match := strings.TrimSpace(r.Match)
+	if match == "" {
+		return ErrInvalidConfig("HTTP rule requires a match")
+	}
+	if strings.Contains(match, "://") {
+		if u, err := url.Parse(match); err != nil || u.Host == "" {
+			return ErrInvalidConfig(fmt.Sprintf("invalid HTTP rule match %q: not a URL with a host", r.Match))
+		}
+	}
+	return r.Settings.validate()
+}
+
+// validate checks the settings that can be checked without sending requests
+func (s HTTPSettings) validate() error {
+	if s.BearerToken != "" && s.Username != "" {
+		return ErrInvalidConfig("bearer token and basic auth are mutually exclusive")
+	}
+	if s.Timeout < 0 {
+		return ErrInvalidConfig("timeout must be positive")
+	}
+	if s.MaxSize < 0 {
+		return ErrInvalidConfig("max size must be positive")
+	}
+	if s.Proxy != "" {
+		if _, err := parseProxyURL(s.Proxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientKey identifies the settings that require a dedicated HTTP client
+type clientKey struct {
+	caFile  string
+	proxy   string
+	timeout time.Duration
+}
+
+// httpClients builds and caches HTTP clients for the settings in use
+type httpClients struct {
+	mu      sync.Mutex
+	clients map[clientKey]*http.Client
+}
+
+// get returns the HTTP client for settings, creating it if needed
+func (c *httpClients) get(s HTTPSettings) (*http.Client, error) {
+	key := clientKey{caFile: s.CAFile, proxy: s.Proxy, timeout: s.Timeout}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+	client, err := newHTTPClient(s)
+	if err != nil {
+		return nil, err
+	}
+	if c.clients == nil {
+		c.clients = make(map[clientKey]*http.Client)
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// newHTTPClient creates an HTTP client with the transport options of s
+func newHTTPClient(s HTTPSettings) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if s.CAFile != "" {
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, ErrInvalidConfig(fmt.Sprintf("failed to read CA bundle: %v", err))
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidConfig(fmt.Sprintf("no certificates found in CA bundle %s", s.CAFile))
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	if s.Proxy != "" {
+		proxyURL, err := parseProxyURL(s.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Timeout:       s.Timeout,
+		Transport:     transport,
+		CheckRedirect: stripHeadersOnHostChange,
+	}, nil
+}
+
+// stripHeadersOnHostChange drops the configured headers when a redirect leaves
+// the original host, so credentials are never sent to a different server
+func stripHeadersOnHostChange(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		userAgent := req.Header.Get("User-Agent")
+		req.Header = make(http.Header)
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+	}
+	return nil
+}
+
+// parseProxyURL parses and validates a proxy URL
+func parseProxyURL(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, ErrInvalidConfig(fmt.Sprintf("invalid proxy URL: %s", proxy))
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return u, nil
+	default:
+		return nil, ErrInvalidConfig(fmt.Sprintf("unsupported proxy scheme: %s", u.Scheme))
+	}
+}
+
+// settingsFor resolves the HTTP settings used for a URL: the downloader settings
+// come first, then the matching rules in order, then the downloader defaults
+func (d *DocumentDownloader) settingsFor(u *url.URL) HTTPSettings {
+	settings := d.config.HTTP
+	for _, rule := range d.config.HTTPRules {
+		if rule.Matches(u) {
+			settings = settings.withDefaults(rule.Settings)
+		}
+	}
+	return settings.withDefaults(HTTPSettings{
+		Timeout: d.config.Timeout,
+		MaxSize: d.config.MaxSize,
+	})
+}
+
+// newRequest creates a request for urlStr with the matching headers and credentials,
+// and returns it with the client and settings to use for it
+func (d *DocumentDownloader) newRequest(ctx context.Context, method, urlStr string) (*http.Request, *http.Client, HTTPSettings, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, nil)
+	if err != nil {
+		return nil, nil, HTTPSettings{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	settings := d.settingsFor(req.URL)
+	client, err := d.clients.get(settings)
+	if err != nil {
+		return nil, nil, HTTPSettings{}, err
+	}
+	settings.apply(req)
+	return req, client, settings, nil
+}
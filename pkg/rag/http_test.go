@@ -0,0 +1,231 @@
+package rag
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPRuleMatches(t *testing.T) {
+	tests := []struct {
+		match string
+		url   string
+		want  bool
+	}{
+		{"docs.example.com", "https://docs.example.com/page", true},
+		{"DOCS.example.com", "https://docs.example.com:8443/page", true},
+		{"docs.example.com:8443", "https://docs.example.com:8443/page", true},
+		{"docs.example.com", "https://wiki.example.com/page", false},
+		{"*.example.com", "https://wiki.example.com/page", true},
+		{"*.example.com", "https://example.com/page", false},
+		{"*.example.com", "https://badexample.com/page", false},
+		{"https://raw.example.com/org/", "https://raw.example.com/org/repo/README.md", true},
+		{"https://raw.example.com/org/", "https://raw.example.com/other/README.md", false},
+		{"https://raw.example.com/org/", "http://raw.example.com/org/README.md", false},
+		{"https://host/Docs/", "https://host/Docs/guide.md", true},
+		{"HTTPS://HOST/Docs/", "https://host/Docs/guide.md", true},
+		{"https://host/Docs/", "https://HOST/Docs/guide.md", true},
+		{"https://host/Docs/", "https://host/docs/guide.md", false},
+		{"https://host", "https://host/docs/guide.md", true},
+		{"https://host/", "https://host/docs/guide.md", true},
+		{"https://confluence.corp", "https://confluence.corp.attacker.net/page", false},
+		{"https://confluence.corp", "https://confluence.corp:8443/page", false},
+		{"https://confluence.corp", "https://user@confluence.corp/page", true},
+		{"https://host/wiki", "https://host/wiki", true},
+		{"https://host/wiki", "https://host/wiki/page", true},
+		{"https://host/wiki", "https://host/wikievil/page", false},
+		{"https://host/wiki/", "https://host/wikievil/page", false},
+		{"*", "http://anything.test/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.match+" "+tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := (HTTPRule{Match: tt.match}).Matches(u); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettingsFor(t *testing.T) {
+	config := DefaultConfig(testLogger)
+	config.CacheDir = t.TempDir()
+	config.HTTP = HTTPSettings{Headers: map[string]string{"x-source": "source"}, MaxSize: 42}
+	config.HTTPRules = []HTTPRule{
+		{Match: "*.example.com", Settings: HTTPSettings{
+			Headers:     map[string]string{"X-Source": "rule", "X-Rule": "wildcard"},
+			BearerToken: "wildcard-token",
+			Timeout:     time.Minute,
+			MaxSize:     1024,
+		}},
+		{Match: "docs.example.com", Settings: HTTPSettings{
+			Username:  "user",
+			Password:  "pass",
+			UserAgent: "docs-agent",
+			Timeout:   time.Hour,
+		}},
+	}
+	d, err := NewDownloader(config)
+	if err != nil {
+		t.Fatalf("NewDownloader() error = %v", err)
+	}
+
+	u, _ := url.Parse("https://docs.example.com/page")
+	got := d.settingsFor(u)
+
+	// Settings of the downloader win over rules, and earlier rules over later ones
+	if got.Headers["X-Source"] != "source" || got.Headers["X-Rule"] != "wildcard" {
+		t.Errorf("Headers = %v", got.Headers)
+	}
+	if got.BearerToken != "wildcard-token" || got.Username != "" {
+		t.Errorf("credentials = %q / %q, want the first matching rule's", got.BearerToken, got.Username)
+	}
+	if got.UserAgent != "docs-agent" || got.Timeout != time.Minute || got.MaxSize != 42 {
+		t.Errorf("settingsFor() = %+v", got)
+	}
+
+	// Unmatched URLs use the downloader defaults
+	u, _ = url.Parse("https://other.test/page")
+	got = d.settingsFor(u)
+	if got.Timeout != config.Timeout || got.MaxSize != 42 || got.BearerToken != "" {
+		t.Errorf("settingsFor() = %+v, want defaults", got)
+	}
+}
+
+func TestDownloaderHTTPSettings(t *testing.T) {
+	// A second server receiving redirects must never see the credentials
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range []string{"Authorization", "X-Api-Key"} {
+			if r.Header.Get(h) != "" {
+				leaked = append(leaked, h)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "elsewhere")
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, other.URL+"/target", http.StatusFound)
+			return
+		case "/big":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, strings.Repeat("x", 100))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer s3cret" || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, r.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	config := DefaultConfig(testLogger)
+	config.CacheDir = t.TempDir()
+	config.HTTPRules = []HTTPRule{{Match: host, Settings: HTTPSettings{
+		Headers:     map[string]string{"X-Api-Key": "key"},
+		BearerToken: "s3cret",
+		UserAgent:   "don-test",
+		MaxSize:     50,
+	}}}
+	d, err := NewDownloader(config)
+	if err != nil {
+		t.Fatalf("NewDownloader() error = %v", err)
+	}
+
+	path, err := d.Download(context.Background(), server.URL+"/private")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "don-test" {
+		t.Errorf("User-Agent = %q, want don-test", content)
+	}
+
+	if _, err := d.Download(context.Background(), server.URL+"/redirect"); err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if len(leaked) > 0 {
+		t.Errorf("headers %v sent to redirect target on another host", leaked)
+	}
+
+	_, err = d.Download(context.Background(), server.URL+"/big")
+	var tooLarge ErrFileTooLarge
+	if !errors.As(err, &tooLarge) || tooLarge.MaxSize != 50 {
+		t.Errorf("Download() error = %v, want per-host size limit", err)
+	}
+}
+
+func TestDownloaderCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "internal docs")
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+
+	config := DefaultConfig(testLogger)
+	config.CacheDir = t.TempDir()
+	d, err := NewDownloader(config)
+	if err != nil {
+		t.Fatalf("NewDownloader() error = %v", err)
+	}
+	if _, err := d.Download(context.Background(), server.URL+"/untrusted"); err == nil {
+		t.Error("Download() expected certificate error without CA bundle")
+	}
+
+	config.HTTP = HTTPSettings{CAFile: caFile}
+	d, err = NewDownloader(config)
+	if err != nil {
+		t.Fatalf("NewDownloader() error = %v", err)
+	}
+	if _, err := d.Download(context.Background(), server.URL+"/trusted"); err != nil {
+		t.Errorf("Download() error = %v", err)
+	}
+}
+
+func TestDownloaderInvalidHTTPSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		http  HTTPSettings
+		rules []HTTPRule
+	}{
+		{name: "missing CA bundle", http: HTTPSettings{CAFile: "/nonexistent/ca.pem"}},
+		{name: "invalid proxy", http: HTTPSettings{Proxy: "ftp://proxy:21"}},
+		{name: "bearer and basic auth", http: HTTPSettings{BearerToken: "t", Username: "u"}},
+		{name: "rule without match", rules: []HTTPRule{{Settings: HTTPSettings{UserAgent: "x"}}}},
+		{name: "rule with URL without host", rules: []HTTPRule{{Match: "https:///docs", Settings: HTTPSettings{UserAgent: "x"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig(testLogger)
+			config.CacheDir = t.TempDir()
+			config.HTTP = tt.http
+			config.HTTPRules = tt.rules
+			if _, err := NewDownloader(config); err == nil {
+				t.Error("NewDownloader() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+const (
+	// indexesSubDir is the cache subdirectory holding the search indexes
+	indexesSubDir = "indexes"
+
+	// indexVersion is bumped when the index format or tokenization changes
+	indexVersion = 1
+)
+
+// IndexedFile records the state of a document when it was indexed
+type IndexedFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Posting records the occurrences of a term in a chunk
+type Posting struct {
+	Chunk int `json:"c"` // Chunk position in Index.Chunks
+	Freq  int `json:"f"` // Occurrences of the term in the chunk
+}
+
+// Index is an inverted index of the chunks of a set of documents
+type Index struct {
+	Version     int                  `json:"version"`
+	Chunking    ChunkConfig          `json:"chunking"`
+	Files       []IndexedFile        `json:"files"`
+	Chunks      []Chunk              `json:"chunks"`
+	Postings    map[string][]Posting `json:"postings"`
+	Lengths     []int                `json:"lengths"` // Number of terms of each chunk
+	TotalLength int                  `json:"total_length"`
+}
+
+// BuildIndex chunks and indexes a set of documents
+func BuildIndex(ctx context.Context, paths []string, config ChunkConfig) (*Index, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	files, err := statFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	idx, _, err := buildIndex(ctx, files, config.withDefaults(), nil)
+	return idx, err
+}
+
+// buildIndex indexes a set of documents, reusing the chunks of the documents
+// unchanged since a previous index (if any)
+// Returns the index and the number of documents that were (re)chunked
+func buildIndex(ctx context.Context, files []IndexedFile, config ChunkConfig, previous *Index) (*Index, int, error) {
+	// Documents and chunks of the previous index, if they can be reused
+	previousFiles := make(map[string]IndexedFile)
+	previousChunks := make(map[string][]Chunk)
+	if previous != nil && previous.Version == indexVersion && previous.Chunking.sameAs(config) {
+		for _, file := range previous.Files {
+			previousFiles[file.Path] = file
+		}
+		for _, chunk := range previous.Chunks {
+			previousChunks[chunk.Path] = append(previousChunks[chunk.Path], chunk)
+		}
+	}
+
+	idx := &Index{
+		Version:  indexVersion,
+		Chunking: config,
+		Files:    files,
+		Postings: make(map[string][]Posting),
+	}
+	chunked := 0
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		chunks := previousChunks[file.Path]
+		if old, ok := previousFiles[file.Path]; !ok || !old.sameAs(file) {
+			content, err := os.ReadFile(file.Path)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to read %s: %w", file.Path, err)
+			}
+			chunks = ChunkText(file.Path, string(content), config)
+			chunked++
+		}
+		for _, chunk := range chunks {
+			idx.addChunk(chunk)
+		}
+	}
+	return idx, chunked, nil
+}
+
+// addChunk adds a chunk to the index
+func (idx *Index) addChunk(chunk Chunk) {
+	position := len(idx.Chunks)
+	idx.Chunks = append(idx.Chunks, chunk)
+
+	terms := Tokenize(chunk.Text)
+	freqs := make(map[string]int, len(terms))
+	for _, term := range terms {
+		freqs[term]++
+	}
+	for term, freq := range freqs {
+		idx.Postings[term] = append(idx.Postings[term], Posting{Chunk: position, Freq: freq})
+	}
+	idx.Lengths = append(idx.Lengths, len(terms))
+	idx.TotalLength += len(terms)
+}
+
+// upToDate checks whether the index was built from the current state of a set of documents
+func (idx *Index) upToDate(files []IndexedFile, config ChunkConfig) bool {
+	if idx.Version != indexVersion || !idx.Chunking.sameAs(config) || len(idx.Files) != len(files) {
+		return false
+	}
+	for i, file := range files {
+		if !idx.Files[i].sameAs(file) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameAs checks whether two states of a document are the same
+func (f IndexedFile) sameAs(other IndexedFile) bool {
+	return f.Path == other.Path && f.Size == other.Size && f.ModTime.Equal(other.ModTime)
+}
+
+// statFiles returns the sorted, deduplicated state of a set of documents
+func statFiles(paths []string) ([]IndexedFile, error) {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	var files []IndexedFile
+	for i, path := range sorted {
+		if i > 0 && path == sorted[i-1] {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to access %s: %w", path, err)
+		}
+		files = append(files, IndexedFile{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return files, nil
+}
+
+// GetIndexPath returns the path of a named index (e.g. "<source>/<strategy>")
+func GetIndexPath(cacheDir, name string) string {
+	return filepath.Join(cacheDir, indexesSubDir, hashURL(name)+".json")
+}
+
+// LoadIndex loads an index from a JSON file
+func LoadIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	return &idx, nil
+}
+
+// Save writes the index to a JSON file
+func (idx *Index) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// OpenIndex returns a named index of a set of documents, stored in the cache directory
+// The index is built (and saved) when missing, and updated when documents change:
+// only new and modified documents are chunked again. With rebuild, all documents
+// are chunked again.
+func OpenIndex(ctx context.Context, cacheDir, name string, paths []string, config ChunkConfig, rebuild bool, logger *common.Logger) (*Index, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config = config.withDefaults()
+	indexPath := GetIndexPath(cacheDir, name)
+
+	unlock, err := lockCacheEntry(ctx, strings.TrimSuffix(indexPath, ".json"))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	files, err := statFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *Index
+	if !rebuild {
+		idx, err := LoadIndex(indexPath)
+		switch {
+		case err == nil && idx.upToDate(files, config):
+			logger.Debug("Using index %s (%d chunks)", indexPath, len(idx.Chunks))
+			return idx, nil
+		case err == nil:
+			previous = idx
+		case !errors.Is(err, os.ErrNotExist):
+			logger.Warn("Failed to load index %s, rebuilding it: %v", indexPath, err)
+		}
+	}
+
+	idx, chunked, err := buildIndex(ctx, files, config, previous)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Indexed %d documents for %s (%d chunks), %d of them reindexed", len(idx.Files), name, len(idx.Chunks), chunked)
+	if err := idx.Save(indexPath); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
@@ -0,0 +1,178 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeDocs(t *testing.T, docs map[string]string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for name, content := range docs {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, content)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("The Quick-brown fox, jumps over the lazy dog 42 times!")
+	want := []string{"quick", "brown", "fox", "jumps", "over", "lazy", "dog", "42", "times"}
+	if len(got) != len(want) {
+		t.Fatalf("Tokenize() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Tokenize()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSearchBM25(t *testing.T) {
+	paths := writeDocs(t, map[string]string{
+		"install.md": "To install the tool run the installer script. The installer needs root.",
+		"usage.md":   "Run the tool with a configuration file to start the server.",
+		"faq.md":     "Frequently asked questions about licensing and support.",
+	})
+	idx, err := BuildIndex(context.Background(), paths, ChunkConfig{})
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		params    BM25Params
+		limit     int
+		wantFirst string
+		wantCount int
+	}{
+		{name: "rare term", query: "installer", wantFirst: "install.md", wantCount: 1},
+		{name: "common term", query: "tool", wantCount: 2},
+		{name: "several terms", query: "run server configuration", wantFirst: "usage.md", wantCount: 2},
+		{name: "limit", query: "tool", limit: 1, wantCount: 1},
+		{name: "threshold", query: "tool", params: BM25Params{Threshold: 10}, wantCount: 0},
+		{name: "no match", query: "kubernetes", wantCount: 0},
+		{name: "stop words only", query: "the and of", wantCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := idx.SearchBM25(tt.query, tt.params, tt.limit)
+			if len(results) != tt.wantCount {
+				t.Fatalf("SearchBM25(%q) returned %d results, want %d", tt.query, len(results), tt.wantCount)
+			}
+			if tt.wantFirst != "" && filepath.Base(results[0].Chunk.Path) != tt.wantFirst {
+				t.Errorf("SearchBM25(%q) ranked %s first, want %s", tt.query, results[0].Chunk.Path, tt.wantFirst)
+			}
+			for i := 1; i < len(results); i++ {
+				if results[i].Score > results[i-1].Score {
+					t.Errorf("SearchBM25(%q) results not sorted by score", tt.query)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchBM25LengthNormalization(t *testing.T) {
+	paths := writeDocs(t, map[string]string{"short.md": "alpha", "long.md": "alpha beta gamma delta epsilon"})
+	idx, err := BuildIndex(context.Background(), paths, ChunkConfig{})
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	// By default the short document ranks first, with b: 0 the length does not count
+	if results := idx.SearchBM25("alpha", BM25Params{}, 0); results[0].Score <= results[1].Score {
+		t.Errorf("SearchBM25() scores = %v and %v, want the short document first", results[0].Score, results[1].Score)
+	}
+	if results := idx.SearchBM25("alpha", BM25Params{B: ptr(0.0)}, 0); results[0].Score != results[1].Score {
+		t.Errorf("SearchBM25() with b: 0 scores = %v and %v, want them equal", results[0].Score, results[1].Score)
+	}
+
+	for _, params := range []BM25Params{{K1: -1}, {B: ptr(-0.5)}, {B: ptr(1.5)}} {
+		if err := params.Validate(); err == nil {
+			t.Errorf("Validate(%+v) error = nil, want an error", params)
+		}
+	}
+	if err := (BM25Params{B: ptr(0.0)}).Validate(); err != nil {
+		t.Errorf("Validate() with b: 0 error = %v", err)
+	}
+}
+
+func TestOpenIndex(t *testing.T) {
+	cacheDir := t.TempDir()
+	paths := writeDocs(t, map[string]string{"a.md": "alpha document", "b.md": "beta document"})
+	ctx := context.Background()
+	open := func(paths []string, config ChunkConfig, rebuild bool) *Index {
+		t.Helper()
+		idx, err := OpenIndex(ctx, cacheDir, "docs/bm25", paths, config, rebuild, testLogger)
+		if err != nil {
+			t.Fatalf("OpenIndex() error = %v", err)
+		}
+		return idx
+	}
+	search := func(idx *Index, query string) int {
+		return len(idx.SearchBM25(query, BM25Params{}, 0))
+	}
+
+	idx := open(paths, ChunkConfig{}, false)
+	if len(idx.Chunks) != 2 {
+		t.Fatalf("OpenIndex() indexed %d chunks, want 2", len(idx.Chunks))
+	}
+	indexPath := GetIndexPath(cacheDir, "docs/bm25")
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		t.Fatalf("OpenIndex() did not save the index: %v", err)
+	}
+
+	// An unchanged index is loaded, not rebuilt
+	open(paths, ChunkConfig{}, false)
+	if again, _ := os.Stat(indexPath); !again.ModTime().Equal(info.ModTime()) {
+		t.Error("OpenIndex() rebuilt an up to date index")
+	}
+
+	// A changed document is reindexed, the others are reused as they are
+	later := time.Now().Add(time.Minute)
+	writeFile(t, paths[0], "gamma document")
+	if err := os.Chtimes(paths[0], later, later); err != nil {
+		t.Fatalf("failed to change modification time: %v", err)
+	}
+	// Content of an unchanged (by size and time) document is not read again
+	stat, _ := os.Stat(paths[1])
+	writeFile(t, paths[1], "zeta document")
+	if err := os.Chtimes(paths[1], stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatalf("failed to change modification time: %v", err)
+	}
+	idx = open(paths, ChunkConfig{}, false)
+	if search(idx, "gamma") != 1 || search(idx, "alpha") != 0 {
+		t.Error("OpenIndex() did not reindex the changed document")
+	}
+	if search(idx, "beta") != 1 {
+		t.Error("OpenIndex() reindexed an unchanged document")
+	}
+
+	// Rebuilding reads all documents again
+	idx = open(paths, ChunkConfig{}, true)
+	if search(idx, "zeta") != 1 || search(idx, "beta") != 0 {
+		t.Error("OpenIndex() did not rebuild the index")
+	}
+
+	// Removed documents are dropped
+	idx = open(paths[:1], ChunkConfig{}, false)
+	if len(idx.Files) != 1 || search(idx, "zeta") != 0 {
+		t.Error("OpenIndex() kept a removed document")
+	}
+
+	// A different chunking reindexes everything
+	idx = open(paths, ChunkConfig{Size: 5, Overlap: ptr(1)}, false)
+	if idx.Chunking.Size != 5 || len(idx.Chunks) <= 2 {
+		t.Errorf("OpenIndex() with a new chunking has %d chunks", len(idx.Chunks))
+	}
+}
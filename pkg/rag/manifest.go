@@ -0,0 +1,151 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// manifestsSubDir is the cache subdirectory holding the manifests of RAG sources
+const manifestsSubDir = "manifests"
+
+// ManifestEntry records the state of a document of a RAG source
+type ManifestEntry struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	ContentHash string    `json:"content_hash"`
+}
+
+// Manifest records the documents of a RAG source, as of the last time it was processed
+type Manifest struct {
+	Source    string                   `json:"source"`
+	UpdatedAt time.Time                `json:"updated_at"`
+	Files     map[string]ManifestEntry `json:"files"`
+}
+
+// ManifestChanges lists the documents changed between two manifests
+type ManifestChanges struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// IsEmpty returns true if no document changed
+func (c ManifestChanges) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// String returns a summary of the changes
+func (c ManifestChanges) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d removed", len(c.Added), len(c.Changed), len(c.Removed))
+}
+
+// GetManifestPath returns the path of the manifest of a RAG source
+func GetManifestPath(cacheDir, source string) string {
+	return filepath.Join(cacheDir, manifestsSubDir, hashURL(source)+".json")
+}
+
+// BuildManifest records the current state of the documents of a RAG source
+// Content hashes are taken from the previous manifest (if any) for documents
+// whose size and modification time did not change, so they are not read again.
+func BuildManifest(source string, paths []string, previous *Manifest) (*Manifest, error) {
+	manifest := &Manifest{
+		Source:    source,
+		UpdatedAt: time.Now(),
+		Files:     make(map[string]ManifestEntry, len(paths)),
+	}
+	for _, path := range paths {
+		if _, ok := manifest.Files[path]; ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to access %s: %w", path, err)
+		}
+		entry := ManifestEntry{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+
+		if old, ok := previous.lookup(path); ok && old.Size == entry.Size && old.ModTime.Equal(entry.ModTime) {
+			entry.ContentHash = old.ContentHash
+		} else {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			entry.ContentHash = ComputeContentHash(content)
+		}
+		manifest.Files[path] = entry
+	}
+	return manifest, nil
+}
+
+// lookup returns the entry of a document, if the manifest exists and has it
+func (m *Manifest) lookup(path string) (ManifestEntry, bool) {
+	if m == nil {
+		return ManifestEntry{}, false
+	}
+	entry, ok := m.Files[path]
+	return entry, ok
+}
+
+// Diff returns the documents added, changed (by content) or removed since a
+// previous manifest. All documents are added when there is no previous manifest.
+func (m *Manifest) Diff(previous *Manifest) ManifestChanges {
+	var changes ManifestChanges
+	for path, entry := range m.Files {
+		old, ok := previous.lookup(path)
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, path)
+		case old.ContentHash != entry.ContentHash:
+			changes.Changed = append(changes.Changed, path)
+		}
+	}
+	if previous != nil {
+		for path := range previous.Files {
+			if _, ok := m.Files[path]; !ok {
+				changes.Removed = append(changes.Removed, path)
+			}
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Changed)
+	sort.Strings(changes.Removed)
+	return changes
+}
+
+// LoadManifest loads the manifest of a RAG source
+// Returns nil (and no error) when the source has no manifest yet
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Save writes the manifest to a JSON file
+func (m *Manifest) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
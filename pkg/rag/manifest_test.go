@@ -0,0 +1,90 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestDiff(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	writeFile(t, path("kept.md"), "kept")
+	writeFile(t, path("changed.md"), "before")
+	writeFile(t, path("touched.md"), "same content")
+	writeFile(t, path("removed.md"), "removed")
+
+	first, err := BuildManifest("docs", []string{path("kept.md"), path("changed.md"), path("touched.md"), path("removed.md")}, nil)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	if changes := first.Diff(nil); len(changes.Added) != 4 {
+		t.Errorf("Diff(nil) = %v, want all documents added", changes)
+	}
+
+	later := time.Now().Add(time.Minute)
+	writeFile(t, path("changed.md"), "after!")
+	if err := os.Chtimes(path("changed.md"), later, later); err != nil {
+		t.Fatalf("failed to change modification time: %v", err)
+	}
+	// A new modification time alone is not a change
+	if err := os.Chtimes(path("touched.md"), later, later); err != nil {
+		t.Fatalf("failed to change modification time: %v", err)
+	}
+	writeFile(t, path("added.md"), "added")
+
+	second, err := BuildManifest("docs", []string{path("kept.md"), path("changed.md"), path("touched.md"), path("added.md")}, first)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	changes := second.Diff(first)
+	check := func(kind string, got []string, want ...string) {
+		t.Helper()
+		for i := range want {
+			want[i] = path(want[i])
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s = %v, want %v", kind, got, want)
+		}
+	}
+	check("Added", changes.Added, "added.md")
+	check("Changed", changes.Changed, "changed.md")
+	check("Removed", changes.Removed, "removed.md")
+	if changes.String() != "1 added, 1 changed, 1 removed" {
+		t.Errorf("String() = %q", changes.String())
+	}
+
+	if changes := second.Diff(second); !changes.IsEmpty() {
+		t.Errorf("Diff() of the same manifest = %v, want no changes", changes)
+	}
+}
+
+func TestManifestSaveLoad(t *testing.T) {
+	cacheDir := t.TempDir()
+	manifestPath := GetManifestPath(cacheDir, "docs")
+
+	missing, err := LoadManifest(manifestPath)
+	if err != nil || missing != nil {
+		t.Fatalf("LoadManifest() of a missing manifest = %v, %v, want nil, nil", missing, err)
+	}
+
+	doc := filepath.Join(t.TempDir(), "doc.md")
+	writeFile(t, doc, "content")
+	manifest, err := BuildManifest("docs", []string{doc, doc}, nil)
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	if err := manifest.Save(manifestPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if loaded.Source != "docs" || len(loaded.Files) != 1 || loaded.Files[doc].ContentHash != ComputeContentHash([]byte("content")) {
+		t.Errorf("LoadManifest() = %+v", loaded)
+	}
+}
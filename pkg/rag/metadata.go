@@ -0,0 +1,132 @@
+package rag
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// TagFilterKey is the key of the filter conditions matching the tags of a document
+const TagFilterKey = "tag"
+
+// MetadataCondition is a condition of a metadata filter: a tag ("tag=<tag>")
+// or a property ("<key>=<value>") the document must have
+type MetadataCondition struct {
+	Key   string
+	Value string
+}
+
+// MetadataFilter selects documents by their metadata: documents must match all its conditions
+type MetadataFilter []MetadataCondition
+
+// ParseMetadataFilter parses a comma-separated list of "key=value" conditions
+// (e.g. "tag=prod,service=payments"). An empty string is an empty filter.
+func ParseMetadataFilter(s string) (MetadataFilter, error) {
+	var filter MetadataFilter
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(term, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid filter condition %q: expected key=value (e.g. tag=prod)", term)
+		}
+		filter = append(filter, MetadataCondition{Key: key, Value: value})
+	}
+	return filter, nil
+}
+
+// Matches checks whether some metadata satisfies all the conditions of the filter
+// Documents without metadata only match an empty filter.
+func (f MetadataFilter) Matches(m *Metadata) bool {
+	for _, condition := range f {
+		if m == nil {
+			return false
+		}
+		if condition.Key == TagFilterKey {
+			if !slices.Contains(m.Tags, condition.Value) {
+				return false
+			}
+			continue
+		}
+		if value, ok := m.Properties[condition.Key]; !ok || value != condition.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the filter in the format parsed by ParseMetadataFilter
+func (f MetadataFilter) String() string {
+	terms := make([]string, len(f))
+	for i, condition := range f {
+		terms[i] = condition.Key + "=" + condition.Value
+	}
+	return strings.Join(terms, ",")
+}
+
+// IsEmpty checks whether the metadata has no description, tags or properties
+func (m *Metadata) IsEmpty() bool {
+	return m == nil || (m.Description == "" && len(m.Tags) == 0 && len(m.Properties) == 0)
+}
+
+// Merge returns the union of two metadata (e.g. for a document listed by several
+// docs entries): tags are combined, and the description and properties of m take
+// precedence over those of other
+func (m *Metadata) Merge(other *Metadata) *Metadata {
+	if m.IsEmpty() {
+		return other
+	}
+	if other.IsEmpty() {
+		return m
+	}
+
+	merged := &Metadata{Description: m.Description}
+	if merged.Description == "" {
+		merged.Description = other.Description
+	}
+	for _, tag := range append(append([]string(nil), m.Tags...), other.Tags...) {
+		if !slices.Contains(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+	if len(m.Properties)+len(other.Properties) > 0 {
+		merged.Properties = make(map[string]string, len(m.Properties)+len(other.Properties))
+		for k, v := range other.Properties {
+			merged.Properties[k] = v
+		}
+		for k, v := range m.Properties {
+			merged.Properties[k] = v
+		}
+	}
+	return merged
+}
+
+// MetadataKeys summarizes the metadata of a set of documents: the sorted tags,
+// and the sorted values of each property
+func MetadataKeys(metadata []*Metadata) (tags []string, properties map[string][]string) {
+	properties = make(map[string][]string)
+	for _, m := range metadata {
+		if m == nil {
+			continue
+		}
+		for _, tag := range m.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		for k, v := range m.Properties {
+			if !slices.Contains(properties[k], v) {
+				properties[k] = append(properties[k], v)
+			}
+		}
+	}
+	sort.Strings(tags)
+	for k := range properties {
+		sort.Strings(properties[k])
+	}
+	return tags, properties
+}
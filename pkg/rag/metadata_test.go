@@ -0,0 +1,97 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetadataFilter(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    MetadataFilter
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "tag=prod", want: MetadataFilter{{Key: "tag", Value: "prod"}}},
+		{input: " tag = prod , service=payments,", want: MetadataFilter{{Key: "tag", Value: "prod"}, {Key: "service", Value: "payments"}}},
+		{input: "prod", wantErr: true},
+		{input: "tag=", wantErr: true},
+		{input: "=prod", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMetadataFilter(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMetadataFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMetadataFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataFilterMatches(t *testing.T) {
+	metadata := &Metadata{Tags: []string{"prod", "eu"}, Properties: map[string]string{"service": "payments"}}
+
+	tests := []struct {
+		name     string
+		filter   string
+		metadata *Metadata
+		want     bool
+	}{
+		{"empty filter", "", nil, true},
+		{"tag", "tag=prod", metadata, true},
+		{"missing tag", "tag=staging", metadata, false},
+		{"property", "service=payments", metadata, true},
+		{"other property value", "service=orders", metadata, false},
+		{"all conditions", "tag=eu,service=payments", metadata, true},
+		{"one condition failing", "tag=eu,service=orders", metadata, false},
+		{"no metadata", "tag=prod", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseMetadataFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseMetadataFilter() error = %v", err)
+			}
+			if got := filter.Matches(tt.metadata); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataMerge(t *testing.T) {
+	a := &Metadata{Tags: []string{"prod"}, Properties: map[string]string{"service": "payments"}}
+	b := &Metadata{Description: "runbooks", Tags: []string{"prod", "eu"}, Properties: map[string]string{"service": "orders", "team": "core"}}
+
+	want := &Metadata{
+		Description: "runbooks",
+		Tags:        []string{"prod", "eu"},
+		Properties:  map[string]string{"service": "payments", "team": "core"},
+	}
+	if got := a.Merge(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+	if got := (*Metadata)(nil).Merge(b); got != b {
+		t.Errorf("Merge() of nil metadata = %+v, want %+v", got, b)
+	}
+	if got := a.Merge(nil); got != a {
+		t.Errorf("Merge() with nil metadata = %+v, want %+v", got, a)
+	}
+}
+
+func TestMetadataKeys(t *testing.T) {
+	tags, properties := MetadataKeys([]*Metadata{
+		{Tags: []string{"staging"}, Properties: map[string]string{"service": "payments"}},
+		nil,
+		{Tags: []string{"prod", "staging"}, Properties: map[string]string{"service": "orders"}},
+	})
+	if want := []string{"prod", "staging"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("MetadataKeys() tags = %v, want %v", tags, want)
+	}
+	if want := map[string][]string{"service": {"orders", "payments"}}; !reflect.DeepEqual(properties, want) {
+		t.Errorf("MetadataKeys() properties = %v, want %v", properties, want)
+	}
+}
@@ -2,24 +2,37 @@
 package rag
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/inercia/don/pkg/common"
 )
 
 // FileScanner implements the Scanner interface
 type FileScanner struct {
+	config ScannerConfig
 	logger *common.Logger
 }
 
-// NewScanner creates a new file scanner
+// NewScanner creates a new file scanner with the default configuration
 func NewScanner(logger *common.Logger) *FileScanner {
+	return NewScannerWithConfig(DefaultScannerConfig(logger))
+}
+
+// NewScannerWithConfig creates a new file scanner with the given configuration
+func NewScannerWithConfig(config ScannerConfig) *FileScanner {
+	if config.SniffSize <= 0 {
+		config.SniffSize = DefaultSniffSize
+	}
 	return &FileScanner{
-		logger: logger,
+		config: config,
+		logger: config.Logger,
 	}
 }
 
@@ -64,7 +77,7 @@ func (s *FileScanner) ScanDirectory(ctx context.Context, dirPath string, recursi
 
 		// Skip directories (unless we're at the root)
 		if info.IsDir() {
-			if path != absPath && !recursive {
+			if path != absPath && (!recursive || vcsDirectories[info.Name()]) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -76,10 +89,12 @@ func (s *FileScanner) ScanDirectory(ctx context.Context, dirPath string, recursi
 		}
 
 		// Check if it's a text file
-		if s.IsTextFile(path) {
-			files = append(files, path)
-			s.logger.Debug("Found text file: %s", path)
+		if err := s.CheckTextFile(path); err != nil {
+			s.logger.Debug("Skipping %v", err)
+			return nil
 		}
+		files = append(files, path)
+		s.logger.Debug("Found text file: %s", path)
 
 		return nil
 	}
@@ -116,42 +131,127 @@ func (s *FileScanner) ScanFile(filePath string) (string, error) {
 	}
 
 	// Check if it's a text file
-	if !s.IsTextFile(absPath) {
-		return "", ErrNotTextFile(absPath)
+	if err := s.CheckTextFile(absPath); err != nil {
+		return "", err
 	}
 
 	s.logger.Debug("Validated text file: %s", absPath)
 	return absPath, nil
 }
 
-// IsTextFile checks if a file is text-based by extension
+// IsTextFile checks if a file is text-based by sniffing its content
 func (s *FileScanner) IsTextFile(path string) bool {
+	return s.CheckTextFile(path) == nil
+}
+
+// CheckTextFile sniffs the first bytes of a file to decide whether it is text.
+// It returns nil for text files, or an ErrNotTextFile explaining why the file
+// was rejected. The file extension is only used as a hint: known binary
+// extensions are rejected without reading, and known text extensions are
+// accepted even when the content is not valid UTF-8 (e.g. Latin-1 files).
+func (s *FileScanner) CheckTextFile(path string) error {
 	ext := strings.ToLower(filepath.Ext(path))
+	if binaryExtensions[ext] {
+		return ErrNotTextFile(fmt.Sprintf("%s: binary file extension %s", path, ext))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ErrNotTextFile(fmt.Sprintf("%s: cannot be read: %v", path, err))
+	}
+	defer f.Close()
+
+	buf := make([]byte, s.config.SniffSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ErrNotTextFile(fmt.Sprintf("%s: cannot be read: %v", path, err))
+	}
+	head := buf[:n]
+
+	if bytes.IndexByte(head, 0) >= 0 {
+		return ErrNotTextFile(fmt.Sprintf("%s: contains NUL bytes", path))
+	}
+
+	if !validUTF8Prefix(head, n == len(buf)) && !s.hasTextExtension(ext) {
+		return ErrNotTextFile(fmt.Sprintf("%s: content is not valid UTF-8", path))
+	}
+
+	return nil
+}
 
-	// List of text file extensions
-	textExtensions := []string{
-		".txt", ".md", ".markdown",
-		".json", ".yaml", ".yml",
-		".xml", ".html", ".htm",
-		".csv", ".tsv",
-		".log",
-		".rst", ".adoc", ".asciidoc",
-		".tex", ".latex",
-		".org",
-		".conf", ".config", ".cfg",
-		".ini", ".toml",
-		".sh", ".bash", ".zsh",
-		".py", ".js", ".ts", ".go", ".java", ".c", ".cpp", ".h", ".hpp",
-		".rb", ".php", ".pl", ".lua", ".r",
-		".css", ".scss", ".sass", ".less",
-		".sql",
-	}
-
-	for _, textExt := range textExtensions {
-		if ext == textExt {
+// hasTextExtension checks if an extension is a known or configured text extension
+func (s *FileScanner) hasTextExtension(ext string) bool {
+	if textExtensions[ext] {
+		return true
+	}
+	for _, extra := range s.config.ExtraExtensions {
+		if ext == normalizeExtension(extra) {
 			return true
 		}
 	}
+	return false
+}
 
+// validUTF8Prefix checks if data is valid UTF-8. When the data was truncated at
+// the sniff limit, an incomplete multi-byte sequence at the end is tolerated.
+func validUTF8Prefix(data []byte, truncated bool) bool {
+	if utf8.Valid(data) {
+		return true
+	}
+	if !truncated {
+		return false
+	}
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.Valid(data[:len(data)-i]) {
+			return true
+		}
+	}
 	return false
 }
+
+// normalizeExtension lowercases an extension and ensures it has a leading dot
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// textExtensions lists extensions that are accepted even when their content
+// is not valid UTF-8 (as long as it has no NUL bytes)
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true,
+	".json": true, ".yaml": true, ".yml": true,
+	".xml": true, ".html": true, ".htm": true,
+	".csv": true, ".tsv": true,
+	".log": true,
+	".rst": true, ".adoc": true, ".asciidoc": true,
+	".tex": true, ".latex": true,
+	".org":  true,
+	".conf": true, ".config": true, ".cfg": true,
+	".ini": true, ".toml": true,
+	".sh": true, ".bash": true, ".zsh": true,
+	".py": true, ".js": true, ".ts": true, ".go": true, ".java": true, ".c": true, ".cpp": true, ".h": true, ".hpp": true,
+	".rb": true, ".php": true, ".pl": true, ".lua": true, ".r": true,
+	".rs": true, ".kt": true, ".tf": true, ".proto": true,
+	".css": true, ".scss": true, ".sass": true, ".less": true,
+	".sql": true,
+}
+
+// vcsDirectories lists version control metadata directories that are never scanned
+var vcsDirectories = map[string]bool{
+	".git": true, ".hg": true, ".svn": true,
+}
+
+// binaryExtensions lists extensions that are rejected without reading the file
+var binaryExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true, ".ico": true, ".webp": true,
+	".pdf": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".7z": true, ".rar": true, ".tar": true,
+	".exe": true, ".dll": true, ".so": true, ".dylib": true, ".a": true, ".o": true, ".class": true, ".jar": true,
+	".wasm": true, ".bin": true,
+	".mp3": true, ".mp4": true, ".wav": true, ".avi": true, ".mov": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true,
+	".sqlite": true, ".db": true,
+}
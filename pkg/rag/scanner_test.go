@@ -0,0 +1,174 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+var testLogger, _ = common.NewLogger("", "", common.LogLevelNone, false)
+
+func TestCheckTextFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name       string
+		file       string
+		content    []byte
+		extra      []string
+		wantErr    bool
+		wantReason string
+	}{
+		{
+			name:    "plain text file",
+			file:    "notes.txt",
+			content: []byte("hello world\n"),
+		},
+		{
+			name:    "makefile without extension",
+			file:    "Makefile",
+			content: []byte("all:\n\tgo build ./...\n"),
+		},
+		{
+			name:    "dockerfile without extension",
+			file:    "Dockerfile",
+			content: []byte("FROM golang:1.25\n"),
+		},
+		{
+			name:    "rust source",
+			file:    "main.rs",
+			content: []byte("fn main() { println!(\"héllo\"); }\n"),
+		},
+		{
+			name:    "empty file",
+			file:    "README",
+			content: []byte{},
+		},
+		{
+			name:       "binary renamed to txt",
+			file:       "fake.txt",
+			content:    []byte{0x7f, 'E', 'L', 'F', 0x02, 0x01, 0x00, 0x00},
+			wantErr:    true,
+			wantReason: "NUL bytes",
+		},
+		{
+			name:       "invalid UTF-8 without hint",
+			file:       "latin1.dat",
+			content:    []byte("caf\xe9 au lait\n"),
+			wantErr:    true,
+			wantReason: "not valid UTF-8",
+		},
+		{
+			name:    "invalid UTF-8 with known text extension",
+			file:    "latin1.md",
+			content: []byte("caf\xe9 au lait\n"),
+		},
+		{
+			name:    "invalid UTF-8 with configured extension",
+			file:    "latin1.j2",
+			content: []byte("caf\xe9 au lait\n"),
+			extra:   []string{"J2"},
+		},
+		{
+			name:       "binary extension",
+			file:       "image.png",
+			content:    []byte("not really a png"),
+			wantErr:    true,
+			wantReason: "binary file extension",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, tt.file)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+
+			config := DefaultScannerConfig(testLogger)
+			config.ExtraExtensions = tt.extra
+			scanner := NewScannerWithConfig(config)
+
+			err := scanner.CheckTextFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckTextFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var notText ErrNotTextFile
+				if !errors.As(err, &notText) {
+					t.Errorf("CheckTextFile() error type = %T, want ErrNotTextFile", err)
+				}
+				if !strings.Contains(err.Error(), tt.wantReason) {
+					t.Errorf("CheckTextFile() error = %q, want reason containing %q", err, tt.wantReason)
+				}
+			}
+			if scanner.IsTextFile(path) == tt.wantErr {
+				t.Errorf("IsTextFile() = %v, want %v", !tt.wantErr, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTextFileTruncatedRune(t *testing.T) {
+	// A multi-byte rune split by the sniff limit must not reject the file
+	path := filepath.Join(t.TempDir(), "unicode")
+	content := []byte("ab" + strings.Repeat("é", 10))
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	config := DefaultScannerConfig(testLogger)
+	config.SniffSize = 3 // "ab" plus the first byte of "é"
+	scanner := NewScannerWithConfig(config)
+
+	if err := scanner.CheckTextFile(path); err != nil {
+		t.Errorf("CheckTextFile() error = %v, want nil", err)
+	}
+}
+
+func TestScanDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string][]byte{
+		"Makefile":       []byte("all:\n"),
+		"docs/guide.md":  []byte("# Guide\n"),
+		"docs/logo.png":  {0x89, 'P', 'N', 'G', 0x00},
+		"bin/tool.txt":   {0x00, 0x01, 0x02},
+		".hidden":        []byte("secret\n"),
+		"infra/main.tf":  []byte("resource \"x\" \"y\" {}\n"),
+		"api/svc.proto":  []byte("syntax = \"proto3\";\n"),
+		"src/lib/lib.kt": []byte("fun main() {}\n"),
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+
+	scanner := NewScanner(testLogger)
+	found, err := scanner.ScanDirectory(context.Background(), tmpDir, true)
+	if err != nil {
+		t.Fatalf("ScanDirectory() error = %v", err)
+	}
+
+	var got []string
+	for _, f := range found {
+		rel, _ := filepath.Rel(tmpDir, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+
+	want := []string{"Makefile", "api/svc.proto", "docs/guide.md", "infra/main.tf", "src/lib/lib.kt"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ScanDirectory() = %v, want %v", got, want)
+	}
+}
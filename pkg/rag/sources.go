@@ -0,0 +1,102 @@
+package rag
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SourceResolver maps the paths of documents stored in the cache (downloaded
+// blobs, git checkouts and extracted archives) back to the locations they came from
+type SourceResolver struct {
+	blobs map[string]string     // Blob path -> URL of the downloaded document
+	trees map[string]cachedTree // Checkout or extraction directory -> where it came from
+}
+
+// cachedTree is the origin of a git checkout or an extracted archive
+type cachedTree struct {
+	location string     // Archive location
+	git      *GitSource // Git source, for checkouts
+	commit   string     // Commit SHA of the checkout, for checkouts
+}
+
+// NewSourceResolver creates a resolver from the metadata in a cache directory
+// Unreadable metadata files are ignored, so their documents resolve to their cache paths
+func NewSourceResolver(cacheDir string) *SourceResolver {
+	r := &SourceResolver{
+		blobs: make(map[string]string),
+		trees: make(map[string]cachedTree),
+	}
+
+	metaFiles, _ := filepath.Glob(filepath.Join(cacheDir, "documents", "*"+metadataExt))
+	for _, metaPath := range metaFiles {
+		meta, err := LoadMetadata(metaPath)
+		if err != nil || meta.ContentHash == "" {
+			continue
+		}
+		// URLs serving the same content share a blob: keep one of them, consistently
+		blobPath := GetBlobPath(cacheDir, meta.ContentHash)
+		if url, ok := r.blobs[blobPath]; !ok || meta.URL < url {
+			r.blobs[blobPath] = meta.URL
+		}
+	}
+
+	for _, subDir := range []string{"git", "archives"} {
+		metaFiles, _ := filepath.Glob(filepath.Join(cacheDir, subDir, "*"+metadataExt))
+		for _, metaPath := range metaFiles {
+			meta, err := LoadMetadata(metaPath)
+			if err != nil {
+				continue
+			}
+			tree := cachedTree{location: meta.URL, commit: meta.Commit}
+			if src, err := ParseGitSource(meta.URL); err == nil {
+				tree.git = src
+			}
+			r.trees[strings.TrimSuffix(metaPath, metadataExt)] = tree
+		}
+	}
+	return r
+}
+
+// Resolve returns the original location of a document: the URL of a downloaded
+// document, or the location of a file in a git repository or archive, using the
+// "//" notation of git sources (e.g. git+https://host/org/repo.git//docs/install.md).
+// Other paths are returned unchanged.
+func (r *SourceResolver) Resolve(path string) string {
+	if url, ok := r.blobs[path]; ok {
+		return url
+	}
+	for dir, tree := range r.trees {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if tree.git != nil {
+			// Checkouts hold the whole repository, so files are relative to its root.
+			// Cite the commit checked out, as the ref may have moved since.
+			src := GitSource{RepoURL: tree.git.RepoURL, SubDir: rel, Ref: tree.git.Ref}
+			if tree.commit != "" {
+				src.Ref = tree.commit
+			}
+			return src.String()
+		}
+		return tree.location + "//" + rel
+	}
+	return path
+}
+
+// FindLines returns the (1-based) lines of a text spanned by a piece of it, such
+// as a chunk returned by a retrieval engine. Surrounding whitespace is ignored.
+func FindLines(text, content string) (startLine, endLine int, ok bool) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return 0, 0, false
+	}
+	offset := strings.Index(text, content)
+	if offset < 0 {
+		return 0, 0, false
+	}
+	startLine = strings.Count(text[:offset], "\n") + 1
+	endLine = startLine + strings.Count(content, "\n")
+	return startLine, endLine, true
+}
@@ -0,0 +1,75 @@
+package rag
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceResolver(t *testing.T) {
+	cacheDir := t.TempDir()
+	hash := ComputeContentHash([]byte("downloaded"))
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	for _, meta := range []struct {
+		path   string
+		url    string
+		hash   string
+		commit string
+	}{
+		{GetCachedMetadataPath(cacheDir, "https://example.com/b.html"), "https://example.com/b.html", hash, ""},
+		{GetCachedMetadataPath(cacheDir, "https://example.com/a.html"), "https://example.com/a.html", hash, ""},
+		{filepath.Join(cacheDir, "git", "abc"+metadataExt), "git+https://github.com/org/repo.git//docs?ref=main", "", commit},
+		{filepath.Join(cacheDir, "git", "ghi"+metadataExt), "git+https://github.com/org/wiki.git?ref=main", "", ""},
+		{filepath.Join(cacheDir, "archives", "def"+metadataExt), "/data/docs.tar.gz", "def", ""},
+	} {
+		if err := SaveMetadata(meta.path, &CacheMetadata{URL: meta.url, ContentHash: meta.hash, Commit: meta.commit}); err != nil {
+			t.Fatalf("SaveMetadata() error = %v", err)
+		}
+	}
+	resolver := NewSourceResolver(cacheDir)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"downloaded document", GetBlobPath(cacheDir, hash), "https://example.com/a.html"},
+		{"git checkout", filepath.Join(cacheDir, "git", "abc", "docs", "install.md"), "git+https://github.com/org/repo.git//docs/install.md?ref=" + commit},
+		{"git checkout without commit", filepath.Join(cacheDir, "git", "ghi", "home.md"), "git+https://github.com/org/wiki.git//home.md?ref=main"},
+		{"extracted archive", filepath.Join(cacheDir, "archives", "def", "guide", "intro.md"), "/data/docs.tar.gz//guide/intro.md"},
+		{"unknown blob", GetBlobPath(cacheDir, "unknown"), GetBlobPath(cacheDir, "unknown")},
+		{"local document", "/home/user/docs/readme.md", "/home/user/docs/readme.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.Resolve(tt.path); got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindLines(t *testing.T) {
+	text := "# Title\n\nFirst paragraph.\nStill first.\n\nSecond paragraph.\n"
+
+	tests := []struct {
+		name      string
+		content   string
+		wantStart int
+		wantEnd   int
+		wantOK    bool
+	}{
+		{"first line", "# Title", 1, 1, true},
+		{"multiple lines", "First paragraph.\nStill first.", 3, 4, true},
+		{"surrounding whitespace", "\n  Second paragraph.\n", 6, 6, true},
+		{"missing", "Third paragraph.", 0, 0, false},
+		{"empty", "  ", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := FindLines(text, tt.content)
+			if start != tt.wantStart || end != tt.wantEnd || ok != tt.wantOK {
+				t.Errorf("FindLines() = %d, %d, %v, want %d, %d, %v", start, end, ok, tt.wantStart, tt.wantEnd, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statsFile is the name of the file holding the cache statistics, in the cache directory
+const statsFile = "stats.json"
+
+// CacheStats holds cumulative statistics of the document cache,
+// shared by all processes using the same cache directory
+type CacheStats struct {
+	Since             time.Time `json:"since"`              // When statistics started being recorded
+	Hits              int64     `json:"hits"`               // Documents served from the cache
+	Misses            int64     `json:"misses"`             // Documents downloaded
+	Deduplicated      int64     `json:"deduplicated"`       // Downloads whose content was already cached from another URL
+	BytesDownloaded   int64     `json:"bytes_downloaded"`   // Bytes downloaded
+	BytesSaved        int64     `json:"bytes_saved"`        // Bytes served from the cache instead of downloaded
+	BytesDeduplicated int64     `json:"bytes_deduplicated"` // Bytes not stored twice thanks to deduplication
+	Evictions         int64     `json:"evictions"`          // Entries evicted to respect the cache size limit
+	BytesEvicted      int64     `json:"bytes_evicted"`      // Bytes evicted
+}
+
+// HitRate returns the fraction of documents served from the cache
+func (s *CacheStats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// LoadCacheStats loads the cache statistics of a cache directory
+// Returns empty statistics when none have been recorded yet
+func LoadCacheStats(cacheDir string) (*CacheStats, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, statsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &CacheStats{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache statistics: %w", err)
+	}
+
+	var stats CacheStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse cache statistics: %w", err)
+	}
+	return &stats, nil
+}
+
+// UpdateCacheStats applies update to the cache statistics of a cache directory
+func UpdateCacheStats(ctx context.Context, cacheDir string, update func(stats *CacheStats)) error {
+	statsPath := filepath.Join(cacheDir, statsFile)
+
+	unlock, err := lockCacheEntry(ctx, strings.TrimSuffix(statsPath, ".json"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stats, err := LoadCacheStats(cacheDir)
+	if err != nil {
+		// Start over rather than failing forever on a damaged file
+		stats = &CacheStats{}
+	}
+	if stats.Since.IsZero() {
+		stats.Since = time.Now()
+	}
+	update(stats)
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache statistics: %w", err)
+	}
+	return writeFileAtomic(statsPath, data, 0644)
+}
+
+// CacheEntryKind is the kind of a cache entry
+type CacheEntryKind string
+
+const (
+	// CacheEntryDocument is a downloaded document (a blob shared by the URLs serving its content)
+	CacheEntryDocument CacheEntryKind = "document"
+	// CacheEntryGit is a git repository checkout
+	CacheEntryGit CacheEntryKind = "git"
+	// CacheEntryArchive is an extracted archive
+	CacheEntryArchive CacheEntryKind = "archive"
+)
+
+// CacheEntry describes an entry of the cache directory
+type CacheEntry struct {
+	Kind       CacheEntryKind // Kind of entry
+	Path       string         // Blob file or checkout/extraction directory
+	Size       int64          // Size on disk in bytes
+	AccessedAt time.Time      // Last time the entry was used
+	URLs       []string       // Sources the entry was fetched from
+
+	metaPaths []string // Metadata files referencing the entry
+	lockPath  string   // Entry path used for locking
+}
+
+// ScanCache lists the entries of a cache directory, least recently used first
+func ScanCache(cacheDir string) ([]*CacheEntry, error) {
+	var entries []*CacheEntry
+
+	documents, err := scanDocuments(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, documents...)
+
+	for _, kind := range []CacheEntryKind{CacheEntryGit, CacheEntryArchive} {
+		dirEntries, err := scanDirectoryEntries(cacheDir, kind)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, dirEntries...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].AccessedAt.Before(entries[j].AccessedAt)
+	})
+	return entries, nil
+}
+
+// scanDocuments lists document blobs, grouping the URL metadata pointing at them
+// Blobs no URL points at (and documents cached by older versions) are listed too,
+// so they can be evicted
+func scanDocuments(cacheDir string) ([]*CacheEntry, error) {
+	blobs := make(map[string]*CacheEntry)
+
+	metaPaths, err := filepath.Glob(filepath.Join(cacheDir, "documents", "*"+metadataExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, metaPath := range metaPaths {
+		meta, err := LoadMetadata(metaPath)
+		if err != nil || meta.ContentHash == "" {
+			continue
+		}
+		blobPath := GetBlobPath(cacheDir, meta.ContentHash)
+		entry, ok := blobs[blobPath]
+		if !ok {
+			entry = &CacheEntry{
+				Kind:     CacheEntryDocument,
+				Path:     blobPath,
+				lockPath: strings.TrimSuffix(blobPath, documentExt),
+			}
+			blobs[blobPath] = entry
+		}
+		entry.URLs = append(entry.URLs, meta.URL)
+		entry.metaPaths = append(entry.metaPaths, metaPath)
+		if accessed := lastAccess(meta); accessed.After(entry.AccessedAt) {
+			entry.AccessedAt = accessed
+		}
+	}
+
+	var entries []*CacheEntry
+	for _, entry := range blobs {
+		info, err := os.Stat(entry.Path)
+		if err != nil {
+			// Metadata without blob: nothing on disk to account for
+			continue
+		}
+		entry.Size = info.Size()
+		entries = append(entries, entry)
+	}
+
+	// Orphan blobs and legacy (URL-keyed) documents
+	for _, pattern := range []string{
+		filepath.Join(cacheDir, blobsSubDir, "*"+documentExt),
+		filepath.Join(cacheDir, "documents", "*"+documentExt),
+	} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			if _, ok := blobs[path]; ok {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, &CacheEntry{
+				Kind:       CacheEntryDocument,
+				Path:       path,
+				Size:       info.Size(),
+				AccessedAt: info.ModTime(),
+				lockPath:   strings.TrimSuffix(path, documentExt),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// scanDirectoryEntries lists git checkouts or extracted archives
+func scanDirectoryEntries(cacheDir string, kind CacheEntryKind) ([]*CacheEntry, error) {
+	subDir := "git"
+	if kind == CacheEntryArchive {
+		subDir = "archives"
+	}
+
+	dirEntries, err := os.ReadDir(filepath.Join(cacheDir, subDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*CacheEntry
+	for _, dirEntry := range dirEntries {
+		// Skip files and in-progress extractions
+		if !dirEntry.IsDir() || strings.Contains(dirEntry.Name(), ".tmp-") {
+			continue
+		}
+		path := filepath.Join(cacheDir, subDir, dirEntry.Name())
+		entry := &CacheEntry{
+			Kind:      kind,
+			Path:      path,
+			Size:      dirSize(path),
+			lockPath:  path,
+			metaPaths: []string{path + metadataExt},
+		}
+		if meta, err := LoadMetadata(path + metadataExt); err == nil {
+			entry.AccessedAt = lastAccess(meta)
+			entry.URLs = []string{meta.URL}
+		} else if info, err := dirEntry.Info(); err == nil {
+			entry.AccessedAt = info.ModTime()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// lastAccess returns the last access time recorded in metadata
+// Entries written before access times were recorded use their download time
+func lastAccess(meta *CacheMetadata) time.Time {
+	if meta.AccessedAt.IsZero() {
+		return meta.DownloadedAt
+	}
+	return meta.AccessedAt
+}
+
+// dirSize returns the total size of the regular files below a directory
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -4,6 +4,7 @@ package rag
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/inercia/don/pkg/common"
@@ -44,9 +45,9 @@ type DocumentSource struct {
 
 // Metadata stores additional information about a document source
 type Metadata struct {
-	Description string            // Human-readable description
-	Tags        []string          // Optional tags for categorization
-	Properties  map[string]string // Additional properties
+	Description string            `json:"description,omitempty"` // Human-readable description
+	Tags        []string          `json:"tags,omitempty"`        // Optional tags for categorization
+	Properties  map[string]string `json:"properties,omitempty"`  // Additional properties
 }
 
 // CacheMetadata stores information about cached documents
@@ -58,6 +59,9 @@ type CacheMetadata struct {
 	LastModified string    `json:"last_modified,omitempty"` // HTTP Last-Modified header
 	ContentType  string    `json:"content_type"`            // HTTP Content-Type header
 	Size         int64     `json:"size"`                    // Size in bytes
+	Commit       string    `json:"commit,omitempty"`        // Git commit SHA (git sources only)
+	Ref          string    `json:"ref,omitempty"`           // Git ref that was fetched (git sources only)
+	AccessedAt   time.Time `json:"accessed_at,omitempty"`   // When the entry was last used (for LRU eviction)
 }
 
 // DownloaderConfig holds configuration for the document downloader
@@ -67,6 +71,18 @@ type DownloaderConfig struct {
 	MaxSize      int64          // Maximum file size in bytes
 	ForceRefresh bool           // Force re-download of cached documents
 	Logger       *common.Logger // Logger instance
+
+	// HTTP settings (headers, credentials, CA bundle, proxy...) for all downloads,
+	// taking precedence over the settings of matching HTTPRules
+	HTTP      HTTPSettings
+	HTTPRules []HTTPRule // Per-host HTTP settings, applied in order
+}
+
+// ScannerConfig holds configuration for the file scanner
+type ScannerConfig struct {
+	ExtraExtensions []string       // Additional extensions treated as text even if not valid UTF-8
+	SniffSize       int            // Number of bytes read to detect text content
+	Logger          *common.Logger // Logger instance
 }
 
 // Downloader interface for downloading and caching documents
@@ -74,6 +90,9 @@ type Downloader interface {
 	// Download downloads a document from a URL and returns the local file path
 	Download(ctx context.Context, url string) (string, error)
 
+	// DownloadArchive downloads an archive from a URL and returns the local file path
+	DownloadArchive(ctx context.Context, url string) (string, error)
+
 	// GetCachedPath returns the cached file path for a URL if it exists
 	// Returns the path, whether it exists, and any error
 	GetCachedPath(url string) (string, bool, error)
@@ -97,6 +116,10 @@ type Scanner interface {
 
 	// IsTextFile checks if a file is text-based
 	IsTextFile(path string) bool
+
+	// CheckTextFile checks if a file is text-based
+	// Returns nil for text files, or an error explaining why the file was rejected
+	CheckTextFile(path string) error
 }
 
 // DefaultConfig returns a default DownloaderConfig
@@ -110,6 +133,17 @@ func DefaultConfig(logger *common.Logger) DownloaderConfig {
 	}
 }
 
+// DefaultSniffSize is the default number of bytes read to detect text content
+const DefaultSniffSize = 8 * 1024
+
+// DefaultScannerConfig returns a default ScannerConfig
+func DefaultScannerConfig(logger *common.Logger) ScannerConfig {
+	return ScannerConfig{
+		SniffSize: DefaultSniffSize,
+		Logger:    logger,
+	}
+}
+
 // ValidateConfig validates the downloader configuration
 func ValidateConfig(config DownloaderConfig) error {
 	if config.Logger == nil {
@@ -121,5 +155,13 @@ func ValidateConfig(config DownloaderConfig) error {
 	if config.MaxSize <= 0 {
 		return ErrInvalidConfig("max size must be positive")
 	}
+	if err := config.HTTP.validate(); err != nil {
+		return err
+	}
+	for _, rule := range config.HTTPRules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("HTTP rule '%s': %w", rule.Match, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,137 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/inercia/don/pkg/common"
+)
+
+// DefaultWatchDebounce is the default quiet period after a change before it is reported
+const DefaultWatchDebounce = 2 * time.Second
+
+// Watcher reports changes to the files below a set of local paths
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	logger  *common.Logger
+}
+
+// NewWatcher creates a watcher for a set of local files and directories
+// Directories are watched recursively (skipping VCS directories), and files
+// are watched through the directory containing them
+func NewWatcher(paths []string, logger *common.Logger) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	w := &Watcher{watcher: watcher, logger: logger}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			logger.Warn("Cannot watch %s: %v", path, err)
+			continue
+		}
+		if !info.IsDir() {
+			path = filepath.Dir(path)
+		}
+		if err := w.addDir(path); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// addDir watches a directory and its subdirectories
+func (w *Watcher) addDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			w.logger.Debug("Cannot watch %s: %v", path, err)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && vcsDirectories[d.Name()] {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// Run reports changes until the context is cancelled
+// Changes are collected until no change happens for the debounce period, and
+// onChange is then called with the changed paths (sorted)
+func (w *Watcher) Run(ctx context.Context, debounce time.Duration, onChange func(paths []string)) {
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	pending := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if ignoredChange(event.Name) {
+				continue
+			}
+			// Watch new directories, so their files are reported too
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := w.addDir(event.Name); err != nil {
+						w.logger.Warn("%v", err)
+					}
+				}
+			}
+			w.logger.Debug("File changed: %s (%s)", event.Name, event.Op)
+			pending[event.Name] = true
+			timer.Reset(debounce)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("File watcher error: %v", err)
+
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			pending = make(map[string]bool)
+			onChange(paths)
+		}
+	}
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+// ignoredChange checks whether a changed path cannot be a document: hidden
+// files (as skipped by the scanner) and editor backup files
+func ignoredChange(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".swp")
+}
@@ -0,0 +1,64 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "docs", "guide.md"), "guide")
+
+	watcher, err := NewWatcher([]string{filepath.Join(dir, "docs")}, testLogger)
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	defer watcher.Close()
+
+	changes := make(chan []string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Run(ctx, 100*time.Millisecond, func(paths []string) { changes <- paths })
+
+	next := func() []string {
+		t.Helper()
+		select {
+		case paths := <-changes:
+			return paths
+		case <-time.After(5 * time.Second):
+			t.Fatal("Watcher did not report changes")
+			return nil
+		}
+	}
+
+	// Several changes are reported together, hidden files are ignored
+	writeFile(t, filepath.Join(dir, "docs", "guide.md"), "guide v2")
+	writeFile(t, filepath.Join(dir, "docs", "faq.md"), "faq")
+	writeFile(t, filepath.Join(dir, "docs", ".guide.md.swp"), "swap")
+	paths := next()
+	want := map[string]bool{filepath.Join(dir, "docs", "faq.md"): true, filepath.Join(dir, "docs", "guide.md"): true}
+	for _, path := range paths {
+		if !want[path] {
+			t.Errorf("Watcher reported %s", path)
+		}
+	}
+	if len(paths) == 0 {
+		t.Error("Watcher reported no paths")
+	}
+
+	// Files in new directories are reported too
+	if err := os.MkdirAll(filepath.Join(dir, "docs", "api"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	next()
+	writeFile(t, filepath.Join(dir, "docs", "api", "users.md"), "users")
+	found := false
+	for !found {
+		for _, path := range next() {
+			found = found || path == filepath.Join(dir, "docs", "api", "users.md")
+		}
+	}
+}
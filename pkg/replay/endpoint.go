@@ -0,0 +1,69 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// modelPathPrefix is the prefix of the paths of the models in the endpoint
+const modelPathPrefix = "/models/"
+
+// Endpoint is a local HTTP server the models of a run use as their API, with a
+// base URL per model
+type Endpoint struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// Serve starts an endpoint on a local port, serving the requests of the models
+// with a Recorder proxy or a Player
+func Serve(handler http.Handler) (*Endpoint, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	e := &Endpoint{
+		listener: listener,
+		server:   &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() { _ = e.server.Serve(listener) }()
+	return e, nil
+}
+
+// URL returns the base URL of a model in the endpoint
+func (e *Endpoint) URL(model string) string {
+	return "http://" + e.listener.Addr().String() + modelPathPrefix + url.PathEscape(model)
+}
+
+// Close stops the endpoint
+func (e *Endpoint) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return e.server.Shutdown(ctx)
+}
+
+// splitPath returns the model and the path relative to its base URL of the
+// escaped path of a request to the endpoint (see url.URL.EscapedPath). The
+// path is split before unescaping, as model names can have slashes (e.g.
+// hf.co/org/model).
+func splitPath(path string) (string, string, error) {
+	rest, ok := strings.CutPrefix(path, modelPathPrefix)
+	if !ok {
+		return "", "", fmt.Errorf("path %s is not the path of a model", path)
+	}
+	escapedModel, escapedRelative, _ := strings.Cut(rest, "/")
+	model, err := url.PathUnescape(escapedModel)
+	if err != nil || model == "" {
+		return "", "", fmt.Errorf("invalid model in path %s", path)
+	}
+	relative, err := url.PathUnescape(escapedRelative)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid path %s: %w", path, err)
+	}
+	return model, "/" + relative, nil
+}
@@ -0,0 +1,126 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Player serves the recorded LLM responses of each model in order, and checks
+// the run makes the tool calls of the recording. Tools still run: their recorded
+// results are not replayed.
+type Player struct {
+	mu        sync.Mutex
+	responses map[string][]Entry // Recorded LLM exchanges not served yet, by model
+	toolCalls []Entry            // Recorded tool calls not made yet
+	problems  []string           // Differences between the run and the recording
+}
+
+// NewPlayer creates a player for the entries of a recording
+func NewPlayer(entries []Entry) *Player {
+	p := &Player{responses: make(map[string][]Entry)}
+	for _, entry := range entries {
+		switch entry.Type {
+		case EntryLLM:
+			p.responses[entry.Model] = append(p.responses[entry.Model], entry)
+		case EntryToolCall:
+			p.toolCalls = append(p.toolCalls, entry)
+		}
+	}
+	return p
+}
+
+// ServeHTTP answers an LLM request with the next recorded response of its model
+func (p *Player) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	model, path, err := splitPath(req.URL.EscapedPath())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	p.mu.Lock()
+	responses := p.responses[model]
+	if len(responses) == 0 {
+		p.problemf("request %s %s for model '%s' has no recorded response left", req.Method, path, model)
+		p.mu.Unlock()
+		http.Error(w, fmt.Sprintf("replay: no recorded response left for model '%s'", model), http.StatusInternalServerError)
+		return
+	}
+	entry := responses[0]
+	p.responses[model] = responses[1:]
+	if entry.Method != req.Method || entry.Path != path {
+		p.problemf("request %s %s for model '%s' does not match the recorded %s %s", req.Method, path, model, entry.Method, entry.Path)
+	}
+	p.mu.Unlock()
+
+	if entry.ContentType != "" {
+		w.Header().Set("Content-Type", entry.ContentType)
+	}
+	w.WriteHeader(entry.Status)
+	_, _ = w.Write([]byte(entry.Response))
+}
+
+// ToolCall checks a tool call of the run is the next one of the recording
+// Arguments are compared as JSON values
+func (p *Player) ToolCall(tool, arguments string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.toolCalls) == 0 {
+		p.problemf("tool call %s(%s) is not in the recording", tool, arguments)
+		return
+	}
+	recorded := p.toolCalls[0]
+	p.toolCalls = p.toolCalls[1:]
+	if recorded.Tool != tool || !sameJSON(recorded.Arguments, arguments) {
+		p.problemf("tool call %s(%s) does not match the recorded %s(%s)", tool, arguments, recorded.Tool, recorded.Arguments)
+	}
+}
+
+// Err returns the differences between the run and the recording: requests and
+// tool calls that do not match, and recorded responses or tool calls left
+func (p *Player) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	problems := append([]string(nil), p.problems...)
+	for _, model := range sortedModels(p.responses) {
+		if left := len(p.responses[model]); left > 0 {
+			problems = append(problems, fmt.Sprintf("%d recorded responses of model '%s' were not requested", left, model))
+		}
+	}
+	if len(p.toolCalls) > 0 {
+		problems = append(problems, fmt.Sprintf("%d recorded tool calls were not made (next: %s)", len(p.toolCalls), p.toolCalls[0].Tool))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the run does not match the recording:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// problemf records a difference between the run and the recording (p.mu held)
+func (p *Player) problemf(format string, args ...interface{}) {
+	p.problems = append(p.problems, fmt.Sprintf(format, args...))
+}
+
+// sortedModels returns the models of a map of responses in order
+func sortedModels(responses map[string][]Entry) []string {
+	models := make([]string, 0, len(responses))
+	for model := range responses {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// sameJSON compares two JSON documents, or two strings when they are not JSON
+func sameJSON(a, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,143 @@
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPlayer(t *testing.T) {
+	entries := []Entry{
+		{Type: EntryLLM, Model: "orchestrator", Method: http.MethodPost, Path: "/chat/completions", Status: http.StatusOK, ContentType: "text/event-stream", Response: "first"},
+		{Type: EntryToolCall, Tool: "disk_usage", Arguments: `{"path":"/var","depth":1}`},
+		{Type: EntryToolResult, Tool: "disk_usage", Content: "42K /var"},
+		{Type: EntryLLM, Model: "orchestrator", Method: http.MethodPost, Path: "/chat/completions", Status: http.StatusOK, Response: "second"},
+	}
+
+	// step is a request for a model (tool empty) or a tool call
+	type step struct {
+		model, path string
+		tool, args  string
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		wantBody  []string
+		wantErrs  []string
+		wantNoErr bool
+	}{
+		{
+			name: "same flow",
+			steps: []step{
+				{model: "orchestrator", path: "/chat/completions"},
+				{tool: "disk_usage", args: `{"depth":1, "path":"/var"}`},
+				{model: "orchestrator", path: "/chat/completions"},
+			},
+			wantBody:  []string{"first", "second"},
+			wantNoErr: true,
+		},
+		{
+			name: "other tool arguments",
+			steps: []step{
+				{model: "orchestrator", path: "/chat/completions"},
+				{tool: "disk_usage", args: `{"path":"/tmp"}`},
+				{model: "orchestrator", path: "/chat/completions"},
+			},
+			wantBody: []string{"first", "second"},
+			wantErrs: []string{`tool call disk_usage({"path":"/tmp"}) does not match the recorded disk_usage`},
+		},
+		{
+			name: "more requests and calls",
+			steps: []step{
+				{model: "orchestrator", path: "/chat/completions"},
+				{tool: "disk_usage", args: `{"path":"/var","depth":1}`},
+				{tool: "disk_usage", args: `{"path":"/home"}`},
+				{model: "orchestrator", path: "/chat/completions"},
+				{model: "orchestrator", path: "/chat/completions"},
+				{model: "tool-runner", path: "/chat/completions"},
+			},
+			wantBody: []string{"first", "second"},
+			wantErrs: []string{
+				`tool call disk_usage({"path":"/home"}) is not in the recording`,
+				"model 'orchestrator' has no recorded response left",
+				"model 'tool-runner' has no recorded response left",
+			},
+		},
+		{
+			name: "less requests and calls",
+			steps: []step{
+				{model: "orchestrator", path: "/v1/messages"},
+			},
+			wantBody: []string{"first"},
+			wantErrs: []string{
+				"request POST /v1/messages for model 'orchestrator' does not match the recorded POST /chat/completions",
+				"1 recorded responses of model 'orchestrator' were not requested",
+				"1 recorded tool calls were not made (next: disk_usage)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player := NewPlayer(entries)
+			var bodies []string
+			for _, s := range tt.steps {
+				if s.tool != "" {
+					player.ToolCall(s.tool, s.args)
+					continue
+				}
+				rec := httptest.NewRecorder()
+				player.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/models/"+s.model+s.path, strings.NewReader("{}")))
+				if rec.Code == http.StatusOK {
+					body, _ := io.ReadAll(rec.Body)
+					bodies = append(bodies, string(body))
+				}
+			}
+			if got, want := strings.Join(bodies, ","), strings.Join(tt.wantBody, ","); got != want {
+				t.Errorf("responses = %q, want %q", got, want)
+			}
+
+			err := player.Err()
+			if tt.wantNoErr {
+				if err != nil {
+					t.Errorf("Err() = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Err() = nil, want %v", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Err() = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlayerModelWithSlashes(t *testing.T) {
+	player := NewPlayer([]Entry{
+		{Type: EntryLLM, Model: "hf.co/x/y", Method: http.MethodPost, Path: "/chat/completions", Status: http.StatusOK, Response: "answer"},
+	})
+	endpoint, err := Serve(player)
+	if err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	defer func() { _ = endpoint.Close() }()
+
+	resp, err := http.Post(endpoint.URL("hf.co/x/y")+"/chat/completions", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "answer" {
+		t.Errorf("response = %d %q, want the recorded one", resp.StatusCode, body)
+	}
+	if err := player.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+// Package replay records the LLM exchanges and tool calls of agent runs, and
+// replays them from a local stand-in endpoint, so agent flows can be tested
+// offline and deterministically.
+//
+// Models reach the endpoint with a base URL per model (see Endpoint.URL). When
+// recording, requests are forwarded to the real API of the model; when
+// replaying, the recorded responses are served in order.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EntryType is the type of an entry of a recording
+type EntryType string
+
+const (
+	EntryLLM        EntryType = "llm"         // An LLM request and its response
+	EntryToolCall   EntryType = "tool_call"   // An agent calls a tool
+	EntryToolResult EntryType = "tool_result" // Result of a tool call
+)
+
+// Entry is a line of a recording
+type Entry struct {
+	Type EntryType `json:"type"`
+	Time time.Time `json:"time"`
+
+	// LLM exchanges (credentials are not recorded)
+	Model       string `json:"model,omitempty"`        // Name of the model in the configuration
+	Method      string `json:"method,omitempty"`       // HTTP method of the request
+	Path        string `json:"path,omitempty"`         // Path of the request, relative to the base URL of the model
+	Request     string `json:"request,omitempty"`      // Body of the request
+	Status      int    `json:"status,omitempty"`       // HTTP status of the response
+	ContentType string `json:"content_type,omitempty"` // Content type of the response (e.g. text/event-stream)
+	Response    string `json:"response,omitempty"`     // Body of the response, streamed responses included
+
+	// Tool calls and results
+	Agent      string `json:"agent,omitempty"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	Tool       string `json:"tool,omitempty"`
+	Arguments  string `json:"arguments,omitempty"` // Arguments (JSON) of tool calls
+	Content    string `json:"content,omitempty"`   // Result of tool calls
+}
+
+// Recorder writes the entries of a run to a JSONL file
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	err     error
+}
+
+// NewRecorder creates a recording file, replacing any previous one
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	return &Recorder{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Record appends an entry to the recording
+// Write errors are kept and returned by Close
+func (r *Recorder) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.encoder.Encode(entry)
+	}
+}
+
+// Close closes the recording, returning the first error writing it
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.file.Close(); r.err == nil && err != nil {
+		r.err = err
+	}
+	if r.err != nil {
+		return fmt.Errorf("failed to write recording: %w", r.err)
+	}
+	return nil
+}
+
+// Proxy returns a handler forwarding the requests of each model to its real
+// base URL (upstreams, by model name), and recording the exchanges
+func (r *Recorder) Proxy(upstreams map[string]string) (http.Handler, error) {
+	proxies := make(map[string]*httputil.ReverseProxy, len(upstreams))
+	for model, upstream := range upstreams {
+		target, err := url.Parse(upstream)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("invalid API URL '%s' for model '%s'", upstream, model)
+		}
+		proxies[model] = r.proxy(model, target)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		model, _, err := splitPath(req.URL.EscapedPath())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		proxy, ok := proxies[model]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown model '%s'", model), http.StatusNotFound)
+			return
+		}
+		// Keep the request body for the recording
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read request: %v", err), http.StatusBadRequest)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), requestBodyKey{}, body))
+		proxy.ServeHTTP(w, req)
+	}), nil
+}
+
+// proxy returns a reverse proxy to the base URL of a model, recording the exchanges
+func (r *Recorder) proxy(model string, target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			_, path, _ := splitPath(pr.In.URL.EscapedPath())
+			pr.Out.URL.Scheme = target.Scheme
+			pr.Out.URL.Host = target.Host
+			pr.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = target.Host
+			// Record plain responses, not compressed ones
+			pr.Out.Header.Del("Accept-Encoding")
+		},
+		FlushInterval: -1, // Stream the responses as they arrive
+		ModifyResponse: func(resp *http.Response) error {
+			req := resp.Request
+			body, _ := req.Context().Value(requestBodyKey{}).([]byte)
+			entry := Entry{
+				Type:        EntryLLM,
+				Model:       model,
+				Method:      req.Method,
+				Path:        strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(target.Path, "/")),
+				Request:     string(body),
+				Status:      resp.StatusCode,
+				ContentType: resp.Header.Get("Content-Type"),
+			}
+			resp.Body = &recordingBody{ReadCloser: resp.Body, done: func(response []byte) {
+				entry.Response = string(response)
+				r.Record(entry)
+			}}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("failed to reach the API of model '%s': %v", model, err), http.StatusBadGateway)
+		},
+	}
+}
+
+// requestBodyKey is the context key of the body of the requests being recorded
+type requestBodyKey struct{}
+
+// recordingBody copies a response body as it is read, and passes the copy to
+// done when it is closed
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func([]byte)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+	return err
+}
+
+// Load reads the entries of a recording
+func Load(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []Entry
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var entry Entry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return nil, fmt.Errorf("invalid recording %s, line %d: %w", path, line, err)
+			}
+			entries = append(entries, entry)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %w", err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: " + string(body) + "\n\n"))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	if _, err := recorder.Proxy(map[string]string{"bad": "localhost"}); err == nil {
+		t.Errorf("Proxy() with an invalid URL: expected an error")
+	}
+	proxy, err := recorder.Proxy(map[string]string{"my model": upstream.URL + "/v1/", "hf.co/x/y": upstream.URL + "/v1"})
+	if err != nil {
+		t.Fatalf("Proxy() error = %v", err)
+	}
+	endpoint, err := Serve(proxy)
+	if err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	defer func() { _ = endpoint.Close() }()
+
+	post := func(url string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"model":"gpt-4o"}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := post(endpoint.URL("my model") + "/chat/completions")
+	if status != http.StatusOK || body != "data: {\"model\":\"gpt-4o\"}\n\n" {
+		t.Errorf("proxied response = %d %q, want the upstream response", status, body)
+	}
+	// Model names can have slashes
+	if status, _ := post(endpoint.URL("hf.co/x/y") + "/chat/completions"); status != http.StatusOK {
+		t.Errorf("request for a model with slashes = %d, want %d", status, http.StatusOK)
+	}
+	if status, _ := post(endpoint.URL("other") + "/chat/completions"); status != http.StatusNotFound {
+		t.Errorf("request for an unknown model = %d, want %d", status, http.StatusNotFound)
+	}
+
+	recorder.Record(Entry{Type: EntryToolCall, Tool: "disk_usage", Arguments: `{"path":"/var"}`})
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	entries, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Load() = %d entries, want 3", len(entries))
+	}
+	got := entries[0]
+	want := Entry{
+		Type: EntryLLM, Time: got.Time, Model: "my model", Method: http.MethodPost, Path: "/chat/completions",
+		Request: `{"model":"gpt-4o"}`, Status: http.StatusOK, ContentType: "text/event-stream", Response: body,
+	}
+	if got != want {
+		t.Errorf("recorded LLM exchange = %+v, want %+v", got, want)
+	}
+	if got.Time.IsZero() {
+		t.Errorf("recorded LLM exchange has no time")
+	}
+	if entries[1].Model != "hf.co/x/y" || entries[1].Path != "/chat/completions" {
+		t.Errorf("recorded LLM exchange of the model with slashes = %+v", entries[1])
+	}
+	if entries[2].Type != EntryToolCall || entries[2].Tool != "disk_usage" {
+		t.Errorf("recorded tool call = %+v", entries[2])
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		wantModel string
+		wantPath  string
+		wantErr   bool
+	}{
+		{path: "/models/gpt-4o/chat/completions", wantModel: "gpt-4o", wantPath: "/chat/completions"},
+		{path: "/models/my%20model/v1/messages", wantModel: "my model", wantPath: "/v1/messages"},
+		{path: "/models/gpt-4o", wantModel: "gpt-4o", wantPath: "/"},
+		{path: "/models/hf.co%2Fx%2Fy/chat/completions", wantModel: "hf.co/x/y", wantPath: "/chat/completions"},
+		{path: "/models/gpt-4o/v1/a%2Fb", wantModel: "gpt-4o", wantPath: "/v1/a/b"},
+		{path: "/chat/completions", wantErr: true},
+		{path: "/models//chat/completions", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			model, path, err := splitPath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("splitPath() = %q, %q, expected an error", model, path)
+				}
+				return
+			}
+			if err != nil || model != tt.wantModel || path != tt.wantPath {
+				t.Errorf("splitPath() = %q, %q, %v, want %q, %q", model, path, err, tt.wantModel, tt.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/rag"
+)
+
+const (
+	// askToolName is the MCP tool delegating a task to the agent
+	askToolName = "ask"
+
+	// ragSearchToolPrefix is the prefix of the MCP tools searching RAG sources
+	ragSearchToolPrefix = "rag_search_"
+)
+
+// invalidToolNameChars matches the characters not allowed in MCP tool names
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// AskArgs are the arguments of the ask tool
+type AskArgs struct {
+	Prompt string   `json:"prompt" jsonschema:"The task or question for the agent, with all the context it needs"`
+	RAG    []string `json:"rag,omitempty" jsonschema:"Names of the RAG sources the agent can search (default: those of the server)"`
+	Tools  string   `json:"tools,omitempty" jsonschema:"Tools file to use, by name (default: the first one of the server)"`
+}
+
+// RAGSearchArgs are the arguments of the rag_search tools
+type RAGSearchArgs struct {
+	Query  string `json:"query" jsonschema:"Keywords or question to search for"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"Maximum number of results (default: the limit of the source)"`
+	Filter string `json:"filter,omitempty" jsonschema:"Only search the documents with these tags or properties, e.g. tag=prod,service=payments"`
+}
+
+// MCPServer returns an MCP server exposing the agent as tools: ask runs the
+// agent once (approving its tool calls) and returns its answer, and a
+// rag_search_<source> tool searches each RAG source locally, without an LLM.
+func (s *Server) MCPServer(version string) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "don", Version: version}, &mcp.ServerOptions{
+		Instructions: "Don is an AI agent with command-line tools and knowledge sources. " +
+			"Use 'ask' to delegate multi-step investigations, and the rag_search tools to look up documentation.",
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        askToolName,
+		Description: s.askDescription(),
+	}, s.handleAsk)
+
+	// Searches share the index files of the sources, so they run one at a time
+	var searchMu sync.Mutex
+	names := make([]string, 0, len(s.config.RAG))
+	for name := range s.config.RAG {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		source := s.config.RAG[name]
+		description := fmt.Sprintf("Search the '%s' knowledge source and return the most relevant passages with their sources.", name)
+		if source.Description != "" {
+			description += " " + source.Description
+		}
+		mcp.AddTool(server, &mcp.Tool{
+			Name:        ragSearchToolPrefix + invalidToolNameChars.ReplaceAllString(name, "_"),
+			Description: description,
+		}, func(ctx context.Context, _ *mcp.CallToolRequest, args RAGSearchArgs) (*mcp.CallToolResult, any, error) {
+			searchMu.Lock()
+			defer searchMu.Unlock()
+			return s.handleRAGSearch(ctx, name, source, args)
+		})
+	}
+	return server
+}
+
+// ServeMCP serves the MCP server over a transport (e.g. stdio) until the client
+// disconnects or the context is canceled
+func (s *Server) ServeMCP(ctx context.Context, version string, transport mcp.Transport) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	s.logger.Info("MCP server running (RAG sources: %d)", len(s.config.RAG))
+	if err := s.MCPServer(version).Run(ctx, transport); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// askDescription describes the ask tool, with the tools files and RAG sources available
+func (s *Server) askDescription() string {
+	var b strings.Builder
+	b.WriteString("Ask the Don agent to perform a task or answer a question. The agent plans the work, " +
+		"runs command-line tools and searches its knowledge sources as needed, and returns its final answer.")
+	if len(s.config.ToolsFiles) > 1 {
+		tools := make([]string, len(s.config.ToolsFiles))
+		for i, path := range s.config.ToolsFiles {
+			tools[i] = modelName(path)
+		}
+		fmt.Fprintf(&b, " Available tools files: %s.", strings.Join(tools, ", "))
+	}
+	if len(s.config.RAG) > 0 {
+		names := make([]string, 0, len(s.config.RAG))
+		for name := range s.config.RAG {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&b, " Available RAG sources: %s.", strings.Join(names, ", "))
+	}
+	return b.String()
+}
+
+// handleAsk runs the agent once with a prompt, and returns its answer
+func (s *Server) handleAsk(ctx context.Context, _ *mcp.CallToolRequest, args AskArgs) (*mcp.CallToolResult, any, error) {
+	config, err := s.runConfig(RunRequest{Prompt: args.Prompt, Tools: args.Tools, RAG: args.RAG, Once: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	config.AutoApprove = true
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := make(chan agent.Event)
+	go func() {
+		if err := s.runAgent(ctx, config, nil, events, nil); err != nil && !errors.Is(err, context.Canceled) {
+			s.logger.Warn("MCP ask failed: %v", err)
+		}
+	}()
+	s.logger.Info("MCP ask started (tools: %s, RAG sources: %v)", config.ToolsFile, config.RAGSources)
+
+	completion := &chatCompletion{usage: make(map[string]agent.EventUsage)}
+	message, failure := completion.collect(events)
+	if failure != "" {
+		return nil, nil, fmt.Errorf("agent failed: %s", failure)
+	}
+	return textResult(string(message.Content)), nil, nil
+}
+
+// handleRAGSearch searches a RAG source with the local retrieval engine
+func (s *Server) handleRAGSearch(ctx context.Context, name string, source agent.RAGSourceConfig, args RAGSearchArgs) (*mcp.CallToolResult, any, error) {
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, nil, fmt.Errorf("query is required")
+	}
+	filter, err := rag.ParseMetadataFilter(args.Filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	processed, err := agent.ProcessRAGSources(ctx, map[string]agent.RAGSourceConfig{name: source}, s.config.Agent.RAGOptions, s.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := agent.SearchRAGSource(ctx, name, processed[name], args.Query, agent.RAGSearchOptions{
+		Limit:  args.Limit,
+		Filter: filter,
+	}, s.logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("search failed: %w", err)
+	}
+	return textResult(formatRAGResults(name, args.Query, results)), nil, nil
+}
+
+// formatRAGResults describes the results of a RAG search for an LLM
+func formatRAGResults(name, query string, results []rag.SearchResult) string {
+	if len(results) == 0 {
+		return fmt.Sprintf("No results in '%s' for: %s", name, query)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d results in '%s' for: %s\n", len(results), name, query)
+	for i, result := range results {
+		fmt.Fprintf(&b, "\n[%d] %s (score %.4f)\n", i+1, result.Chunk.Location(), result.Score)
+		b.WriteString(strings.TrimSpace(result.Chunk.Text))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// textResult returns a tool result with some text
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}
+}
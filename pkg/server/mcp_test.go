@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/common"
+	"github.com/inercia/don/pkg/rag"
+)
+
+// connectMCP serves the MCP server of a server in memory, and returns a client session
+func connectMCP(t *testing.T, s *Server) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := s.MCPServer("test").Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect the server: %v", err)
+	}
+	t.Cleanup(func() { _ = serverSession.Close() })
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect the client: %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+	return session
+}
+
+// callTool calls an MCP tool, returning its text and whether it failed
+func callTool(t *testing.T, session *mcp.ClientSession, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("CallTool(%s) error = %v", name, err)
+	}
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(*mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), result.IsError
+}
+
+func TestMCPServer(t *testing.T) {
+	t.Setenv(rag.CacheDirEnv, t.TempDir())
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	dir := t.TempDir()
+	docs := map[string]string{
+		"restart.md": "To restart the payments service, run the deploy job again.",
+		"install.md": "Install the agent with go install.",
+	}
+	for name, content := range docs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write document: %v", err)
+		}
+	}
+
+	s := New(Config{
+		Agent:      agent.AgentConfig{ToolsFile: "/tools/default.yaml"},
+		ToolsFiles: []string{"/tools/default.yaml", "/tools/k8s.yaml"},
+		RAG: map[string]agent.RAGSourceConfig{
+			"run books": {
+				Description: "Operations runbooks.",
+				Docs:        agent.RAGDocPaths(dir),
+				Strategies:  []agent.RAGStrategyConfig{{Type: "bm25"}},
+			},
+		},
+	}, logger)
+	s.runAgent = fakeChatRun
+	session := connectMCP(t, s)
+
+	tools, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+		if tool.Name == askToolName && !strings.Contains(tool.Description, "default, k8s") {
+			t.Errorf("ask description = %q, want the tools files", tool.Description)
+		}
+	}
+	if strings.Join(names, ",") != "ask,rag_search_run_books" {
+		t.Errorf("tools = %v, want ask and a search tool per RAG source", names)
+	}
+
+	t.Run("ask", func(t *testing.T) {
+		text, isError := callTool(t, session, askToolName, map[string]any{"prompt": "disk?", "tools": "k8s"})
+		if isError || text != "disk? (/tools/k8s.yaml, )" {
+			t.Errorf("ask = %q (error: %v), want the answer of the root agent", text, isError)
+		}
+		if text, isError := callTool(t, session, askToolName, map[string]any{"prompt": "disk?", "rag": []string{"wiki"}}); !isError {
+			t.Errorf("ask with an unknown RAG source = %q, want an error", text)
+		}
+		if text, isError := callTool(t, session, askToolName, map[string]any{"prompt": "fail"}); !isError || !strings.Contains(text, "model unavailable") {
+			t.Errorf("ask with a failing agent = %q, want the error", text)
+		}
+	})
+
+	t.Run("rag_search", func(t *testing.T) {
+		text, isError := callTool(t, session, "rag_search_run_books", map[string]any{"query": "restart payments", "limit": 1})
+		if isError || !strings.Contains(text, "Found 1 results") || !strings.Contains(text, "restart.md") {
+			t.Errorf("rag_search = %q (error: %v), want the restart runbook", text, isError)
+		}
+		if text, isError := callTool(t, session, "rag_search_run_books", map[string]any{"query": "restart", "filter": "prod"}); !isError {
+			t.Errorf("rag_search with an invalid filter = %q, want an error", text)
+		}
+	})
+}
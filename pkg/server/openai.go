@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/inercia/don/pkg/agent"
+)
+
+// DefaultModelName is the model of the OpenAI-compatible API using the default tools file
+const DefaultModelName = "don"
+
+// rootAgentName is the agent whose messages make the answer of a chat completion
+const rootAgentName = "root"
+
+// ChatCompletionRequest is the body of an OpenAI chat completion request.
+// Sampling parameters (temperature, max_tokens...) are accepted and ignored.
+type ChatCompletionRequest struct {
+	Model         string             `json:"model"`
+	Messages      []ChatMessage      `json:"messages"`
+	Stream        bool               `json:"stream,omitempty"`
+	StreamOptions *ChatStreamOptions `json:"stream_options,omitempty"`
+	Annotations   *bool              `json:"annotations,omitempty"` // Report the tool activity (default: server setting)
+}
+
+// ChatStreamOptions holds the options of streamed chat completions
+type ChatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+// ChatMessage is a message of a chat completion
+type ChatMessage struct {
+	Role        string           `json:"role,omitempty"`
+	Content     ChatContent      `json:"content"`
+	Annotations []ChatAnnotation `json:"annotations,omitempty"`
+}
+
+// ChatContent is the text of a message, given by clients as a string or as a
+// list of parts (only the text parts are kept)
+type ChatContent string
+
+// UnmarshalJSON accepts a string, a list of content parts or null
+func (c *ChatContent) UnmarshalJSON(data []byte) error {
+	var text *string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if text != nil {
+			*c = ChatContent(*text)
+		}
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or a list of parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*c = ChatContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// ChatAnnotation reports the activity of a tool while answering
+type ChatAnnotation struct {
+	Type      string `json:"type"` // "tool_call" or "tool_result"
+	Agent     string `json:"agent,omitempty"`
+	Tool      string `json:"tool"`
+	Arguments string `json:"arguments,omitempty"` // Arguments (JSON) of tool calls
+	Content   string `json:"content,omitempty"`   // Output of tool results
+}
+
+// ChatCompletion is the response to a chat completion request, or a chunk of it when streamed
+type ChatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   *ChatUsage   `json:"usage,omitempty"`
+}
+
+// ChatChoice is the answer of a chat completion
+type ChatChoice struct {
+	Index        int          `json:"index"`
+	Message      *ChatMessage `json:"message,omitempty"` // Whole answer
+	Delta        *ChatMessage `json:"delta,omitempty"`   // Piece of a streamed answer
+	FinishReason *string      `json:"finish_reason"`
+}
+
+// ChatUsage holds the tokens used by a chat completion
+type ChatUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// ModelList is the response listing the models of the OpenAI-compatible API
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+// Model is a model of the OpenAI-compatible API, i.e. a tools file of the server
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// openAIError is the body of the error responses of the OpenAI-compatible API
+type openAIError struct {
+	Error openAIErrorDetail `json:"error"`
+}
+
+type openAIErrorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// handleModels lists the models (tools files): GET /v1/models
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	models := ModelList{Object: "list", Data: []Model{{ID: DefaultModelName, Object: "model", OwnedBy: DefaultModelName}}}
+	for _, path := range s.config.ToolsFiles {
+		models.Data = append(models.Data, Model{ID: modelName(path), Object: "model", OwnedBy: DefaultModelName})
+	}
+	writeJSON(w, http.StatusOK, models)
+}
+
+// handleChatCompletions answers a chat completion with a one-shot run: POST
+// /v1/chat/completions. Nobody can answer the tool call confirmations, so tool
+// calls are rejected unless the server approves them automatically.
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	config, err := s.chatConfig(req)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := newRunID()
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	completion := &chatCompletion{
+		ChatCompletion: ChatCompletion{
+			ID:      "chatcmpl-" + strings.TrimPrefix(id, "run_"),
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+		},
+		annotations: s.config.Annotations,
+		usage:       make(map[string]agent.EventUsage),
+	}
+	if req.Annotations != nil {
+		completion.annotations = *req.Annotations
+	}
+	if completion.Model == "" {
+		completion.Model = DefaultModelName
+	}
+
+	if status, err := s.reserveRun(); err != nil {
+		writeOpenAIError(w, status, err.Error())
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events := make(chan agent.Event)
+	go func() {
+		defer s.releaseRun()
+		if err := s.runAgent(ctx, config, nil, events, nil); err != nil && !errors.Is(err, context.Canceled) {
+			s.logger.Warn("Chat completion %s failed: %v", completion.ID, err)
+		}
+	}()
+	s.logger.Info("Chat completion %s started (tools: %s)", completion.ID, config.ToolsFile)
+
+	if req.Stream {
+		s.streamChatCompletion(w, completion, events, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+		return
+	}
+
+	message, failure := completion.collect(events)
+	if failure != "" {
+		writeOpenAIError(w, http.StatusBadGateway, failure)
+		return
+	}
+
+	response := completion.ChatCompletion
+	response.Object = "chat.completion"
+	response.Choices = []ChatChoice{{Message: message, FinishReason: finishReason("stop")}}
+	response.Usage = completion.totalUsage()
+	writeJSON(w, http.StatusOK, response)
+}
+
+// streamChatCompletion sends the answer of a run as chat completion chunks over Server-Sent Events
+func (s *Server) streamChatCompletion(w http.ResponseWriter, completion *chatCompletion, events <-chan agent.Event, includeUsage bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			s.logger.Error("Failed to encode chunk of chat completion %s: %v", completion.ID, err)
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	send(completion.chunk(&ChatMessage{Role: "assistant"}, nil))
+	failure := ""
+	for event := range events {
+		if event.Type == agent.EventDone {
+			failure = event.Content
+		}
+		if delta := completion.delta(event); delta != nil {
+			send(completion.chunk(delta, nil))
+		}
+	}
+	if failure != "" {
+		send(openAIError{Error: openAIErrorDetail{Message: failure, Type: "server_error"}})
+	} else {
+		send(completion.chunk(&ChatMessage{}, finishReason("stop")))
+		if includeUsage {
+			chunk := completion.chunk(nil, nil)
+			chunk.Choices = []ChatChoice{}
+			chunk.Usage = completion.totalUsage()
+			send(chunk)
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// chatConfig builds the agent configuration of a chat completion. The last
+// message is the prompt, and the system messages and the rest of the
+// conversation are given as context: clients cannot change the system prompts
+// of the server.
+func (s *Server) chatConfig(req ChatCompletionRequest) (agent.AgentConfig, error) {
+	if len(req.Messages) == 0 {
+		return agent.AgentConfig{}, fmt.Errorf("messages are required")
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "user" {
+		return agent.AgentConfig{}, fmt.Errorf("the last message must be from the user (got '%s')", last.Role)
+	}
+
+	var instructions []string
+	var history strings.Builder
+	for _, message := range req.Messages[:len(req.Messages)-1] {
+		switch message.Role {
+		case "system", "developer":
+			instructions = append(instructions, string(message.Content))
+		case "user", "assistant":
+			if message.Content != "" {
+				fmt.Fprintf(&history, "%s: %s\n\n", message.Role, message.Content)
+			}
+		default:
+			// Tool messages belong to the tool calls of the client, not to Don's
+		}
+	}
+	prompt := string(last.Content)
+	if history.Len() > 0 {
+		prompt = fmt.Sprintf("Conversation so far:\n\n%s---\n\n%s", history.String(), prompt)
+	}
+	if len(instructions) > 0 {
+		prompt = fmt.Sprintf("Instructions from the client:\n\n%s\n\n---\n\n%s", strings.Join(instructions, "\n\n"), prompt)
+	}
+
+	tools := ""
+	if req.Model != "" && req.Model != DefaultModelName {
+		if _, err := s.toolsFile(req.Model); err != nil {
+			return agent.AgentConfig{}, fmt.Errorf("model '%s' not found (see /v1/models)", req.Model)
+		}
+		tools = req.Model
+	}
+	return s.runConfig(RunRequest{Prompt: prompt, Tools: tools, Once: true})
+}
+
+// chatCompletion turns the events of a run into a chat completion
+type chatCompletion struct {
+	ChatCompletion
+	annotations bool                        // Report the tool activity
+	usage       map[string]agent.EventUsage // Last token usage of each agent
+}
+
+// delta returns the part of the answer in an event, if any
+func (c *chatCompletion) delta(event agent.Event) *ChatMessage {
+	switch event.Type {
+	case agent.EventMessage:
+		if event.Agent == rootAgentName {
+			return &ChatMessage{Content: ChatContent(event.Content)}
+		}
+	case agent.EventSources:
+		return &ChatMessage{Content: ChatContent("\n\n" + event.Content)}
+	case agent.EventToolCall, agent.EventToolResult:
+		if c.annotations {
+			return &ChatMessage{Annotations: []ChatAnnotation{{
+				Type:      string(event.Type),
+				Agent:     event.Agent,
+				Tool:      event.Tool,
+				Arguments: event.Arguments,
+				Content:   event.Content,
+			}}}
+		}
+	case agent.EventTokenUsage:
+		if event.Usage != nil {
+			c.usage[event.Agent] = *event.Usage
+		}
+	}
+	return nil
+}
+
+// collect returns the whole answer of a run, or the error of a failed run
+func (c *chatCompletion) collect(events <-chan agent.Event) (*ChatMessage, string) {
+	message := &ChatMessage{Role: "assistant"}
+	var content strings.Builder
+	failure := ""
+	for event := range events {
+		if event.Type == agent.EventDone {
+			failure = event.Content
+		}
+		if delta := c.delta(event); delta != nil {
+			content.WriteString(string(delta.Content))
+			message.Annotations = append(message.Annotations, delta.Annotations...)
+		}
+	}
+	message.Content = ChatContent(content.String())
+	return message, failure
+}
+
+// chunk returns a chunk of a streamed chat completion
+func (c *chatCompletion) chunk(delta *ChatMessage, finish *string) ChatCompletion {
+	chunk := c.ChatCompletion
+	chunk.Object = "chat.completion.chunk"
+	chunk.Choices = []ChatChoice{{Delta: delta, FinishReason: finish}}
+	return chunk
+}
+
+// totalUsage returns the tokens used by all the agents
+func (c *chatCompletion) totalUsage() *ChatUsage {
+	usage := &ChatUsage{}
+	for _, u := range c.usage {
+		usage.PromptTokens += u.InputTokens
+		usage.CompletionTokens += u.OutputTokens
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// modelName returns the model name of a tools file: its name without extension
+func modelName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func finishReason(reason string) *string {
+	return &reason
+}
+
+// writeOpenAIError writes an error response in the format of the OpenAI API
+func writeOpenAIError(w http.ResponseWriter, status int, message string) {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	writeJSON(w, status, openAIError{Error: openAIErrorDetail{Message: message, Type: errType}})
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/inercia/don/pkg/agent"
+)
+
+// fakeChatRun is a one-shot agent calling a tool through a sub-agent, and
+// answering with its prompt, the tools file and its system prompts
+func fakeChatRun(ctx context.Context, config agent.AgentConfig, userInput <-chan string, events chan<- agent.Event, approvals <-chan agent.ToolApproval) error {
+	defer close(events)
+	if !config.Once || approvals != nil {
+		events <- agent.Event{Type: agent.EventDone, Content: "chat completions must run once without approvals"}
+		return nil
+	}
+	if strings.Contains(config.UserPrompt, "fail") {
+		events <- agent.Event{Type: agent.EventDone, Content: "model unavailable"}
+		return nil
+	}
+	events <- agent.Event{Type: agent.EventStreamStarted, Agent: "root"}
+	events <- agent.Event{Type: agent.EventToolCall, Agent: "tool-runner", Tool: "disk_usage", Arguments: `{"path":"/var"}`}
+	events <- agent.Event{Type: agent.EventToolResult, Agent: "tool-runner", Tool: "disk_usage", Content: "12G"}
+	events <- agent.Event{Type: agent.EventMessage, Agent: "tool-runner", Content: "internal notes"}
+	events <- agent.Event{Type: agent.EventMessage, Agent: "root", Content: config.UserPrompt}
+	events <- agent.Event{Type: agent.EventMessage, Agent: "root", Content: " (" + config.ToolsFile + ", " + strings.Join(config.ModelConfig.Prompts.System, ";") + ")"}
+	events <- agent.Event{Type: agent.EventTokenUsage, Agent: "root", Usage: &agent.EventUsage{InputTokens: 10, OutputTokens: 5}}
+	events <- agent.Event{Type: agent.EventTokenUsage, Agent: "tool-runner", Usage: &agent.EventUsage{InputTokens: 3, OutputTokens: 2}}
+	events <- agent.Event{Type: agent.EventDone}
+	return nil
+}
+
+func TestChatCompletions(t *testing.T) {
+	ts := newTestServer(t, fakeChatRun)
+
+	tests := []struct {
+		name            string
+		body            string
+		wantContent     string
+		wantAnnotations int
+	}{
+		{
+			name:        "default model",
+			body:        `{"model": "don", "messages": [{"role": "user", "content": "disk?"}], "temperature": 0.2}`,
+			wantContent: "disk? (/tools/default.yaml, )",
+		},
+		{
+			name:        "tools file as model, system prompt and history",
+			body:        `{"model": "k8s", "messages": [{"role": "system", "content": "be brief"}, {"role": "user", "content": "hi"}, {"role": "assistant", "content": "hello"}, {"role": "user", "content": [{"type": "text", "text": "disk?"}]}]}`,
+			wantContent: "Instructions from the client:\n\nbe brief\n\n---\n\nConversation so far:\n\nuser: hi\n\nassistant: hello\n\n---\n\ndisk? (/tools/k8s.yaml, )",
+		},
+		{
+			name:            "annotations",
+			body:            `{"messages": [{"role": "user", "content": "disk?"}], "annotations": true}`,
+			wantContent:     "disk? (/tools/default.yaml, )",
+			wantAnnotations: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response ChatCompletion
+			if status := post(t, ts.URL+"/v1/chat/completions", tt.body, &response); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if response.Object != "chat.completion" || !strings.HasPrefix(response.ID, "chatcmpl-") || len(response.Choices) != 1 {
+				t.Fatalf("response = %+v, want a chat completion with one choice", response)
+			}
+			message := response.Choices[0].Message
+			if message == nil || message.Role != "assistant" || string(message.Content) != tt.wantContent {
+				t.Errorf("message = %+v, want the assistant answering %q", message, tt.wantContent)
+			}
+			if len(message.Annotations) != tt.wantAnnotations {
+				t.Errorf("annotations = %+v, want %d", message.Annotations, tt.wantAnnotations)
+			}
+			if response.Usage == nil || response.Usage.PromptTokens != 13 || response.Usage.TotalTokens != 20 {
+				t.Errorf("usage = %+v, want the tokens of all the agents", response.Usage)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsAutoApprove(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoApprove bool
+	}{
+		{name: "tool calls rejected"},
+		{name: "tool calls approved by the server", autoApprove: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			autoApprove := make(chan bool, 1)
+			ts := newTestServer(t, func(ctx context.Context, config agent.AgentConfig, userInput <-chan string, events chan<- agent.Event, approvals <-chan agent.ToolApproval) error {
+				autoApprove <- config.AutoApprove
+				return fakeChatRun(ctx, config, userInput, events, approvals)
+			}, func(c *Config) { c.AutoApprove = tt.autoApprove })
+
+			if status := post(t, ts.URL+"/v1/chat/completions", `{"messages": [{"role": "user", "content": "disk?"}]}`, nil); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if got := <-autoApprove; got != tt.autoApprove {
+				t.Errorf("AutoApprove = %v, want %v", got, tt.autoApprove)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	ts := newTestServer(t, fakeChatRun)
+
+	resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(
+		`{"model": "don", "stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "disk?"}]}`))
+	if err != nil {
+		t.Fatalf("POST error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Content-Type = %s, want an event stream", resp.Header.Get("Content-Type"))
+	}
+
+	var content strings.Builder
+	var chunks []ChatCompletion
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk ChatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("failed to decode chunk: %v", err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("chunk object = %s, want chat.completion.chunk", chunk.Object)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(string(choice.Delta.Content))
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if !done {
+		t.Error("stream did not end with [DONE]")
+	}
+	if want := "disk? (/tools/default.yaml, )"; content.String() != want {
+		t.Errorf("streamed content = %q, want %q", content.String(), want)
+	}
+	if len(chunks) < 3 || chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Fatalf("chunks = %+v, want the role first", chunks)
+	}
+	finish := chunks[len(chunks)-2].Choices[0].FinishReason
+	if finish == nil || *finish != "stop" {
+		t.Errorf("finish reason = %v, want stop", finish)
+	}
+	if usage := chunks[len(chunks)-1].Usage; usage == nil || usage.TotalTokens != 20 {
+		t.Errorf("last chunk usage = %+v, want the usage", usage)
+	}
+}
+
+func TestChatCompletionsErrors(t *testing.T) {
+	ts := newTestServer(t, fakeChatRun)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"no messages", `{"model": "don", "messages": []}`, http.StatusBadRequest},
+		{"last message not from the user", `{"messages": [{"role": "user", "content": "hi"}, {"role": "assistant", "content": "hello"}]}`, http.StatusBadRequest},
+		{"unknown model", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`, http.StatusBadRequest},
+		{"invalid content", `{"messages": [{"role": "user", "content": 42}]}`, http.StatusBadRequest},
+		{"failed run", `{"messages": [{"role": "user", "content": "fail"}]}`, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body openAIError
+			if status := post(t, ts.URL+"/v1/chat/completions", tt.body, &body); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if body.Error.Message == "" || body.Error.Type == "" {
+				t.Errorf("error = %+v, want an OpenAI error", body)
+			}
+		})
+	}
+}
+
+func TestModels(t *testing.T) {
+	ts := newTestServer(t, fakeChatRun)
+
+	resp, err := http.Get(ts.URL + "/v1/models")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+	var models ModelList
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		t.Fatalf("failed to decode models: %v", err)
+	}
+	var ids []string
+	for _, model := range models.Data {
+		ids = append(ids, model.ID)
+	}
+	if strings.Join(ids, ",") != "don,default,k8s" {
+		t.Errorf("models = %v, want don and the tools files", ids)
+	}
+}
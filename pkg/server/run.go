@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/inercia/don/pkg/agent"
+)
+
+// RunStatus is the status of a run
+type RunStatus string
+
+const (
+	RunRunning         RunStatus = "running"          // The agent is working
+	RunWaitingInput    RunStatus = "waiting_input"    // The conversation waits for a message
+	RunWaitingApproval RunStatus = "waiting_approval" // A tool call waits for an approval
+	RunDone            RunStatus = "done"             // The run ended
+)
+
+// RunInfo describes a run in the API responses
+type RunInfo struct {
+	ID        string    `json:"id"`
+	Status    RunStatus `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	Events    int       `json:"events"`          // Number of events so far
+	Error     string    `json:"error,omitempty"` // Error of a failed run
+}
+
+// run is an agent run with its own runtime, and the events it produced
+type run struct {
+	id        string
+	createdAt time.Time
+	cancel    context.CancelFunc
+	input     chan string             // Messages continuing the conversation
+	approvals chan agent.ToolApproval // Answers to tool call confirmations
+	idle      time.Duration           // How long the run waits for a message or an approval (forever when 0)
+
+	mu        sync.Mutex
+	status    RunStatus
+	err       string
+	events    []agent.Event
+	updated   chan struct{} // Closed (and replaced) when events are added or the status changes
+	idleTimer *time.Timer   // Stops the run when it waits for too long
+}
+
+// newRun creates a run, not started yet
+func newRun(id string, cancel context.CancelFunc, idle time.Duration) *run {
+	return &run{
+		id:        id,
+		createdAt: time.Now(),
+		cancel:    cancel,
+		input:     make(chan string, 1),
+		approvals: make(chan agent.ToolApproval, 1),
+		idle:      idle,
+		status:    RunRunning,
+		updated:   make(chan struct{}),
+	}
+}
+
+// record adds the events of the agent to the run, updating its status, until
+// the agent closes the channel
+func (r *run) record(events <-chan agent.Event) {
+	for event := range events {
+		r.mu.Lock()
+		r.events = append(r.events, event)
+		switch event.Type {
+		case agent.EventWaitingInput:
+			r.status = RunWaitingInput
+			r.startIdleTimer()
+		case agent.EventToolConfirmation:
+			r.status = RunWaitingApproval
+			r.startIdleTimer()
+		case agent.EventDone:
+			r.status = RunDone
+			r.stopIdleTimer()
+			if r.err == "" {
+				r.err = event.Content
+			}
+		}
+		r.notify()
+		r.mu.Unlock()
+	}
+
+	// The run ended without a done event (e.g. the agent panicked)
+	r.mu.Lock()
+	if r.status != RunDone {
+		r.status = RunDone
+		r.stopIdleTimer()
+		r.notify()
+	}
+	r.mu.Unlock()
+}
+
+// startIdleTimer stops the run if it still waits after the idle timeout, with
+// the lock held
+func (r *run) startIdleTimer() {
+	if r.idle <= 0 {
+		return
+	}
+	r.stopIdleTimer()
+	var timer *time.Timer
+	timer = time.AfterFunc(r.idle, func() {
+		r.mu.Lock()
+		if r.idleTimer != timer || r.err != "" {
+			// Stopped while firing (the run got what it waited for), or already stopped
+			r.mu.Unlock()
+			return
+		}
+		r.err = fmt.Sprintf("run stopped after waiting for %s (status: %s)", r.idle, r.status)
+		r.idleTimer = nil
+		r.mu.Unlock()
+		r.cancel()
+	})
+	r.idleTimer = timer
+}
+
+// stopIdleTimer stops the idle timer, if any, with the lock held
+func (r *run) stopIdleTimer() {
+	if r.idleTimer != nil {
+		r.idleTimer.Stop()
+		r.idleTimer = nil
+	}
+}
+
+// notify wakes up the readers of the events, with the lock held
+func (r *run) notify() {
+	close(r.updated)
+	r.updated = make(chan struct{})
+}
+
+// info returns the description of the run
+func (r *run) info() RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RunInfo{ID: r.id, Status: r.status, CreatedAt: r.createdAt, Events: len(r.events), Error: r.err}
+}
+
+// eventsSince returns the events after the first n, a channel closed when there
+// are new ones, and whether the run ended
+func (r *run) eventsSince(n int) ([]agent.Event, <-chan struct{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []agent.Event
+	if n < len(r.events) {
+		events = append(events, r.events[n:]...)
+	}
+	return events, r.updated, r.status == RunDone
+}
+
+// send continues the conversation with a message, if the run waits for one
+func (r *run) send(message string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != RunWaitingInput {
+		return false
+	}
+	r.input <- message
+	r.status = RunRunning
+	r.stopIdleTimer()
+	r.notify()
+	return true
+}
+
+// approve answers the pending tool call confirmation, if any
+func (r *run) approve(approval agent.ToolApproval) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != RunWaitingApproval {
+		return false
+	}
+	r.approvals <- approval
+	r.status = RunRunning
+	r.stopIdleTimer()
+	r.notify()
+	return true
+}
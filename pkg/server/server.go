@@ -0,0 +1,487 @@
+// Package server provides an HTTP API to run the agent programmatically.
+// Each run has its own agent and cagent runtime; its events are streamed over
+// Server-Sent Events, and the conversation continues with new messages. An
+// OpenAI-compatible chat completions API is also served (see openai.go), and
+// the agent can be exposed as an MCP server too (see mcp.go).
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/common"
+)
+
+const (
+	// DefaultRetention is how long finished runs are kept by default
+	DefaultRetention = time.Hour
+
+	// DefaultIdleTimeout is how long runs wait for a message or an approval by default
+	DefaultIdleTimeout = 30 * time.Minute
+
+	// DefaultMaxRuns is the default number of runs (and chat completions) at the same time
+	DefaultMaxRuns = 10
+
+	// maxRequestSize is the maximum size of a request body
+	maxRequestSize = 1 << 20
+
+	// keepAliveInterval is the interval of the comments keeping event streams open
+	keepAliveInterval = 15 * time.Second
+)
+
+// Config holds the settings of the API server
+type Config struct {
+	Agent      agent.AgentConfig                // Base configuration of the runs (model, prompts, RAG options...)
+	ToolsFiles []string                         // Tools files the runs can use, the first one by default
+	RAG        map[string]agent.RAGSourceConfig // RAG sources the runs can enable (from the configuration file)
+	Retention  time.Duration                    // How long finished runs are kept (default: 1h)
+
+	// IdleTimeout stops the runs waiting for a message or an approval for
+	// longer than this (no timeout when 0)
+	IdleTimeout time.Duration
+
+	// MaxRuns is the number of runs (and chat completions) at the same time,
+	// with new ones refused beyond it (no limit when 0)
+	MaxRuns int
+
+	// Token is the bearer token required by all the requests (none when empty)
+	Token string
+
+	// AutoApprove approves the tool calls of all the runs without asking. Tool
+	// calls of chat completions are rejected without it, as nobody can answer.
+	AutoApprove bool
+
+	// Annotations reports the tool activity in the chat completions by default
+	Annotations bool
+}
+
+// RunRequest is the body of a request creating a run
+type RunRequest struct {
+	Prompt string   `json:"prompt"`
+	Tools  string   `json:"tools,omitempty"` // Tools file (path or name without extension) among those of the server
+	RAG    []string `json:"rag,omitempty"`   // RAG sources to enable (default: those of the server)
+	Once   bool     `json:"once,omitempty"`  // End the run after the first answer
+}
+
+// MessageRequest is the body of a request continuing a conversation
+type MessageRequest struct {
+	Content string `json:"content"`
+}
+
+// ApproveRequest is the body of a request answering a tool call confirmation
+type ApproveRequest struct {
+	Approval string `json:"approval,omitempty"` // "approve" (default), "approve-session" or "reject"
+}
+
+// errorResponse is the body of error responses
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// runAgentFunc runs an agent, sending its events (see agent.Agent.RunEvents)
+type runAgentFunc func(ctx context.Context, config agent.AgentConfig, userInput <-chan string, events chan<- agent.Event, approvals <-chan agent.ToolApproval) error
+
+// Server serves the agent over HTTP
+type Server struct {
+	config   Config
+	logger   *common.Logger
+	runAgent runAgentFunc
+
+	mu     sync.Mutex
+	ctx    context.Context // Context of the runs, canceled when the server stops
+	runs   map[string]*run
+	active int // Runs and chat completions in progress
+}
+
+// New creates an API server
+func New(config Config, logger *common.Logger) *Server {
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+	return &Server{
+		config: config,
+		logger: logger,
+		runAgent: func(ctx context.Context, config agent.AgentConfig, userInput <-chan string, events chan<- agent.Event, approvals <-chan agent.ToolApproval) error {
+			return agent.New(config, logger).RunEvents(ctx, userInput, events, approvals)
+		},
+		ctx:  context.Background(),
+		runs: make(map[string]*run),
+	}
+}
+
+// Handler returns the HTTP handler of the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/runs", s.handleCreateRun)
+	mux.HandleFunc("GET /v1/runs/{id}", s.handleGetRun)
+	mux.HandleFunc("DELETE /v1/runs/{id}", s.handleDeleteRun)
+	mux.HandleFunc("GET /v1/runs/{id}/events", s.handleEvents)
+	mux.HandleFunc("POST /v1/runs/{id}/messages", s.handleMessage)
+	mux.HandleFunc("POST /v1/runs/{id}/approve", s.handleApprove)
+
+	// OpenAI-compatible API
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	return s.authenticate(mux)
+}
+
+// authenticate requires the bearer token of the server in all the requests, if any
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.config.Token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="don"`)
+			writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reserveRun reserves a place for a run or a chat completion, returning an error
+// when the server is shutting down or runs the maximum number of them. The
+// place is freed with releaseRun.
+func (s *Server) reserveRun() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return http.StatusServiceUnavailable, fmt.Errorf("server is shutting down")
+	}
+	if s.config.MaxRuns > 0 && s.active >= s.config.MaxRuns {
+		return http.StatusTooManyRequests, fmt.Errorf("too many runs in progress (maximum: %d)", s.config.MaxRuns)
+	}
+	s.active++
+	return 0, nil
+}
+
+// releaseRun frees the place of a run or a chat completion
+func (s *Server) releaseRun() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+}
+
+// ListenAndServe serves the API on an address until the context is canceled,
+// then stops all the runs
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves the API on a listener until the context is canceled, then stops all the runs
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	runsCtx, cancelRuns := context.WithCancel(ctx)
+	defer cancelRuns()
+	s.mu.Lock()
+	s.ctx = runsCtx
+	s.mu.Unlock()
+
+	httpServer := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return runsCtx },
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.Serve(listener)
+	}()
+	s.logger.Info("API server listening on %s", listener.Addr())
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("Shutting down API server...")
+	cancelRuns()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+// handleCreateRun starts a run: POST /v1/runs
+func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	var req RunRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	config, err := s.runConfig(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := newRunID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if status, err := s.reserveRun(); err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	s.mu.Lock()
+	ctx, cancel := context.WithCancel(s.ctx)
+	run := newRun(id, cancel, s.config.IdleTimeout)
+	s.runs[id] = run
+	s.mu.Unlock()
+
+	events := make(chan agent.Event)
+	go run.record(events)
+	go func() {
+		defer s.releaseRun()
+		defer cancel()
+		if err := s.runAgent(ctx, config, run.input, events, run.approvals); err != nil && !errors.Is(err, context.Canceled) {
+			s.logger.Warn("Run %s failed: %v", id, err)
+		}
+		s.logger.Info("Run %s ended", id)
+
+		// Finished runs are kept for a while, so their events can still be read
+		time.AfterFunc(s.config.Retention, func() { s.removeRun(id) })
+	}()
+
+	s.logger.Info("Run %s started (tools: %s, RAG sources: %v)", id, config.ToolsFile, config.RAGSources)
+	writeJSON(w, http.StatusCreated, run.info())
+}
+
+// runConfig builds the agent configuration of a run
+func (s *Server) runConfig(req RunRequest) (agent.AgentConfig, error) {
+	if strings.TrimSpace(req.Prompt) == "" {
+		return agent.AgentConfig{}, fmt.Errorf("prompt is required")
+	}
+
+	config := s.config.Agent
+	config.UserPrompt = req.Prompt
+	config.Once = req.Once
+	config.AutoApprove = s.config.AutoApprove
+
+	if req.Tools != "" {
+		toolsFile, err := s.toolsFile(req.Tools)
+		if err != nil {
+			return agent.AgentConfig{}, err
+		}
+		config.ToolsFile = toolsFile
+	}
+
+	if req.RAG != nil {
+		config.RAGSources = req.RAG
+		config.RAGConfig = make(map[string]agent.RAGSourceConfig, len(req.RAG))
+		for _, name := range req.RAG {
+			source, ok := s.config.RAG[name]
+			if !ok {
+				return agent.AgentConfig{}, fmt.Errorf("RAG source '%s' not found in agent config file", name)
+			}
+			config.RAGConfig[name] = source
+		}
+	}
+	return config, nil
+}
+
+// toolsFile finds a tools file of the server by path or by name (without extension)
+func (s *Server) toolsFile(name string) (string, error) {
+	for _, path := range s.config.ToolsFiles {
+		if name == path || name == filepath.Base(path) || name == modelName(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("tools file '%s' is not available (available: %s)", name, strings.Join(s.config.ToolsFiles, ", "))
+}
+
+// handleGetRun describes a run: GET /v1/runs/{id}
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	if run := s.findRun(w, r); run != nil {
+		writeJSON(w, http.StatusOK, run.info())
+	}
+}
+
+// handleDeleteRun stops and forgets a run: DELETE /v1/runs/{id}
+func (s *Server) handleDeleteRun(w http.ResponseWriter, r *http.Request) {
+	run := s.findRun(w, r)
+	if run == nil {
+		return
+	}
+	run.cancel()
+	s.removeRun(run.id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEvents streams the events of a run over Server-Sent Events, from the
+// first one (or the one after Last-Event-ID) until the run ends:
+// GET /v1/runs/{id}/events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	run := s.findRun(w, r)
+	if run == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	// Events are numbered from 1, so clients can resume after the last one they got
+	next := 0
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		n, err := strconv.Atoi(lastID)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+		next = n
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		events, updated, done := run.eventsSince(next)
+		for _, event := range events {
+			next++
+			data, err := json.Marshal(event)
+			if err != nil {
+				s.logger.Error("Failed to encode event of run %s: %v", run.id, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", next, event.Type, data)
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+
+		select {
+		case <-updated:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleMessage continues the conversation of a run: POST /v1/runs/{id}/messages
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	run := s.findRun(w, r)
+	if run == nil {
+		return
+	}
+	var req MessageRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	if !run.send(req.Content) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("run is not waiting for a message (status: %s)", run.info().Status))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run.info())
+}
+
+// handleApprove answers the pending tool call confirmation of a run:
+// POST /v1/runs/{id}/approve
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	run := s.findRun(w, r)
+	if run == nil {
+		return
+	}
+	var req ApproveRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Approval == "" {
+		req.Approval = string(agent.ToolApprove)
+	}
+	approval, err := agent.ParseToolApproval(req.Approval)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !run.approve(approval) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("run is not waiting for an approval (status: %s)", run.info().Status))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run.info())
+}
+
+// findRun returns the run of a request, or writes a not found error
+func (s *Server) findRun(w http.ResponseWriter, r *http.Request) *run {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	run, ok := s.runs[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("run '%s' not found", id))
+		return nil
+	}
+	return run
+}
+
+// removeRun forgets a run
+func (s *Server) removeRun(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.runs, id)
+}
+
+// newRunID returns a random run ID
+func newRunID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate run ID: %w", err)
+	}
+	return "run_" + hex.EncodeToString(b), nil
+}
+
+// decodeRequest decodes the JSON body of a request, or writes a bad request error
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
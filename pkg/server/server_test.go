@@ -0,0 +1,398 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inercia/don/pkg/agent"
+	"github.com/inercia/don/pkg/common"
+)
+
+// fakeRun is an agent answering with the prompt and the tools file, asking for
+// the approval of a tool call, and echoing the messages continuing the conversation
+func fakeRun(ctx context.Context, config agent.AgentConfig, userInput <-chan string, events chan<- agent.Event, approvals <-chan agent.ToolApproval) error {
+	defer close(events)
+	events <- agent.Event{Type: agent.EventMessage, Agent: "root", Content: config.UserPrompt + " with " + config.ToolsFile}
+	events <- agent.Event{Type: agent.EventToolConfirmation, Agent: "root", Tool: "disk_usage"}
+	select {
+	case approval := <-approvals:
+		events <- agent.Event{Type: agent.EventToolResult, Agent: "root", Tool: "disk_usage", Content: string(approval)}
+	case <-ctx.Done():
+	}
+	for !config.Once {
+		events <- agent.Event{Type: agent.EventWaitingInput}
+		select {
+		case message, ok := <-userInput:
+			if !ok {
+				config.Once = true
+				continue
+			}
+			events <- agent.Event{Type: agent.EventMessage, Agent: "root", Content: "echo: " + message}
+		case <-ctx.Done():
+			events <- agent.Event{Type: agent.EventDone, Content: ctx.Err().Error()}
+			return ctx.Err()
+		}
+	}
+	events <- agent.Event{Type: agent.EventDone}
+	return nil
+}
+
+// newTestServer starts a server running agents with runAgent, with the
+// configuration changed by the configure functions
+func newTestServer(t *testing.T, runAgent runAgentFunc, configure ...func(*Config)) *httptest.Server {
+	t.Helper()
+	logger, err := common.NewLogger("", "", common.LogLevelError, false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	config := Config{
+		Agent:      agent.AgentConfig{ToolsFile: "/tools/default.yaml"},
+		ToolsFiles: []string{"/tools/default.yaml", "/tools/k8s.yaml"},
+		RAG:        map[string]agent.RAGSourceConfig{"docs": {}},
+	}
+	for _, fn := range configure {
+		fn(&config)
+	}
+	s := New(config, logger)
+	s.runAgent = runAgent
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// post sends a JSON request, returning the status and decoding the response
+func post(t *testing.T, url string, body string, out interface{}) int {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("POST %s error = %v", url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode response of %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// waitStatus polls a run until it has a status
+func waitStatus(t *testing.T, url string, status RunStatus) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", url, err)
+		}
+		var info RunInfo
+		err = json.NewDecoder(resp.Body).Decode(&info)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("failed to decode run: %v", err)
+		}
+		if info.Status == status {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("run did not reach status %s", status)
+}
+
+// readEvents reads a stream of Server-Sent Events until it ends
+func readEvents(t *testing.T, req *http.Request) ([]string, []agent.Event) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET events error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events response = %d %s, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var ids []string
+	var events []agent.Event
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		case strings.HasPrefix(line, "data: "):
+			var event agent.Event
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("failed to decode event: %v", err)
+			}
+			events = append(events, event)
+		}
+	}
+	return ids, events
+}
+
+func TestServerRun(t *testing.T) {
+	ts := newTestServer(t, fakeRun)
+
+	var created RunInfo
+	if status := post(t, ts.URL+"/v1/runs", `{"prompt": "check the disk", "tools": "k8s", "rag": ["docs"]}`, &created); status != http.StatusCreated {
+		t.Fatalf("create run status = %d, want %d", status, http.StatusCreated)
+	}
+	if !strings.HasPrefix(created.ID, "run_") {
+		t.Errorf("run ID = %q, want a run_ prefix", created.ID)
+	}
+	runURL := ts.URL + "/v1/runs/" + created.ID
+
+	// Messages are refused while a tool call waits for an approval
+	waitStatus(t, runURL, RunWaitingApproval)
+	if status := post(t, runURL+"/messages", `{"content": "hello"}`, nil); status != http.StatusConflict {
+		t.Errorf("message while waiting for an approval status = %d, want %d", status, http.StatusConflict)
+	}
+	if status := post(t, runURL+"/approve", `{"approval": "maybe"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("invalid approval status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if status := post(t, runURL+"/approve", `{}`, nil); status != http.StatusAccepted {
+		t.Errorf("approve status = %d, want %d", status, http.StatusAccepted)
+	}
+
+	waitStatus(t, runURL, RunWaitingInput)
+	if status := post(t, runURL+"/approve", `{}`, nil); status != http.StatusConflict {
+		t.Errorf("approve without a confirmation status = %d, want %d", status, http.StatusConflict)
+	}
+	if status := post(t, runURL+"/messages", `{"content": "hello"}`, nil); status != http.StatusAccepted {
+		t.Errorf("message status = %d, want %d", status, http.StatusAccepted)
+	}
+	waitStatus(t, runURL, RunWaitingInput)
+
+	// Stopping the run ends its event stream
+	req, err := http.NewRequest(http.MethodGet, runURL+"/events", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		del, _ := http.NewRequest(http.MethodDelete, runURL, nil)
+		if resp, err := http.DefaultClient.Do(del); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	ids, events := readEvents(t, req)
+
+	var contents []string
+	for _, event := range events {
+		contents = append(contents, string(event.Type)+":"+event.Content)
+	}
+	want := []string{
+		"message:check the disk with /tools/k8s.yaml",
+		"tool_confirmation:",
+		"tool_result:approve",
+		"waiting_input:",
+		"message:echo: hello",
+		"waiting_input:",
+		"done:context canceled",
+	}
+	if strings.Join(contents, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %v, want %v", contents, want)
+	}
+	if len(ids) != len(events) || ids[0] != "1" {
+		t.Errorf("event IDs = %v, want one per event from 1", ids)
+	}
+
+	resp, err := http.Get(runURL)
+	if err != nil {
+		t.Fatalf("GET run error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted run status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServerEventsResume(t *testing.T) {
+	ts := newTestServer(t, fakeRun)
+
+	var created RunInfo
+	if status := post(t, ts.URL+"/v1/runs", `{"prompt": "hi", "once": true}`, &created); status != http.StatusCreated {
+		t.Fatalf("create run status = %d, want %d", status, http.StatusCreated)
+	}
+	runURL := ts.URL + "/v1/runs/" + created.ID
+	waitStatus(t, runURL, RunWaitingApproval)
+	post(t, runURL+"/approve", `{"approval": "reject"}`, nil)
+	waitStatus(t, runURL, RunDone)
+
+	req, err := http.NewRequest(http.MethodGet, runURL+"/events", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Last-Event-ID", "2")
+	ids, events := readEvents(t, req)
+	if strings.Join(ids, ",") != "3,4" || events[0].Content != "reject" || events[1].Type != agent.EventDone {
+		t.Errorf("events after 2 = %v %+v, want the tool result and the end", ids, events)
+	}
+}
+
+func TestServerCreateRunErrors(t *testing.T) {
+	ts := newTestServer(t, fakeRun)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no prompt", `{"prompt": " "}`},
+		{"unknown tools file", `{"prompt": "hi", "tools": "aws"}`},
+		{"unknown RAG source", `{"prompt": "hi", "rag": ["wiki"]}`},
+		{"unknown field", `{"prompt": "hi", "model": "gpt-4o"}`},
+		{"auto approve", `{"prompt": "hi", "auto_approve": true}`},
+		{"invalid JSON", `{"prompt":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body errorResponse
+			if status := post(t, ts.URL+"/v1/runs", tt.body, &body); status != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", status, http.StatusBadRequest)
+			}
+			if body.Error == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/runs/run_unknown/events")
+	if err != nil {
+		t.Fatalf("GET events error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("events of an unknown run status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServerAutoApprove(t *testing.T) {
+	autoApprove := make(chan bool, 1)
+	ts := newTestServer(t, func(ctx context.Context, config agent.AgentConfig, userInput <-chan string, events chan<- agent.Event, approvals <-chan agent.ToolApproval) error {
+		autoApprove <- config.AutoApprove
+		close(events)
+		return nil
+	}, func(c *Config) { c.AutoApprove = true })
+
+	if status := post(t, ts.URL+"/v1/runs", `{"prompt": "hi"}`, nil); status != http.StatusCreated {
+		t.Fatalf("create run status = %d, want %d", status, http.StatusCreated)
+	}
+	if !<-autoApprove {
+		t.Error("AutoApprove = false, want the one of the server")
+	}
+}
+
+func TestServerToken(t *testing.T) {
+	ts := newTestServer(t, fakeRun, func(c *Config) { c.Token = "secret" })
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"no token", http.MethodPost, "/v1/runs", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "/v1/runs", "Bearer wrong", http.StatusUnauthorized},
+		{"not a bearer token", http.MethodPost, "/v1/runs", "Basic secret", http.StatusUnauthorized},
+		{"models without a token", http.MethodGet, "/v1/models", "", http.StatusUnauthorized},
+		{"unknown route without a token", http.MethodGet, "/v1/runs/run_unknown", "", http.StatusUnauthorized},
+		{"valid token", http.MethodPost, "/v1/runs", "Bearer secret", http.StatusCreated},
+		{"models with a token", http.MethodGet, "/v1/models", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(`{"prompt": "hi"}`))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s error = %v", tt.method, tt.path, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	ts := newTestServer(t, fakeRun, func(c *Config) { c.IdleTimeout = 50 * time.Millisecond })
+
+	var created RunInfo
+	if status := post(t, ts.URL+"/v1/runs", `{"prompt": "hi"}`, &created); status != http.StatusCreated {
+		t.Fatalf("create run status = %d, want %d", status, http.StatusCreated)
+	}
+	runURL := ts.URL + "/v1/runs/" + created.ID
+	waitStatus(t, runURL, RunDone)
+
+	resp, err := http.Get(runURL)
+	if err != nil {
+		t.Fatalf("GET run error = %v", err)
+	}
+	defer resp.Body.Close()
+	var info RunInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode run: %v", err)
+	}
+	if want := "run stopped after waiting for 50ms (status: waiting_approval)"; info.Error != want {
+		t.Errorf("run error = %q, want %q", info.Error, want)
+	}
+}
+
+func TestServerMaxRuns(t *testing.T) {
+	ts := newTestServer(t, fakeRun, func(c *Config) { c.MaxRuns = 1 })
+
+	var created RunInfo
+	if status := post(t, ts.URL+"/v1/runs", `{"prompt": "hi"}`, &created); status != http.StatusCreated {
+		t.Fatalf("create run status = %d, want %d", status, http.StatusCreated)
+	}
+	var body errorResponse
+	if status := post(t, ts.URL+"/v1/runs", `{"prompt": "hi"}`, &body); status != http.StatusTooManyRequests {
+		t.Errorf("second run status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(body.Error, "maximum: 1") {
+		t.Errorf("error = %q, want the maximum", body.Error)
+	}
+	if status := post(t, ts.URL+"/v1/chat/completions", `{"messages": [{"role": "user", "content": "hi"}]}`, nil); status != http.StatusTooManyRequests {
+		t.Errorf("chat completion status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// Ending the run makes room for a new one
+	runURL := ts.URL + "/v1/runs/" + created.ID
+	waitStatus(t, runURL, RunWaitingApproval)
+	post(t, runURL+"/approve", `{}`, nil)
+	waitStatus(t, runURL, RunWaitingInput)
+	del, err := http.NewRequest(http.MethodDelete, runURL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(del)
+	if err != nil {
+		t.Fatalf("DELETE run error = %v", err)
+	}
+	resp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for post(t, ts.URL+"/v1/runs", `{"prompt": "hi", "once": true}`, nil) != http.StatusCreated {
+		if time.Now().After(deadline) {
+			t.Fatal("no run could be created after the first one ended")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}